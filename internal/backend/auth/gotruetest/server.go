@@ -0,0 +1,478 @@
+// Package gotruetest provides an in-process fake of the Supabase GoTrue
+// endpoints used by auth.SupabaseClient, for tests that should not reach a
+// real Supabase project.
+package gotruetest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is the anon key the fake expects in the apikey header
+const APIKey = "test-anon-key"
+
+// ServiceKey is the service role key the fake expects on admin endpoints
+const ServiceKey = "test-service-key"
+
+// Endpoint names accepted by Fail
+const (
+	Signup     = "signup"
+	Token      = "token"
+	GetUser    = "user"
+	UpdateUser = "update_user"
+	Verify     = "verify"
+	Resend     = "resend"
+	Recover    = "recover"
+	AdminUser  = "admin_user"
+)
+
+// User is an account of the fake
+type User struct {
+	ID          string
+	Email       string
+	Password    string
+	ConfirmedAt *time.Time
+	OTP         string // the token of the last signup, recovery or email change email
+	NewEmail    string // the address of a pending email change
+}
+
+// Server is a fake GoTrue server. Its zero value is not usable; create one
+// with NewServer and Close it when done.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	users    map[string]*User  // by email
+	sessions map[string]string // access token to email
+	failures map[string][]failure
+	calls    map[string]int
+}
+
+// failure is a scripted error response
+type failure struct {
+	status int
+	msg    string
+}
+
+// NewServer starts a fake GoTrue server
+func NewServer() *Server {
+	s := &Server{
+		users:    make(map[string]*User),
+		sessions: make(map[string]string),
+		failures: make(map[string][]failure),
+		calls:    make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /auth/v1/signup", s.handle(Signup, s.signup))
+	mux.HandleFunc("POST /auth/v1/token", s.handle(Token, s.token))
+	mux.HandleFunc("GET /auth/v1/user", s.handle(GetUser, s.getUser))
+	mux.HandleFunc("PUT /auth/v1/user", s.handle(UpdateUser, s.updateUser))
+	mux.HandleFunc("POST /auth/v1/verify", s.handle(Verify, s.verify))
+	mux.HandleFunc("POST /auth/v1/resend", s.handle(Resend, s.resend))
+	mux.HandleFunc("POST /auth/v1/recover", s.handle(Recover, s.recover))
+	mux.HandleFunc("PUT /auth/v1/admin/users/{id}", s.handle(AdminUser, s.adminUpdateUser))
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Fail makes the next request to endpoint fail with status and a GoTrue
+// error message. Calls queue up, so several failures can be scripted.
+func (s *Server) Fail(endpoint string, status int, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failure{status: status, msg: msg})
+}
+
+// Calls returns how many requests reached endpoint
+func (s *Server) Calls(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[endpoint]
+}
+
+// User returns a copy of the account registered under email
+func (s *Server) User(email string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[strings.ToLower(email)]
+	if !ok {
+		return User{}, false
+	}
+	return *user, true
+}
+
+// Confirm marks the email of an account as confirmed, as if the user had
+// followed the verification link
+func (s *Server) Confirm(email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[strings.ToLower(email)]; ok {
+		now := time.Now()
+		user.ConfirmedAt = &now
+	}
+}
+
+// AccessToken issues an access token for an account, like the one Supabase
+// puts in the URL hash of a verification link
+func (s *Server) AccessToken(email string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newSession(strings.ToLower(email), "otp")
+}
+
+// RecoveryAccessToken issues an access token for an account like the one
+// Supabase puts in the URL hash of a password reset link
+func (s *Server) RecoveryAccessToken(email string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newSession(strings.ToLower(email), "recovery")
+}
+
+// handle counts requests to an endpoint, checks the apikey header and serves
+// scripted failures before calling next
+func (s *Server) handle(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[endpoint]++
+		var scripted *failure
+		if queue := s.failures[endpoint]; len(queue) > 0 {
+			scripted = &queue[0]
+			s.failures[endpoint] = queue[1:]
+		}
+		s.mu.Unlock()
+
+		if key := r.Header.Get("apikey"); key != APIKey && key != ServiceKey {
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if scripted != nil {
+			writeError(w, scripted.status, scripted.msg)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// signup registers an account. Like GoTrue with email confirmations enabled,
+// it answers with the bare user rather than a session.
+func (s *Server) signup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "Signup requires a valid password")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(req.Email)
+	if _, ok := s.users[email]; ok {
+		writeError(w, http.StatusUnprocessableEntity, "User already registered")
+		return
+	}
+
+	user := &User{ID: randomID(), Email: email, Password: req.Password, OTP: randomID()}
+	s.users[email] = user
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+// token signs in with the password grant
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("grant_type") != "password" {
+		writeError(w, http.StatusBadRequest, "Unsupported grant type")
+		return
+	}
+
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[strings.ToLower(req.Email)]
+	if !ok || user.Password != req.Password {
+		writeError(w, http.StatusBadRequest, "Invalid login credentials")
+		return
+	}
+	if user.ConfirmedAt == nil {
+		writeError(w, http.StatusBadRequest, "Email not confirmed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.sessionJSON(user, "password"))
+}
+
+// getUser returns the account of the bearer token
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.bearerUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid JWT")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+// updateUser changes the password of the account of the bearer token, or
+// starts a change of its email that the token sent to the new address confirms
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.bearerUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Invalid JWT")
+		return
+	}
+
+	if req.Password != "" {
+		user.Password = req.Password
+	}
+	if req.Email != "" {
+		email := strings.ToLower(req.Email)
+		if _, ok := s.users[email]; ok {
+			writeError(w, http.StatusUnprocessableEntity, "A user with this email address has already been registered")
+			return
+		}
+		user.NewEmail = email
+		user.OTP = randomID()
+	}
+	writeJSON(w, http.StatusOK, userJSON(user))
+}
+
+// verify redeems the token of a signup, recovery or email change email
+func (s *Server) verify(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Token string `json:"token"`
+		Type  string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if req.Type == "email_change" {
+		s.verifyEmailChange(w, strings.ToLower(req.Email), req.Token)
+		return
+	}
+
+	user, ok := s.users[strings.ToLower(req.Email)]
+	if !ok || user.OTP == "" || user.OTP != req.Token || (req.Type != "signup" && req.Type != "recovery") {
+		writeError(w, http.StatusForbidden, "Token has expired or is invalid")
+		return
+	}
+
+	user.OTP = ""
+	if user.ConfirmedAt == nil {
+		now := time.Now()
+		user.ConfirmedAt = &now
+	}
+	method := "otp"
+	if req.Type == "recovery" {
+		method = "recovery"
+	}
+	writeJSON(w, http.StatusOK, s.sessionJSON(user, method))
+}
+
+// verifyEmailChange moves the account with a pending change to email over
+// to it. The caller holds s.mu.
+func (s *Server) verifyEmailChange(w http.ResponseWriter, email, token string) {
+	for oldEmail, user := range s.users {
+		if user.NewEmail != email || user.OTP == "" || user.OTP != token {
+			continue
+		}
+
+		delete(s.users, oldEmail)
+		user.Email, user.NewEmail, user.OTP = email, "", ""
+		s.users[email] = user
+		for accessToken, sessionEmail := range s.sessions {
+			if sessionEmail == oldEmail {
+				s.sessions[accessToken] = email
+			}
+		}
+		writeJSON(w, http.StatusOK, s.sessionJSON(user, "otp"))
+		return
+	}
+
+	writeError(w, http.StatusForbidden, "Token has expired or is invalid")
+}
+
+// resend issues a new signup token
+func (s *Server) resend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Type  string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Type != "signup" {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[strings.ToLower(req.Email)]; ok && user.ConfirmedAt == nil {
+		user.OTP = randomID()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+// recover issues a recovery token; unknown emails are accepted silently
+func (s *Server) recover(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if user, ok := s.users[strings.ToLower(req.Email)]; ok {
+		user.OTP = randomID()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{})
+}
+
+// adminUpdateUser changes the password of any account; it requires the service role key
+func (s *Server) adminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+ServiceKey {
+		writeError(w, http.StatusForbidden, "User not allowed")
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == r.PathValue("id") {
+			if req.Password != "" {
+				user.Password = req.Password
+			}
+			writeJSON(w, http.StatusOK, userJSON(user))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "User not found")
+}
+
+// bearerUser returns the account of the request's access token. The caller holds s.mu.
+func (s *Server) bearerUser(r *http.Request) (*User, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	email, ok := s.sessions[token]
+	if !ok {
+		return nil, false
+	}
+	user, ok := s.users[email]
+	return user, ok
+}
+
+// newSession issues an access token for an account. Like GoTrue's, the token
+// is a JWT whose amr claim names how the session was authenticated; it is
+// not signed. The caller holds s.mu.
+func (s *Server) newSession(email, method string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims, _ := json.Marshal(map[string]any{
+		"email": email,
+		"amr":   []map[string]any{{"method": method, "timestamp": time.Now().Unix()}},
+	})
+	token := header + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + randomID()
+	s.sessions[token] = email
+	return token
+}
+
+// sessionJSON builds a token response for an account authenticated with
+// method. The caller holds s.mu.
+func (s *Server) sessionJSON(user *User, method string) map[string]any {
+	return map[string]any{
+		"access_token":  s.newSession(user.Email, method),
+		"token_type":    "bearer",
+		"expires_in":    3600,
+		"refresh_token": randomID(),
+		"user":          userJSON(user),
+	}
+}
+
+// userJSON builds the GoTrue representation of an account
+func userJSON(user *User) map[string]any {
+	out := map[string]any{
+		"id":         user.ID,
+		"aud":        "authenticated",
+		"email":      user.Email,
+		"created_at": time.Now().UTC(),
+		"updated_at": time.Now().UTC(),
+	}
+	if user.ConfirmedAt != nil {
+		out["email_confirmed_at"] = user.ConfirmedAt.UTC()
+	} else {
+		out["confirmation_sent_at"] = time.Now().UTC()
+	}
+	return out
+}
+
+// writeError writes a GoTrue error body
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]any{"code": status, "msg": msg})
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// randomID returns a random hex identifier
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
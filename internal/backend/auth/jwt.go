@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"time"
 
@@ -14,56 +15,136 @@ var (
 	ErrTokenClaims  = errors.New("invalid token claims")
 )
 
+// PurposeMFA marks the short-lived token Login issues while a second factor is pending
+const PurposeMFA = "mfa"
+
+// tokenIssuer is the iss claim of every PassGO token
+const tokenIssuer = "passgo-backend"
+
+// AccessTokenTTL is how long a session token is valid
+func AccessTokenTTL() time.Duration {
+	return time.Duration(config.JWTExpiration) * time.Hour
+}
+
+// MFATokenTTL is how long a user has to enter the second factor after the password
+func MFATokenTTL() time.Duration {
+	return time.Duration(config.MFATokenTTLMinutes) * time.Minute
+}
+
 // Claims represents the JWT claims
 type Claims struct {
 	UserID      string `json:"user_id"`
 	Email       string `json:"email"`
 	SupabaseUID string `json:"supabase_uid"`
+	// SessionVersion must match the user's current session version
+	SessionVersion int64 `json:"session_version"`
+	// Purpose restricts a token to a single step, e.g. PurposeMFA; session tokens have none
+	Purpose string `json:"purpose,omitempty"`
+	// RegisteredClaims.ID (jti) names the session of a session token, or the
+	// pending challenge of an MFA token
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a JWT token for a user
-func GenerateToken(userID, email, supabaseUID string) (string, error) {
-	if config.JWTSecret == "" {
-		return "", errors.New("JWT secret not configured")
+// GenerateToken creates a JWT token for a session of a user
+func GenerateToken(userID, email, supabaseUID string, sessionVersion int64, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL())
+
+	claims := &Claims{
+		UserID:         userID,
+		Email:          email,
+		SupabaseUID:    supabaseUID,
+		SessionVersion: sessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    tokenIssuer,
+		},
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
+	return signToken(claims)
+}
 
+// GenerateMFAToken creates a short-lived token that only proves the password
+// step of a login. It carries the ID of the pending MFA challenge and can
+// only be exchanged for a session token at the MFA verification endpoint.
+// The email names the account whose login failures MFA failures count against.
+func GenerateMFAToken(userID, email, challengeID string) (string, error) {
 	claims := &Claims{
-		UserID:      userID,
-		Email:       email,
-		SupabaseUID: supabaseUID,
+		UserID:  userID,
+		Email:   email,
+		Purpose: PurposeMFA,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			ID:        challengeID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFATokenTTL())),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "passgo-backend",
+			Issuer:    tokenIssuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.JWTSecret))
+	return signToken(claims)
+}
+
+// signToken signs claims with the current signing key and names the key in
+// the kid header
+func signToken(claims *Claims) (string, error) {
+	if signingKeys == nil {
+		return "", ErrSigningKeysNotConfigured
+	}
+
+	key, err := signingKeys.signer(context.Background())
 	if err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
 }
 
-// VerifyToken validates a JWT token and returns the claims
+// VerifyMFAToken validates a token issued by GenerateMFAToken and returns its claims
+func VerifyMFAToken(tokenString string) (*Claims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFA || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// VerifyToken validates a session JWT token and returns the claims
 func VerifyToken(tokenString string) (*Claims, error) {
-	if config.JWTSecret == "" {
-		return nil, errors.New("JWT secret not configured")
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Single-purpose tokens never grant a session, and session tokens always
+	// name their session
+	if claims.Purpose != "" || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// parseToken checks the signature and lifetime of a token and returns its claims
+func parseToken(tokenString string) (*Claims, error) {
+	if signingKeys == nil {
+		return nil, ErrSigningKeysNotConfigured
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		// Verify signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		if _, ok := token.Method.(*jwt.SigningMethodEd25519); !ok {
 			return nil, errors.New("unexpected signing method")
 		}
-		return []byte(config.JWTSecret), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return signingKeys.publicKey(context.Background(), kid)
+	}, jwt.WithValidMethods([]string{AlgorithmEdDSA}), jwt.WithIssuer(tokenIssuer))
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -79,33 +160,3 @@ func VerifyToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
-
-// RefreshToken creates a new token with extended expiration
-func RefreshToken(oldToken string) (string, error) {
-	claims, err := VerifyToken(oldToken)
-	if err != nil {
-		// Allow expired tokens to be refreshed within 7 days
-		if !errors.Is(err, ErrTokenExpired) {
-			return "", err
-		}
-
-		token, parseErr := jwt.ParseWithClaims(oldToken, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		}, jwt.WithoutClaimsValidation())
-
-		if parseErr != nil {
-			return "", ErrInvalidToken
-		}
-
-		claims, ok := token.Claims.(*Claims)
-		if !ok {
-			return "", ErrTokenClaims
-		}
-
-		if time.Since(claims.IssuedAt.Time) > 7*24*time.Hour {
-			return "", ErrTokenExpired
-		}
-	}
-
-	return GenerateToken(claims.UserID, claims.Email, claims.SupabaseUID)
-}
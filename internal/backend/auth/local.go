@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/mail"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// Lifetimes of the tokens issued by the local provider
+const (
+	signupTokenTTL      = 24 * time.Hour
+	recoveryTokenTTL    = time.Hour
+	accessTokenTTL      = time.Hour
+	emailChangeTokenTTL = 24 * time.Hour
+)
+
+// localTimeout bounds the database work of a single provider call
+const localTimeout = 10 * time.Second
+
+// dummyHash is verified against when an email is unknown
+var dummyHash, _ = HashPassword("passgo-dummy-password")
+
+// LocalProvider is the built-in identity provider for self-hosting without
+// Supabase. It keeps Argon2id password hashes in MongoDB and emails its own
+// verification and reset links.
+type LocalProvider struct {
+	identities *database.IdentityRepository
+	mailer     mail.Sender
+}
+
+// NewLocalProvider creates a new local identity provider
+func NewLocalProvider() *LocalProvider {
+	return &LocalProvider{
+		identities: database.NewIdentityRepository(),
+		mailer:     mail.NewSender(),
+	}
+}
+
+// SignUp registers an account and emails its verification link
+func (p *LocalProvider) SignUp(email, password string) (*ProviderSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &models.Identity{
+		Email:        normalizeEmail(email),
+		PasswordHash: hash,
+	}
+	if err := p.identities.CreateIdentity(ctx, identity); err != nil {
+		if errors.Is(err, database.ErrDuplicateEmail) {
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, err
+	}
+
+	if err := p.sendVerification(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	return &ProviderSession{User: providerUser(identity)}, nil
+}
+
+// SignIn checks an account's credentials and issues an access token
+func (p *LocalProvider) SignIn(email, password string) (*ProviderSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.identities.GetIdentityByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityNotFound) {
+			// Spend the same time as a wrong password so unknown emails do not stand out
+			VerifyPassword(password, dummyHash)
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	ok, err := VerifyPassword(password, identity.PasswordHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if identity.EmailConfirmedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	return p.newSession(ctx, identity)
+}
+
+// GetUser returns the account an access token belongs to
+func (p *LocalProvider) GetUser(accessToken string) (*ProviderUser, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.accessIdentity(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user := providerUser(identity)
+	return &user, nil
+}
+
+// GetRecoveryUser always fails: reset links of the local provider carry the
+// emailed token for VerifyOTP rather than an access token
+func (p *LocalProvider) GetRecoveryUser(accessToken string) (*ProviderUser, error) {
+	return nil, ErrInvalidToken
+}
+
+// ResendVerificationEmail emails a new verification link to an unverified
+// account. Unknown or verified emails are ignored so they cannot be probed.
+func (p *LocalProvider) ResendVerificationEmail(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.identities.GetIdentityByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if identity.EmailConfirmedAt != nil {
+		return nil
+	}
+
+	return p.sendVerification(ctx, identity)
+}
+
+// VerifyOTP redeems an emailed signup, recovery or email change token. A
+// signup token confirms the account's email; an email change token moves the
+// account to the new address it was sent to.
+func (p *LocalProvider) VerifyOTP(email, token, tokenType string) (*ProviderSession, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	if tokenType == models.IdentityTokenEmailChange {
+		return p.confirmEmailChange(ctx, normalizeEmail(email), token)
+	}
+
+	if tokenType != models.IdentityTokenSignup && tokenType != models.IdentityTokenRecovery {
+		return nil, ErrInvalidToken
+	}
+
+	identity, err := p.identities.GetIdentityByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if _, err := p.identities.ConsumeToken(ctx, identity.ID, tokenType, hashToken(token)); err != nil {
+		if errors.Is(err, database.ErrIdentityTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if tokenType == models.IdentityTokenSignup && identity.EmailConfirmedAt == nil {
+		if err := p.identities.ConfirmEmail(ctx, identity.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		identity.EmailConfirmedAt = &now
+	}
+
+	return p.newSession(ctx, identity)
+}
+
+// ResetPassword emails a password reset link. Unknown emails are ignored so
+// they cannot be probed.
+func (p *LocalProvider) ResetPassword(email string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.identities.GetIdentityByEmail(ctx, normalizeEmail(email))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := p.issueToken(ctx, identity, models.IdentityTokenRecovery, recoveryTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/reset-password?email=%s&token=%s",
+		config.PublicURL, url.QueryEscape(identity.Email), url.QueryEscape(token))
+	body := fmt.Sprintf("Someone asked to reset the password of your PassGO account.\n\n"+
+		"Open this link within an hour to choose a new one:\n%s\n\n"+
+		"A new password cannot unlock your current vault, so resetting it erases your vault items. "+
+		"If you have your recovery key, use account recovery in the app instead to keep them.\n\n"+
+		"If it was not you, you can ignore this email.", link)
+
+	return p.mailer.Send(identity.Email, "Reset your PassGO password", body)
+}
+
+// UpdatePassword sets the password of the account an access token belongs to
+func (p *LocalProvider) UpdatePassword(accessToken, newPassword string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.accessIdentity(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	return p.setPassword(ctx, identity, newPassword)
+}
+
+// RequestEmailChange emails a confirmation link to the new address of the
+// account an access token belongs to. Only the latest request can be confirmed.
+func (p *LocalProvider) RequestEmailChange(accessToken, newEmail string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.accessIdentity(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+
+	newEmail = normalizeEmail(newEmail)
+	if _, err := p.identities.GetIdentityByEmail(ctx, newEmail); err == nil {
+		return ErrUserAlreadyExists
+	} else if !errors.Is(err, database.ErrIdentityNotFound) {
+		return err
+	}
+
+	if err := p.identities.DeleteTokens(ctx, identity.ID, models.IdentityTokenEmailChange); err != nil {
+		return err
+	}
+	if err := p.identities.SetPendingEmail(ctx, identity.ID, newEmail); err != nil {
+		return err
+	}
+
+	token, err := p.issueToken(ctx, identity, models.IdentityTokenEmailChange, emailChangeTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/confirm-email-change?email=%s&token=%s",
+		config.PublicURL, url.QueryEscape(newEmail), url.QueryEscape(token))
+	body := fmt.Sprintf("Someone asked to change the email of a PassGO account to this address.\n\n"+
+		"Open this link within a day to confirm the change:\n%s\n\n"+
+		"If it was not you, you can ignore this email.", link)
+
+	return p.mailer.Send(newEmail, "Confirm your new PassGO email address", body)
+}
+
+// AdminAvailable reports whether AdminUpdatePassword can be used, which is
+// always the case for the local provider
+func (p *LocalProvider) AdminAvailable() bool {
+	return true
+}
+
+// AdminUpdatePassword sets a password without the current credential
+func (p *LocalProvider) AdminUpdatePassword(uid, newPassword string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), localTimeout)
+	defer cancel()
+
+	identity, err := p.identities.GetIdentityByID(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	return p.setPassword(ctx, identity, newPassword)
+}
+
+// setPassword stores a new password hash and ends the access tokens issued
+// for the old password
+func (p *LocalProvider) setPassword(ctx context.Context, identity *models.Identity, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	if err := p.identities.SetPasswordHash(ctx, identity.ID, hash); err != nil {
+		return err
+	}
+
+	return p.identities.DeleteTokens(ctx, identity.ID, models.IdentityTokenAccess)
+}
+
+// confirmEmailChange redeems an email change token sent to email
+func (p *LocalProvider) confirmEmailChange(ctx context.Context, email, token string) (*ProviderSession, error) {
+	stored, err := p.identities.GetToken(ctx, models.IdentityTokenEmailChange, hashToken(token))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	identity, err := p.identities.GetIdentityByID(ctx, stored.IdentityID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if identity.PendingEmail == "" || identity.PendingEmail != email {
+		return nil, ErrInvalidToken
+	}
+
+	if _, err := p.identities.ConsumeToken(ctx, identity.ID, models.IdentityTokenEmailChange, hashToken(token)); err != nil {
+		if errors.Is(err, database.ErrIdentityTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if err := p.identities.ChangeEmail(ctx, identity.ID, email); err != nil {
+		if errors.Is(err, database.ErrDuplicateEmail) {
+			return nil, ErrUserAlreadyExists
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	identity.Email = email
+	identity.PendingEmail = ""
+	identity.EmailConfirmedAt = &now
+	return p.newSession(ctx, identity)
+}
+
+// sendVerification emails a fresh verification link to an account
+func (p *LocalProvider) sendVerification(ctx context.Context, identity *models.Identity) error {
+	token, err := p.issueToken(ctx, identity, models.IdentityTokenSignup, signupTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/auth/verify-email?email=%s&token=%s",
+		config.PublicURL, url.QueryEscape(identity.Email), url.QueryEscape(token))
+	body := fmt.Sprintf("Welcome to PassGO!\n\nOpen this link to verify your email address:\n%s", link)
+
+	return p.mailer.Send(identity.Email, "Verify your PassGO account", body)
+}
+
+// newSession issues an access token for an account
+func (p *LocalProvider) newSession(ctx context.Context, identity *models.Identity) (*ProviderSession, error) {
+	token, err := p.issueToken(ctx, identity, models.IdentityTokenAccess, accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ProviderSession{
+		AccessToken: token,
+		TokenType:   "bearer",
+		ExpiresIn:   int(accessTokenTTL.Seconds()),
+		User:        providerUser(identity),
+	}, nil
+}
+
+// accessIdentity returns the account an unexpired access token belongs to
+func (p *LocalProvider) accessIdentity(ctx context.Context, accessToken string) (*models.Identity, error) {
+	token, err := p.identities.GetToken(ctx, models.IdentityTokenAccess, hashToken(accessToken))
+	if err != nil {
+		if errors.Is(err, database.ErrIdentityTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return p.identities.GetIdentityByID(ctx, token.IdentityID.Hex())
+}
+
+// issueToken stores the hash of a new random token and returns the token
+func (p *LocalProvider) issueToken(ctx context.Context, identity *models.Identity, tokenType string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	err := p.identities.CreateToken(ctx, &models.IdentityToken{
+		IdentityID: identity.ID,
+		Type:       tokenType,
+		TokenHash:  hashToken(token),
+		ExpiresAt:  time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash under which a token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeEmail lowercases an email so lookups do not depend on its case
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// providerUser converts an identity to the provider-neutral user
+func providerUser(identity *models.Identity) ProviderUser {
+	user := ProviderUser{
+		ID:        identity.ID.Hex(),
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+		UpdatedAt: identity.UpdatedAt,
+	}
+	if identity.EmailConfirmedAt != nil {
+		user.EmailConfirmedAt = identity.EmailConfirmedAt.Format(time.RFC3339)
+	}
+	return user
+}
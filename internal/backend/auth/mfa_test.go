@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 test key of RFC 6238, base32 encoded
+var rfcSecret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPMatchesRFCVectors(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, code := range vectors {
+		at := time.Unix(unix, 0)
+		step, ok := ValidateTOTP(rfcSecret, code, at)
+		if !ok || step != unix/totpPeriod {
+			t.Errorf("Expected %s to be valid at %d, got step %d, %v", code, unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfSkew(t *testing.T) {
+	at := time.Unix(59, 0)
+
+	if _, ok := ValidateTOTP(rfcSecret, "287082", at.Add(totpPeriod*time.Second)); !ok {
+		t.Error("Expected the previous step to be accepted")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "287082", at.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("Expected a code three steps old to be rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "000000", at); ok {
+		t.Error("Expected a wrong code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := TOTPURI("alice@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/PassGO:alice@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("Unexpected provisioning URI %q", uri)
+	}
+}
+
+func TestBackupCodes(t *testing.T) {
+	codes, err := GenerateBackupCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != BackupCodeCount {
+		t.Fatalf("Expected %d codes, got %d", BackupCodeCount, len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if IsTOTPCode(code) || seen[code] {
+			t.Errorf("Unexpected backup code %q", code)
+		}
+		seen[code] = true
+	}
+
+	if HashBackupCode(codes[0]) != HashBackupCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("Expected hashing to ignore case, dashes and spaces")
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "testing"
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := VerifyPassword("correct horse", hash)
+	if err != nil || !ok {
+		t.Fatalf("Expected password to verify, got %v, %v", ok, err)
+	}
+
+	ok, err = VerifyPassword("wrong", hash)
+	if err != nil || ok {
+		t.Errorf("Expected wrong password to be rejected, got %v, %v", ok, err)
+	}
+
+	other, _ := HashPassword("correct horse")
+	if other == hash {
+		t.Error("Expected hashes of the same password to use different salts")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{"", "plain", "$argon2i$v=19$m=16,t=1,p=1$c2FsdA$aGFzaA", "$argon2id$v=19$m=x$c2FsdA$aGFzaA"} {
+		if _, err := VerifyPassword("password", hash); err == nil {
+			t.Errorf("Expected error for %q", hash)
+		}
+	}
+}
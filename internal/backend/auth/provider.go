@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+)
+
+// Identity provider names accepted in AUTH_PROVIDER
+const (
+	ProviderSupabase = "supabase"
+	ProviderLocal    = "local"
+)
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// IdentityProvider verifies account credentials and runs the email
+// verification and password reset flows. Vault data never depends on the
+// provider; the backend only keeps the provider's user ID on its own user.
+type IdentityProvider interface {
+	// SignUp registers an account and sends its verification email
+	SignUp(email, password string) (*ProviderSession, error)
+	// SignIn checks credentials, failing with ErrInvalidCredentials or ErrEmailNotVerified
+	SignIn(email, password string) (*ProviderSession, error)
+	// GetUser returns the account an access token belongs to
+	GetUser(accessToken string) (*ProviderUser, error)
+	// GetRecoveryUser returns the account of an access token that was issued
+	// for a password reset link, failing with ErrInvalidToken for any other token
+	GetRecoveryUser(accessToken string) (*ProviderUser, error)
+	// ResendVerificationEmail sends a new verification email
+	ResendVerificationEmail(email string) error
+	// VerifyOTP redeems an emailed signup, recovery or email_change token
+	VerifyOTP(email, token, tokenType string) (*ProviderSession, error)
+	// ResetPassword sends a password reset email
+	ResetPassword(email string) error
+	// UpdatePassword sets the password of the account an access token belongs to
+	UpdatePassword(accessToken, newPassword string) error
+	// RequestEmailChange emails a confirmation to the new address of the account
+	// an access token belongs to; redeeming it as an email_change token with
+	// VerifyOTP changes the address. Fails with ErrUserAlreadyExists if the
+	// address is taken.
+	RequestEmailChange(accessToken, newEmail string) error
+	// AdminAvailable reports whether AdminUpdatePassword can be used
+	AdminAvailable() bool
+	// AdminUpdatePassword sets a password without the current credential
+	AdminUpdatePassword(uid, newPassword string) error
+}
+
+// ProviderUser represents an account at the identity provider
+type ProviderUser struct {
+	ID               string    `json:"id"`
+	Email            string    `json:"email"`
+	EmailConfirmedAt string    `json:"email_confirmed_at,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// ProviderSession represents a response of the identity provider that
+// authenticates an account, such as a sign in or redeemed token
+type ProviderSession struct {
+	AccessToken  string       `json:"access_token,omitempty"`
+	TokenType    string       `json:"token_type,omitempty"`
+	ExpiresIn    int          `json:"expires_in,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	User         ProviderUser `json:"user"`
+}
+
+// NewIdentityProvider creates the identity provider selected by AUTH_PROVIDER
+func NewIdentityProvider() (IdentityProvider, error) {
+	switch config.AuthProvider {
+	case ProviderSupabase:
+		client, err := NewSupabaseClient()
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	case ProviderLocal:
+		return NewLocalProvider(), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, config.AuthProvider)
+	}
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+)
+
+// refreshTokenSize is the number of random bytes in a refresh token
+const refreshTokenSize = 32
+
+// GenerateRefreshToken creates an opaque refresh token and the hash under
+// which it is stored. Only the client ever sees the token itself.
+func GenerateRefreshToken() (token, tokenHash string, err error) {
+	raw := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	token = base64.RawURLEncoding.EncodeToString(raw)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hash under which a refresh token is stored.
+// Refresh tokens are random, so a plain hash suffices.
+func HashRefreshToken(token string) string {
+	return hashToken(token)
+}
+
+// RefreshTokenTTL is how long a refresh token can be exchanged after it was issued
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(config.RefreshTokenTTLDays) * 24 * time.Hour
+}
@@ -0,0 +1,452 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+	"golang.org/x/crypto/hkdf"
+)
+
+// AlgorithmEdDSA is the JWS algorithm of PassGO signing keys (Ed25519)
+const AlgorithmEdDSA = "EdDSA"
+
+const (
+	// signingKeyLead is how long a key is published before it starts signing,
+	// so that services caching the JWKS already know it by then
+	signingKeyLead = time.Hour
+	// signingKeyCheckInterval is how often RotateSigningKeys checks whether
+	// the next key is due; it must be shorter than signingKeyLead
+	signingKeyCheckInterval = 15 * time.Minute
+	// signingKeyReloadInterval limits how often each unknown key ID makes
+	// the key ring reload keys another instance may have created
+	signingKeyReloadInterval = time.Minute
+	// maxSigningKeyReloads bounds how many unknown key IDs are remembered
+	// within signingKeyReloadInterval; more are rejected without a reload
+	maxSigningKeyReloads = 1024
+	// signingKeyIDSize is the number of public key digest bytes in a key ID
+	signingKeyIDSize = 16
+	// signingKeyWrapInfo separates the key that seals private signing keys
+	// from any other use of JWT_SECRET
+	signingKeyWrapInfo = "passgo signing key wrap v1"
+)
+
+var ErrSigningKeysNotConfigured = errors.New("signing keys not configured")
+
+// SigningKeyStore persists signing keys so that every backend instance signs
+// and verifies tokens with the same keys
+type SigningKeyStore interface {
+	CreateSigningKey(ctx context.Context, key *models.SigningKey) error
+	ListSigningKeys(ctx context.Context) ([]*models.SigningKey, error)
+}
+
+// signingKey is a stored signing key with its private key unsealed. The
+// private key is nil when it cannot be unsealed, e.g. after JWT_SECRET
+// changed; such a key still verifies the tokens it signed.
+type signingKey struct {
+	kid       string
+	private   ed25519.PrivateKey
+	public    ed25519.PublicKey
+	activeAt  time.Time
+	retiresAt time.Time
+	expiresAt time.Time
+}
+
+// keyRing caches the keys of a SigningKeyStore and rotates them
+type keyRing struct {
+	store SigningKeyStore
+
+	mu       sync.Mutex
+	keys     []*signingKey // ordered by activeAt
+	loadedAt time.Time
+	reloads  map[string]*keyReload // by the unknown key ID that caused them
+}
+
+// keyReload is a reload of the keys for an unknown key ID; done is closed
+// once the reloaded keys are cached
+type keyReload struct {
+	startedAt time.Time
+	done      chan struct{}
+}
+
+// signingKeys is the key ring tokens are signed and verified with
+var signingKeys *keyRing
+
+// UseSigningKeyStore makes tokens be signed and verified with the keys of store
+func UseSigningKeyStore(store SigningKeyStore) {
+	signingKeys = &keyRing{store: store, reloads: make(map[string]*keyReload)}
+}
+
+// RotateSigningKeys checks the signing keys once immediately and then
+// periodically until ctx is done, creating the next key ahead of the
+// retirement of the current one
+func RotateSigningKeys(ctx context.Context) {
+	if signingKeys == nil {
+		return
+	}
+
+	ticker := time.NewTicker(signingKeyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := signingKeys.rotate(ctx); err != nil {
+			log.Printf("Warning: Failed to rotate signing keys: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SigningKeyRotation is how long each signing key signs tokens
+func SigningKeyRotation() time.Duration {
+	return time.Duration(config.JWTKeyRotationDays) * 24 * time.Hour
+}
+
+// JSONWebKey is the public half of a signing key as a JWK (RFC 8037)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JSONWebKeySet is a JWK set as served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that verify PassGO tokens: the current key,
+// the next one once it is scheduled, and retired keys until the last token
+// they signed has expired
+func JWKS(ctx context.Context) (*JSONWebKeySet, error) {
+	if signingKeys == nil {
+		return nil, ErrSigningKeysNotConfigured
+	}
+
+	r := signingKeys
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.loadedAt) >= signingKeyReloadInterval {
+		if err := r.load(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range r.keys {
+		if !key.expiresAt.After(now) {
+			continue
+		}
+		set.Keys = append(set.Keys, JSONWebKey{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.public),
+			KeyID:     key.kid,
+			Algorithm: AlgorithmEdDSA,
+			Use:       "sig",
+		})
+	}
+
+	return set, nil
+}
+
+// rotate reloads the keys and schedules the next key once the newest one
+// retires within signingKeyLead, or creates a key that signs right away when
+// the newest one has already retired
+func (r *keyRing) rotate(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.load(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if len(r.keys) == 0 {
+		return r.create(ctx, now)
+	}
+
+	latest := r.keys[len(r.keys)-1]
+	switch {
+	case !latest.retiresAt.After(now):
+		return r.create(ctx, now)
+	case latest.retiresAt.Sub(now) <= signingKeyLead:
+		return r.create(ctx, latest.retiresAt)
+	}
+	return nil
+}
+
+// signer returns the key that signs tokens now, creating one if none does
+func (r *keyRing) signer(ctx context.Context) (*signingKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if key := r.current(now); key != nil {
+		return key, nil
+	}
+
+	// Another instance may already have created the key
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	if key := r.current(now); key != nil {
+		return key, nil
+	}
+
+	if err := r.create(ctx, now); err != nil {
+		return nil, err
+	}
+	return r.current(now), nil
+}
+
+// publicKey returns the unexpired key with the given ID, reloading the keys
+// when it is unknown since another instance may have created it. Each key ID
+// causes at most one reload per signingKeyReloadInterval, and requests for
+// the same key ID wait for the reload in progress. The store is read without
+// holding r.mu, so a slow store does not hold up verifying known keys.
+func (r *keyRing) publicKey(ctx context.Context, kid string) (ed25519.PublicKey, error) {
+	r.mu.Lock()
+	now := time.Now()
+	if key := r.lookup(kid, now); key != nil {
+		r.mu.Unlock()
+		return key.public, nil
+	}
+
+	// Key IDs of other sizes were never issued by any instance
+	if raw, err := base64.RawURLEncoding.DecodeString(kid); err != nil || len(raw) != signingKeyIDSize {
+		r.mu.Unlock()
+		return nil, ErrInvalidToken
+	}
+
+	if reload, ok := r.reloads[kid]; ok && now.Sub(reload.startedAt) < signingKeyReloadInterval {
+		r.mu.Unlock()
+		select {
+		case <-reload.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return r.cachedPublicKey(kid)
+	}
+
+	for id, reload := range r.reloads {
+		if now.Sub(reload.startedAt) >= signingKeyReloadInterval {
+			delete(r.reloads, id)
+		}
+	}
+	if len(r.reloads) >= maxSigningKeyReloads {
+		r.mu.Unlock()
+		return nil, ErrInvalidToken
+	}
+	reload := &keyReload{startedAt: now, done: make(chan struct{})}
+	r.reloads[kid] = reload
+	r.mu.Unlock()
+
+	keys, err := r.fetch(ctx)
+	if err == nil {
+		r.mu.Lock()
+		r.merge(keys)
+		r.mu.Unlock()
+	}
+	close(reload.done)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.cachedPublicKey(kid)
+}
+
+// cachedPublicKey returns the unexpired cached key with the given ID
+func (r *keyRing) cachedPublicKey(kid string) (ed25519.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key := r.lookup(kid, time.Now()); key != nil {
+		return key.public, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+// current returns the newest key that signs at now; r.mu must be held
+func (r *keyRing) current(now time.Time) *signingKey {
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		key := r.keys[i]
+		if key.private != nil && !key.activeAt.After(now) && key.retiresAt.After(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// lookup returns the unexpired key with the given ID; r.mu must be held
+func (r *keyRing) lookup(kid string, now time.Time) *signingKey {
+	for _, key := range r.keys {
+		if key.kid == kid && key.expiresAt.After(now) {
+			return key
+		}
+	}
+	return nil
+}
+
+// load replaces the cached keys with the ones in the store; r.mu must be held
+func (r *keyRing) load(ctx context.Context) error {
+	keys, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.keys = keys
+	r.loadedAt = time.Now()
+	return nil
+}
+
+// merge adds fetched keys that are not cached yet. Unlike load it keeps the
+// cached keys, since a key created while the fetch was running may be
+// missing from it; r.mu must be held.
+func (r *keyRing) merge(keys []*signingKey) {
+	for _, key := range keys {
+		if !slices.ContainsFunc(r.keys, func(cached *signingKey) bool { return cached.kid == key.kid }) {
+			r.keys = append(r.keys, key)
+		}
+	}
+	sortSigningKeys(r.keys)
+}
+
+// fetch reads and unseals the keys in the store
+func (r *keyRing) fetch(ctx context.Context) ([]*signingKey, error) {
+	stored, err := r.store.ListSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*signingKey, 0, len(stored))
+	for _, s := range stored {
+		if s.Algorithm != AlgorithmEdDSA || len(s.PublicKey) != ed25519.PublicKeySize {
+			continue
+		}
+
+		key := &signingKey{
+			kid:       s.KID,
+			public:    ed25519.PublicKey(s.PublicKey),
+			activeAt:  s.ActiveAt,
+			retiresAt: s.RetiresAt,
+			expiresAt: s.ExpiresAt,
+		}
+		if seed, err := openSigningKey(s.KID, s.PrivateKey); err != nil {
+			log.Printf("Warning: Signing key %s cannot be unsealed and only verifies tokens: %v", s.KID, err)
+		} else {
+			key.private = ed25519.NewKeyFromSeed(seed)
+		}
+		keys = append(keys, key)
+	}
+	sortSigningKeys(keys)
+
+	return keys, nil
+}
+
+// create stores a new key that signs from activeAt on; r.mu must be held
+func (r *keyRing) create(ctx context.Context, activeAt time.Time) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	// The key ID is derived from the public key, so it never repeats
+	digest := sha256.Sum256(public)
+	kid := base64.RawURLEncoding.EncodeToString(digest[:signingKeyIDSize])
+
+	sealed, err := sealSigningKey(kid, private.Seed())
+	if err != nil {
+		return err
+	}
+
+	retiresAt := activeAt.Add(SigningKeyRotation())
+	expiresAt := retiresAt.Add(max(AccessTokenTTL(), MFATokenTTL()))
+	err = r.store.CreateSigningKey(ctx, &models.SigningKey{
+		KID:        kid,
+		Algorithm:  AlgorithmEdDSA,
+		PublicKey:  public,
+		PrivateKey: sealed,
+		ActiveAt:   activeAt,
+		RetiresAt:  retiresAt,
+		ExpiresAt:  expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.keys = append(r.keys, &signingKey{
+		kid:       kid,
+		private:   private,
+		public:    public,
+		activeAt:  activeAt,
+		retiresAt: retiresAt,
+		expiresAt: expiresAt,
+	})
+	sortSigningKeys(r.keys)
+	return nil
+}
+
+func sortSigningKeys(keys []*signingKey) {
+	slices.SortStableFunc(keys, func(a, b *signingKey) int {
+		return a.activeAt.Compare(b.activeAt)
+	})
+}
+
+// signingKeyWrapKey derives the key that seals private signing keys at rest
+func signingKeyWrapKey() ([]byte, error) {
+	if config.JWTSecret == "" {
+		return nil, errors.New("JWT secret not configured")
+	}
+
+	key := make([]byte, crypto.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(config.JWTSecret), nil, []byte(signingKeyWrapInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// sealSigningKey encrypts the seed of a private key, bound to its key ID
+func sealSigningKey(kid string, seed []byte) (string, error) {
+	wrapKey, err := signingKeyWrapKey()
+	if err != nil {
+		return "", err
+	}
+	return crypto.Encrypt(wrapKey, seed, []byte(kid))
+}
+
+// openSigningKey decrypts the seed of a private key sealed by sealSigningKey
+func openSigningKey(kid, sealed string) ([]byte, error) {
+	wrapKey, err := signingKeyWrapKey()
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := crypto.Decrypt(wrapKey, sealed, []byte(kid))
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, crypto.ErrInvalidKey
+	}
+	return seed, nil
+}
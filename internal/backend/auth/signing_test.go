@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// memSigningKeyStore is an in-memory SigningKeyStore
+type memSigningKeyStore struct {
+	mu    sync.Mutex
+	keys  []*models.SigningKey
+	lists int // calls of ListSigningKeys
+}
+
+func (s *memSigningKeyStore) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.ID = bson.NewObjectID()
+	key.CreatedAt = time.Now()
+	copied := *key
+	s.keys = append(s.keys, &copied)
+	return nil
+}
+
+func (s *memSigningKeyStore) ListSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists++
+	var keys []*models.SigningKey
+	for _, key := range s.keys {
+		if key.ExpiresAt.After(time.Now()) {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+// age moves every stored key d into the past, as if d had passed
+func (s *memSigningKeyStore) age(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		key.ActiveAt = key.ActiveAt.Add(-d)
+		key.RetiresAt = key.RetiresAt.Add(-d)
+		key.ExpiresAt = key.ExpiresAt.Add(-d)
+	}
+}
+
+// useTestSigningKeys configures token signing against a fresh in-memory store
+func useTestSigningKeys(t *testing.T) *memSigningKeyStore {
+	t.Helper()
+
+	secret, expiration, rotation := config.JWTSecret, config.JWTExpiration, config.JWTKeyRotationDays
+	t.Cleanup(func() {
+		config.JWTSecret, config.JWTExpiration, config.JWTKeyRotationDays = secret, expiration, rotation
+		signingKeys = nil
+	})
+	config.JWTSecret = "test-secret"
+	config.JWTExpiration = 24
+	config.JWTKeyRotationDays = 30
+
+	store := &memSigningKeyStore{}
+	UseSigningKeyStore(store)
+	return store
+}
+
+func tokenKeyID(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestTokensNameTheirSigningKey(t *testing.T) {
+	useTestSigningKeys(t)
+
+	token, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := VerifyToken(token)
+	if err != nil {
+		t.Fatalf("Expected the token to verify: %v", err)
+	}
+	if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != 24*time.Hour {
+		t.Errorf("Expected the token to last JWT_EXPIRATION_HOURS, got %v", got)
+	}
+
+	set, err := JWKS(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].KeyID != tokenKeyID(t, token) {
+		t.Fatalf("Expected the JWKS to publish the signing key, got %+v", set.Keys)
+	}
+	if key := set.Keys[0]; key.KeyType != "OKP" || key.Curve != "Ed25519" || key.Algorithm != AlgorithmEdDSA {
+		t.Errorf("Expected an Ed25519 JWK, got %+v", key)
+	}
+}
+
+func TestSigningKeyRotationOverlaps(t *testing.T) {
+	store := useTestSigningKeys(t)
+	ctx := context.Background()
+
+	oldToken, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKID := tokenKeyID(t, oldToken)
+
+	// Shortly before the key retires, its successor is published but does not sign yet
+	store.age(SigningKeyRotation() - signingKeyLead/2)
+	if err := signingKeys.rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := JWKS(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 2 {
+		t.Fatalf("Expected the next key to be published ahead of time, got %d keys", len(set.Keys))
+	}
+	token, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenKeyID(t, token) != oldKID {
+		t.Error("Expected the current key to keep signing until it retires")
+	}
+
+	// Once the key retired its successor signs, and the old tokens still verify
+	store.age(signingKeyLead)
+	if err := signingKeys.rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err = GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenKeyID(t, token) == oldKID {
+		t.Error("Expected the next key to sign after the current one retired")
+	}
+	if len(store.keys) != 2 {
+		t.Errorf("Expected no key beyond the scheduled one, got %d", len(store.keys))
+	}
+
+	if _, err := VerifyToken(oldToken); err != nil {
+		t.Errorf("Expected tokens of the retired key to still verify, got %v", err)
+	}
+}
+
+func TestExpiredSigningKeyIsDropped(t *testing.T) {
+	store := useTestSigningKeys(t)
+	ctx := context.Background()
+
+	token, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := tokenKeyID(t, token)
+
+	store.age(SigningKeyRotation() + AccessTokenTTL() + time.Minute)
+	if err := signingKeys.rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := JWKS(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range set.Keys {
+		if key.KeyID == kid {
+			t.Error("Expected the expired key to be dropped from the JWKS")
+		}
+	}
+	if key, err := signingKeys.publicKey(ctx, kid); err == nil {
+		t.Errorf("Expected the expired key to be unknown, got %v", key)
+	}
+}
+
+func TestUnknownKeyIDsReloadOncePerInterval(t *testing.T) {
+	store := useTestSigningKeys(t)
+	ctx := context.Background()
+
+	// A key created by another instance is found by reloading
+	other := &keyRing{store: store, reloads: make(map[string]*keyReload)}
+	if _, err := other.signer(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signingKeys.publicKey(ctx, other.keys[0].kid); err != nil {
+		t.Fatalf("Expected the key of another instance to be found, got %v", err)
+	}
+
+	// A key ID nobody created reloads once per interval
+	unknown := base64.RawURLEncoding.EncodeToString(make([]byte, signingKeyIDSize))
+	lists := store.lists
+	for range 3 {
+		if _, err := signingKeys.publicKey(ctx, unknown); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Expected an unknown key ID to be rejected, got %v", err)
+		}
+	}
+	if store.lists != lists+1 {
+		t.Errorf("Expected one reload for the unknown key ID, got %d", store.lists-lists)
+	}
+
+	// Key IDs that were never issued do not reload at all
+	if _, err := signingKeys.publicKey(ctx, "not-a-key-id"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Expected a malformed key ID to be rejected, got %v", err)
+	}
+	if store.lists != lists+1 {
+		t.Error("Expected a malformed key ID not to reload the keys")
+	}
+}
+
+func TestVerifyRejectsForeignTokens(t *testing.T) {
+	useTestSigningKeys(t)
+
+	token, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := tokenKeyID(t, token)
+
+	claims := &Claims{
+		UserID: "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "session",
+			Issuer:    tokenIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	// The old shared secret no longer signs tokens
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither does a key that merely claims a known key ID
+	_, foreignKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	forged.Header["kid"] = kid
+	forgedToken, err := forged.SignedString(foreignKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"HS256": hmac, "forged": forgedToken} {
+		if _, err := VerifyToken(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected the %s token to be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestSigningKeysAreSealedUnderJWTSecret(t *testing.T) {
+	store := useTestSigningKeys(t)
+	ctx := context.Background()
+
+	token, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored := store.keys[0]
+	if _, err := openSigningKey(stored.KID, stored.PrivateKey); err != nil {
+		t.Fatalf("Expected the private key to unseal: %v", err)
+	}
+
+	// Under another secret the key can no longer sign but still verifies
+	config.JWTSecret = "rotated-secret"
+	if err := signingKeys.rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyToken(token); err != nil {
+		t.Errorf("Expected tokens of the old key to still verify, got %v", err)
+	}
+
+	next, err := GenerateToken("user", "alice@example.com", "", 1, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenKeyID(t, next) == stored.KID {
+		t.Error("Expected a new key to sign once the old one cannot be unsealed")
+	}
+}
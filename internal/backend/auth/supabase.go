@@ -2,11 +2,14 @@ package auth
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/philopaterwaheed/passGO/internal/backend/config"
@@ -19,31 +22,15 @@ var (
 	ErrEmailNotVerified      = errors.New("email not verified")
 	ErrInvalidCredentials    = errors.New("invalid email or password")
 	ErrUserAlreadyExists     = errors.New("user already exists")
+	ErrAdminNotConfigured    = errors.New("supabase service role key not configured")
 )
 
 //handles communication with Supabase Auth
 type SupabaseClient struct {
-	url    string
-	apiKey string
-	client *http.Client
-}
-
-// SupabaseUser represents a user from Supabase Auth
-type SupabaseUser struct {
-	ID               string    `json:"id"`
-	Email            string    `json:"email"`
-	EmailConfirmedAt string    `json:"email_confirmed_at,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-}
-
-// SupabaseAuthResponse represents the response from Supabase Auth endpoints
-type SupabaseAuthResponse struct {
-	AccessToken  string       `json:"access_token,omitempty"`
-	TokenType    string       `json:"token_type,omitempty"`
-	ExpiresIn    int          `json:"expires_in,omitempty"`
-	RefreshToken string       `json:"refresh_token,omitempty"`
-	User         SupabaseUser `json:"user"`
+	url        string
+	apiKey     string
+	serviceKey string
+	client     *http.Client
 }
 
 // SupabaseErrorResponse represents an error response from Supabase
@@ -60,17 +47,25 @@ func NewSupabaseClient() (*SupabaseClient, error) {
 		return nil, ErrSupabaseNotConfigured
 	}
 
+	return NewSupabaseClientWithConfig(config.SupabaseURL, config.SupabaseAPIKey, config.SupabaseServiceRoleKey), nil
+}
+
+// NewSupabaseClientWithConfig creates a Supabase client for an explicit
+// project URL and keys, e.g. a fake GoTrue server in tests. An empty
+// serviceKey disables admin calls.
+func NewSupabaseClientWithConfig(url, apiKey, serviceKey string) *SupabaseClient {
 	return &SupabaseClient{
-		url:    config.SupabaseURL,
-		apiKey: config.SupabaseAPIKey,
+		url:        url,
+		apiKey:     apiKey,
+		serviceKey: serviceKey,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-	}, nil
+	}
 }
 
 //registers a new user with Supabase Auth
-func (s *SupabaseClient) SignUp(email, password string) (*SupabaseAuthResponse, error) {
+func (s *SupabaseClient) SignUp(email, password string) (*ProviderSession, error) {
 	payload := map[string]string{
 		"email":    email,
 		"password": password,
@@ -96,7 +91,6 @@ func (s *SupabaseClient) SignUp(email, password string) (*SupabaseAuthResponse,
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
-	fmt.Println(string(respBody))
 	if err != nil {
 		return nil, err
 	}
@@ -117,16 +111,23 @@ func (s *SupabaseClient) SignUp(email, password string) (*SupabaseAuthResponse,
 		return nil, ErrSignupFailed
 	}
 
-	var authResp SupabaseAuthResponse
+	var authResp ProviderSession
 	if err := json.Unmarshal(respBody, &authResp); err != nil {
 		return nil, err
 	}
 
+	// With email confirmations enabled GoTrue returns the bare user instead of a session
+	if authResp.User.ID == "" {
+		if err := json.Unmarshal(respBody, &authResp.User); err != nil {
+			return nil, err
+		}
+	}
+
 	return &authResp, nil
 }
 
 // SignIn authenticates a user with email and password
-func (s *SupabaseClient) SignIn(email, password string) (*SupabaseAuthResponse, error) {
+func (s *SupabaseClient) SignIn(email, password string) (*ProviderSession, error) {
 	payload := map[string]string{
 		"email":    email,
 		"password": password,
@@ -156,7 +157,6 @@ func (s *SupabaseClient) SignIn(email, password string) (*SupabaseAuthResponse,
 		return nil, err
 	}
 
-	fmt.Println(string(respBody))
 	if resp.StatusCode >= 400 {
 		var errResp SupabaseErrorResponse
 		if err := json.Unmarshal(respBody, &errResp); err == nil {
@@ -173,7 +173,7 @@ func (s *SupabaseClient) SignIn(email, password string) (*SupabaseAuthResponse,
 		return nil, ErrLoginFailed
 	}
 
-	var authResp SupabaseAuthResponse
+	var authResp ProviderSession
 	if err := json.Unmarshal(respBody, &authResp); err != nil {
 		return nil, err
 	}
@@ -187,7 +187,7 @@ func (s *SupabaseClient) SignIn(email, password string) (*SupabaseAuthResponse,
 }
 
 // GetUser retrieves user information using an access token
-func (s *SupabaseClient) GetUser(accessToken string) (*SupabaseUser, error) {
+func (s *SupabaseClient) GetUser(accessToken string) (*ProviderUser, error) {
 	req, err := http.NewRequest("GET", s.url+"/auth/v1/user", nil)
 	if err != nil {
 		return nil, err
@@ -211,7 +211,7 @@ func (s *SupabaseClient) GetUser(accessToken string) (*SupabaseUser, error) {
 		return nil, errors.New("failed to get user")
 	}
 
-	var user SupabaseUser
+	var user ProviderUser
 	if err := json.Unmarshal(respBody, &user); err != nil {
 		return nil, err
 	}
@@ -219,6 +219,44 @@ func (s *SupabaseClient) GetUser(accessToken string) (*SupabaseUser, error) {
 	return &user, nil
 }
 
+// GetRecoveryUser returns the account of an access token from the URL hash of
+// a password reset link. GoTrue lists how a session was authenticated in the
+// token's amr claim, where redeeming a reset link is the "recovery" method.
+func (s *SupabaseClient) GetRecoveryUser(accessToken string) (*ProviderUser, error) {
+	// GoTrue vouches for the token, so its claims only need to be read
+	user, err := s.GetUser(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims struct {
+		AMR []struct {
+			Method    string `json:"method"`
+			Timestamp int64  `json:"timestamp"`
+		} `json:"amr"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	for _, entry := range claims.AMR {
+		if entry.Method == "recovery" && time.Since(time.Unix(entry.Timestamp, 0)) < recoveryTokenTTL {
+			return user, nil
+		}
+	}
+
+	return nil, ErrInvalidToken
+}
+
 // ResendVerificationEmail resends the email verification link
 func (s *SupabaseClient) ResendVerificationEmail(email string) error {
 	payload := map[string]string{
@@ -253,7 +291,7 @@ func (s *SupabaseClient) ResendVerificationEmail(email string) error {
 }
 
 // VerifyOTP verifies an email OTP token
-func (s *SupabaseClient) VerifyOTP(email, token, tokenType string) (*SupabaseAuthResponse, error) {
+func (s *SupabaseClient) VerifyOTP(email, token, tokenType string) (*ProviderSession, error) {
 	payload := map[string]string{
 		"email": email,
 		"token": token,
@@ -288,7 +326,7 @@ func (s *SupabaseClient) VerifyOTP(email, token, tokenType string) (*SupabaseAut
 		return nil, errors.New("verification failed")
 	}
 
-	var authResp SupabaseAuthResponse
+	var authResp ProviderSession
 	if err := json.Unmarshal(respBody, &authResp); err != nil {
 		return nil, err
 	}
@@ -296,7 +334,8 @@ func (s *SupabaseClient) VerifyOTP(email, token, tokenType string) (*SupabaseAut
 	return &authResp, nil
 }
 
-// ResetPassword sends a password reset email
+// ResetPassword sends a password reset email. The link leads back to
+// /api/auth/reset-password.
 func (s *SupabaseClient) ResetPassword(email string) error {
 	payload := map[string]string{
 		"email": email,
@@ -307,7 +346,8 @@ func (s *SupabaseClient) ResetPassword(email string) error {
 		return err
 	}
 
-	req, err := http.NewRequest("POST", s.url+"/auth/v1/recover", bytes.NewBuffer(body))
+	redirectTo := url.QueryEscape(config.PublicURL + "/api/auth/reset-password")
+	req, err := http.NewRequest("POST", s.url+"/auth/v1/recover?redirect_to="+redirectTo, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
@@ -360,3 +400,87 @@ func (s *SupabaseClient) UpdatePassword(accessToken, newPassword string) error {
 
 	return nil
 }
+
+// RequestEmailChange asks Supabase to email a confirmation link to the new
+// address. The link leads back to /api/auth/confirm-email-change.
+func (s *SupabaseClient) RequestEmailChange(accessToken, newEmail string) error {
+	payload := map[string]string{
+		"email": newEmail,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	redirectTo := url.QueryEscape(config.PublicURL + "/api/auth/confirm-email-change")
+	req, err := http.NewRequest("PUT", s.url+"/auth/v1/user?redirect_to="+redirectTo, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp SupabaseErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil && strings.Contains(errResp.Message, "already been registered") {
+			return ErrUserAlreadyExists
+		}
+		return errors.New("failed to request email change")
+	}
+
+	return nil
+}
+
+// AdminAvailable reports whether AdminUpdatePassword can be used, which
+// requires the service role key
+func (s *SupabaseClient) AdminAvailable() bool {
+	return s.serviceKey != ""
+}
+
+// AdminUpdatePassword sets a user's password without their current credential.
+// It uses the service role key and must only be called once the caller has
+// proven control of the account by other means, such as a recovery key.
+func (s *SupabaseClient) AdminUpdatePassword(supabaseUID, newPassword string) error {
+	if s.serviceKey == "" {
+		return ErrAdminNotConfigured
+	}
+
+	payload := map[string]string{
+		"password": newPassword,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", s.url+"/auth/v1/admin/users/"+url.PathEscape(supabaseUID), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", s.serviceKey)
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return errors.New("failed to update password")
+	}
+
+	return nil
+}
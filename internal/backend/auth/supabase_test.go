@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/auth/gotruetest"
+)
+
+func TestSupabaseSignUpAndSignIn(t *testing.T) {
+	gotrue := gotruetest.NewServer()
+	defer gotrue.Close()
+	client := NewSupabaseClientWithConfig(gotrue.URL, gotruetest.APIKey, "")
+
+	resp, err := client.SignUp("alice@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, _ := gotrue.User("alice@example.com")
+	if resp.User.ID == "" || resp.User.ID != registered.ID {
+		t.Fatalf("Expected the user ID of the new account, got %q", resp.User.ID)
+	}
+
+	if _, err := client.SignUp("alice@example.com", "correct horse"); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Errorf("Expected ErrUserAlreadyExists, got %v", err)
+	}
+
+	if _, err := client.SignIn("alice@example.com", "correct horse"); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Expected ErrEmailNotVerified before confirmation, got %v", err)
+	}
+
+	gotrue.Confirm("alice@example.com")
+
+	if _, err := client.SignIn("alice@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+
+	session, err := client.SignIn("alice@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.AccessToken == "" || session.User.EmailConfirmedAt == "" {
+		t.Errorf("Expected a confirmed session, got %+v", session)
+	}
+
+	user, err := client.GetUser(session.AccessToken)
+	if err != nil || user.ID != registered.ID {
+		t.Errorf("Expected GetUser to return the account, got %+v, %v", user, err)
+	}
+}
+
+func TestSupabaseScriptedFailures(t *testing.T) {
+	gotrue := gotruetest.NewServer()
+	defer gotrue.Close()
+	client := NewSupabaseClientWithConfig(gotrue.URL, gotruetest.APIKey, "")
+
+	gotrue.Fail(gotruetest.Signup, http.StatusInternalServerError, "Database error saving new user")
+	if _, err := client.SignUp("bob@example.com", "correct horse"); err == nil || err.Error() != "Database error saving new user" {
+		t.Errorf("Expected the scripted error, got %v", err)
+	}
+
+	// Failures apply once
+	if _, err := client.SignUp("bob@example.com", "correct horse"); err != nil {
+		t.Errorf("Expected the retry to succeed, got %v", err)
+	}
+
+	gotrue.Fail(gotruetest.Recover, http.StatusTooManyRequests, "Rate limit exceeded")
+	if err := client.ResetPassword("bob@example.com"); err == nil {
+		t.Error("Expected ResetPassword to fail")
+	}
+}
+
+func TestSupabaseAdminUpdatePassword(t *testing.T) {
+	gotrue := gotruetest.NewServer()
+	defer gotrue.Close()
+
+	anon := NewSupabaseClientWithConfig(gotrue.URL, gotruetest.APIKey, "")
+	resp, err := anon.SignUp("carol@example.com", "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotrue.Confirm("carol@example.com")
+
+	if err := anon.AdminUpdatePassword(resp.User.ID, "battery staple"); !errors.Is(err, ErrAdminNotConfigured) {
+		t.Errorf("Expected ErrAdminNotConfigured without a service key, got %v", err)
+	}
+
+	admin := NewSupabaseClientWithConfig(gotrue.URL, gotruetest.APIKey, gotruetest.ServiceKey)
+	if err := admin.AdminUpdatePassword(resp.User.ID, "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := admin.SignIn("carol@example.com", "battery staple"); err != nil {
+		t.Errorf("Expected sign in with the new password, got %v", err)
+	}
+}
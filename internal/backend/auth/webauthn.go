@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+)
+
+// webauthnTimeout is how long a registration or login ceremony stays valid
+const webauthnTimeout = 5 * time.Minute
+
+// NewRelyingParty configures WebAuthn ceremonies from WEBAUTHN_RP_ID,
+// WEBAUTHN_RP_NAME and the comma-separated WEBAUTHN_ORIGINS
+func NewRelyingParty() (*webauthn.WebAuthn, error) {
+	rpID := config.WebAuthnRPID
+	if rpID == "" {
+		publicURL, err := url.Parse(config.PublicURL)
+		if err != nil {
+			return nil, err
+		}
+		rpID = publicURL.Hostname()
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(config.WebAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnTimeout, TimeoutUVD: webauthnTimeout}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: config.WebAuthnRPName,
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+}
+
+// WebAuthnUser adapts an account and its registered credentials to the
+// webauthn.User interface. ID is the user handle stored by authenticators.
+type WebAuthnUser struct {
+	ID          []byte
+	Email       string
+	Credentials []webauthn.Credential
+}
+
+func (u *WebAuthnUser) WebAuthnID() []byte {
+	return u.ID
+}
+
+func (u *WebAuthnUser) WebAuthnName() string {
+	return u.Email
+}
+
+func (u *WebAuthnUser) WebAuthnDisplayName() string {
+	return u.Email
+}
+
+func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.Credentials
+}
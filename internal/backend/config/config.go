@@ -9,17 +9,66 @@ import (
 )
 
 var (
-	Port        string
-	Environment string
+	Port           string
+	Environment    string
+	PublicURL      string
+	TrustedProxies string
+	AdminEmails    string
 
-	JWTSecret     string
-	JWTExpiration int
+	JWTSecret          string
+	JWTExpiration      int
+	JWTKeyRotationDays int
+	MFATokenTTLMinutes int
+
+	RefreshTokenTTLDays int
 
 	MongoURI      string
 	MongoDatabase string
 
-	SupabaseURL    string
-	SupabaseAPIKey string
+	AuthProvider string
+
+	SupabaseURL            string
+	SupabaseAPIKey         string
+	SupabaseServiceRoleKey string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	VaultRevisionRetention  int
+	VaultTrashRetentionDays int
+	VaultTrashSweepInterval int
+	SyncTombstoneRetention  int
+
+	AttachmentStorage    string
+	AttachmentPath       string
+	AttachmentQuotaMB    int
+	AttachmentMaxChunkMB int
+
+	EventsKeepAliveSeconds int
+
+	KDFMinMemoryKiB  int
+	KDFMinIterations int
+
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins string
+
+	RateLimitStore              string
+	RateLimitLogin              string
+	RateLimitSignup             string
+	RateLimitForgotPassword     string
+	RateLimitResendVerification string
+	RateLimitRecovery           string
+	RateLimitMFA                string
+	RateLimitRefresh            string
+	RateLimitVerify             string
+
+	LoginDelayAfter       int
+	LoginLockoutThreshold int
+	LoginLockoutMinutes   int
 )
 
 func init() {
@@ -30,12 +79,61 @@ func init() {
 	}
 	Port = getEnv("PORT", "8080")
 	Environment = getEnv("ENVIRONMENT", "development")
+	PublicURL = getEnv("PUBLIC_URL", "http://localhost:"+Port)
+	TrustedProxies = getEnv("TRUSTED_PROXIES", "")
+	// Comma-separated emails of the accounts allowed to manage users
+	AdminEmails = getEnv("ADMIN_EMAILS", "")
 	JWTSecret = getEnv("JWT_SECRET", "")
 	JWTExpiration = getEnvAsInt("JWT_EXPIRATION_HOURS", 24)
+	JWTKeyRotationDays = getEnvAsInt("JWT_KEY_ROTATION_DAYS", 30)
+	MFATokenTTLMinutes = getEnvAsInt("MFA_TOKEN_TTL_MINUTES", 5)
+	RefreshTokenTTLDays = getEnvAsInt("REFRESH_TOKEN_TTL_DAYS", 30)
 	MongoURI = getEnv("MONGO_URI", "mongodb://localhost:27017")
 	MongoDatabase = getEnv("MONGO_DATABASE", "passgo")
 	SupabaseURL = getEnv("SUPABASE_URL", "")
 	SupabaseAPIKey = getEnv("SUPABASE_API_KEY", "")
+	SupabaseServiceRoleKey = getEnv("SUPABASE_SERVICE_ROLE_KEY", "")
+	// Default to Supabase when it is configured and to the built-in provider otherwise
+	AuthProvider = getEnv("AUTH_PROVIDER", "")
+	if AuthProvider == "" {
+		AuthProvider = "local"
+		if SupabaseURL != "" {
+			AuthProvider = "supabase"
+		}
+	}
+	SMTPHost = getEnv("SMTP_HOST", "")
+	SMTPPort = getEnvAsInt("SMTP_PORT", 587)
+	SMTPUsername = getEnv("SMTP_USERNAME", "")
+	SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	SMTPFrom = getEnv("SMTP_FROM", "passgo@localhost")
+	VaultRevisionRetention = getEnvAsInt("VAULT_REVISION_RETENTION", 20)
+	VaultTrashRetentionDays = getEnvAsInt("VAULT_TRASH_RETENTION_DAYS", 30)
+	VaultTrashSweepInterval = getEnvAsInt("VAULT_TRASH_SWEEP_MINUTES", 60)
+	SyncTombstoneRetention = getEnvAsInt("SYNC_TOMBSTONE_RETENTION_DAYS", 90)
+	AttachmentStorage = getEnv("ATTACHMENT_STORAGE", "gridfs")
+	AttachmentPath = getEnv("ATTACHMENT_PATH", "data/attachments")
+	AttachmentQuotaMB = getEnvAsInt("ATTACHMENT_QUOTA_MB", 1024)
+	AttachmentMaxChunkMB = getEnvAsInt("ATTACHMENT_MAX_CHUNK_MB", 8)
+	EventsKeepAliveSeconds = getEnvAsInt("EVENTS_KEEPALIVE_SECONDS", 25)
+	KDFMinMemoryKiB = getEnvAsInt("KDF_MIN_MEMORY_KIB", 19*1024)
+	KDFMinIterations = getEnvAsInt("KDF_MIN_ITERATIONS", 2)
+	// The relying party ID defaults to the host of PUBLIC_URL
+	WebAuthnRPID = getEnv("WEBAUTHN_RP_ID", "")
+	WebAuthnRPName = getEnv("WEBAUTHN_RP_NAME", "PassGO")
+	WebAuthnOrigins = getEnv("WEBAUTHN_ORIGINS", PublicURL)
+	// Rate limits are "<per IP>,<per email>", each "<requests>/<window>" or empty for no limit
+	RateLimitStore = getEnv("RATE_LIMIT_STORE", "memory")
+	RateLimitLogin = getEnv("RATE_LIMIT_LOGIN", "30/1m,10/1m")
+	RateLimitSignup = getEnv("RATE_LIMIT_SIGNUP", "10/1h,3/1h")
+	RateLimitForgotPassword = getEnv("RATE_LIMIT_FORGOT_PASSWORD", "10/1h,3/1h")
+	RateLimitResendVerification = getEnv("RATE_LIMIT_RESEND_VERIFICATION", "10/1h,3/1h")
+	RateLimitRecovery = getEnv("RATE_LIMIT_RECOVERY", "20/1h,5/1h")
+	RateLimitMFA = getEnv("RATE_LIMIT_MFA", "30/1m,")
+	RateLimitRefresh = getEnv("RATE_LIMIT_REFRESH", "60/1m,")
+	RateLimitVerify = getEnv("RATE_LIMIT_VERIFY", "30/1h,10/1h")
+	LoginDelayAfter = getEnvAsInt("LOGIN_DELAY_AFTER", 3)
+	LoginLockoutThreshold = getEnvAsInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+	LoginLockoutMinutes = getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15)
 }
 
 func getEnv(key, defaultValue string) string {
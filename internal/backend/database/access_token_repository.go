@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const accessTokensCollection = "access_tokens"
+
+var ErrAccessTokenNotFound = errors.New("access token not found or expired")
+
+// AccessTokenRepository handles the personal access tokens of users
+type AccessTokenRepository struct {
+	tokens *mongo.Collection
+}
+
+// NewAccessTokenRepository creates a new access token repository
+func NewAccessTokenRepository() *AccessTokenRepository {
+	return &AccessTokenRepository{
+		tokens: GetCollection(accessTokensCollection),
+	}
+}
+
+// CreateAccessToken stores a new access token
+func (r *AccessTokenRepository) CreateAccessToken(ctx context.Context, token *models.AccessToken) error {
+	token.ID = bson.NewObjectID()
+	token.CreatedAt = time.Now()
+
+	_, err := r.tokens.InsertOne(ctx, token)
+	return err
+}
+
+// ListAccessTokens retrieves the unexpired access tokens of a user, newest first
+func (r *AccessTokenRepository) ListAccessTokens(ctx context.Context, userID string) ([]*models.AccessToken, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"user_id":    ownerID,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.tokens.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []*models.AccessToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetAccessTokenByVerifier retrieves an unexpired access token by the
+// verifier of its auth key
+func (r *AccessTokenRepository) GetAccessTokenByVerifier(ctx context.Context, verifier string) (*models.AccessToken, error) {
+	filter := bson.M{
+		"verifier":   verifier,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	var token models.AccessToken
+	err := r.tokens.FindOne(ctx, filter).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAccessTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// RecordAccessTokenUse records that a token was just used from an IP address
+func (r *AccessTokenRepository) RecordAccessTokenUse(ctx context.Context, id bson.ObjectID, ip string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"last_used_at": time.Now(),
+			"last_used_ip": ip,
+		},
+	}
+
+	_, err := r.tokens.UpdateByID(ctx, id, update)
+	return err
+}
+
+// DeleteAccessToken revokes an access token of a user
+func (r *AccessTokenRepository) DeleteAccessToken(ctx context.Context, userID, id string) error {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrAccessTokenNotFound
+	}
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrAccessTokenNotFound
+	}
+
+	result, err := r.tokens.DeleteOne(ctx, bson.M{"_id": objectID, "user_id": ownerID})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrAccessTokenNotFound
+	}
+
+	return nil
+}
+
+// DeleteAccessTokens revokes every access token of a user
+func (r *AccessTokenRepository) DeleteAccessTokens(ctx context.Context, userID string) (int64, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.tokens.DeleteMany(ctx, bson.M{"user_id": ownerID})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// CreateIndexes creates necessary indexes for access tokens. Tokens are
+// removed by a TTL index once they expire.
+func (r *AccessTokenRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "verifier", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
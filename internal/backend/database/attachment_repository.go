@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	attachmentsCollection     = "attachments"
+	attachmentUsageCollection = "attachment_usage"
+)
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrQuotaExceeded      = errors.New("attachment storage quota exceeded")
+)
+
+// AttachmentRepository handles attachment metadata database operations.
+// The attachment content itself lives in a storage.BlobStore.
+type AttachmentRepository struct {
+	collection *mongo.Collection
+	// usage holds one counter per user of the bytes their attachments reserve
+	usage *mongo.Collection
+}
+
+// NewAttachmentRepository creates a new attachment repository
+func NewAttachmentRepository() *AttachmentRepository {
+	return &AttachmentRepository{
+		collection: GetCollection(attachmentsCollection),
+		usage:      GetCollection(attachmentUsageCollection),
+	}
+}
+
+// CreateAttachment reserves the size of a new pending attachment against
+// the user's quota and stores its metadata in one transaction. It returns
+// ErrQuotaExceeded if the size does not fit.
+func (r *AttachmentRepository) CreateAttachment(ctx context.Context, attachment *models.Attachment, quota int64) error {
+	attachment.ID = bson.NewObjectID()
+	attachment.Status = models.AttachmentPending
+	attachment.ChunkSizes = make([]int64, attachment.ChunkCount)
+	attachment.CreatedAt = time.Now()
+	attachment.UpdatedAt = attachment.CreatedAt
+
+	return withTransaction(ctx, func(ctx context.Context) error {
+		if err := r.reserve(ctx, attachment.UserID, attachment.Size, quota); err != nil {
+			return err
+		}
+
+		_, err := r.collection.InsertOne(ctx, attachment)
+		return err
+	})
+}
+
+// reserve adds size to a user's usage counter unless that would exceed quota.
+// The increment is conditional on the current count, so concurrent uploads
+// cannot both pass the check.
+func (r *AttachmentRepository) reserve(ctx context.Context, userID bson.ObjectID, size, quota int64) error {
+	result, err := r.usage.UpdateOne(ctx,
+		bson.M{"_id": userID, "bytes": bson.M{"$lte": quota - size}},
+		bson.M{"$inc": bson.M{"bytes": size}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	err = r.usage.FindOne(ctx, bson.M{"_id": userID}).Err()
+	if err == nil {
+		return ErrQuotaExceeded
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	// Users whose attachments predate the counter start from their sum
+	used, err := r.sumSizes(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if used+size > quota {
+		return ErrQuotaExceeded
+	}
+	_, err = r.usage.InsertOne(ctx, bson.M{"_id": userID, "bytes": used + size})
+	return err
+}
+
+// GetAttachment retrieves an attachment of an item owned by a user
+func (r *AttachmentRepository) GetAttachment(ctx context.Context, userID string, itemID bson.ObjectID, id string) (*models.Attachment, error) {
+	filter, err := ownedFilter(userID, id, ErrAttachmentNotFound)
+	if err != nil {
+		return nil, err
+	}
+	filter["item_id"] = itemID
+
+	var attachment models.Attachment
+	err = r.collection.FindOne(ctx, filter).Decode(&attachment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// ListAttachments retrieves all attachments of an item
+func (r *AttachmentRepository) ListAttachments(ctx context.Context, itemID bson.ObjectID) ([]*models.Attachment, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"item_id": itemID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	attachments := []*models.Attachment{}
+	if err = cursor.All(ctx, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Usage returns the number of bytes reserved by a user's attachments
+func (r *AttachmentRepository) Usage(ctx context.Context, userID bson.ObjectID) (int64, error) {
+	var counter struct {
+		Bytes int64 `bson:"bytes"`
+	}
+	err := r.usage.FindOne(ctx, bson.M{"_id": userID}).Decode(&counter)
+	if err == nil {
+		return counter.Bytes, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	return r.sumSizes(ctx, userID)
+}
+
+// sumSizes adds up the sizes of a user's attachments
+func (r *AttachmentRepository) sumSizes(ctx context.Context, userID bson.ObjectID) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
+
+// SetChunkSize records the size of an uploaded chunk of a pending attachment
+func (r *AttachmentRepository) SetChunkSize(ctx context.Context, id bson.ObjectID, index int, size int64) error {
+	update := bson.M{
+		"$set": bson.M{
+			fmt.Sprintf("chunk_sizes.%d", index): size,
+			"updated_at":                         time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.AttachmentPending}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+// MarkReady marks a pending attachment as fully uploaded
+func (r *AttachmentRepository) MarkReady(ctx context.Context, id bson.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":     models.AttachmentReady,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.AttachmentPending}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrAttachmentNotFound
+	}
+
+	return nil
+}
+
+// DeleteAttachment removes the metadata of an attachment and releases its
+// size from the user's usage counter
+func (r *AttachmentRepository) DeleteAttachment(ctx context.Context, attachment *models.Attachment) error {
+	return withTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.collection.DeleteOne(ctx, bson.M{"_id": attachment.ID})
+		if err != nil {
+			return err
+		}
+
+		if result.DeletedCount == 0 {
+			return ErrAttachmentNotFound
+		}
+
+		_, err = r.usage.UpdateOne(ctx, bson.M{"_id": attachment.UserID}, bson.M{"$inc": bson.M{"bytes": -attachment.Size}})
+		return err
+	})
+}
+
+// ListOrphaned retrieves attachments whose item no longer exists and pending
+// uploads that were abandoned before staleBefore
+func (r *AttachmentRepository) ListOrphaned(ctx context.Context, staleBefore time.Time) ([]*models.Attachment, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{
+			"from":         vaultItemsCollection,
+			"localField":   "item_id",
+			"foreignField": "_id",
+			"as":           "item",
+		}}},
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"item": bson.M{"$size": 0}},
+			bson.M{"status": models.AttachmentPending, "created_at": bson.M{"$lt": staleBefore}},
+		}}}},
+		{{Key: "$project", Value: bson.M{"item": 0}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	attachments := []*models.Attachment{}
+	if err := cursor.All(ctx, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// CreateIndexes creates necessary indexes for the attachments collection
+func (r *AttachmentRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "item_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
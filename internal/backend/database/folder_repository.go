@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const foldersCollection = "folders"
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderCycle    = errors.New("folder cannot be moved into itself or a descendant")
+	ErrFolderConflict = errors.New("folder was modified concurrently")
+)
+
+// FolderRepository handles folder database operations
+type FolderRepository struct {
+	collection *mongo.Collection
+	items      *mongo.Collection
+	sync       revisionCounter
+}
+
+// NewFolderRepository creates a new folder repository
+func NewFolderRepository() *FolderRepository {
+	return &FolderRepository{
+		collection: GetCollection(foldersCollection),
+		items:      GetCollection(vaultItemsCollection),
+		sync:       newRevisionCounter(),
+	}
+}
+
+// CreateFolder stores a new folder for a user
+func (r *FolderRepository) CreateFolder(ctx context.Context, userID string, folder *models.Folder) error {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	folder.ID = bson.NewObjectID()
+	folder.UserID = ownerID
+	folder.Revision = 1
+	folder.CreatedAt = time.Now()
+	folder.UpdatedAt = folder.CreatedAt
+
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		folder.UserRevision = userRevision
+		_, err := r.collection.InsertOne(ctx, folder)
+		return err
+	})
+	return err
+}
+
+// GetFolder retrieves a single folder owned by a user
+func (r *FolderRepository) GetFolder(ctx context.Context, userID, id string) (*models.Folder, error) {
+	filter, err := ownedFilter(userID, id, ErrFolderNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	var folder models.Folder
+	err = r.collection.FindOne(ctx, filter).Decode(&folder)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+// ListFolders retrieves all folders owned by a user
+func (r *FolderRepository) ListFolders(ctx context.Context, userID string) ([]*models.Folder, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": ownerID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	folders := []*models.Folder{}
+	if err = cursor.All(ctx, &folders); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// ResolveFolderID checks that a folder exists for the user and returns its ID.
+// An empty id resolves to nil, meaning "no folder".
+func (r *FolderRepository) ResolveFolderID(ctx context.Context, userID, id string) (*bson.ObjectID, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	folder, err := r.GetFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder.ID, nil
+}
+
+// UpdateFolder renames and/or moves a folder, refusing to create cycles.
+// A non-zero ifRevision makes it fail with ErrFolderConflict unless the
+// folder is still at that revision.
+func (r *FolderRepository) UpdateFolder(ctx context.Context, userID, id string, update *models.UpdateFolderRequest, ifRevision int64) (*models.Folder, error) {
+	folder, err := r.GetFolder(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if ifRevision != 0 && folder.Revision != ifRevision {
+		return nil, ErrFolderConflict
+	}
+
+	setFields := bson.M{"updated_at": time.Now()}
+	updateDoc := bson.M{
+		"$set": setFields,
+		"$inc": bson.M{"revision": 1},
+	}
+
+	if update.Name != "" {
+		setFields["name"] = update.Name
+	}
+
+	if update.ParentID != nil {
+		parentID, err := r.ResolveFolderID(ctx, userID, *update.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parentID == nil {
+			updateDoc["$unset"] = bson.M{"parent_id": ""}
+		} else {
+			if err := r.checkNoCycle(ctx, folder, *parentID); err != nil {
+				return nil, err
+			}
+			setFields["parent_id"] = parentID
+		}
+	}
+
+	filter := bson.M{"_id": folder.ID, "user_id": folder.UserID}
+	if ifRevision != 0 {
+		filter["revision"] = ifRevision
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedFolder models.Folder
+	_, err = r.sync.stamp(ctx, folder.UserID, func(ctx context.Context, userRevision int64) error {
+		setFields["user_revision"] = userRevision
+		return r.collection.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&updatedFolder)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if ifRevision != 0 {
+				return nil, ErrFolderConflict
+			}
+			return nil, ErrFolderNotFound
+		}
+		return nil, err
+	}
+
+	return &updatedFolder, nil
+}
+
+// DeleteFolder removes a folder. Its items move out of any folder and its
+// subfolders move up to the deleted folder's parent.
+func (r *FolderRepository) DeleteFolder(ctx context.Context, userID, id string) error {
+	folder, err := r.GetFolder(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_, err = r.sync.stamp(ctx, folder.UserID, func(ctx context.Context, userRevision int64) error {
+		childUpdate := bson.M{
+			"$set": bson.M{"user_revision": userRevision, "updated_at": now},
+			"$inc": bson.M{"revision": 1},
+		}
+		if folder.ParentID == nil {
+			childUpdate["$unset"] = bson.M{"parent_id": ""}
+		} else {
+			childUpdate["$set"].(bson.M)["parent_id"] = folder.ParentID
+		}
+		if _, err := r.collection.UpdateMany(ctx, bson.M{"user_id": folder.UserID, "parent_id": folder.ID}, childUpdate); err != nil {
+			return err
+		}
+
+		itemUpdate := bson.M{
+			"$set":   bson.M{"user_revision": userRevision, "updated_at": now},
+			"$unset": bson.M{"folder_id": ""},
+			"$inc":   bson.M{"revision": 1},
+		}
+		if _, err := r.items.UpdateMany(ctx, bson.M{"user_id": folder.UserID, "folder_id": folder.ID}, itemUpdate); err != nil {
+			return err
+		}
+
+		result, err := r.collection.DeleteOne(ctx, bson.M{"_id": folder.ID, "user_id": folder.UserID})
+		if err != nil {
+			return err
+		}
+
+		if result.DeletedCount == 0 {
+			return ErrFolderNotFound
+		}
+
+		return r.sync.bury(ctx, folder.UserID, models.TombstoneFolder, []bson.ObjectID{folder.ID}, userRevision)
+	})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for the folders collection
+func (r *FolderRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "parent_id", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// checkNoCycle walks up from the new parent and fails if it reaches the folder itself
+func (r *FolderRepository) checkNoCycle(ctx context.Context, folder *models.Folder, parentID bson.ObjectID) error {
+	current := &parentID
+	for depth := 0; current != nil; depth++ {
+		if *current == folder.ID || depth > 256 {
+			return ErrFolderCycle
+		}
+
+		var ancestor models.Folder
+		err := r.collection.FindOne(ctx, bson.M{"_id": *current, "user_id": folder.UserID}).Decode(&ancestor)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil
+			}
+			return err
+		}
+		current = ancestor.ParentID
+	}
+
+	return nil
+}
+
+// ownedFilter builds a filter matching a document by ID that belongs to the given user.
+// Malformed document IDs are reported as notFound.
+func ownedFilter(userID, id string, notFound error) (bson.M, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, notFound
+	}
+
+	return bson.M{"_id": objectID, "user_id": ownerID}, nil
+}
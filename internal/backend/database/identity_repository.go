@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	identitiesCollection     = "identities"
+	identityTokensCollection = "identity_tokens"
+)
+
+var (
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityTokenNotFound = errors.New("identity token not found or expired")
+)
+
+// IdentityRepository handles the accounts and tokens of the local identity provider
+type IdentityRepository struct {
+	identities *mongo.Collection
+	tokens     *mongo.Collection
+}
+
+// NewIdentityRepository creates a new identity repository
+func NewIdentityRepository() *IdentityRepository {
+	return &IdentityRepository{
+		identities: GetCollection(identitiesCollection),
+		tokens:     GetCollection(identityTokensCollection),
+	}
+}
+
+// CreateIdentity stores a new identity
+func (r *IdentityRepository) CreateIdentity(ctx context.Context, identity *models.Identity) error {
+	identity.ID = bson.NewObjectID()
+	identity.CreatedAt = time.Now()
+	identity.UpdatedAt = identity.CreatedAt
+
+	_, err := r.identities.InsertOne(ctx, identity)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return nil
+}
+
+// GetIdentityByEmail retrieves an identity by its email
+func (r *IdentityRepository) GetIdentityByEmail(ctx context.Context, email string) (*models.Identity, error) {
+	return r.findIdentity(ctx, bson.M{"email": email})
+}
+
+// GetIdentityByID retrieves an identity by its ID
+func (r *IdentityRepository) GetIdentityByID(ctx context.Context, id string) (*models.Identity, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrIdentityNotFound
+	}
+
+	return r.findIdentity(ctx, bson.M{"_id": objectID})
+}
+
+// ConfirmEmail marks the email of an identity as confirmed
+func (r *IdentityRepository) ConfirmEmail(ctx context.Context, id bson.ObjectID) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"email_confirmed_at": now,
+			"updated_at":         now,
+		},
+	}
+
+	return r.updateIdentity(ctx, id, update)
+}
+
+// SetPasswordHash replaces the password hash of an identity
+func (r *IdentityRepository) SetPasswordHash(ctx context.Context, id bson.ObjectID, passwordHash string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"password_hash": passwordHash,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	return r.updateIdentity(ctx, id, update)
+}
+
+// SetPendingEmail records the address an identity asked to change its email to
+func (r *IdentityRepository) SetPendingEmail(ctx context.Context, id bson.ObjectID, email string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"pending_email": email,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	return r.updateIdentity(ctx, id, update)
+}
+
+// ChangeEmail replaces the email of an identity with its confirmed pending email
+func (r *IdentityRepository) ChangeEmail(ctx context.Context, id bson.ObjectID, email string) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"email":              email,
+			"email_confirmed_at": now,
+			"updated_at":         now,
+		},
+		"$unset": bson.M{"pending_email": ""},
+	}
+
+	err := r.updateIdentity(ctx, id, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateEmail
+	}
+	return err
+}
+
+// CreateToken stores a new identity token
+func (r *IdentityRepository) CreateToken(ctx context.Context, token *models.IdentityToken) error {
+	token.ID = bson.NewObjectID()
+	token.CreatedAt = time.Now()
+
+	_, err := r.tokens.InsertOne(ctx, token)
+	return err
+}
+
+// GetToken retrieves an unexpired token of a type by its hash
+func (r *IdentityRepository) GetToken(ctx context.Context, tokenType, tokenHash string) (*models.IdentityToken, error) {
+	var token models.IdentityToken
+	err := r.tokens.FindOne(ctx, tokenFilter(tokenType, tokenHash)).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrIdentityTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ConsumeToken deletes and returns an unexpired token of a type issued to an
+// identity, so that it can be used only once
+func (r *IdentityRepository) ConsumeToken(ctx context.Context, identityID bson.ObjectID, tokenType, tokenHash string) (*models.IdentityToken, error) {
+	filter := tokenFilter(tokenType, tokenHash)
+	filter["identity_id"] = identityID
+
+	var token models.IdentityToken
+	err := r.tokens.FindOneAndDelete(ctx, filter).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrIdentityTokenNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// DeleteTokens removes every token of a type issued to an identity
+func (r *IdentityRepository) DeleteTokens(ctx context.Context, identityID bson.ObjectID, tokenType string) error {
+	_, err := r.tokens.DeleteMany(ctx, bson.M{"identity_id": identityID, "type": tokenType})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for identities and their tokens.
+// Expired tokens are removed by a TTL index.
+func (r *IdentityRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.identities.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "identity_id", Value: 1}, {Key: "type", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// findIdentity decodes the identity matching filter
+func (r *IdentityRepository) findIdentity(ctx context.Context, filter bson.M) (*models.Identity, error) {
+	var identity models.Identity
+	err := r.identities.FindOne(ctx, filter).Decode(&identity)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// updateIdentity applies update to an identity
+func (r *IdentityRepository) updateIdentity(ctx context.Context, id bson.ObjectID, update bson.M) error {
+	result, err := r.identities.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrIdentityNotFound
+	}
+
+	return nil
+}
+
+// tokenFilter matches an unexpired token of a type by its hash. The TTL
+// monitor runs only once a minute, so expiry is checked here as well.
+func tokenFilter(tokenType, tokenHash string) bson.M {
+	return bson.M{
+		"type":       tokenType,
+		"token_hash": tokenHash,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+}
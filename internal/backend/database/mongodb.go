@@ -62,6 +62,22 @@ func GetClient() *mongo.Client {
 	return client
 }
 
+// withTransaction runs fn in a transaction, retrying it on transient errors.
+// fn must pass the context it is given to its operations so they join the
+// transaction, and must not have side effects outside the database.
+func withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
 // GetCollection returns a collection from the database
 func GetCollection(collectionName string) *mongo.Collection {
 	if database == nil {
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	rateLimitsCollection    = "rate_limits"
+	loginFailuresCollection = "login_failures"
+)
+
+// RateLimitRepository keeps rate limit counters and login failures in MongoDB,
+// so that every backend instance enforces the same limits
+type RateLimitRepository struct {
+	counters *mongo.Collection
+	failures *mongo.Collection
+}
+
+// NewRateLimitRepository creates a new rate limit repository
+func NewRateLimitRepository() *RateLimitRepository {
+	return &RateLimitRepository{
+		counters: GetCollection(rateLimitsCollection),
+		failures: GetCollection(loginFailuresCollection),
+	}
+}
+
+// Hit counts a request against key in the window starting at windowStart and
+// returns the counts of that window and of the one before it
+func (r *RateLimitRepository) Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (current, previous int64, err error) {
+	update := bson.M{
+		"$inc":         bson.M{"count": 1},
+		"$setOnInsert": bson.M{"expires_at": windowStart.Add(2 * window)},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter models.RateLimitCounter
+	err = r.counters.FindOneAndUpdate(ctx, bson.M{"_id": counterID(key, windowStart)}, update, opts).Decode(&counter)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var before models.RateLimitCounter
+	err = r.counters.FindOne(ctx, bson.M{"_id": counterID(key, windowStart.Add(-window))}).Decode(&before)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, 0, err
+	}
+
+	return counter.Count, before.Count, nil
+}
+
+// GetLoginFailures retrieves the failed logins recorded under key
+func (r *RateLimitRepository) GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error) {
+	var failures models.LoginFailures
+	err := r.failures.FindOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&failures)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &models.LoginFailures{ID: key}, nil
+		}
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// RecordLoginFailure counts a failed login under key and keeps the failures
+// until ttl has passed without another one
+func (r *RateLimitRepository) RecordLoginFailure(ctx context.Context, key string, ttl time.Duration) (*models.LoginFailures, error) {
+	now := time.Now()
+
+	// Failures that already expired but were not yet removed start over
+	_, err := r.failures.DeleteOne(ctx, bson.M{"_id": key, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{
+			"last_failure_at": now,
+			"expires_at":      now.Add(ttl),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var failures models.LoginFailures
+	if err := r.failures.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&failures); err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// ResetLoginFailures forgets the failed logins recorded under key
+func (r *RateLimitRepository) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := r.failures.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for rate limiting. Counters and
+// login failures are removed by TTL indexes once they no longer matter.
+func (r *RateLimitRepository) CreateIndexes(ctx context.Context) error {
+	ttl := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	if _, err := r.counters.Indexes().CreateOne(ctx, ttl); err != nil {
+		return err
+	}
+	_, err := r.failures.Indexes().CreateOne(ctx, ttl)
+	return err
+}
+
+// counterID is the document ID of a counter window
+func counterID(key string, windowStart time.Time) string {
+	return key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+}
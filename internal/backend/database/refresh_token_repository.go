@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const refreshTokensCollection = "refresh_tokens"
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found, expired or revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token was already used")
+)
+
+// RefreshTokenRepository handles refresh tokens and their families
+type RefreshTokenRepository struct {
+	tokens *mongo.Collection
+}
+
+// NewRefreshTokenRepository creates a new refresh token repository
+func NewRefreshTokenRepository() *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		tokens: GetCollection(refreshTokensCollection),
+	}
+}
+
+// CreateRefreshToken stores a new refresh token
+func (r *RefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	token.ID = bson.NewObjectID()
+	token.CreatedAt = time.Now()
+
+	_, err := r.tokens.InsertOne(ctx, token)
+	return err
+}
+
+// GetRefreshToken returns an unused, unexpired and unrevoked refresh token.
+// A token that was already used is returned together with
+// ErrRefreshTokenReused so its family can be revoked.
+func (r *RefreshTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := r.tokens.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+
+	switch {
+	case token.RevokedAt != nil || !token.ExpiresAt.After(time.Now()):
+		return nil, ErrRefreshTokenNotFound
+	case token.UsedAt != nil:
+		return &token, ErrRefreshTokenReused
+	}
+	return &token, nil
+}
+
+// RotateRefreshToken marks a refresh token as used and stores its successor
+// in one transaction, so that the token is only spent once the next one
+// exists. It returns ErrRefreshTokenReused if the token was used meanwhile.
+func (r *RefreshTokenRepository) RotateRefreshToken(ctx context.Context, usedID bson.ObjectID, next *models.RefreshToken) error {
+	next.ID = bson.NewObjectID()
+	next.CreatedAt = time.Now()
+
+	return withTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.tokens.UpdateOne(ctx, bson.M{
+			"_id":        usedID,
+			"used_at":    bson.M{"$exists": false},
+			"revoked_at": bson.M{"$exists": false},
+		}, bson.M{"$set": bson.M{"used_at": next.CreatedAt}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		_, err = r.tokens.InsertOne(ctx, next)
+		return err
+	})
+}
+
+// RevokeRefreshTokenFamily revokes every token of a family, ending the
+// session it was issued for
+func (r *RefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID bson.ObjectID) error {
+	filter := bson.M{
+		"family_id":  familyID,
+		"revoked_at": bson.M{"$exists": false},
+	}
+
+	_, err := r.tokens.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for refresh tokens. Used tokens are
+// kept until they expire so that replaying them is detected; a TTL index
+// removes them afterwards.
+func (r *RefreshTokenRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.tokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "family_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
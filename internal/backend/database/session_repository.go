@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const sessionsCollection = "sessions"
+
+var ErrSessionNotFound = errors.New("session not found, expired or revoked")
+
+// SessionRepository handles the login sessions of users
+type SessionRepository struct {
+	sessions *mongo.Collection
+}
+
+// NewSessionRepository creates a new session repository
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{
+		sessions: GetCollection(sessionsCollection),
+	}
+}
+
+// CreateSession stores a new session
+func (r *SessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	session.ID = bson.NewObjectID()
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+
+	_, err := r.sessions.InsertOne(ctx, session)
+	return err
+}
+
+// GetSession retrieves an active session by its ID
+func (r *SessionRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	filter := activeSessionFilter()
+	filter["_id"] = objectID
+
+	var session models.Session
+	err = r.sessions.FindOne(ctx, filter).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetSessionUser retrieves an active session together with its user in a
+// single query, for authenticating each request of the session
+func (r *SessionRepository) GetSessionUser(ctx context.Context, id string) (*models.Session, *models.User, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil, ErrSessionNotFound
+	}
+
+	filter := activeSessionFilter()
+	filter["_id"] = objectID
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         usersCollection,
+			"localField":   "user_id",
+			"foreignField": "_id",
+			"as":           "user",
+		}}},
+	}
+
+	cursor, err := r.sessions.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		models.Session `bson:",inline"`
+		User           []models.User `bson:"user"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, nil, ErrSessionNotFound
+	}
+	if len(result[0].User) == 0 {
+		return nil, nil, ErrUserNotFound
+	}
+	return &result[0].Session, &result[0].User[0], nil
+}
+
+// ListSessions retrieves the active sessions of a user, most recently seen first
+func (r *SessionRepository) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := activeSessionFilter()
+	filter["user_id"] = ownerID
+
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := r.sessions.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records that a session was just used from an IP address
+func (r *SessionRepository) TouchSession(ctx context.Context, id bson.ObjectID, ip string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"last_seen_at": time.Now(),
+			"ip":           ip,
+		},
+	}
+
+	return r.updateSession(ctx, id, update)
+}
+
+// ExtendSession records a refresh of a session, which keeps it alive until
+// the new refresh token expires
+func (r *SessionRepository) ExtendSession(ctx context.Context, id bson.ObjectID, ip string, expiresAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"last_seen_at": time.Now(),
+			"ip":           ip,
+			"expires_at":   expiresAt,
+		},
+	}
+
+	return r.updateSession(ctx, id, update)
+}
+
+// RevokeSession revokes an active session of a user
+func (r *SessionRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	filter := activeSessionFilter()
+	filter["_id"] = objectID
+	filter["user_id"] = ownerID
+
+	result, err := r.sessions.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every active session of a user except keepID,
+// which may be empty to revoke them all, and returns the revoked session IDs
+func (r *SessionRepository) RevokeOtherSessions(ctx context.Context, userID, keepID string) ([]bson.ObjectID, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := activeSessionFilter()
+	filter["user_id"] = ownerID
+	if keepID != "" {
+		keep, err := bson.ObjectIDFromHex(keepID)
+		if err != nil {
+			return nil, err
+		}
+		filter["_id"] = bson.M{"$ne": keep}
+	}
+
+	cursor, err := r.sessions.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]bson.ObjectID, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+	if _, err := r.sessions.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, update); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// CreateIndexes creates necessary indexes for sessions. Sessions are removed
+// by a TTL index once their last refresh token has expired.
+func (r *SessionRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// updateSession applies update to an active session
+func (r *SessionRepository) updateSession(ctx context.Context, id bson.ObjectID, update bson.M) error {
+	filter := activeSessionFilter()
+	filter["_id"] = id
+
+	result, err := r.sessions.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// activeSessionFilter matches sessions that are neither revoked nor expired.
+// The TTL monitor runs only once a minute, so expiry is checked here as well.
+func activeSessionFilter() bson.M {
+	return bson.M{
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const signingKeysCollection = "signing_keys"
+
+// SigningKeyRepository handles the token signing keys shared by all backend instances
+type SigningKeyRepository struct {
+	keys *mongo.Collection
+}
+
+// NewSigningKeyRepository creates a new signing key repository
+func NewSigningKeyRepository() *SigningKeyRepository {
+	return &SigningKeyRepository{
+		keys: GetCollection(signingKeysCollection),
+	}
+}
+
+// CreateSigningKey stores a new signing key
+func (r *SigningKeyRepository) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	key.ID = bson.NewObjectID()
+	key.CreatedAt = time.Now()
+
+	_, err := r.keys.InsertOne(ctx, key)
+	return err
+}
+
+// ListSigningKeys retrieves the signing keys that have not expired, oldest first
+func (r *SigningKeyRepository) ListSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	filter := bson.M{"expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "active_at", Value: 1}})
+
+	cursor, err := r.keys.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []*models.SigningKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// CreateIndexes creates necessary indexes for signing keys. Keys are removed
+// by a TTL index once no token they signed can still be valid.
+func (r *SigningKeyRepository) CreateIndexes(ctx context.Context) error {
+	_, err := r.keys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
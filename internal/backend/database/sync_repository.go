@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const tombstonesCollection = "tombstones"
+
+// revisionCounter hands out per-user vault revisions and records tombstones.
+// Every write to a synced entity stamps it with a fresh revision so clients
+// can ask for everything that changed after the last revision they saw.
+type revisionCounter struct {
+	users      *mongo.Collection
+	tombstones *mongo.Collection
+}
+
+// newRevisionCounter creates a revision counter for the repositories that write synced entities
+func newRevisionCounter() revisionCounter {
+	return revisionCounter{
+		users:      GetCollection(usersCollection),
+		tombstones: GetCollection(tombstonesCollection),
+	}
+}
+
+// stamp runs write with a fresh revision of the user's vault, in the same
+// transaction as the bump of the revision, and notifies the user's connected
+// clients once it committed. A sync that sees the new revision therefore also
+// sees everything stamped with it, and concurrent writes of a user queue up
+// behind the one holding the revision.
+func (c revisionCounter) stamp(ctx context.Context, userID bson.ObjectID, write func(ctx context.Context, revision int64) error) (int64, error) {
+	var revision int64
+	err := withTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if revision, err = c.next(ctx, userID); err != nil {
+			return err
+		}
+		return write(ctx, revision)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	events.Publish(userID.Hex(), events.Event{Type: events.VaultChanged, Revision: revision})
+	return revision, nil
+}
+
+// next bumps the user's vault revision and returns the new value
+func (c revisionCounter) next(ctx context.Context, userID bson.ObjectID) (int64, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"revision": 1})
+
+	var user struct {
+		Revision int64 `bson:"revision"`
+	}
+	err := c.users.FindOneAndUpdate(ctx, bson.M{"_id": userID}, bson.M{"$inc": bson.M{"revision": 1}}, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return user.Revision, nil
+}
+
+// bury records tombstones for permanently deleted entities of a user
+func (c revisionCounter) bury(ctx context.Context, userID bson.ObjectID, kind string, ids []bson.ObjectID, revision int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	tombstones := make([]*models.Tombstone, len(ids))
+	for i, id := range ids {
+		tombstones[i] = &models.Tombstone{
+			ID:           bson.NewObjectID(),
+			UserID:       userID,
+			Kind:         kind,
+			EntityID:     id,
+			UserRevision: revision,
+			DeletedAt:    now,
+		}
+	}
+
+	_, err := c.tombstones.InsertMany(ctx, tombstones)
+	return err
+}
+
+// SyncChanges holds everything that changed in a user's vault after a revision
+type SyncChanges struct {
+	Revision int64
+	// Full is set when the changes are the whole vault rather than a delta
+	Full       bool
+	Items      []*models.VaultItem
+	Folders    []*models.Folder
+	Tags       []*models.Tag
+	Tombstones []*models.Tombstone
+}
+
+// SyncRepository reads vault changes for delta sync
+type SyncRepository struct {
+	users      *mongo.Collection
+	items      *mongo.Collection
+	folders    *mongo.Collection
+	tags       *mongo.Collection
+	tombstones *mongo.Collection
+}
+
+// NewSyncRepository creates a new sync repository
+func NewSyncRepository() *SyncRepository {
+	return &SyncRepository{
+		users:      GetCollection(usersCollection),
+		items:      GetCollection(vaultItemsCollection),
+		folders:    GetCollection(foldersCollection),
+		tags:       GetCollection(tagsCollection),
+		tombstones: GetCollection(tombstonesCollection),
+	}
+}
+
+// CurrentRevision returns the latest vault revision of a user
+func (r *SyncRepository) CurrentRevision(ctx context.Context, userID string) (int64, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := r.revisions(ctx, ownerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return user.Revision, nil
+}
+
+// revisions reads the latest vault revision of a user and the newest one
+// whose tombstones were pruned
+func (r *SyncRepository) revisions(ctx context.Context, ownerID bson.ObjectID) (*models.User, error) {
+	opts := options.FindOne().SetProjection(bson.M{"revision": 1, "pruned_revision": 1})
+
+	var user models.User
+	err := r.users.FindOne(ctx, bson.M{"_id": ownerID}, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Changes retrieves the items (including trashed ones), folders, tags and
+// tombstones of a user written after the since revision. A since of 0, or one
+// older than the pruned tombstones, returns the whole vault without tombstones.
+func (r *SyncRepository) Changes(ctx context.Context, userID string, since int64) (*SyncChanges, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the revision first so that writes landing while the changes are
+	// collected are returned again on the next sync rather than skipped.
+	// Writes commit together with their revision, so none stamped with it
+	// or earlier can still be missing.
+	user, err := r.revisions(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	revision := user.Revision
+
+	// The deletions a client this far behind missed may be gone
+	if since < user.PrunedRevision {
+		since = 0
+	}
+
+	filter := bson.M{"user_id": ownerID}
+	if since > 0 {
+		filter["user_revision"] = bson.M{"$gt": since}
+	}
+
+	changes := &SyncChanges{
+		Revision:   revision,
+		Full:       since == 0,
+		Items:      []*models.VaultItem{},
+		Folders:    []*models.Folder{},
+		Tags:       []*models.Tag{},
+		Tombstones: []*models.Tombstone{},
+	}
+
+	if err := findAll(ctx, r.items, filter, &changes.Items); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, r.folders, filter, &changes.Folders); err != nil {
+		return nil, err
+	}
+	if err := findAll(ctx, r.tags, filter, &changes.Tags); err != nil {
+		return nil, err
+	}
+	if since > 0 {
+		if err := findAll(ctx, r.tombstones, filter, &changes.Tombstones); err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// PruneTombstones deletes the tombstones recorded before a time. Each user
+// whose tombstones go first records the newest revision among them, so that
+// clients that synced before it get the whole vault instead of a delta that
+// misses those deletions.
+func (r *SyncRepository) PruneTombstones(ctx context.Context, before time.Time) (int64, error) {
+	cursor, err := r.tombstones.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"deleted_at": bson.M{"$lt": before}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$user_id", "revision": bson.M{"$max": "$user_revision"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned []struct {
+		UserID   bson.ObjectID `bson:"_id"`
+		Revision int64         `bson:"revision"`
+	}
+	if err := cursor.All(ctx, &pruned); err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, p := range pruned {
+		if _, err := r.users.UpdateOne(ctx, bson.M{"_id": p.UserID}, bson.M{"$max": bson.M{"pruned_revision": p.Revision}}); err != nil {
+			return deleted, err
+		}
+
+		result, err := r.tombstones.DeleteMany(ctx, bson.M{"user_id": p.UserID, "user_revision": bson.M{"$lte": p.Revision}})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += result.DeletedCount
+	}
+
+	return deleted, nil
+}
+
+// CreateIndexes creates necessary indexes for delta sync lookups
+func (r *SyncRepository) CreateIndexes(ctx context.Context) error {
+	byRevision := mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "user_revision", Value: 1}},
+	}
+
+	for _, collection := range []*mongo.Collection{r.items, r.folders, r.tags, r.tombstones} {
+		if _, err := collection.Indexes().CreateOne(ctx, byRevision); err != nil {
+			return err
+		}
+	}
+
+	_, err := r.tombstones.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "deleted_at", Value: 1}},
+	})
+	return err
+}
+
+// findAll decodes every document matching filter, in revision order, into results
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, results any) error {
+	opts := options.Find().SetSort(bson.D{{Key: "user_revision", Value: 1}})
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	return cursor.All(ctx, results)
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const tagsCollection = "tags"
+
+var (
+	ErrTagNotFound = errors.New("tag not found")
+)
+
+// TagRepository handles tag database operations
+type TagRepository struct {
+	collection *mongo.Collection
+	items      *mongo.Collection
+	sync       revisionCounter
+}
+
+// NewTagRepository creates a new tag repository
+func NewTagRepository() *TagRepository {
+	return &TagRepository{
+		collection: GetCollection(tagsCollection),
+		items:      GetCollection(vaultItemsCollection),
+		sync:       newRevisionCounter(),
+	}
+}
+
+// CreateTag stores a new tag for a user
+func (r *TagRepository) CreateTag(ctx context.Context, userID string, tag *models.Tag) error {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	tag.ID = bson.NewObjectID()
+	tag.UserID = ownerID
+	tag.Revision = 1
+	tag.CreatedAt = time.Now()
+	tag.UpdatedAt = tag.CreatedAt
+
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		tag.UserRevision = userRevision
+		_, err := r.collection.InsertOne(ctx, tag)
+		return err
+	})
+	return err
+}
+
+// ListTags retrieves all tags owned by a user
+func (r *TagRepository) ListTags(ctx context.Context, userID string) ([]*models.Tag, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.findTags(ctx, bson.M{"user_id": ownerID})
+}
+
+// ListFolderTags retrieves the tags of a user that are assigned to active
+// items in the given folders
+func (r *TagRepository) ListFolderTags(ctx context.Context, userID string, folderIDs []bson.ObjectID) ([]*models.Tag, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tagIDs []bson.ObjectID
+	err = r.items.Distinct(ctx, "tag_ids", bson.M{
+		"user_id":    ownerID,
+		"folder_id":  bson.M{"$in": folderIDs},
+		"deleted_at": notDeleted,
+	}).Decode(&tagIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(tagIDs) == 0 {
+		return []*models.Tag{}, nil
+	}
+
+	return r.findTags(ctx, bson.M{"user_id": ownerID, "_id": bson.M{"$in": tagIDs}})
+}
+
+// findTags retrieves the tags matching filter, oldest first
+func (r *TagRepository) findTags(ctx context.Context, filter bson.M) ([]*models.Tag, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tags := []*models.Tag{}
+	if err = cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// ResolveTagIDs checks that all tags exist for the user and returns their IDs
+func (r *TagRepository) ResolveTagIDs(ctx context.Context, userID string, ids []string) ([]bson.ObjectID, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[bson.ObjectID]bool, len(ids))
+	tagIDs := make([]bson.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectID, err := bson.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, ErrTagNotFound
+		}
+		if !seen[objectID] {
+			seen[objectID] = true
+			tagIDs = append(tagIDs, objectID)
+		}
+	}
+
+	if len(tagIDs) == 0 {
+		return tagIDs, nil
+	}
+
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": bson.M{"$in": tagIDs}, "user_id": ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	if count != int64(len(tagIDs)) {
+		return nil, ErrTagNotFound
+	}
+
+	return tagIDs, nil
+}
+
+// UpdateTag renames a tag
+func (r *TagRepository) UpdateTag(ctx context.Context, userID, id, name string) (*models.Tag, error) {
+	filter, err := ownedFilter(userID, id, ErrTagNotFound)
+	if err != nil {
+		return nil, err
+	}
+
+	setFields := bson.M{
+		"name":       name,
+		"updated_at": time.Now(),
+	}
+	update := bson.M{
+		"$set": setFields,
+		"$inc": bson.M{"revision": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedTag models.Tag
+	_, err = r.sync.stamp(ctx, filter["user_id"].(bson.ObjectID), func(ctx context.Context, userRevision int64) error {
+		setFields["user_revision"] = userRevision
+		return r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedTag)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrTagNotFound
+		}
+		return nil, err
+	}
+
+	return &updatedTag, nil
+}
+
+// DeleteTag removes a tag and detaches it from every item
+func (r *TagRepository) DeleteTag(ctx context.Context, userID, id string) error {
+	filter, err := ownedFilter(userID, id, ErrTagNotFound)
+	if err != nil {
+		return err
+	}
+
+	ownerID := filter["user_id"].(bson.ObjectID)
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		result, err := r.collection.DeleteOne(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		if result.DeletedCount == 0 {
+			return ErrTagNotFound
+		}
+
+		itemUpdate := bson.M{
+			"$set":  bson.M{"user_revision": userRevision, "updated_at": time.Now()},
+			"$pull": bson.M{"tag_ids": filter["_id"]},
+			"$inc":  bson.M{"revision": 1},
+		}
+		if _, err := r.items.UpdateMany(ctx, bson.M{"user_id": ownerID, "tag_ids": filter["_id"]}, itemUpdate); err != nil {
+			return err
+		}
+
+		return r.sync.bury(ctx, ownerID, models.TombstoneTag, []bson.ObjectID{filter["_id"].(bson.ObjectID)}, userRevision)
+	})
+	return err
+}
+
+// CreateIndexes creates necessary indexes for the tags collection
+func (r *TagRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+
+	_, err := r.collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
@@ -16,6 +16,16 @@ const usersCollection = "users"
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrDuplicateEmail    = errors.New("email already exists")
+	ErrVaultKeysExist    = errors.New("vault keys already initialized")
+	ErrVaultKeysChanged  = errors.New("vault keys were changed concurrently")
+	ErrAuthKDFExists     = errors.New("login credential derivation already set")
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication not enabled")
+	ErrMFACodeUsed         = errors.New("two-factor code already used")
+	ErrMFAChallengeInvalid = errors.New("two-factor challenge invalid or already used")
 )
 
 // UserRepository handles user database operations
@@ -125,6 +135,474 @@ func (r *UserRepository) UpdateEmailVerified(ctx context.Context, id string, ver
 	return nil
 }
 
+// SetPendingEmail records the address a user asked to change their email to
+func (r *UserRepository) SetPendingEmail(ctx context.Context, id, email string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"pending_email": email,
+			"updated_at":    time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// ChangeEmail replaces the email of a user with an address the identity
+// provider confirmed, and clears the pending change
+func (r *UserRepository) ChangeEmail(ctx context.Context, id, email string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"email":          email,
+			"email_verified": true,
+			"updated_at":     time.Now(),
+		},
+		"$unset": bson.M{"pending_email": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// InitVaultKeys stores the user's vault key material if none is set yet
+func (r *UserRepository) InitVaultKeys(ctx context.Context, id string, keys *models.VaultKeys) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"keys":       keys,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "keys": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrVaultKeysExist
+	}
+
+	return nil
+}
+
+// ClearVaultKeys removes the user's vault key material and recovery key, so
+// the next login sets up a new vault key with InitVaultKeys
+func (r *UserRepository) ClearVaultKeys(ctx context.Context, id string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"keys": "", "recovery": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// InitAuthKDF records how the user's login credential is derived if nothing
+// is recorded yet
+func (r *UserRepository) InitAuthKDF(ctx context.Context, id string, authKDF *models.AuthKDF) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"auth":       authKDF,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "auth": bson.M{"$exists": false}}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrAuthKDFExists
+	}
+
+	return nil
+}
+
+// ClearAuthKDF returns the user to logging in with the master password itself
+func (r *UserRepository) ClearAuthKDF(ctx context.Context, id string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"auth": ""},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SwapVaultKeys replaces the user's vault key material, but only if the
+// currently stored wrapped key is still the one the caller based its change on
+func (r *UserRepository) SwapVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"keys":       keys,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "keys.wrapped_vault_key": currentWrappedKey}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrVaultKeysChanged
+	}
+
+	return nil
+}
+
+// RotateVaultKeys swaps the vault keys like SwapVaultKeys and bumps the
+// session version in the same update, so that a password change cannot leave
+// older tokens valid. It returns the new session version.
+func (r *UserRepository) RotateVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) (int64, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"keys":       keys,
+			"updated_at": time.Now(),
+		},
+		"$inc": bson.M{"session_version": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user models.User
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID, "keys.wrapped_vault_key": currentWrappedKey}, update, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if _, err := r.GetUserByID(ctx, id); err != nil {
+				return 0, err
+			}
+			return 0, ErrVaultKeysChanged
+		}
+		return 0, err
+	}
+
+	return user.SessionVersion, nil
+}
+
+// RevokeSessions bumps the user's session version, invalidating every token
+// issued before, and returns the new version
+func (r *UserRepository) RevokeSessions(ctx context.Context, id string) (int64, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"session_version": 1},
+		"$set": bson.M{"updated_at": time.Now()},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user models.User
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return user.SessionVersion, nil
+}
+
+// SetRecoveryKeys replaces the user's recovery material, which invalidates
+// the previous recovery key
+func (r *UserRepository) SetRecoveryKeys(ctx context.Context, id string, recovery *models.RecoveryKeys) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"recovery":   recovery,
+			"updated_at": time.Now(),
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// SetPendingTOTP stores a TOTP secret awaiting confirmation, replacing any
+// earlier unconfirmed one. It fails once TOTP is enabled.
+func (r *UserRepository) SetPendingTOTP(ctx context.Context, id, secret string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.totp_secret": secret,
+			"updated_at":      time.Now(),
+		},
+	}
+
+	return r.updateMFA(ctx, id, bson.M{"mfa.totp_enabled": bson.M{"$ne": true}}, update, ErrMFAAlreadyEnabled)
+}
+
+// EnableTOTP turns on TOTP for the pending secret, recording the step of the
+// confirming code. Non-nil backupCodes replace the backup code hashes.
+func (r *UserRepository) EnableTOTP(ctx context.Context, id, secret string, step int64, backupCodes []string) error {
+	now := time.Now()
+	set := bson.M{
+		"mfa.totp_enabled":    true,
+		"mfa.last_totp_step":  step,
+		"mfa.totp_enabled_at": now,
+		"updated_at":          now,
+	}
+	if backupCodes != nil {
+		set["mfa.backup_codes"] = backupCodes
+	}
+
+	filter := bson.M{"mfa.totp_enabled": bson.M{"$ne": true}, "mfa.totp_secret": secret}
+	return r.updateMFA(ctx, id, filter, bson.M{"$set": set}, ErrMFAAlreadyEnabled)
+}
+
+// DisableTOTP removes the TOTP secret. When no security key is registered
+// either, the backup codes and any pending challenge go with it.
+func (r *UserRepository) DisableTOTP(ctx context.Context, id string) error {
+	keepMFA := bson.M{
+		"$set":   bson.M{"mfa.totp_enabled": false, "updated_at": time.Now()},
+		"$unset": bson.M{"mfa.totp_secret": "", "mfa.totp_enabled_at": ""},
+	}
+	err := r.updateMFA(ctx, id, bson.M{"mfa.totp_enabled": true, "mfa.webauthn": true}, keepMFA, ErrMFANotEnabled)
+	if !errors.Is(err, ErrMFANotEnabled) {
+		return err
+	}
+
+	dropMFA := bson.M{
+		"$unset": bson.M{"mfa": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	return r.updateMFA(ctx, id, bson.M{"mfa.totp_enabled": true}, dropMFA, ErrMFANotEnabled)
+}
+
+// SetWebAuthnMFA records whether the user has security keys registered. When
+// the last one goes and TOTP is off as well, the backup codes go with it.
+// Non-nil backupCodes replace the backup code hashes when enabling.
+func (r *UserRepository) SetWebAuthnMFA(ctx context.Context, id string, enabled bool, backupCodes []string) error {
+	if enabled {
+		set := bson.M{"mfa.webauthn": true, "updated_at": time.Now()}
+		if backupCodes != nil {
+			set["mfa.backup_codes"] = backupCodes
+		}
+		return r.updateMFA(ctx, id, bson.M{}, bson.M{"$set": set}, ErrUserNotFound)
+	}
+
+	keepMFA := bson.M{
+		"$set": bson.M{"mfa.webauthn": false, "updated_at": time.Now()},
+	}
+	err := r.updateMFA(ctx, id, bson.M{"mfa.totp_enabled": true}, keepMFA, ErrMFANotEnabled)
+	if !errors.Is(err, ErrMFANotEnabled) {
+		return err
+	}
+
+	dropMFA := bson.M{
+		"$unset": bson.M{"mfa": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}
+	return r.updateMFA(ctx, id, bson.M{}, dropMFA, ErrUserNotFound)
+}
+
+// SetBackupCodes replaces the backup code hashes, invalidating unused codes
+func (r *UserRepository) SetBackupCodes(ctx context.Context, id string, backupCodes []string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"mfa.backup_codes": backupCodes,
+			"updated_at":       time.Now(),
+		},
+	}
+
+	return r.updateMFA(ctx, id, mfaEnabledFilter(), update, ErrMFANotEnabled)
+}
+
+// UseTOTPStep records that a TOTP code of the given time step was accepted.
+// It fails with ErrMFACodeUsed if that step or a later one was already used.
+func (r *UserRepository) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	update := bson.M{
+		"$set": bson.M{"mfa.last_totp_step": step},
+	}
+
+	filter := bson.M{"mfa.totp_enabled": true, "mfa.last_totp_step": bson.M{"$lt": step}}
+	return r.updateMFA(ctx, id, filter, update, ErrMFACodeUsed)
+}
+
+// UseBackupCode removes a backup code hash, failing with ErrMFACodeUsed if it is not an unused code
+func (r *UserRepository) UseBackupCode(ctx context.Context, id, codeHash string) error {
+	update := bson.M{
+		"$pull": bson.M{"mfa.backup_codes": codeHash},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	return r.updateMFA(ctx, id, bson.M{"mfa.backup_codes": codeHash}, update, ErrMFACodeUsed)
+}
+
+// SetMFAChallenge starts a login challenge, replacing any earlier one
+func (r *UserRepository) SetMFAChallenge(ctx context.Context, id string, challenge *models.MFAChallenge) error {
+	update := bson.M{
+		"$set": bson.M{"mfa.challenge": challenge},
+	}
+
+	return r.updateMFA(ctx, id, mfaEnabledFilter(), update, ErrMFANotEnabled)
+}
+
+// FailMFAChallenge counts a wrong code against a challenge and returns the
+// number of failures so far
+func (r *UserRepository) FailMFAChallenge(ctx context.Context, id, challengeID string) (int, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{
+		"$inc": bson.M{"mfa.challenge.failures": 1},
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var user models.User
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID, "mfa.challenge.id": challengeID}, update, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, ErrMFAChallengeInvalid
+		}
+		return 0, err
+	}
+
+	return user.MFA.Challenge.Failures, nil
+}
+
+// ConsumeMFAChallenge ends a challenge. Only one caller succeeds for a given
+// challenge, so an MFA token cannot be exchanged twice.
+func (r *UserRepository) ConsumeMFAChallenge(ctx context.Context, id, challengeID string) error {
+	update := bson.M{
+		"$unset": bson.M{"mfa.challenge": ""},
+	}
+
+	return r.updateMFA(ctx, id, bson.M{"mfa.challenge.id": challengeID}, update, ErrMFAChallengeInvalid)
+}
+
+// updateMFA applies an update to the user if it also matches filter. When
+// only the filter fails to match, it returns errNoMatch.
+func (r *UserRepository) updateMFA(ctx context.Context, id string, filter, update bson.M, errNoMatch error) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	filter["_id"] = objectID
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return err
+		}
+		return errNoMatch
+	}
+
+	return nil
+}
+
+// mfaEnabledFilter matches users with any second factor enabled
+func mfaEnabledFilter() bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"mfa.totp_enabled": true},
+		bson.M{"mfa.webauthn": true},
+	}}
+}
+
 // GetAllUsers retrieves all users with pagination
 func (r *UserRepository) GetAllUsers(ctx context.Context, page, limit int64) ([]*models.User, error) {
 	skip := (page - 1) * limit
@@ -163,9 +641,6 @@ func (r *UserRepository) UpdateUser(ctx context.Context, id string, update *mode
 
 	setFields := updateDoc["$set"].(bson.M)
 
-	if update.Email != "" {
-		setFields["email"] = update.Email
-	}
 	if update.IsActive != nil {
 		setFields["is_active"] = *update.IsActive
 	}
@@ -183,11 +658,6 @@ func (r *UserRepository) UpdateUser(ctx context.Context, id string, update *mode
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrUserNotFound
 		}
-		if mongo.IsDuplicateKeyError(err) {
-			if containsField(err.Error(), "email") {
-				return nil, ErrDuplicateEmail
-			}
-		}
 		return nil, err
 	}
 
@@ -0,0 +1,699 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	vaultItemsCollection         = "vault_items"
+	vaultItemRevisionsCollection = "vault_item_revisions"
+)
+
+var (
+	ErrVaultItemNotFound = errors.New("vault item not found")
+	ErrRevisionNotFound  = errors.New("vault item revision not found")
+	ErrVaultItemConflict = errors.New("vault item was modified concurrently")
+	ErrVaultItemExists   = errors.New("vault item with this client ID already exists")
+)
+
+// notDeleted matches items that are not in the trash
+var notDeleted = bson.M{"$exists": false}
+
+// VaultItemUpdate describes a change to a vault item's ciphertext and organisation.
+// Folder and tag assignments are only touched when SetFolder or SetTags is true.
+// A non-zero IfRevision makes the update fail with ErrVaultItemConflict unless
+// the item is still at that revision.
+type VaultItemUpdate struct {
+	IfRevision int64
+	Type       string
+	Data       string
+	SetFolder  bool
+	FolderID   *bson.ObjectID
+	SetTags    bool
+	TagIDs     []bson.ObjectID
+	// InFolders limits the update to items in these folders; items elsewhere
+	// are reported as not found. Empty allows any item.
+	InFolders []bson.ObjectID
+}
+
+// VaultItemRepository handles vault item database operations
+type VaultItemRepository struct {
+	collection     *mongo.Collection
+	revisions      *mongo.Collection
+	folders        *mongo.Collection
+	tags           *mongo.Collection
+	sync           revisionCounter
+	retention      int
+	trashRetention time.Duration
+}
+
+// NewVaultItemRepository creates a new vault item repository
+func NewVaultItemRepository() *VaultItemRepository {
+	return &VaultItemRepository{
+		collection:     GetCollection(vaultItemsCollection),
+		revisions:      GetCollection(vaultItemRevisionsCollection),
+		folders:        GetCollection(foldersCollection),
+		tags:           GetCollection(tagsCollection),
+		sync:           newRevisionCounter(),
+		retention:      config.VaultRevisionRetention,
+		trashRetention: time.Duration(config.VaultTrashRetentionDays) * 24 * time.Hour,
+	}
+}
+
+// CreateItem stores a new vault item for a user
+func (r *VaultItemRepository) CreateItem(ctx context.Context, userID string, item *models.VaultItem) error {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return err
+	}
+
+	item.ID = bson.NewObjectID()
+	item.UserID = ownerID
+	item.Revision = 1
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = item.CreatedAt
+
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		item.UserRevision = userRevision
+		_, err := r.collection.InsertOne(ctx, item)
+		if mongo.IsDuplicateKeyError(err) && item.ClientID != "" {
+			return ErrVaultItemExists
+		}
+		return err
+	})
+	return err
+}
+
+// GetItemByClientID retrieves a vault item, in the trash or not, by the
+// client ID it was created with
+func (r *VaultItemRepository) GetItemByClientID(ctx context.Context, userID, clientID string) (*models.VaultItem, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrVaultItemNotFound
+	}
+
+	var item models.VaultItem
+	err = r.collection.FindOne(ctx, bson.M{"user_id": ownerID, "client_id": clientID}).Decode(&item)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrVaultItemNotFound
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// GetItem retrieves a single vault item owned by a user
+func (r *VaultItemRepository) GetItem(ctx context.Context, userID, id string) (*models.VaultItem, error) {
+	filter, err := itemFilter(userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.VaultItem
+	err = r.collection.FindOne(ctx, filter).Decode(&item)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrVaultItemNotFound
+		}
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// ListItems retrieves all vault items owned by a user that are not in the trash
+func (r *VaultItemRepository) ListItems(ctx context.Context, userID string) ([]*models.VaultItem, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": ownerID, "deleted_at": notDeleted}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []*models.VaultItem{}
+	if err = cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// UpdateItem replaces the ciphertext of a vault item and bumps its revision.
+// The overwritten version is archived in the item's revision history.
+func (r *VaultItemRepository) UpdateItem(ctx context.Context, userID, id string, update *VaultItemUpdate, sessionID string) (*models.VaultItem, error) {
+	filter, err := itemFilter(userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	setFields := bson.M{
+		"data":       update.Data,
+		"session_id": sessionID,
+		"updated_at": now,
+	}
+	if update.Type != "" {
+		setFields["type"] = update.Type
+	}
+
+	updateDoc := bson.M{
+		"$set": setFields,
+		"$inc": bson.M{"revision": 1},
+	}
+
+	if update.SetFolder {
+		if update.FolderID == nil {
+			updateDoc["$unset"] = bson.M{"folder_id": ""}
+		} else {
+			setFields["folder_id"] = update.FolderID
+		}
+	}
+	if update.SetTags {
+		setFields["tag_ids"] = update.TagIDs
+	}
+
+	if update.IfRevision != 0 {
+		filter["revision"] = update.IfRevision
+	}
+	if len(update.InFolders) > 0 {
+		filter["folder_id"] = bson.M{"$in": update.InFolders}
+	}
+
+	// Return the previous version so it can be archived in the same
+	// transaction, keeping the history in step with the item
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	var previous models.VaultItem
+	userRevision, err := r.sync.stamp(ctx, filter["user_id"].(bson.ObjectID), func(ctx context.Context, userRevision int64) error {
+		setFields["user_revision"] = userRevision
+		if err := r.collection.FindOneAndUpdate(ctx, filter, updateDoc, opts).Decode(&previous); err != nil {
+			return err
+		}
+		return r.archiveRevision(ctx, &previous, now)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if update.IfRevision == 0 {
+				return nil, ErrVaultItemNotFound
+			}
+			// Tell a stale revision apart from a missing item
+			current, err := r.GetItem(ctx, userID, id)
+			if err != nil {
+				return nil, err
+			}
+			if len(update.InFolders) > 0 && (current.FolderID == nil || !slices.Contains(update.InFolders, *current.FolderID)) {
+				return nil, ErrVaultItemNotFound
+			}
+			return nil, ErrVaultItemConflict
+		}
+		return nil, err
+	}
+
+	updatedItem := previous
+	updatedItem.Data = update.Data
+	updatedItem.SessionID = sessionID
+	updatedItem.UpdatedAt = now
+	updatedItem.Revision++
+	updatedItem.UserRevision = userRevision
+	if update.Type != "" {
+		updatedItem.Type = update.Type
+	}
+	if update.SetFolder {
+		updatedItem.FolderID = update.FolderID
+	}
+	if update.SetTags {
+		updatedItem.TagIDs = update.TagIDs
+	}
+
+	return &updatedItem, nil
+}
+
+// ListRevisions retrieves the archived revisions of a vault item, newest first
+func (r *VaultItemRepository) ListRevisions(ctx context.Context, userID, id string) ([]*models.VaultItemRevision, error) {
+	item, err := r.GetItem(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+
+	cursor, err := r.revisions.Find(ctx, bson.M{"item_id": item.ID, "user_id": item.UserID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := []*models.VaultItemRevision{}
+	if err = cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision retrieves a single archived revision of a vault item
+func (r *VaultItemRepository) GetRevision(ctx context.Context, userID, id string, revision int64) (*models.VaultItemRevision, error) {
+	filter, err := itemFilter(userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var rev models.VaultItemRevision
+	err = r.revisions.FindOne(ctx, bson.M{
+		"item_id":  filter["_id"],
+		"user_id":  filter["user_id"],
+		"revision": revision,
+	}).Decode(&rev)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// RestoreRevision makes an archived revision the current version of the item.
+// The version being replaced is archived like any other update; ifRevision
+// guards it the same way as VaultItemUpdate.IfRevision.
+func (r *VaultItemRepository) RestoreRevision(ctx context.Context, userID, id string, revision, ifRevision int64, sessionID string) (*models.VaultItem, error) {
+	rev, err := r.GetRevision(ctx, userID, id, revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.UpdateItem(ctx, userID, id, &VaultItemUpdate{
+		IfRevision: ifRevision,
+		Type:       rev.Type,
+		Data:       rev.Data,
+	}, sessionID)
+}
+
+// MoveItems assigns several active items of a user to a folder (nil for none)
+func (r *VaultItemRepository) MoveItems(ctx context.Context, userID string, ids []string, folderID *bson.ObjectID) (int64, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	itemIDs := make([]bson.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		objectID, err := bson.ObjectIDFromHex(id)
+		if err != nil {
+			return 0, ErrVaultItemNotFound
+		}
+		itemIDs = append(itemIDs, objectID)
+	}
+
+	setFields := bson.M{"updated_at": time.Now()}
+	update := bson.M{
+		"$set": setFields,
+		"$inc": bson.M{"revision": 1},
+	}
+	if folderID == nil {
+		update["$unset"] = bson.M{"folder_id": ""}
+	} else {
+		setFields["folder_id"] = folderID
+	}
+
+	var moved int64
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		setFields["user_revision"] = userRevision
+		result, err := r.collection.UpdateMany(ctx, bson.M{
+			"_id":        bson.M{"$in": itemIDs},
+			"user_id":    ownerID,
+			"deleted_at": notDeleted,
+		}, update)
+		if err != nil {
+			return err
+		}
+		moved = result.ModifiedCount
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return moved, nil
+}
+
+// archiveRevision stores a previous item version and enforces the retention limit
+func (r *VaultItemRepository) archiveRevision(ctx context.Context, previous *models.VaultItem, archivedAt time.Time) error {
+	if r.retention <= 0 {
+		return nil
+	}
+
+	rev := &models.VaultItemRevision{
+		ID:         bson.NewObjectID(),
+		ItemID:     previous.ID,
+		UserID:     previous.UserID,
+		Revision:   previous.Revision,
+		Type:       previous.Type,
+		Data:       previous.Data,
+		SessionID:  previous.SessionID,
+		WrittenAt:  previous.UpdatedAt,
+		ArchivedAt: archivedAt,
+	}
+
+	if _, err := r.revisions.InsertOne(ctx, rev); err != nil {
+		return err
+	}
+
+	// Drop everything older than the newest `retention` revisions
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "revision", Value: -1}}).
+		SetSkip(int64(r.retention - 1))
+
+	var oldestKept models.VaultItemRevision
+	err := r.revisions.FindOne(ctx, bson.M{"item_id": previous.ID}, opts).Decode(&oldestKept)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = r.revisions.DeleteMany(ctx, bson.M{
+		"item_id":  previous.ID,
+		"revision": bson.M{"$lt": oldestKept.Revision},
+	})
+	return err
+}
+
+// TrashItem moves a vault item to the trash and schedules its permanent purge
+func (r *VaultItemRepository) TrashItem(ctx context.Context, userID, id string) (*models.VaultItem, error) {
+	filter, err := itemFilter(userID, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	purgeAt := now.Add(r.trashRetention)
+	setFields := bson.M{
+		"deleted_at": now,
+		"purge_at":   purgeAt,
+		"updated_at": now,
+	}
+	update := bson.M{
+		"$set": setFields,
+		"$inc": bson.M{"revision": 1},
+	}
+
+	return r.findAndUpdate(ctx, filter, update, setFields)
+}
+
+// ListTrash retrieves all vault items of a user that are in the trash
+func (r *VaultItemRepository) ListTrash(ctx context.Context, userID string) ([]*models.VaultItem, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}})
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": ownerID, "deleted_at": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []*models.VaultItem{}
+	if err = cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// RestoreItem moves a vault item out of the trash
+func (r *VaultItemRepository) RestoreItem(ctx context.Context, userID, id string) (*models.VaultItem, error) {
+	filter, err := itemFilter(userID, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	setFields := bson.M{"updated_at": time.Now()}
+	update := bson.M{
+		"$set":   setFields,
+		"$unset": bson.M{"deleted_at": "", "purge_at": ""},
+		"$inc":   bson.M{"revision": 1},
+	}
+
+	return r.findAndUpdate(ctx, filter, update, setFields)
+}
+
+// DeleteItem permanently removes a trashed vault item and its revision history
+func (r *VaultItemRepository) DeleteItem(ctx context.Context, userID, id string) error {
+	filter, err := itemFilter(userID, id, true)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := r.deleteItems(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrVaultItemNotFound
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently removes every trashed vault item of a user
+func (r *VaultItemRepository) EmptyTrash(ctx context.Context, userID string) (int64, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.deleteItems(ctx, bson.M{"user_id": ownerID, "deleted_at": bson.M{"$exists": true}})
+}
+
+// EraseVault permanently removes every vault item of a user, trashed or not,
+// together with the folders and tags, whose names are encrypted with the same
+// vault key. Everything goes in one transaction with its tombstones.
+func (r *VaultItemRepository) EraseVault(ctx context.Context, userID string) (int64, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	_, err = r.sync.stamp(ctx, ownerID, func(ctx context.Context, userRevision int64) error {
+		itemIDs, err := ownedIDs(ctx, r.collection, ownerID)
+		if err != nil {
+			return err
+		}
+		folderIDs, err := ownedIDs(ctx, r.folders, ownerID)
+		if err != nil {
+			return err
+		}
+		tagIDs, err := ownedIDs(ctx, r.tags, ownerID)
+		if err != nil {
+			return err
+		}
+
+		result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": ownerID})
+		if err != nil {
+			return err
+		}
+		if _, err := r.revisions.DeleteMany(ctx, bson.M{"user_id": ownerID}); err != nil {
+			return err
+		}
+		if _, err := r.folders.DeleteMany(ctx, bson.M{"user_id": ownerID}); err != nil {
+			return err
+		}
+		if _, err := r.tags.DeleteMany(ctx, bson.M{"user_id": ownerID}); err != nil {
+			return err
+		}
+		deleted = result.DeletedCount
+
+		if err := r.sync.bury(ctx, ownerID, models.TombstoneItem, itemIDs, userRevision); err != nil {
+			return err
+		}
+		if err := r.sync.bury(ctx, ownerID, models.TombstoneFolder, folderIDs, userRevision); err != nil {
+			return err
+		}
+		return r.sync.bury(ctx, ownerID, models.TombstoneTag, tagIDs, userRevision)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+// ownedIDs returns the IDs of a user's documents in collection
+func ownedIDs(ctx context.Context, collection *mongo.Collection, ownerID bson.ObjectID) ([]bson.ObjectID, error) {
+	cursor, err := collection.Find(ctx, bson.M{"user_id": ownerID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]bson.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+// PurgeExpired permanently removes trashed items whose retention period is over
+func (r *VaultItemRepository) PurgeExpired(ctx context.Context, now time.Time) (int64, error) {
+	return r.deleteItems(ctx, bson.M{"purge_at": bson.M{"$lte": now}})
+}
+
+// findAndUpdate applies an update to a single item, stamping it with a fresh
+// revision through setFields, the $set of the update, and returns the result
+func (r *VaultItemRepository) findAndUpdate(ctx context.Context, filter, update, setFields bson.M) (*models.VaultItem, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updatedItem models.VaultItem
+	_, err := r.sync.stamp(ctx, filter["user_id"].(bson.ObjectID), func(ctx context.Context, userRevision int64) error {
+		setFields["user_revision"] = userRevision
+		return r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedItem)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrVaultItemNotFound
+		}
+		return nil, err
+	}
+
+	return &updatedItem, nil
+}
+
+// deleteItems permanently removes the matching items together with their revisions
+// and leaves a tombstone for each of them in their owner's sync history
+func (r *VaultItemRepository) deleteItems(ctx context.Context, filter bson.M) (int64, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1, "user_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+
+	var matched []struct {
+		ID     bson.ObjectID `bson:"_id"`
+		UserID bson.ObjectID `bson:"user_id"`
+	}
+	if err := cursor.All(ctx, &matched); err != nil {
+		return 0, err
+	}
+
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	byUser := make(map[bson.ObjectID][]bson.ObjectID)
+	for _, m := range matched {
+		byUser[m.UserID] = append(byUser[m.UserID], m.ID)
+	}
+
+	// Each owner's items go in one transaction with their tombstones, so a
+	// sync never misses a deletion
+	var deleted int64
+	for userID, ids := range byUser {
+		var userDeleted int64
+		_, err := r.sync.stamp(ctx, userID, func(ctx context.Context, userRevision int64) error {
+			result, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "user_id": userID})
+			if err != nil {
+				return err
+			}
+			if _, err := r.revisions.DeleteMany(ctx, bson.M{"item_id": bson.M{"$in": ids}}); err != nil {
+				return err
+			}
+			userDeleted = result.DeletedCount
+			return r.sync.bury(ctx, userID, models.TombstoneItem, ids, userRevision)
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += userDeleted
+	}
+
+	return deleted, nil
+}
+
+// CreateIndexes creates necessary indexes for the vault items collection
+func (r *VaultItemRepository) CreateIndexes(ctx context.Context) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "purge_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "folder_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tag_ids", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"client_id": bson.M{"$exists": true}}),
+		},
+	}
+
+	if _, err := r.collection.Indexes().CreateMany(ctx, indexes); err != nil {
+		return err
+	}
+
+	revisionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "item_id", Value: 1}, {Key: "revision", Value: -1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	}
+
+	_, err := r.revisions.Indexes().CreateMany(ctx, revisionIndexes)
+	return err
+}
+
+// itemFilter builds a filter matching an item by ID that belongs to the given user,
+// either among the active items or among those in the trash
+func itemFilter(userID, id string, trashed bool) (bson.M, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrVaultItemNotFound
+	}
+
+	return bson.M{
+		"_id":        objectID,
+		"user_id":    ownerID,
+		"deleted_at": bson.M{"$exists": trashed},
+	}, nil
+}
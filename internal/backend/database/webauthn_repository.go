@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	webauthnCredentialsCollection = "webauthn_credentials"
+	webauthnCeremoniesCollection  = "webauthn_ceremonies"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+	ErrWebAuthnCeremonyNotFound   = errors.New("webauthn ceremony not found or expired")
+)
+
+// WebAuthnRepository handles registered security keys and passkeys and the
+// ceremonies in progress
+type WebAuthnRepository struct {
+	credentials *mongo.Collection
+	ceremonies  *mongo.Collection
+}
+
+// NewWebAuthnRepository creates a new WebAuthn repository
+func NewWebAuthnRepository() *WebAuthnRepository {
+	return &WebAuthnRepository{
+		credentials: GetCollection(webauthnCredentialsCollection),
+		ceremonies:  GetCollection(webauthnCeremoniesCollection),
+	}
+}
+
+// CreateCredential stores a newly registered credential
+func (r *WebAuthnRepository) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	credential.ID = bson.NewObjectID()
+	credential.CreatedAt = time.Now()
+
+	_, err := r.credentials.InsertOne(ctx, credential)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListCredentials retrieves the credentials of a user, oldest first
+func (r *WebAuthnRepository) ListCredentials(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := r.credentials.Find(ctx, bson.M{"user_id": ownerID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	credentials := []*models.WebAuthnCredential{}
+	if err := cursor.All(ctx, &credentials); err != nil {
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// GetCredentialByCredentialID retrieves a credential by the ID its authenticator assigned
+func (r *WebAuthnRepository) GetCredentialByCredentialID(ctx context.Context, credentialID []byte) (*models.WebAuthnCredential, error) {
+	var credential models.WebAuthnCredential
+	err := r.credentials.FindOne(ctx, bson.M{"credential.id": credentialID}).Decode(&credential)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+// RecordCredentialUse stores the authenticator state after a successful login
+func (r *WebAuthnRepository) RecordCredentialUse(ctx context.Context, credentialID []byte, authenticator webauthn.Authenticator) error {
+	update := bson.M{
+		"$set": bson.M{
+			"credential.authenticator": authenticator,
+			"last_used_at":             time.Now(),
+		},
+	}
+
+	return r.updateCredential(ctx, bson.M{"credential.id": credentialID}, update)
+}
+
+// RenameCredential changes the display name of a user's credential
+func (r *WebAuthnRepository) RenameCredential(ctx context.Context, userID, id, name string) error {
+	filter, err := credentialFilter(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return r.updateCredential(ctx, filter, bson.M{"$set": bson.M{"name": name}})
+}
+
+// DeleteCredential removes a user's credential and returns how many the user has left
+func (r *WebAuthnRepository) DeleteCredential(ctx context.Context, userID, id string) (int64, error) {
+	filter, err := credentialFilter(userID, id)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := r.credentials.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	if result.DeletedCount == 0 {
+		return 0, ErrWebAuthnCredentialNotFound
+	}
+
+	return r.credentials.CountDocuments(ctx, bson.M{"user_id": filter["user_id"]})
+}
+
+// CreateCeremony stores a ceremony until the authenticator responds
+func (r *WebAuthnRepository) CreateCeremony(ctx context.Context, ceremony *models.WebAuthnCeremony) error {
+	ceremony.ID = bson.NewObjectID()
+
+	_, err := r.ceremonies.InsertOne(ctx, ceremony)
+	return err
+}
+
+// ConsumeCeremony removes and returns an unexpired ceremony, so each one can be finished once
+func (r *WebAuthnRepository) ConsumeCeremony(ctx context.Context, id string) (*models.WebAuthnCeremony, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+
+	var ceremony models.WebAuthnCeremony
+	filter := bson.M{"_id": objectID, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := r.ceremonies.FindOneAndDelete(ctx, filter).Decode(&ceremony); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrWebAuthnCeremonyNotFound
+		}
+		return nil, err
+	}
+
+	return &ceremony, nil
+}
+
+// CreateIndexes creates necessary indexes for credentials and ceremonies.
+// Expired ceremonies are removed by a TTL index.
+func (r *WebAuthnRepository) CreateIndexes(ctx context.Context) error {
+	credentialIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "credential.id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+	}
+	if _, err := r.credentials.Indexes().CreateMany(ctx, credentialIndexes); err != nil {
+		return err
+	}
+
+	_, err := r.ceremonies.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// updateCredential applies an update to the credential matching filter
+func (r *WebAuthnRepository) updateCredential(ctx context.Context, filter, update bson.M) error {
+	result, err := r.credentials.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+// credentialFilter matches a credential by its ID and owner
+func credentialFilter(userID, id string) (bson.M, error) {
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, err
+	}
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	return bson.M{"_id": objectID, "user_id": ownerID}, nil
+}
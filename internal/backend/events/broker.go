@@ -0,0 +1,113 @@
+package events
+
+import (
+	"sync"
+)
+
+// Event types pushed to clients
+const (
+	// VaultChanged means the user's vault revision moved; clients should sync
+	VaultChanged = "vault_changed"
+	// SessionRevoked means the session receiving it is no longer valid
+	SessionRevoked = "session_revoked"
+	// ShareReceived means another user shared something with this user
+	ShareReceived = "share_received"
+)
+
+// subscriberBuffer is how many undelivered events a subscriber may queue
+// before it is considered too slow and disconnected
+const subscriberBuffer = 16
+
+// Event is a change notification for a single user
+type Event struct {
+	Type     string `json:"type"`
+	Revision int64  `json:"revision,omitempty"`
+	// SessionVersion is the user's new session version on SessionRevoked;
+	// only sessions issued before it are revoked
+	SessionVersion int64 `json:"session_version,omitempty"`
+	// SessionID limits SessionRevoked to a single session when set
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// Broker fans out events to the open subscriptions of each user.
+// It lives in process memory, so events only reach clients connected to the
+// same backend instance.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+// NewBroker creates an empty broker
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[string]map[chan Event]struct{}),
+	}
+}
+
+// Subscribe registers a subscription for a user's events. The returned channel
+// is closed by unsubscribe, or by the broker when the subscriber falls behind;
+// a client that sees it closed should reconnect and resync.
+func (b *Broker) Subscribe(userID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan Event]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(userID, ch)
+	}
+
+	return ch, unsubscribe
+}
+
+// Publish sends an event to every subscription of a user without blocking
+func (b *Broker) Publish(userID string, event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[userID] {
+		select {
+		case ch <- event:
+		default:
+			// Dropping a single event could leave the client stale without
+			// knowing it; cut it off instead so it reconnects and resyncs
+			b.remove(userID, ch)
+		}
+	}
+}
+
+// remove closes and forgets a subscription. The caller must hold b.mu.
+func (b *Broker) remove(userID string, ch chan Event) {
+	subs, ok := b.subscribers[userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(b.subscribers, userID)
+	}
+}
+
+// Default is the process-wide broker used by the handlers and repositories
+var Default = NewBroker()
+
+// Subscribe registers a subscription on the default broker
+func Subscribe(userID string) (<-chan Event, func()) {
+	return Default.Subscribe(userID)
+}
+
+// Publish sends an event through the default broker
+func Publish(userID string, event Event) {
+	Default.Publish(userID, event)
+}
@@ -0,0 +1,61 @@
+package events
+
+import "testing"
+
+func TestSlowSubscriberIsCutOff(t *testing.T) {
+	b := NewBroker()
+	slow, unsubscribeSlow := b.Subscribe("user1")
+	defer unsubscribeSlow()
+	other, unsubscribeOther := b.Subscribe("user2")
+	defer unsubscribeOther()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish("user1", Event{Type: VaultChanged, Revision: int64(i + 1)})
+	}
+
+	for i := 0; i < subscriberBuffer; i++ {
+		if event, ok := <-slow; !ok || event.Revision != int64(i+1) {
+			t.Fatalf("event %d: got %+v, %v", i, event, ok)
+		}
+	}
+	if _, ok := <-slow; ok {
+		t.Fatal("subscriber that fell behind was not closed")
+	}
+
+	b.Publish("user2", Event{Type: VaultChanged, Revision: 1})
+	if event := <-other; event.Revision != 1 {
+		t.Errorf("other user's subscription got %+v", event)
+	}
+}
+
+func TestUnsubscribeTwice(t *testing.T) {
+	b := NewBroker()
+	ch, unsubscribe := b.Subscribe("user1")
+	kept, unsubscribeKept := b.Subscribe("user1")
+	defer unsubscribeKept()
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-ch; ok {
+		t.Fatal("channel not closed by unsubscribe")
+	}
+
+	b.Publish("user1", Event{Type: VaultChanged, Revision: 2})
+	if event := <-kept; event.Revision != 2 {
+		t.Errorf("remaining subscription got %+v", event)
+	}
+}
+
+func TestUnsubscribeAfterCutOff(t *testing.T) {
+	b := NewBroker()
+	_, unsubscribe := b.Subscribe("user1")
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish("user1", Event{Type: VaultChanged})
+	}
+
+	// The broker already closed the channel; closing it again would panic
+	unsubscribe()
+	if len(b.subscribers) != 0 {
+		t.Errorf("subscriptions left: %v", b.subscribers)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// AccessTokenHandler handles HTTP requests for personal access tokens
+type AccessTokenHandler struct {
+	tokens  *database.AccessTokenRepository
+	folders *database.FolderRepository
+}
+
+// NewAccessTokenHandler creates a new access token handler
+func NewAccessTokenHandler() *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokens:  database.NewAccessTokenRepository(),
+		folders: database.NewFolderRepository(),
+	}
+}
+
+// CreateAccessToken handles POST /api/auth/tokens
+// Registers a personal access token generated by the client. Only a verifier
+// of its auth key is stored; the vault key, if given, is wrapped under a key
+// derived from the token.
+func (h *AccessTokenHandler) CreateAccessToken(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	authKey, err := base64.StdEncoding.DecodeString(req.AuthKey)
+	if err != nil || len(authKey) != crypto.KeySize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid auth key"})
+		return
+	}
+
+	ownerID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	token := &models.AccessToken{
+		UserID:          ownerID,
+		Name:            req.Name,
+		Verifier:        crypto.AccessTokenVerifier(authKey),
+		WrappedVaultKey: req.WrappedVaultKey,
+		ExpiresAt:       time.Now().AddDate(0, 0, req.ExpiresInDays),
+	}
+
+	for _, scope := range req.Scopes {
+		if !slices.Contains(token.Scopes, scope) {
+			token.Scopes = append(token.Scopes, scope)
+		}
+	}
+
+	for _, id := range req.FolderIDs {
+		folder, err := h.folders.GetFolder(c.Request.Context(), userID, id)
+		if err != nil {
+			if errors.Is(err, database.ErrFolderNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Folder not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve folder"})
+			return
+		}
+		if !slices.Contains(token.FolderIDs, folder.ID) {
+			token.FolderIDs = append(token.FolderIDs, folder.ID)
+		}
+	}
+
+	if err := h.tokens.CreateAccessToken(c.Request.Context(), token); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access token already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Access token created successfully",
+		"token":   token.ToResponse(),
+	})
+}
+
+// ListAccessTokens handles GET /api/auth/tokens
+func (h *AccessTokenHandler) ListAccessTokens(c *gin.Context) {
+	tokens, err := h.tokens.ListAccessTokens(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve access tokens"})
+		return
+	}
+
+	responses := make([]models.AccessTokenResponse, len(tokens))
+	for i, token := range tokens {
+		responses[i] = token.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": responses})
+}
+
+// RevokeAccessToken handles DELETE /api/auth/tokens/:id
+func (h *AccessTokenHandler) RevokeAccessToken(c *gin.Context) {
+	if err := h.tokens.DeleteAccessToken(c.Request.Context(), c.GetString("userID"), c.Param("id")); err != nil {
+		if errors.Is(err, database.ErrAccessTokenNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
+
+// requestAccessToken returns the personal access token a request was
+// authenticated with, or nil for requests of logged in sessions
+func requestAccessToken(c *gin.Context) *models.AccessToken {
+	if value, ok := c.Get("accessToken"); ok {
+		return value.(*models.AccessToken)
+	}
+	return nil
+}
+
+// allowsFolder reports whether the request may access items in a folder,
+// which only personal access tokens restricted to other folders may not
+func allowsFolder(c *gin.Context, folderID *bson.ObjectID) bool {
+	token := requestAccessToken(c)
+	return token == nil || token.AllowsFolder(folderID)
+}
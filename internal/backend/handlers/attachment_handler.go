@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/internal/backend/storage"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// AttachmentHandler handles HTTP requests for encrypted vault item attachments
+type AttachmentHandler struct {
+	items       *database.VaultItemRepository
+	attachments *database.AttachmentRepository
+	store       storage.BlobStore
+	quota       int64
+	maxChunk    int64
+}
+
+// NewAttachmentHandler creates a new attachment handler using the configured blob store
+func NewAttachmentHandler() (*AttachmentHandler, error) {
+	store, err := storage.NewBlobStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttachmentHandler{
+		items:       database.NewVaultItemRepository(),
+		attachments: database.NewAttachmentRepository(),
+		store:       store,
+		quota:       int64(config.AttachmentQuotaMB) << 20,
+		maxChunk:    int64(config.AttachmentMaxChunkMB) << 20,
+	}, nil
+}
+
+// ListAttachments handles GET /api/vault/items/:id/attachments
+func (h *AttachmentHandler) ListAttachments(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.attachments.ListAttachments(c.Request.Context(), item.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachments"})
+		return
+	}
+
+	attachmentResponses := make([]models.AttachmentResponse, len(attachments))
+	for i, attachment := range attachments {
+		attachmentResponses[i] = attachment.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": attachmentResponses})
+}
+
+// CreateAttachment handles POST /api/vault/items/:id/attachments
+// Reserves quota for the declared size and returns a pending attachment to upload chunks to
+func (h *AttachmentHandler) CreateAttachment(c *gin.Context) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Size > int64(req.ChunkCount)*h.maxChunk {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunks exceed the maximum chunk size of " + strconv.FormatInt(h.maxChunk, 10) + " bytes"})
+		return
+	}
+
+	attachment := &models.Attachment{
+		ItemID:     item.ID,
+		UserID:     item.UserID,
+		FileName:   req.FileName,
+		Key:        req.Key,
+		Size:       req.Size,
+		ChunkCount: req.ChunkCount,
+	}
+
+	if err := h.attachments.CreateAttachment(c.Request.Context(), attachment, h.quota); err != nil {
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachment storage quota exceeded"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create attachment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Attachment created, upload its chunks to complete it",
+		"attachment": attachment.ToResponse(),
+	})
+}
+
+// GetAttachment handles GET /api/vault/items/:id/attachments/:attachmentId
+func (h *AttachmentHandler) GetAttachment(c *gin.Context) {
+	_, attachment, ok := h.loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment.ToResponse())
+}
+
+// UploadChunk handles PUT /api/vault/items/:id/attachments/:attachmentId/chunks/:index
+// The request body is streamed straight into the blob store
+func (h *AttachmentHandler) UploadChunk(c *gin.Context) {
+	_, attachment, ok := h.loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if attachment.Status != models.AttachmentPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment upload is already complete"})
+		return
+	}
+
+	index, ok := chunkIndex(c, attachment)
+	if !ok {
+		return
+	}
+
+	// A chunk may only use what is left of the declared size
+	remaining := attachment.Size
+	for i, size := range attachment.ChunkSizes {
+		if i != index {
+			remaining -= size
+		}
+	}
+	limit := min(remaining, h.maxChunk)
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	written, err := h.store.Put(c.Request.Context(), attachment.ChunkKey(index), body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Chunk exceeds the declared attachment size"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store chunk"})
+		return
+	}
+
+	if err := h.attachments.SetChunkSize(c.Request.Context(), attachment.ID, index, written); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record chunk"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Chunk uploaded successfully",
+		"index":   index,
+		"size":    written,
+	})
+}
+
+// CompleteAttachment handles POST /api/vault/items/:id/attachments/:attachmentId/complete
+func (h *AttachmentHandler) CompleteAttachment(c *gin.Context) {
+	_, attachment, ok := h.loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if attachment.Status != models.AttachmentPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment upload is already complete"})
+		return
+	}
+
+	var total int64
+	missing := []int{}
+	for i, size := range attachment.ChunkSizes {
+		if size == 0 {
+			missing = append(missing, i)
+		}
+		total += size
+	}
+
+	if len(missing) > 0 || total != attachment.Size {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":          "Attachment upload is incomplete",
+			"missing_chunks": missing,
+			"uploaded":       total,
+		})
+		return
+	}
+
+	if err := h.attachments.MarkReady(c.Request.Context(), attachment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete attachment"})
+		return
+	}
+
+	attachment.Status = models.AttachmentReady
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Attachment uploaded successfully",
+		"attachment": attachment.ToResponse(),
+	})
+}
+
+// DownloadChunk handles GET /api/vault/items/:id/attachments/:attachmentId/chunks/:index
+// The chunk is streamed from the blob store without buffering it
+func (h *AttachmentHandler) DownloadChunk(c *gin.Context) {
+	_, attachment, ok := h.loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if attachment.Status != models.AttachmentReady {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment upload is not complete"})
+		return
+	}
+
+	index, ok := chunkIndex(c, attachment)
+	if !ok {
+		return
+	}
+
+	reader, err := h.store.Get(c.Request.Context(), attachment.ChunkKey(index))
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chunk not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read chunk"})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.ChunkSizes[index], "application/octet-stream", reader, nil)
+}
+
+// DeleteAttachment handles DELETE /api/vault/items/:id/attachments/:attachmentId
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	_, attachment, ok := h.loadAttachment(c)
+	if !ok {
+		return
+	}
+
+	if err := storage.DeleteAttachment(c.Request.Context(), h.store, h.attachments, attachment); err != nil {
+		log.Printf("Failed to delete attachment %s: %v", attachment.ID.Hex(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// GetUsage handles GET /api/vault/attachments/usage
+func (h *AttachmentHandler) GetUsage(c *gin.Context) {
+	userID, err := bson.ObjectIDFromHex(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	used, err := h.attachments.Usage(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve storage usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"used":            used,
+		"quota":           h.quota,
+		"max_chunk_bytes": h.maxChunk,
+	})
+}
+
+// loadItem resolves the vault item from the path, responding with an error if it is not accessible
+func (h *AttachmentHandler) loadItem(c *gin.Context) (*models.VaultItem, bool) {
+	item, err := h.items.GetItem(c.Request.Context(), c.GetString("userID"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vault item"})
+		return nil, false
+	}
+	return item, true
+}
+
+// loadAttachment resolves the vault item and attachment from the path
+func (h *AttachmentHandler) loadAttachment(c *gin.Context) (*models.VaultItem, *models.Attachment, bool) {
+	item, ok := h.loadItem(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	attachment, err := h.attachments.GetAttachment(c.Request.Context(), c.GetString("userID"), item.ID, c.Param("attachmentId"))
+	if err != nil {
+		if errors.Is(err, database.ErrAttachmentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachment"})
+		return nil, nil, false
+	}
+	return item, attachment, true
+}
+
+// chunkIndex parses and bounds-checks the chunk index from the path
+func chunkIndex(c *gin.Context, attachment *models.Attachment) (int, bool) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 || index >= attachment.ChunkCount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chunk index"})
+		return 0, false
+	}
+	return index, true
+}
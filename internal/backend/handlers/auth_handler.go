@@ -1,34 +1,140 @@
 package handlers
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
-	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
 	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+	"github.com/philopaterwaheed/passGO/internal/backend/mail"
 	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// userStore is the part of database.UserRepository the auth handler uses
+type userStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id string) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserBySupabaseUID(ctx context.Context, supabaseUID string) (*models.User, error)
+	UpdateEmailVerified(ctx context.Context, id string, verified bool) error
+	SetPendingEmail(ctx context.Context, id, email string) error
+	ChangeEmail(ctx context.Context, id, email string) error
+	SwapVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) error
+	RotateVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) (int64, error)
+	ClearVaultKeys(ctx context.Context, id string) error
+	InitAuthKDF(ctx context.Context, id string, authKDF *models.AuthKDF) error
+	ClearAuthKDF(ctx context.Context, id string) error
+	RevokeSessions(ctx context.Context, id string) (int64, error)
+	SetRecoveryKeys(ctx context.Context, id string, recovery *models.RecoveryKeys) error
+	SetPendingTOTP(ctx context.Context, id, secret string) error
+	EnableTOTP(ctx context.Context, id, secret string, step int64, backupCodes []string) error
+	DisableTOTP(ctx context.Context, id string) error
+	SetWebAuthnMFA(ctx context.Context, id string, enabled bool, backupCodes []string) error
+	SetBackupCodes(ctx context.Context, id string, backupCodes []string) error
+	UseTOTPStep(ctx context.Context, id string, step int64) error
+	UseBackupCode(ctx context.Context, id, codeHash string) error
+	SetMFAChallenge(ctx context.Context, id string, challenge *models.MFAChallenge) error
+	FailMFAChallenge(ctx context.Context, id, challengeID string) (int, error)
+	ConsumeMFAChallenge(ctx context.Context, id, challengeID string) error
+}
+
+// passkeyStore is the part of database.WebAuthnRepository the auth handler uses
+type passkeyStore interface {
+	CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	ListCredentials(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error)
+	GetCredentialByCredentialID(ctx context.Context, credentialID []byte) (*models.WebAuthnCredential, error)
+	RecordCredentialUse(ctx context.Context, credentialID []byte, authenticator webauthn.Authenticator) error
+	RenameCredential(ctx context.Context, userID, id, name string) error
+	DeleteCredential(ctx context.Context, userID, id string) (int64, error)
+	CreateCeremony(ctx context.Context, ceremony *models.WebAuthnCeremony) error
+	ConsumeCeremony(ctx context.Context, id string) (*models.WebAuthnCeremony, error)
+}
+
+// refreshTokenStore is the part of database.RefreshTokenRepository the auth handler uses
+type refreshTokenStore interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, usedID bson.ObjectID, next *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID bson.ObjectID) error
+}
+
+// sessionStore is the part of database.SessionRepository the auth handler uses
+type sessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	ListSessions(ctx context.Context, userID string) ([]*models.Session, error)
+	ExtendSession(ctx context.Context, id bson.ObjectID, ip string, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, userID, id string) error
+	RevokeOtherSessions(ctx context.Context, userID, keepID string) ([]bson.ObjectID, error)
+}
+
+// itemStore is the part of database.VaultItemRepository the auth handler uses
+type itemStore interface {
+	EraseVault(ctx context.Context, userID string) (int64, error)
+}
+
+// accessTokenStore is the part of database.AccessTokenRepository the auth handler uses
+type accessTokenStore interface {
+	DeleteAccessTokens(ctx context.Context, userID string) (int64, error)
+}
+
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
-	repo     *database.UserRepository
-	supabase *auth.SupabaseClient
+	repo          userStore
+	provider      auth.IdentityProvider
+	refreshTokens refreshTokenStore
+	sessions      sessionStore
+	passkeys      passkeyStore
+	items         itemStore
+	accessTokens  accessTokenStore
+	mailer        mail.Sender
+	// relyingParty runs WebAuthn ceremonies; nil when WebAuthn is not configured
+	relyingParty *webauthn.WebAuthn
 }
 
-// NewAuthHandler creates a new auth handler
+// NewAuthHandler creates a new auth handler backed by the configured identity provider
 func NewAuthHandler() (*AuthHandler, error) {
-	supabaseClient, err := auth.NewSupabaseClient()
+	provider, err := auth.NewIdentityProvider()
 	if err != nil {
-		fmt.Println("Error creating Supabase client:", err)
+		log.Printf("Failed to create identity provider: %v", err)
 		return nil, err
 	}
 
+	relyingParty, err := auth.NewRelyingParty()
+	if err != nil {
+		log.Printf("Warning: WebAuthn not configured: %v", err)
+		relyingParty = nil
+	}
+
+	return newAuthHandler(database.NewUserRepository(), provider, database.NewRefreshTokenRepository(), database.NewSessionRepository(), database.NewWebAuthnRepository(), database.NewVaultItemRepository(), database.NewAccessTokenRepository(), mail.NewSender(), relyingParty), nil
+}
+
+// newAuthHandler creates an auth handler on top of explicit dependencies
+func newAuthHandler(repo userStore, provider auth.IdentityProvider, refreshTokens refreshTokenStore, sessions sessionStore, passkeys passkeyStore, items itemStore, accessTokens accessTokenStore, mailer mail.Sender, relyingParty *webauthn.WebAuthn) *AuthHandler {
 	return &AuthHandler{
-		repo:     database.NewUserRepository(),
-		supabase: supabaseClient,
-	}, nil
+		repo:          repo,
+		provider:      provider,
+		refreshTokens: refreshTokens,
+		sessions:      sessions,
+		passkeys:      passkeys,
+		items:         items,
+		accessTokens:  accessTokens,
+		mailer:        mailer,
+		relyingParty:  relyingParty,
+	}
 }
 
 // Signup handles POST /api/auth/signup
@@ -39,6 +145,26 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
+	if req.Keys != nil && !checkKDFParams(c, req.Keys.KDFParams) {
+		return
+	}
+	if req.Auth != nil && !checkKDFParams(c, req.Auth.Params) {
+		return
+	}
+
+	var recovery *models.RecoveryKeys
+	if req.Recovery != nil {
+		if req.Keys == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A recovery key requires vault keys"})
+			return
+		}
+		var err error
+		if recovery, err = req.Recovery.ToRecoveryKeys(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Check if email already exists in local database
 	_, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
 	if err == nil {
@@ -46,10 +172,10 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 		return
 	}
 
-	// Register with Supabase
-	supabaseResp, err := h.supabase.SignUp(req.Email, req.Password)
+	// Register with the identity provider
+	providerResp, err := h.provider.SignUp(req.Email, req.Password)
 	if err != nil {
-		fmt.Printf("Supabase SignUp Error: %v\n", err) // Log error
+		log.Printf("Failed to register with the identity provider: %v", err)
 		if errors.Is(err, auth.ErrUserAlreadyExists) {
 			c.JSON(http.StatusConflict, gin.H{"error": "User already exists in authentication system"})
 			return
@@ -61,12 +187,15 @@ func (h *AuthHandler) Signup(c *gin.Context) {
 	// Create user in local database
 	user := &models.User{
 		Email:         req.Email,
-		SupabaseUID:   supabaseResp.User.ID,
+		SupabaseUID:   providerResp.User.ID,
 		EmailVerified: false,
+		Keys:          req.Keys,
+		Recovery:      recovery,
+		Auth:          req.Auth,
 	}
 
 	if err := h.repo.CreateUser(c.Request.Context(), user); err != nil {
-		fmt.Printf("CreateUser Error: %v\n", err) // Log error
+		log.Printf("Failed to create user: %v", err)
 		if errors.Is(err, database.ErrDuplicateEmail) {
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
 			return
@@ -89,9 +218,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Authenticate with Supabase
-	supabaseResp, err := h.supabase.SignIn(req.Email, req.Password)
-	fmt.Println("Supabase Login Response:", supabaseResp)
+	// Authenticate with the identity provider
+	providerResp, err := h.provider.SignIn(req.Email, req.Password)
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
@@ -109,8 +237,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, database.ErrUserNotFound) {
 			user = &models.User{
-				Email:         supabaseResp.User.Email,
-				SupabaseUID:   supabaseResp.User.ID,
+				Email:         providerResp.User.Email,
+				SupabaseUID:   providerResp.User.ID,
 				EmailVerified: true,
 				IsActive:      true,
 			}
@@ -125,7 +253,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Update email verification status if needed
-	if !user.EmailVerified && supabaseResp.User.EmailConfirmedAt != "" {
+	if !user.EmailVerified && providerResp.User.EmailConfirmedAt != "" {
 		if err := h.repo.UpdateEmailVerified(c.Request.Context(), user.ID.Hex(), true); err == nil {
 			user.EmailVerified = true
 		}
@@ -137,19 +265,180 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID.Hex(), user.Email, user.SupabaseUID)
+	// Accounts from before derived credentials log in with the master password
+	// itself; move them over while it is at hand
+	if user.Auth == nil {
+		h.upgradeCredential(c.Request.Context(), user, req.Password, providerResp.AccessToken)
+	}
+
+	// The password alone only earns an MFA token when a second factor is enabled
+	if user.MFAEnabled() {
+		h.startMFAChallenge(c, user)
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+// upgradeCredential switches an account that logs in with its master password
+// over to a credential derived from it. Failures are only logged: the password
+// keeps working and the next login tries again.
+func (h *AuthHandler) upgradeCredential(ctx context.Context, user *models.User, password, providerToken string) {
+	userID := user.ID.Hex()
+
+	salt, err := crypto.NewSalt()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		log.Printf("Failed to generate login credential salt for user %s: %v", userID, err)
+		return
+	}
+	authKDF := &models.AuthKDF{
+		Salt:   base64.StdEncoding.EncodeToString(salt),
+		Params: crypto.DefaultKDFParams().AtLeast(minKDFParams()),
+	}
+	credential, err := crypto.DeriveAuthCredential(password, salt, authKDF.Params)
+	if err != nil {
+		log.Printf("Failed to derive login credential for user %s: %v", userID, err)
 		return
 	}
 
+	// Claim the upgrade first, so that a concurrent login cannot set another
+	// salt than the one the provider's password ends up derived with
+	if err := h.repo.InitAuthKDF(ctx, userID, authKDF); err != nil {
+		if !errors.Is(err, database.ErrAuthKDFExists) {
+			log.Printf("Failed to record login credential of user %s: %v", userID, err)
+		}
+		return
+	}
+
+	if err := h.provider.UpdatePassword(providerToken, credential); err != nil {
+		log.Printf("Failed to switch user %s to a derived login credential: %v", userID, err)
+		if err := h.repo.ClearAuthKDF(ctx, userID); err != nil {
+			log.Printf("Failed to roll back login credential of user %s: %v", userID, err)
+		}
+		return
+	}
+
+	user.Auth = authKDF
+}
+
+// Prelogin handles POST /api/auth/prelogin
+// Tells a client how to derive the credential it logs in with. Unknown emails
+// get the same answer as accounts that still log in with the password itself:
+// parameters derived from the server secret and the legacy flag, so that the
+// response does not tell whether an email is registered.
+func (h *AuthHandler) Prelogin(c *gin.Context) {
+	var req models.PreloginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), req.Email)
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+	if err == nil && user.Auth != nil {
+		c.JSON(http.StatusOK, models.PreloginResponse{Auth: user.Auth})
+		return
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.JWTSecret))
+	mac.Write([]byte("passgo:prelogin:" + strings.ToLower(req.Email)))
+	c.JSON(http.StatusOK, models.PreloginResponse{
+		Auth: &models.AuthKDF{
+			Salt:   base64.StdEncoding.EncodeToString(mac.Sum(nil)[:crypto.SaltSize]),
+			Params: crypto.DefaultKDFParams().AtLeast(minKDFParams()),
+		},
+		Legacy: true,
+	})
+}
+
+// issueSession responds with a session token, the user and their vault keys
+func (h *AuthHandler) issueSession(c *gin.Context, user *models.User) {
+	token, refreshToken, ok := h.startSession(c, user)
+	if !ok {
+		return
+	}
+
+	minimum := minKDFParams()
 	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: token,
-		User:  user.ToResponse(),
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user.ToResponse(),
+		Keys:         user.Keys,
+		KDFMinimum:   &minimum,
 	})
 }
 
+// startSession records a new session for the calling device and issues its
+// access token and first refresh token, writing the error response if it cannot
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) (token, refreshToken string, ok bool) {
+	session := &models.Session{
+		UserID:     user.ID,
+		DeviceName: deviceName(c),
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		ExpiresAt:  time.Now().Add(auth.RefreshTokenTTL()),
+	}
+	if err := h.sessions.CreateSession(c.Request.Context(), session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start session"})
+		return "", "", false
+	}
+
+	return h.sessionTokens(c, user, session.ID)
+}
+
+// sessionTokens issues an access token and a new refresh token of a session,
+// writing the error response if it cannot. The session ID doubles as the
+// token's jti and as the family of its refresh tokens.
+func (h *AuthHandler) sessionTokens(c *gin.Context, user *models.User, sessionID bson.ObjectID) (token, refreshToken string, ok bool) {
+	token, err := auth.GenerateToken(user.ID.Hex(), user.Email, user.SupabaseUID, user.SessionVersion, sessionID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return "", "", false
+	}
+
+	refreshToken, err = h.issueRefreshToken(c.Request.Context(), user.ID, sessionID, user.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return "", "", false
+	}
+
+	return token, refreshToken, true
+}
+
+// issueRefreshToken stores a new refresh token of a family and returns it
+func (h *AuthHandler) issueRefreshToken(ctx context.Context, userID, familyID bson.ObjectID, sessionVersion int64) (string, error) {
+	refreshToken, stored, err := newRefreshToken(userID, familyID, sessionVersion)
+	if err != nil {
+		return "", err
+	}
+
+	if err := h.refreshTokens.CreateRefreshToken(ctx, stored); err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+// newRefreshToken generates a refresh token of a family and the record that
+// stores its hash
+func newRefreshToken(userID, familyID bson.ObjectID, sessionVersion int64) (string, *models.RefreshToken, error) {
+	refreshToken, tokenHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return refreshToken, &models.RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		TokenHash:      tokenHash,
+		SessionVersion: sessionVersion,
+		ExpiresAt:      time.Now().Add(auth.RefreshTokenTTL()),
+	}, nil
+}
+
 // VerifyEmail handles GET /api/auth/verify-email
 func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 	html := `
@@ -212,12 +501,11 @@ func (h *AuthHandler) VerifyEmail(c *gin.Context) {
 		if c.Query("token") != "" && c.Query("email") != "" {
 			var req models.VerifyEmailRequest
 			if err := c.ShouldBind(&req); err == nil {
-				supabaseResp, err := h.supabase.VerifyOTP(req.Email, req.Token, "signup")
-				if err != nil {
+				if _, err := h.provider.VerifyOTP(req.Email, req.Token, "signup"); err != nil {
 					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
 					return
 				}
-				h.finalizeVerification(c, req.Email, supabaseResp.User.ID)
+				h.finalizeVerification(c, req.Email)
 				return
 			}
 		}
@@ -234,18 +522,20 @@ func (h *AuthHandler) VerifyHash(c *gin.Context) {
 		return
 	}
 
-	// Verify the access token with Supabase
-	user, err := h.supabase.GetUser(req.AccessToken)
+	// Verify the access token with the identity provider
+	user, err := h.provider.GetUser(req.AccessToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
 		return
 	}
 
-	h.finalizeVerification(c, user.Email, user.ID)
+	h.finalizeVerification(c, user.Email)
 }
 
-// Helper to finalize verification (update DB and return token)
-func (h *AuthHandler) finalizeVerification(c *gin.Context, email, supabaseUID string) {
+// Helper to finalize verification (update DB). No session is issued: a
+// provider access token only takes the password to get, so it must not stand
+// in for a login, which may also require a second factor.
+func (h *AuthHandler) finalizeVerification(c *gin.Context, email string) {
 	user, err := h.repo.GetUserByEmail(c.Request.Context(), email)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -257,17 +547,10 @@ func (h *AuthHandler) finalizeVerification(c *gin.Context, email, supabaseUID st
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID.Hex(), user.Email, supabaseUID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
-
 	user.EmailVerified = true
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Email verified successfully",
-		"token":   token,
+		"message": "Email verified successfully. You can now log in.",
 		"user":    user.ToResponse(),
 	})
 }
@@ -298,9 +581,8 @@ func (h *AuthHandler) ResendVerification(c *gin.Context) {
 		return
 	}
 
-	// Resend verification email via Supabase
-	// Todo add rate limiting to prevent abuse
-	if err := h.supabase.ResendVerificationEmail(req.Email); err != nil {
+	// Resend verification email via the identity provider
+	if err := h.provider.ResendVerificationEmail(req.Email); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
 		return
 	}
@@ -317,9 +599,9 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 		return
 	}
 
-	// Send password reset email via Supabase
+	// Send password reset email via the identity provider
 	// Don't check if user exists for security reasons
-	if err := h.supabase.ResetPassword(req.Email); err != nil {
+	if err := h.provider.ResetPassword(req.Email); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset email"})
 		return
 	}
@@ -328,28 +610,92 @@ func (h *AuthHandler) ForgotPassword(c *gin.Context) {
 }
 
 // RefreshToken handles POST /api/auth/refresh
-// Refreshes an existing JWT token
+// Exchanges a refresh token for a new access token and the next refresh token
+// of its family. Replaying a refresh token that was already exchanged revokes
+// the whole family, since either the client or an attacker holds a stolen copy.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-	// Get current token from header
-	tokenString := c.GetHeader("Authorization")
-	if tokenString == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Remove "Bearer " prefix if present
-	if len(tokenString) > 7 && tokenString[:7] == "Bearer " {
-		tokenString = tokenString[7:]
+	ctx := c.Request.Context()
+	current, err := h.refreshTokens.GetRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrRefreshTokenReused):
+			h.refreshTokenReused(c, current)
+		case errors.Is(err, database.ErrRefreshTokenNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify refresh token"})
+		}
+		return
+	}
+
+	// Tokens of revoked sessions must not be renewed
+	user, err := h.repo.GetUserByID(ctx, current.UserID.Hex())
+	if err != nil || !user.IsActive || user.SessionVersion != current.SessionVersion {
+		h.refreshTokens.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+		return
 	}
 
-	// Refresh the token
-	newToken, err := auth.RefreshToken(tokenString)
+	err = h.sessions.ExtendSession(ctx, current.FamilyID, c.ClientIP(), time.Now().Add(auth.RefreshTokenTTL()))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		if errors.Is(err, database.ErrSessionNotFound) {
+			h.refreshTokens.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to extend session"})
+		return
+	}
+
+	token, err := auth.GenerateToken(user.ID.Hex(), user.Email, user.SupabaseUID, user.SessionVersion, current.FamilyID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	refreshToken, next, err := newRefreshToken(user.ID, current.FamilyID, user.SessionVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// The presented token is only spent together with storing its successor,
+	// so a failure up to here leaves it valid for another attempt
+	if err := h.refreshTokens.RotateRefreshToken(ctx, current.ID, next); err != nil {
+		if errors.Is(err, database.ErrRefreshTokenReused) {
+			h.refreshTokenReused(c, current)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": newToken})
+	c.JSON(http.StatusOK, models.RefreshTokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
+}
+
+// refreshTokenReused ends the session of a refresh token that was presented
+// again after it had been exchanged, since one of the two copies leaked
+func (h *AuthHandler) refreshTokenReused(c *gin.Context, current *models.RefreshToken) {
+	ctx := c.Request.Context()
+	log.Printf("Refresh token reuse detected for user %s, revoking session %s", current.UserID.Hex(), current.FamilyID.Hex())
+	err := h.endSession(ctx, current.UserID.Hex(), current.FamilyID)
+	if errors.Is(err, database.ErrSessionNotFound) {
+		// The session already ended; its refresh tokens still must not work
+		err = h.refreshTokens.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token was already used, please log in again"})
 }
 
 // GetCurrentUser handles GET /api/auth/me
@@ -374,3 +720,399 @@ func (h *AuthHandler) GetCurrentUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, user.ToResponse())
 }
+
+// ChangePassword handles POST /api/auth/change-password
+// Verifies the current password, swaps in the vault key re-wrapped under the
+// new password, updates the password with the identity provider and revokes every other session
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkKDFParams(c, req.Keys.KDFParams) {
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user.Keys == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vault keys are not initialized"})
+		return
+	}
+
+	// Verify the current credential; the session gives the provider access for the update
+	session, err := h.provider.SignIn(user.Email, req.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify current password"})
+		return
+	}
+
+	// Swap the keys first: if the password update fails they can be swapped back,
+	// whereas a changed password with stale keys would lock the user out. The
+	// same update revokes every session, so no failure after the password
+	// changed can leave the old ones signed in.
+	oldKeys := *user.Keys
+	sessionVersion, err := h.repo.RotateVaultKeys(c.Request.Context(), userID, oldKeys.WrappedVaultKey, &req.Keys)
+	if err != nil {
+		if errors.Is(err, database.ErrVaultKeysChanged) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Vault keys were changed by another device"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault keys"})
+		return
+	}
+	events.Publish(userID, events.Event{Type: events.SessionRevoked, SessionVersion: sessionVersion})
+
+	if err := h.provider.UpdatePassword(session.AccessToken, req.NewPassword); err != nil {
+		if rollbackErr := h.repo.SwapVaultKeys(c.Request.Context(), userID, req.Keys.WrappedVaultKey, &oldKeys); rollbackErr != nil {
+			log.Printf("Failed to restore vault keys of user %s after password update failure: %v", userID, rollbackErr)
+		}
+		// The rotation already revoked every session, so the caller gets
+		// fresh tokens even though the password stays the same
+		token, refreshToken, ok := h.keepSession(c, user, sessionVersion)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":         "Failed to update password",
+			"token":         token,
+			"refresh_token": refreshToken,
+		})
+		return
+	}
+
+	// The calling session continues with fresh tokens
+	token, refreshToken, ok := h.keepSession(c, user, sessionVersion)
+	if !ok {
+		return
+	}
+
+	user.Keys = &req.Keys
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password changed successfully. Other sessions have been signed out.",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user.ToResponse(),
+		"keys":          user.Keys,
+	})
+}
+
+// keepSession marks every other session of a user whose session version was
+// bumped as revoked and gives the calling session fresh tokens at the new
+// version. Callers without a session, such as a recovery, get a new one.
+func (h *AuthHandler) keepSession(c *gin.Context, user *models.User, sessionVersion int64) (token, refreshToken string, ok bool) {
+	userID := user.ID.Hex()
+	sessionID := c.GetString("sessionID")
+	if _, err := h.sessions.RevokeOtherSessions(c.Request.Context(), userID, sessionID); err != nil {
+		log.Printf("Failed to mark other sessions of user %s as revoked: %v", userID, err)
+	}
+
+	user.SessionVersion = sessionVersion
+	if current, err := bson.ObjectIDFromHex(sessionID); err == nil {
+		return h.sessionTokens(c, user, current)
+	}
+	return h.startSession(c, user)
+}
+
+// BeginRecovery handles POST /api/auth/recovery/begin
+// Returns the recovery-wrapped vault key to a client that proves it holds the
+// recovery key, so it can re-wrap the vault key under a new master password
+func (h *AuthHandler) BeginRecovery(c *gin.Context) {
+	var req models.BeginRecoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.recoveryUser(c, req.Email, req.AuthKey)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wrapped_vault_key": user.Recovery.WrappedVaultKey})
+}
+
+// CompleteRecovery handles POST /api/auth/recovery/complete
+// Sets a new master password for a client that proves it holds the recovery
+// key, swaps in the vault key wrapped under it and revokes every session
+func (h *AuthHandler) CompleteRecovery(c *gin.Context) {
+	var req models.CompleteRecoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkKDFParams(c, req.Keys.KDFParams) {
+		return
+	}
+
+	var recovery *models.RecoveryKeys
+	if req.Recovery != nil {
+		var err error
+		if recovery, err = req.Recovery.ToRecoveryKeys(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !h.provider.AdminAvailable() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Account recovery is not configured on this server"})
+		return
+	}
+
+	user, ok := h.recoveryUser(c, req.Email, req.AuthKey)
+	if !ok {
+		return
+	}
+	userID := user.ID.Hex()
+
+	if user.Keys == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vault keys are not initialized"})
+		return
+	}
+
+	// As with a password change, swap the keys first so they can be swapped
+	// back if the password update fails, revoking every session along with it
+	oldKeys := *user.Keys
+	sessionVersion, err := h.repo.RotateVaultKeys(c.Request.Context(), userID, oldKeys.WrappedVaultKey, &req.Keys)
+	if err != nil {
+		if errors.Is(err, database.ErrVaultKeysChanged) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Vault keys were changed by another device"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault keys"})
+		return
+	}
+	events.Publish(userID, events.Event{Type: events.SessionRevoked, SessionVersion: sessionVersion})
+
+	if err := h.provider.AdminUpdatePassword(user.SupabaseUID, req.NewPassword); err != nil {
+		if rollbackErr := h.repo.SwapVaultKeys(c.Request.Context(), userID, req.Keys.WrappedVaultKey, &oldKeys); rollbackErr != nil {
+			log.Printf("Failed to restore vault keys of user %s after password update failure: %v", userID, rollbackErr)
+		}
+		// The rotation already revoked every session, so the caller gets
+		// fresh tokens even though the password stays the same
+		token, refreshToken, ok := h.keepSession(c, user, sessionVersion)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":         "Failed to update password",
+			"token":         token,
+			"refresh_token": refreshToken,
+		})
+		return
+	}
+
+	// The password is already changed at this point, so a failure to replace
+	// the recovery key leaves the old one valid rather than failing the request
+	if recovery != nil {
+		if err := h.repo.SetRecoveryKeys(c.Request.Context(), userID, recovery); err != nil {
+			log.Printf("Failed to replace recovery key of user %s: %v", userID, err)
+		} else {
+			user.Recovery = recovery
+		}
+	}
+
+	token, refreshToken, ok := h.keepSession(c, user, sessionVersion)
+	if !ok {
+		return
+	}
+
+	user.Keys = &req.Keys
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Password reset with recovery key. All other sessions have been signed out.",
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user.ToResponse(),
+		"keys":          user.Keys,
+	})
+}
+
+// RegenerateRecoveryKey handles PUT /api/auth/recovery
+// Replaces the recovery key after verifying the current password; the
+// previous recovery key stops working
+func (h *AuthHandler) RegenerateRecoveryKey(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.RegenerateRecoveryKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recovery, err := req.Recovery.ToRecoveryKeys()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user.Keys == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vault keys are not initialized"})
+		return
+	}
+
+	if _, err := h.provider.SignIn(user.Email, req.CurrentPassword); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify current password"})
+		return
+	}
+
+	if err := h.repo.SetRecoveryKeys(c.Request.Context(), userID, recovery); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recovery key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Recovery key regenerated. The previous recovery key no longer works.",
+		"created_at": recovery.CreatedAt,
+	})
+}
+
+// recoveryUser looks up the user of a recovery request and checks the
+// recovery auth key. Unknown emails and wrong keys get the same response so
+// the endpoint does not reveal which accounts exist.
+func (h *AuthHandler) recoveryUser(c *gin.Context, email, authKey string) (*models.User, bool) {
+	user, err := h.repo.GetUserByEmail(c.Request.Context(), email)
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+
+	if err != nil || user.Recovery == nil || !user.Recovery.Verify(authKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or recovery key"})
+		return nil, false
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+// GetKDFPolicy handles GET /api/auth/kdf-policy
+// Returns the weakest KDF parameters the server accepts, so clients can pick
+// parameters for new key material that will not be rejected
+func (h *AuthHandler) GetKDFPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"minimum": minKDFParams()})
+}
+
+// UpgradeKDF handles POST /api/auth/upgrade-kdf
+// Swaps in the vault key re-wrapped with stronger KDF parameters after
+// verifying the master password. Sessions stay valid since the password is unchanged.
+func (h *AuthHandler) UpgradeKDF(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.UpgradeKDFRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkKDFParams(c, req.Keys.KDFParams) {
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user.Keys == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Vault keys are not initialized"})
+		return
+	}
+
+	if !req.Keys.KDFParams.Meets(user.Keys.KDFParams) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Key derivation parameters must not be weaker than the current ones"})
+		return
+	}
+
+	if _, err := h.provider.SignIn(user.Email, req.Password); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify password"})
+		return
+	}
+
+	if err := h.repo.SwapVaultKeys(c.Request.Context(), userID, user.Keys.WrappedVaultKey, &req.Keys); err != nil {
+		if errors.Is(err, database.ErrVaultKeysChanged) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Vault keys were changed by another device"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Key derivation parameters upgraded",
+		"keys":    req.Keys,
+	})
+}
+
+// minKDFParams returns the weakest KDF parameters accepted for new key material
+func minKDFParams() crypto.KDFParams {
+	return crypto.KDFParams{
+		Algorithm:   crypto.KDFArgon2id,
+		Memory:      uint32(config.KDFMinMemoryKiB),
+		Iterations:  uint32(config.KDFMinIterations),
+		Parallelism: 1,
+	}
+}
+
+// checkKDFParams validates client-supplied KDF parameters against the server
+// minimums. It responds with 400 and the minimums and returns false if they
+// are unusable or too weak.
+func checkKDFParams(c *gin.Context, params crypto.KDFParams) bool {
+	if err := params.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if minimum := minKDFParams(); !params.Meets(minimum) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   crypto.ErrWeakKDFParams.Error(),
+			"minimum": minimum,
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,947 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth/gotruetest"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	config.JWTSecret = "test-secret"
+	auth.UseSigningKeyStore(&memSigningKeyStore{})
+	config.WebAuthnRPID = testRPID
+	config.WebAuthnOrigins = testOrigin
+	os.Exit(m.Run())
+}
+
+// memUserStore is an in-memory userStore
+type memUserStore struct {
+	mu    sync.Mutex
+	users map[string]*models.User
+}
+
+func newMemUserStore() *memUserStore {
+	return &memUserStore{users: make(map[string]*models.User)}
+}
+
+func (s *memUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.users {
+		if existing.Email == user.Email {
+			return database.ErrDuplicateEmail
+		}
+	}
+	user.ID = bson.NewObjectID()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.IsActive = true
+	copied := *user
+	s.users[user.ID.Hex()] = &copied
+	return nil
+}
+
+func (s *memUserStore) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, database.ErrUserNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (s *memUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, database.ErrUserNotFound
+}
+
+func (s *memUserStore) GetUserBySupabaseUID(ctx context.Context, supabaseUID string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.SupabaseUID == supabaseUID {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, database.ErrUserNotFound
+}
+
+func (s *memUserStore) UpdateEmailVerified(ctx context.Context, id string, verified bool) error {
+	return s.update(id, func(user *models.User) error {
+		user.EmailVerified = verified
+		return nil
+	})
+}
+
+func (s *memUserStore) SetPendingEmail(ctx context.Context, id, email string) error {
+	return s.update(id, func(user *models.User) error {
+		user.PendingEmail = email
+		return nil
+	})
+}
+
+func (s *memUserStore) ChangeEmail(ctx context.Context, id, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for existingID, existing := range s.users {
+		if existing.Email == email && existingID != id {
+			return database.ErrDuplicateEmail
+		}
+	}
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	user.Email = email
+	user.EmailVerified = true
+	user.PendingEmail = ""
+	return nil
+}
+
+func (s *memUserStore) SwapVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) error {
+	return s.update(id, func(user *models.User) error {
+		if user.Keys == nil || user.Keys.WrappedVaultKey != currentWrappedKey {
+			return database.ErrVaultKeysChanged
+		}
+		user.Keys = keys
+		return nil
+	})
+}
+
+func (s *memUserStore) RotateVaultKeys(ctx context.Context, id, currentWrappedKey string, keys *models.VaultKeys) (int64, error) {
+	var version int64
+	err := s.update(id, func(user *models.User) error {
+		if user.Keys == nil || user.Keys.WrappedVaultKey != currentWrappedKey {
+			return database.ErrVaultKeysChanged
+		}
+		user.Keys = keys
+		user.SessionVersion++
+		version = user.SessionVersion
+		return nil
+	})
+	return version, err
+}
+
+func (s *memUserStore) ClearVaultKeys(ctx context.Context, id string) error {
+	return s.update(id, func(user *models.User) error {
+		user.Keys = nil
+		user.Recovery = nil
+		return nil
+	})
+}
+
+func (s *memUserStore) InitAuthKDF(ctx context.Context, id string, authKDF *models.AuthKDF) error {
+	return s.update(id, func(user *models.User) error {
+		if user.Auth != nil {
+			return database.ErrAuthKDFExists
+		}
+		user.Auth = authKDF
+		return nil
+	})
+}
+
+func (s *memUserStore) ClearAuthKDF(ctx context.Context, id string) error {
+	return s.update(id, func(user *models.User) error {
+		user.Auth = nil
+		return nil
+	})
+}
+
+func (s *memUserStore) RevokeSessions(ctx context.Context, id string) (int64, error) {
+	var version int64
+	err := s.update(id, func(user *models.User) error {
+		user.SessionVersion++
+		version = user.SessionVersion
+		return nil
+	})
+	return version, err
+}
+
+func (s *memUserStore) SetRecoveryKeys(ctx context.Context, id string, recovery *models.RecoveryKeys) error {
+	return s.update(id, func(user *models.User) error {
+		user.Recovery = recovery
+		return nil
+	})
+}
+
+func (s *memUserStore) SetPendingTOTP(ctx context.Context, id, secret string) error {
+	return s.update(id, func(user *models.User) error {
+		mfa := models.MFASettings{}
+		if user.MFA != nil {
+			mfa = *user.MFA
+		}
+		if mfa.TOTPEnabled {
+			return database.ErrMFAAlreadyEnabled
+		}
+		mfa.TOTPSecret = secret
+		user.MFA = &mfa
+		return nil
+	})
+}
+
+func (s *memUserStore) EnableTOTP(ctx context.Context, id, secret string, step int64, backupCodes []string) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		if mfa.TOTPEnabled || mfa.TOTPSecret != secret {
+			return database.ErrMFAAlreadyEnabled
+		}
+		now := time.Now()
+		mfa.TOTPEnabled, mfa.LastTOTPStep, mfa.TOTPEnabledAt = true, step, &now
+		if backupCodes != nil {
+			mfa.BackupCodes = backupCodes
+		}
+		return nil
+	})
+}
+
+func (s *memUserStore) DisableTOTP(ctx context.Context, id string) error {
+	return s.update(id, func(user *models.User) error {
+		if user.MFA == nil || !user.MFA.TOTPEnabled {
+			return database.ErrMFANotEnabled
+		}
+		if !user.MFA.WebAuthn {
+			user.MFA = nil
+			return nil
+		}
+		mfa := *user.MFA
+		mfa.TOTPEnabled, mfa.TOTPSecret, mfa.TOTPEnabledAt = false, "", nil
+		user.MFA = &mfa
+		return nil
+	})
+}
+
+func (s *memUserStore) SetWebAuthnMFA(ctx context.Context, id string, enabled bool, backupCodes []string) error {
+	return s.update(id, func(user *models.User) error {
+		mfa := models.MFASettings{}
+		if user.MFA != nil {
+			mfa = *user.MFA
+		}
+		if !enabled && !mfa.TOTPEnabled {
+			user.MFA = nil
+			return nil
+		}
+		mfa.WebAuthn = enabled
+		if enabled && backupCodes != nil {
+			mfa.BackupCodes = backupCodes
+		}
+		user.MFA = &mfa
+		return nil
+	})
+}
+
+func (s *memUserStore) SetBackupCodes(ctx context.Context, id string, backupCodes []string) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		mfa.BackupCodes = backupCodes
+		return nil
+	})
+}
+
+func (s *memUserStore) UseTOTPStep(ctx context.Context, id string, step int64) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		if !mfa.TOTPEnabled || mfa.LastTOTPStep >= step {
+			return database.ErrMFACodeUsed
+		}
+		mfa.LastTOTPStep = step
+		return nil
+	})
+}
+
+func (s *memUserStore) UseBackupCode(ctx context.Context, id, codeHash string) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		for i, hash := range mfa.BackupCodes {
+			if hash == codeHash {
+				mfa.BackupCodes = append(mfa.BackupCodes[:i:i], mfa.BackupCodes[i+1:]...)
+				return nil
+			}
+		}
+		return database.ErrMFACodeUsed
+	})
+}
+
+func (s *memUserStore) SetMFAChallenge(ctx context.Context, id string, challenge *models.MFAChallenge) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		copied := *challenge
+		mfa.Challenge = &copied
+		return nil
+	})
+}
+
+func (s *memUserStore) FailMFAChallenge(ctx context.Context, id, challengeID string) (int, error) {
+	var failures int
+	err := s.updateMFA(id, func(mfa *models.MFASettings) error {
+		if mfa.Challenge == nil || mfa.Challenge.ID != challengeID {
+			return database.ErrMFAChallengeInvalid
+		}
+		challenge := *mfa.Challenge
+		challenge.Failures++
+		mfa.Challenge, failures = &challenge, challenge.Failures
+		return nil
+	})
+	return failures, err
+}
+
+func (s *memUserStore) ConsumeMFAChallenge(ctx context.Context, id, challengeID string) error {
+	return s.updateMFA(id, func(mfa *models.MFASettings) error {
+		if mfa.Challenge == nil || mfa.Challenge.ID != challengeID {
+			return database.ErrMFAChallengeInvalid
+		}
+		mfa.Challenge = nil
+		return nil
+	})
+}
+
+// updateMFA applies a change to a copy of the user's MFA settings, so users
+// handed out earlier keep the settings they were read with
+func (s *memUserStore) updateMFA(id string, apply func(*models.MFASettings) error) error {
+	return s.update(id, func(user *models.User) error {
+		if user.MFA == nil {
+			return database.ErrMFANotEnabled
+		}
+		mfa := *user.MFA
+		if err := apply(&mfa); err != nil {
+			return err
+		}
+		user.MFA = &mfa
+		return nil
+	})
+}
+
+func (s *memUserStore) update(id string, apply func(*models.User) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return database.ErrUserNotFound
+	}
+	return apply(user)
+}
+
+// memSigningKeyStore is an in-memory auth.SigningKeyStore
+type memSigningKeyStore struct {
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (s *memSigningKeyStore) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *key
+	s.keys = append(s.keys, &copied)
+	return nil
+}
+
+func (s *memSigningKeyStore) ListSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*models.SigningKey, len(s.keys))
+	for i, key := range s.keys {
+		copied := *key
+		keys[i] = &copied
+	}
+	return keys, nil
+}
+
+// memRefreshTokenStore is an in-memory refreshTokenStore
+type memRefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]*models.RefreshToken
+	err    error // returned by RotateRefreshToken when set
+}
+
+func newMemRefreshTokenStore() *memRefreshTokenStore {
+	return &memRefreshTokenStore{tokens: make(map[string]*models.RefreshToken)}
+}
+
+func (s *memRefreshTokenStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token.ID = bson.NewObjectID()
+	token.CreatedAt = time.Now()
+	copied := *token
+	s.tokens[token.TokenHash] = &copied
+	return nil
+}
+
+func (s *memRefreshTokenStore) GetRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[tokenHash]
+	if !ok || token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, database.ErrRefreshTokenNotFound
+	}
+	copied := *token
+	if token.UsedAt != nil {
+		return &copied, database.ErrRefreshTokenReused
+	}
+	return &copied, nil
+}
+
+func (s *memRefreshTokenStore) RotateRefreshToken(ctx context.Context, usedID bson.ObjectID, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	for _, token := range s.tokens {
+		if token.ID != usedID {
+			continue
+		}
+		if token.UsedAt != nil || token.RevokedAt != nil {
+			return database.ErrRefreshTokenReused
+		}
+		now := time.Now()
+		token.UsedAt = &now
+		next.ID = bson.NewObjectID()
+		next.CreatedAt = now
+		copied := *next
+		s.tokens[next.TokenHash] = &copied
+		return nil
+	}
+	return database.ErrRefreshTokenNotFound
+}
+
+func (s *memRefreshTokenStore) RevokeRefreshTokenFamily(ctx context.Context, familyID bson.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, token := range s.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// authTestEnv wires an AuthHandler to a fake GoTrue server and in-memory stores
+type authTestEnv struct {
+	router   *gin.Engine
+	gotrue   *gotruetest.Server
+	users    *memUserStore
+	refresh  *memRefreshTokenStore
+	sessions *memSessionStore
+	passkeys *memPasskeyStore
+	items    *memItemStore
+	tokens   *memAccessTokenStore
+	mailer   *memMailer
+}
+
+func newAuthTestEnv(t *testing.T) *authTestEnv {
+	t.Helper()
+
+	gotrue := gotruetest.NewServer()
+	t.Cleanup(gotrue.Close)
+
+	relyingParty, err := auth.NewRelyingParty()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users := newMemUserStore()
+	refresh := newMemRefreshTokenStore()
+	sessions := newMemSessionStore()
+	passkeys := newMemPasskeyStore()
+	items := &memItemStore{}
+	tokens := &memAccessTokenStore{}
+	mailer := &memMailer{}
+	provider := auth.NewSupabaseClientWithConfig(gotrue.URL, gotruetest.APIKey, gotruetest.ServiceKey)
+	h := newAuthHandler(users, provider, refresh, sessions, passkeys, items, tokens, mailer, relyingParty)
+
+	router := gin.New()
+	router.POST("/api/auth/signup", h.Signup)
+	router.POST("/api/auth/prelogin", h.Prelogin)
+	router.POST("/api/auth/login", h.Login)
+	router.GET("/api/auth/verify-email", h.VerifyEmail)
+	router.POST("/api/auth/verify-hash", h.VerifyHash)
+	router.GET("/api/auth/confirm-email-change", h.ConfirmEmailChange)
+	router.POST("/api/auth/confirm-email-change", h.ConfirmEmailChangeHash)
+	router.POST("/api/auth/change-email", requireToken(sessions), h.ChangeEmail)
+	router.POST("/api/auth/change-password", requireToken(sessions), h.ChangePassword)
+	router.POST("/api/auth/forgot-password", h.ForgotPassword)
+	router.GET("/api/auth/reset-password", h.ResetPasswordPage)
+	router.POST("/api/auth/reset-password", h.CompletePasswordReset)
+	router.POST("/api/auth/refresh", h.RefreshToken)
+	router.POST("/api/auth/mfa/verify", h.VerifyMFA)
+	router.POST("/api/auth/mfa/totp/setup", requireToken(sessions), h.SetupTOTP)
+	router.POST("/api/auth/mfa/totp/confirm", requireToken(sessions), h.ConfirmTOTP)
+	router.POST("/api/auth/mfa/backup-codes", requireToken(sessions), h.RegenerateBackupCodes)
+	router.POST("/api/auth/mfa/totp/disable", requireToken(sessions), h.DisableTOTP)
+	router.POST("/api/auth/mfa/webauthn/begin", h.BeginWebAuthnMFA)
+	router.POST("/api/auth/mfa/webauthn/finish", h.FinishWebAuthnMFA)
+	router.POST("/api/auth/webauthn/login/begin", h.BeginPasskeyLogin)
+	router.POST("/api/auth/webauthn/login/finish", h.FinishPasskeyLogin)
+	router.POST("/api/auth/webauthn/register/begin", requireToken(sessions), h.BeginWebAuthnRegistration)
+	router.POST("/api/auth/webauthn/register/finish", requireToken(sessions), h.FinishWebAuthnRegistration)
+	router.GET("/api/auth/webauthn/credentials", requireToken(sessions), h.ListWebAuthnCredentials)
+	router.PUT("/api/auth/webauthn/credentials/:id", requireToken(sessions), h.RenameWebAuthnCredential)
+	router.DELETE("/api/auth/webauthn/credentials/:id", requireToken(sessions), h.DeleteWebAuthnCredential)
+	router.GET("/api/auth/sessions", requireToken(sessions), h.ListSessions)
+	router.DELETE("/api/auth/sessions/:id", requireToken(sessions), h.RevokeSession)
+	router.POST("/api/auth/sessions/revoke-others", requireToken(sessions), h.RevokeOtherSessions)
+
+	return &authTestEnv{router: router, gotrue: gotrue, users: users, refresh: refresh, sessions: sessions, passkeys: passkeys, items: items, tokens: tokens, mailer: mailer}
+}
+
+// requireToken stands in for middleware.AuthMiddleware, which reads users and
+// sessions from MongoDB
+func requireToken(sessions *memSessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		claims, err := auth.VerifyToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		if _, err := sessions.GetSession(c.Request.Context(), claims.ID); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			return
+		}
+		c.Set("userID", claims.UserID)
+		c.Set("sessionID", claims.ID)
+	}
+}
+
+// do sends a request and decodes the JSON response into out, if given
+func (e *authTestEnv) do(t *testing.T, method, path, token string, body, out any) int {
+	t.Helper()
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("Failed to decode %s %s response %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func testVaultKeys() *models.VaultKeys {
+	return &models.VaultKeys{
+		KDFSalt:         "c2FsdHNhbHRzYWx0c2FsdA==",
+		KDFParams:       crypto.DefaultKDFParams(),
+		WrappedVaultKey: "d3JhcHBlZC12YXVsdC1rZXk=",
+	}
+}
+
+// testAuthKDF describes the login credential of accounts created by an up to
+// date client; the handlers never derive it, so tests send any password
+func testAuthKDF() *models.AuthKDF {
+	return &models.AuthKDF{
+		Salt:   "YXV0aHNhbHRhdXRoc2FsdA==",
+		Params: crypto.DefaultKDFParams(),
+	}
+}
+
+func TestSignupVerifyLoginAndRefresh(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "alice@example.com"
+
+	signup := models.SignupRequest{Email: email, Password: "correct horse", Keys: testVaultKeys()}
+	if code := env.do(t, "POST", "/api/auth/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Expected signup to return %d, got %d", http.StatusCreated, code)
+	}
+
+	user, err := env.users.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered, _ := env.gotrue.User(email)
+	if user.SupabaseUID != registered.ID || user.EmailVerified {
+		t.Fatalf("Expected an unverified user linked to the provider account, got %+v", user)
+	}
+
+	login := models.LoginRequest{Email: email, Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusForbidden {
+		t.Errorf("Expected login before verification to return %d, got %d", http.StatusForbidden, code)
+	}
+
+	// Follow the verification link, which hands the access token to verify-hash
+	env.gotrue.Confirm(email)
+	var verified struct {
+		Token string              `json:"token"`
+		User  models.UserResponse `json:"user"`
+	}
+	hash := models.VerifyHashRequest{AccessToken: env.gotrue.AccessToken(email)}
+	if code := env.do(t, "POST", "/api/auth/verify-hash", "", hash, &verified); code != http.StatusOK {
+		t.Fatalf("Expected verify-hash to return %d, got %d", http.StatusOK, code)
+	}
+	// Verification is not a login, which may need a second factor
+	if verified.Token != "" || !verified.User.EmailVerified {
+		t.Errorf("Expected the user to be verified without a session, got %+v", verified)
+	}
+
+	var session models.AuthResponse
+	if code := env.do(t, "POST", "/api/auth/login", "", login, &session); code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, code)
+	}
+	if session.Token == "" || session.Keys == nil || session.Keys.WrappedVaultKey != signup.Keys.WrappedVaultKey {
+		t.Errorf("Expected a token and the vault keys, got %+v", session)
+	}
+	if session.KDFMinimum == nil {
+		t.Error("Expected the login response to advertise the KDF minimum")
+	}
+
+	var refreshed models.RefreshTokenResponse
+	refresh := models.RefreshTokenRequest{RefreshToken: session.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", refresh, &refreshed); code != http.StatusOK {
+		t.Fatalf("Expected refresh to return %d, got %d", http.StatusOK, code)
+	}
+	claims, err := auth.VerifyToken(refreshed.Token)
+	if err != nil || claims.UserID != user.ID.Hex() {
+		t.Errorf("Expected a valid token for the user, got %+v, %v", claims, err)
+	}
+	if refreshed.RefreshToken == "" || refreshed.RefreshToken == session.RefreshToken {
+		t.Error("Expected the refresh token to rotate")
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	signup := models.SignupRequest{Email: "mallory@example.com", Password: "correct horse", Auth: testAuthKDF()}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(signup.Email)
+
+	login := models.LoginRequest{Email: signup.Email, Password: signup.Password}
+	var session, otherDevice models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", login, &session)
+	env.do(t, "POST", "/api/auth/login", "", login, &otherDevice)
+
+	stolen := models.RefreshTokenRequest{RefreshToken: session.RefreshToken}
+	var rotated models.RefreshTokenResponse
+	if code := env.do(t, "POST", "/api/auth/refresh", "", stolen, &rotated); code != http.StatusOK {
+		t.Fatalf("Expected refresh to return %d, got %d", http.StatusOK, code)
+	}
+
+	// Replaying the exchanged token ends the whole family...
+	if code := env.do(t, "POST", "/api/auth/refresh", "", stolen, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed refresh token to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	next := models.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", next, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the rotated token of a revoked family to return %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	// ...but not the sessions of other logins
+	other := models.RefreshTokenRequest{RefreshToken: otherDevice.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", other, nil); code != http.StatusOK {
+		t.Errorf("Expected another login to keep refreshing, got %d", code)
+	}
+}
+
+func TestRefreshTokenSurvivesFailedRotation(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	signup := models.SignupRequest{Email: "peggy@example.com", Password: "correct horse", Auth: testAuthKDF()}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(signup.Email)
+
+	var session models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: signup.Email, Password: signup.Password}, &session)
+	req := models.RefreshTokenRequest{RefreshToken: session.RefreshToken}
+
+	// A server error before the successor is stored does not spend the token...
+	env.refresh.err = errors.New("write conflict")
+	if code := env.do(t, "POST", "/api/auth/refresh", "", req, nil); code != http.StatusInternalServerError {
+		t.Fatalf("Expected a failed rotation to return %d, got %d", http.StatusInternalServerError, code)
+	}
+
+	// ...so presenting it again is a retry rather than a replay
+	env.refresh.err = nil
+	var rotated models.RefreshTokenResponse
+	if code := env.do(t, "POST", "/api/auth/refresh", "", req, &rotated); code != http.StatusOK {
+		t.Fatalf("Expected the retried refresh to return %d, got %d", http.StatusOK, code)
+	}
+	next := models.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", next, nil); code != http.StatusOK {
+		t.Errorf("Expected the rotated token to keep refreshing, got %d", code)
+	}
+}
+
+func TestLoginUpgradesPasswordToDerivedCredential(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "oscar@example.com"
+
+	// An account created before derived credentials logs in with the password
+	signup := models.SignupRequest{Email: email, Password: "correct horse", Keys: testVaultKeys()}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(email)
+
+	var prelogin models.PreloginResponse
+	if code := env.do(t, "POST", "/api/auth/prelogin", "", models.PreloginRequest{Email: email}, &prelogin); code != http.StatusOK {
+		t.Fatalf("Expected prelogin to return %d, got %d", http.StatusOK, code)
+	}
+	if !prelogin.Legacy {
+		t.Fatalf("Expected an old account to log in with the password, got %+v", prelogin)
+	}
+
+	login := models.LoginRequest{Email: email, Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, code)
+	}
+
+	// The login switched the account over to a derived credential
+	env.do(t, "POST", "/api/auth/prelogin", "", models.PreloginRequest{Email: email}, &prelogin)
+	if prelogin.Legacy || prelogin.Auth == nil {
+		t.Fatal("Expected the login to set up a credential derivation")
+	}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the password itself to stop working, got %d", code)
+	}
+
+	salt, _ := base64.StdEncoding.DecodeString(prelogin.Auth.Salt)
+	credential, err := crypto.DeriveAuthCredential("correct horse", salt, prelogin.Auth.Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login.Password = credential
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusOK {
+		t.Errorf("Expected login with the derived credential to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestPreloginOfUnknownEmail(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	var first, second models.PreloginResponse
+	unknown := models.PreloginRequest{Email: "nobody@example.com"}
+	if code := env.do(t, "POST", "/api/auth/prelogin", "", unknown, &first); code != http.StatusOK {
+		t.Fatalf("Expected prelogin to return %d, got %d", http.StatusOK, code)
+	}
+	env.do(t, "POST", "/api/auth/prelogin", "", unknown, &second)
+
+	// Unknown emails look like accounts and do not change between requests
+	if first.Auth == nil || second.Auth == nil || first.Auth.Salt != second.Auth.Salt {
+		t.Errorf("Expected the same derivation for every request, got %+v and %+v", first.Auth, second.Auth)
+	}
+
+	var other models.PreloginResponse
+	env.do(t, "POST", "/api/auth/prelogin", "", models.PreloginRequest{Email: "somebody@example.com"}, &other)
+	if other.Auth == nil || other.Auth.Salt == first.Auth.Salt {
+		t.Error("Expected another email to get another salt")
+	}
+
+	// An account that logs in with its password answers the same way
+	const email = "oscar@example.com"
+	env.do(t, "POST", "/api/auth/signup", "", models.SignupRequest{Email: email, Password: "correct horse", Keys: testVaultKeys()}, nil)
+	var legacy, unregistered models.PreloginResponse
+	env.do(t, "POST", "/api/auth/prelogin", "", models.PreloginRequest{Email: email}, &legacy)
+	user, _ := env.users.GetUserByEmail(context.Background(), email)
+	delete(env.users.users, user.ID.Hex())
+	env.do(t, "POST", "/api/auth/prelogin", "", models.PreloginRequest{Email: email}, &unregistered)
+	if !reflect.DeepEqual(legacy, unregistered) {
+		t.Errorf("Expected a legacy account to look unregistered, got %+v and %+v", legacy, unregistered)
+	}
+}
+
+func TestVerifyEmailWithEmailedToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "bob@example.com"
+
+	signup := models.SignupRequest{Email: email, Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Expected signup to return %d, got %d", http.StatusCreated, code)
+	}
+
+	if code := env.do(t, "GET", "/api/auth/verify-email?email="+url.QueryEscape(email)+"&token=wrong", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong token to return %d, got %d", http.StatusBadRequest, code)
+	}
+
+	registered, _ := env.gotrue.User(email)
+	path := "/api/auth/verify-email?email=" + url.QueryEscape(email) + "&token=" + registered.OTP
+	if code := env.do(t, "GET", path, "", nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected verification to return %d, got %d", http.StatusOK, code)
+	}
+
+	user, _ := env.users.GetUserByEmail(context.Background(), email)
+	if !user.EmailVerified {
+		t.Error("Expected the user to be verified")
+	}
+
+	login := models.LoginRequest{Email: email, Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusOK {
+		t.Errorf("Expected login after verification to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestSignupErrors(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	signup := models.SignupRequest{Email: "carol@example.com", Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Expected signup to return %d, got %d", http.StatusCreated, code)
+	}
+	if code := env.do(t, "POST", "/api/auth/signup", "", signup, nil); code != http.StatusConflict {
+		t.Errorf("Expected a duplicate signup to return %d, got %d", http.StatusConflict, code)
+	}
+
+	// The provider knows the email although the local database does not
+	env.gotrue.Fail(gotruetest.Signup, http.StatusUnprocessableEntity, "User already registered")
+	other := models.SignupRequest{Email: "dave@example.com", Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/signup", "", other, nil); code != http.StatusConflict {
+		t.Errorf("Expected a provider conflict to return %d, got %d", http.StatusConflict, code)
+	}
+
+	env.gotrue.Fail(gotruetest.Signup, http.StatusInternalServerError, "Database error saving new user")
+	if code := env.do(t, "POST", "/api/auth/signup", "", other, nil); code != http.StatusInternalServerError {
+		t.Errorf("Expected a provider failure to return %d, got %d", http.StatusInternalServerError, code)
+	}
+	if _, err := env.users.GetUserByEmail(context.Background(), other.Email); err == nil {
+		t.Error("Expected no local user after a failed signup")
+	}
+
+	weak := models.SignupRequest{Email: "erin@example.com", Password: "correct horse", Keys: testVaultKeys()}
+	weak.Keys.KDFParams.Iterations = 1
+	if code := env.do(t, "POST", "/api/auth/signup", "", weak, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected weak KDF parameters to return %d, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestLoginRejectsInvalidCredentials(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	signup := models.SignupRequest{Email: "frank@example.com", Password: "correct horse"}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(signup.Email)
+
+	login := models.LoginRequest{Email: signup.Email, Password: "wrong password"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to return %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	unknown := models.LoginRequest{Email: "nobody@example.com", Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/login", "", unknown, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown email to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestVerifyHashRejectsInvalidAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	hash := models.VerifyHashRequest{AccessToken: "not-a-token"}
+	if code := env.do(t, "POST", "/api/auth/verify-hash", "", hash, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an invalid access token to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestRefreshRejectsRevokedSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	signup := models.SignupRequest{Email: "grace@example.com", Password: "correct horse"}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(signup.Email)
+
+	var session models.AuthResponse
+	login := models.LoginRequest{Email: signup.Email, Password: signup.Password}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, &session); code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, code)
+	}
+
+	if code := env.do(t, "POST", "/api/auth/refresh", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected refresh without a token to return %d, got %d", http.StatusBadRequest, code)
+	}
+	unknown := models.RefreshTokenRequest{RefreshToken: "not-a-refresh-token"}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", unknown, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown refresh token to return %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	user, _ := env.users.GetUserByEmail(context.Background(), signup.Email)
+	env.users.RevokeSessions(context.Background(), user.ID.Hex())
+
+	refresh := models.RefreshTokenRequest{RefreshToken: session.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", refresh, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh of a revoked session to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestChangePasswordRevokesSessionsWithKeySwap(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "heidi@example.com"
+	token := env.loginSession(t, email, "correct horse")
+
+	keys := *testVaultKeys()
+	keys.WrappedVaultKey = "cmV3cmFwcGVkLXZhdWx0LWtleQ=="
+	change := models.ChangePasswordRequest{CurrentPassword: "correct horse", NewPassword: "battery staple", Keys: keys}
+
+	// A failed password update restores the keys, but the sessions stay
+	// revoked and only the caller keeps theirs with fresh tokens
+	env.gotrue.Fail(gotruetest.UpdateUser, http.StatusInternalServerError, "Database error updating user")
+	var failed models.AuthResponse
+	if code := env.do(t, "POST", "/api/auth/change-password", token, change, &failed); code != http.StatusBadGateway {
+		t.Fatalf("Expected a failed password update to return %d, got %d", http.StatusBadGateway, code)
+	}
+	user, _ := env.users.GetUserByEmail(context.Background(), email)
+	if user.Keys.WrappedVaultKey != testVaultKeys().WrappedVaultKey {
+		t.Error("Expected the vault keys to be swapped back")
+	}
+	if user.SessionVersion != 1 {
+		t.Errorf("Expected session version 1 after the key swap, got %d", user.SessionVersion)
+	}
+	kept, err := auth.VerifyToken(failed.Token)
+	if err != nil {
+		t.Fatalf("Expected the failed update to return a token: %v", err)
+	}
+	if kept.SessionVersion != user.SessionVersion || failed.RefreshToken == "" {
+		t.Errorf("Expected tokens at session version %d, got %d", user.SessionVersion, kept.SessionVersion)
+	}
+
+	var changed models.AuthResponse
+	if code := env.do(t, "POST", "/api/auth/change-password", failed.Token, change, &changed); code != http.StatusOK {
+		t.Fatalf("Expected password change to return %d, got %d", http.StatusOK, code)
+	}
+	user, _ = env.users.GetUserByEmail(context.Background(), email)
+	if user.Keys.WrappedVaultKey != keys.WrappedVaultKey || user.SessionVersion != 2 {
+		t.Errorf("Expected new keys at session version 2, got %q at %d", user.Keys.WrappedVaultKey, user.SessionVersion)
+	}
+
+	claims, err := auth.VerifyToken(changed.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.SessionVersion != user.SessionVersion {
+		t.Errorf("Expected the new token to carry session version %d, got %d", user.SessionVersion, claims.SessionVersion)
+	}
+}
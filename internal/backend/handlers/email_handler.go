@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// confirmEmailChangePage hands the access token Supabase puts in the URL hash
+// of a confirmation link to POST /api/auth/confirm-email-change. With secure
+// email change enabled the first of the two links only carries a message.
+const confirmEmailChangePage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Confirming Email Change...</title>
+	<script>
+		function show(title, detail) {
+			const heading = document.createElement('h1');
+			heading.textContent = title;
+			document.body.replaceChildren(heading);
+			if (detail) {
+				const paragraph = document.createElement('p');
+				paragraph.textContent = detail;
+				document.body.appendChild(paragraph);
+			}
+		}
+
+		window.onload = function() {
+			const params = new URLSearchParams(window.location.hash.substring(1));
+			const accessToken = params.get('access_token');
+			if (!accessToken) {
+				const message = params.get('message') || params.get('error_description');
+				if (message) {
+					show(message);
+				} else {
+					show('Invalid Link', 'No access token found.');
+				}
+				return;
+			}
+
+			fetch('/api/auth/confirm-email-change', {
+				method: 'POST',
+				headers: {
+					'Content-Type': 'application/json'
+				},
+				body: JSON.stringify({ access_token: accessToken })
+			})
+			.then(response => response.json())
+			.then(data => {
+				if (data.error) {
+					show('Error: ' + data.error);
+				} else {
+					show('Email Changed Successfully!', 'Log in with your new address from now on.');
+				}
+			})
+			.catch(err => {
+				show('Error confirming email change');
+			});
+		}
+	</script>
+</head>
+<body>
+	<h1>Confirming email change...</h1>
+</body>
+</html>
+`
+
+// ChangeEmail handles POST /api/auth/change-email
+// Verifies the current password and has the identity provider email a
+// confirmation link to the new address. The account keeps its current email
+// until the link is followed.
+func (h *AuthHandler) ChangeEmail(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	newEmail := strings.ToLower(strings.TrimSpace(req.NewEmail))
+	if strings.EqualFold(newEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current one"})
+		return
+	}
+
+	if _, err := h.repo.GetUserByEmail(c.Request.Context(), newEmail); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+		return
+	} else if !errors.Is(err, database.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+		return
+	}
+
+	// Verify the current credential; the session gives the provider access for the change
+	session, err := h.provider.SignIn(user.Email, req.CurrentPassword)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify current password"})
+		return
+	}
+
+	if err := h.provider.RequestEmailChange(session.AccessToken, newEmail); err != nil {
+		if errors.Is(err, auth.ErrUserAlreadyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to send confirmation email"})
+		return
+	}
+
+	if err := h.repo.SetPendingEmail(c.Request.Context(), userID, newEmail); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record email change"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "A confirmation link has been sent to the new address",
+		"pending_email": newEmail,
+	})
+}
+
+// ConfirmEmailChange handles GET /api/auth/confirm-email-change
+// Redeems the emailed token of an email change, or serves the page that
+// forwards the access token of a Supabase confirmation link
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindQuery(&req); err == nil && req.Email != "" && req.Token != "" {
+		providerResp, err := h.provider.VerifyOTP(req.Email, req.Token, "email_change")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired confirmation link"})
+			return
+		}
+		h.finalizeEmailChange(c, &providerResp.User)
+		return
+	}
+
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, confirmEmailChangePage)
+}
+
+// ConfirmEmailChangeHash handles POST /api/auth/confirm-email-change
+// Completes an email change with the access token of a confirmation link
+func (h *AuthHandler) ConfirmEmailChangeHash(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.AccessToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Access token is required"})
+		return
+	}
+
+	providerUser, err := h.provider.GetUser(req.AccessToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+		return
+	}
+
+	h.finalizeEmailChange(c, providerUser)
+}
+
+// finalizeEmailChange moves the user over to the email the identity provider
+// confirmed and tells the old address about it
+func (h *AuthHandler) finalizeEmailChange(c *gin.Context, providerUser *auth.ProviderUser) {
+	user, err := h.repo.GetUserBySupabaseUID(c.Request.Context(), providerUser.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.PendingEmail == "" || !strings.EqualFold(user.PendingEmail, providerUser.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No matching email change is pending"})
+		return
+	}
+
+	oldEmail := user.Email
+	if err := h.repo.ChangeEmail(c.Request.Context(), user.ID.Hex(), providerUser.Email); err != nil {
+		if errors.Is(err, database.ErrDuplicateEmail) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+		return
+	}
+
+	body := fmt.Sprintf("The email address of your PassGO account was changed from %s to %s.\n\n"+
+		"If you did not make this change, contact support and change your master password right away.\n", oldEmail, providerUser.Email)
+	if err := h.mailer.Send(oldEmail, "Your PassGO email address was changed", body); err != nil {
+		log.Printf("Failed to notify %s of the email change of user %s: %v", oldEmail, user.ID.Hex(), err)
+	}
+
+	user.Email = providerUser.Email
+	user.PendingEmail = ""
+	user.EmailVerified = true
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email changed successfully",
+		"user":    user.ToResponse(),
+	})
+}
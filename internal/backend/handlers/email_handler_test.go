@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// memMailer is a mail.Sender that keeps the emails it is given
+type memMailer struct {
+	mu   sync.Mutex
+	sent []memMail
+}
+
+// memMail is an email sent through memMailer
+type memMail struct {
+	To, Subject, Body string
+}
+
+func (m *memMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, memMail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+func TestChangeEmailAfterConfirmation(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const oldEmail, newEmail = "erin@example.com", "erin@example.org"
+	token := env.loginSession(t, oldEmail, "correct horse")
+
+	wrong := models.ChangeEmailRequest{NewEmail: newEmail, CurrentPassword: "wrong"}
+	if code := env.do(t, "POST", "/api/auth/change-email", token, wrong, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to return %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	change := models.ChangeEmailRequest{NewEmail: newEmail, CurrentPassword: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/change-email", token, change, nil); code != http.StatusOK {
+		t.Fatalf("Expected change-email to return %d, got %d", http.StatusOK, code)
+	}
+
+	// Nothing changes until the new address confirms
+	user, err := env.users.GetUserByEmail(context.Background(), oldEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.PendingEmail != newEmail {
+		t.Errorf("Expected %s to be pending, got %q", newEmail, user.PendingEmail)
+	}
+
+	registered, _ := env.gotrue.User(oldEmail)
+	if code := env.do(t, "GET", "/api/auth/confirm-email-change?email="+url.QueryEscape(newEmail)+"&token=wrong", "", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong token to return %d, got %d", http.StatusBadRequest, code)
+	}
+
+	var confirmed struct {
+		User models.UserResponse `json:"user"`
+	}
+	path := "/api/auth/confirm-email-change?email=" + url.QueryEscape(newEmail) + "&token=" + registered.OTP
+	if code := env.do(t, "GET", path, "", nil, &confirmed); code != http.StatusOK {
+		t.Fatalf("Expected confirmation to return %d, got %d", http.StatusOK, code)
+	}
+	if confirmed.User.Email != newEmail || confirmed.User.PendingEmail != "" {
+		t.Errorf("Expected the user to move to %s, got %+v", newEmail, confirmed.User)
+	}
+
+	if _, err := env.users.GetUserByEmail(context.Background(), newEmail); err != nil {
+		t.Errorf("Expected the user to be found by the new email: %v", err)
+	}
+	if len(env.mailer.sent) != 1 || env.mailer.sent[0].To != oldEmail {
+		t.Errorf("Expected one notification to the old address, got %+v", env.mailer.sent)
+	}
+
+	login := models.LoginRequest{Email: newEmail, Password: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusOK {
+		t.Errorf("Expected login with the new email to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestChangeEmailRejectsTakenAddress(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.loginSession(t, "frank@example.com", "correct horse")
+	env.loginSession(t, "grace@example.com", "correct horse")
+
+	change := models.ChangeEmailRequest{NewEmail: "grace@example.com", CurrentPassword: "correct horse"}
+	if code := env.do(t, "POST", "/api/auth/change-email", token, change, nil); code != http.StatusConflict {
+		t.Errorf("Expected a taken email to return %d, got %d", http.StatusConflict, code)
+	}
+}
+
+func TestConfirmEmailChangeRequiresPendingChange(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "heidi@example.com"
+	env.loginSession(t, email, "correct horse")
+
+	// A plain session of the account does not confirm anything
+	hash := models.ConfirmEmailChangeRequest{AccessToken: env.gotrue.AccessToken(email)}
+	if code := env.do(t, "POST", "/api/auth/confirm-email-change", "", hash, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected confirmation without a pending change to return %d, got %d", http.StatusBadRequest, code)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"io"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+)
+
+// EventHandler streams change notifications to connected clients
+type EventHandler struct {
+	broker    *events.Broker
+	keepAlive time.Duration
+}
+
+// NewEventHandler creates a new event handler backed by the default broker
+func NewEventHandler() *EventHandler {
+	return &EventHandler{
+		broker:    events.Default,
+		keepAlive: time.Duration(config.EventsKeepAliveSeconds) * time.Second,
+	}
+}
+
+// Stream handles GET /api/events
+// Pushes the user's events as Server-Sent Events until the client disconnects,
+// the token expires or the session is revoked
+func (h *EventHandler) Stream(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	ch, unsubscribe := h.broker.Subscribe(userID)
+	defer unsubscribe()
+
+	// Stop streaming once the token the stream was opened with expires
+	var expired <-chan time.Time
+	var sessionVersion int64
+	var sessionID string
+	if value, ok := c.Get("claims"); ok {
+		claims := value.(*auth.Claims)
+		sessionVersion = claims.SessionVersion
+		sessionID = claims.ID
+		if claims.ExpiresAt != nil {
+			timer := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+			defer timer.Stop()
+			expired = timer.C
+		}
+	}
+
+	keepAlive := time.NewTicker(h.keepAlive)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-expired:
+			return false
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			if event.Type == events.SessionRevoked && !revokes(event, sessionID, sessionVersion) {
+				// Revocation of other sessions; this one stays valid
+				return true
+			}
+			c.SSEvent(event.Type, event)
+			return event.Type != events.SessionRevoked
+		case <-keepAlive.C:
+			// An SSE comment keeps proxies from closing an idle stream
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		}
+	})
+}
+
+// revokes reports whether a SessionRevoked event ends the session a stream
+// was opened with: either that session alone or every session issued before
+// the event's session version
+func revokes(event events.Event, sessionID string, sessionVersion int64) bool {
+	if event.SessionID != "" {
+		return event.SessionID == sessionID
+	}
+	return sessionVersion < event.SessionVersion
+}
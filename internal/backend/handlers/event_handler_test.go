@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+)
+
+func TestRevokes(t *testing.T) {
+	tests := []struct {
+		name           string
+		event          events.Event
+		sessionID      string
+		sessionVersion int64
+		want           bool
+	}{
+		{"this session", events.Event{Type: events.SessionRevoked, SessionID: "s1"}, "s1", 1, true},
+		{"another session", events.Event{Type: events.SessionRevoked, SessionID: "s2"}, "s1", 1, false},
+		{"another session despite an older version", events.Event{Type: events.SessionRevoked, SessionID: "s2", SessionVersion: 5}, "s1", 1, false},
+		{"issued before the new version", events.Event{Type: events.SessionRevoked, SessionVersion: 2}, "s1", 1, true},
+		{"issued at the new version", events.Event{Type: events.SessionRevoked, SessionVersion: 2}, "s1", 2, false},
+	}
+
+	for _, tt := range tests {
+		if got := revokes(tt.event, tt.sessionID, tt.sessionVersion); got != tt.want {
+			t.Errorf("%s: revokes = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
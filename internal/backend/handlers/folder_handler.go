@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// FolderHandler handles HTTP requests for folders and tags
+type FolderHandler struct {
+	folders *database.FolderRepository
+	tags    *database.TagRepository
+}
+
+// NewFolderHandler creates a new folder handler
+func NewFolderHandler() *FolderHandler {
+	return &FolderHandler{
+		folders: database.NewFolderRepository(),
+		tags:    database.NewTagRepository(),
+	}
+}
+
+// ListFolders handles GET /api/vault/folders
+func (h *FolderHandler) ListFolders(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	folders, err := h.folders.ListFolders(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folders"})
+		return
+	}
+
+	folderResponses := make([]models.FolderResponse, 0, len(folders))
+	for _, folder := range folders {
+		if allowsFolder(c, &folder.ID) {
+			folderResponses = append(folderResponses, folder.ToResponse())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"folders": folderResponses})
+}
+
+// GetFolder handles GET /api/vault/folders/:id
+func (h *FolderHandler) GetFolder(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	folder, err := h.folders.GetFolder(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folder"})
+		return
+	}
+
+	if !allowsFolder(c, &folder.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		return
+	}
+
+	setETag(c, folder.Revision)
+	c.JSON(http.StatusOK, folder.ToResponse())
+}
+
+// CreateFolder handles POST /api/vault/folders
+func (h *FolderHandler) CreateFolder(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parentID, err := h.folders.ResolveFolderID(c.Request.Context(), userID, req.ParentID)
+	if err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve parent folder"})
+		return
+	}
+
+	folder := &models.Folder{
+		Name:     req.Name,
+		ParentID: parentID,
+	}
+
+	if err := h.folders.CreateFolder(c.Request.Context(), userID, folder); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Folder created successfully",
+		"folder":  folder.ToResponse(),
+	})
+}
+
+// UpdateFolder handles PUT /api/vault/folders/:id
+// Requires If-Match with the revision the client edited
+func (h *FolderHandler) UpdateFolder(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	ifRevision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateFolderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folder, err := h.folders.UpdateFolder(c.Request.Context(), userID, c.Param("id"), &req, ifRevision)
+	if err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		if errors.Is(err, database.ErrFolderConflict) {
+			h.folderConflict(c, userID)
+			return
+		}
+		if errors.Is(err, database.ErrFolderCycle) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Folder cannot be moved into itself or one of its subfolders"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update folder"})
+		return
+	}
+
+	setETag(c, folder.Revision)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Folder updated successfully",
+		"folder":  folder.ToResponse(),
+	})
+}
+
+// DeleteFolder handles DELETE /api/vault/folders/:id
+// Items in the folder are kept and moved out of it
+func (h *FolderHandler) DeleteFolder(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	if err := h.folders.DeleteFolder(c.Request.Context(), userID, c.Param("id")); err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
+}
+
+// ListTags handles GET /api/vault/tags
+func (h *FolderHandler) ListTags(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	// Access tokens restricted to folders only see the tags of their items
+	var tags []*models.Tag
+	var err error
+	if token := requestAccessToken(c); token != nil && len(token.FolderIDs) > 0 {
+		tags, err = h.tags.ListFolderTags(c.Request.Context(), userID, token.FolderIDs)
+	} else {
+		tags, err = h.tags.ListTags(c.Request.Context(), userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	tagResponses := make([]models.TagResponse, len(tags))
+	for i, tag := range tags {
+		tagResponses[i] = tag.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tagResponses})
+}
+
+// CreateTag handles POST /api/vault/tags
+func (h *FolderHandler) CreateTag(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := &models.Tag{Name: req.Name}
+
+	if err := h.tags.CreateTag(c.Request.Context(), userID, tag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Tag created successfully",
+		"tag":     tag.ToResponse(),
+	})
+}
+
+// UpdateTag handles PUT /api/vault/tags/:id
+func (h *FolderHandler) UpdateTag(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.TagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag, err := h.tags.UpdateTag(c.Request.Context(), userID, c.Param("id"), req.Name)
+	if err != nil {
+		if errors.Is(err, database.ErrTagNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Tag updated successfully",
+		"tag":     tag.ToResponse(),
+	})
+}
+
+// DeleteTag handles DELETE /api/vault/tags/:id
+func (h *FolderHandler) DeleteTag(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	if err := h.tags.DeleteTag(c.Request.Context(), userID, c.Param("id")); err != nil {
+		if errors.Is(err, database.ErrTagNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+// folderConflict responds 409 with the current server copy of the requested folder
+func (h *FolderHandler) folderConflict(c *gin.Context, userID string) {
+	folder, err := h.folders.GetFolder(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve folder"})
+		return
+	}
+
+	setETag(c, folder.Revision)
+	c.JSON(http.StatusConflict, gin.H{
+		"error":  "Folder was modified by another device",
+		"folder": folder.ToResponse(),
+	})
+}
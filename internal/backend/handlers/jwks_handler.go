@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+)
+
+// jwksMaxAge is how long verifiers may cache the JWKS. It is shorter than the
+// lead with which keys are published before they start signing.
+const jwksMaxAge = "max-age=900"
+
+// JWKSHandler publishes the public keys that verify PassGO tokens
+type JWKSHandler struct{}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler() *JWKSHandler {
+	return &JWKSHandler{}
+}
+
+// GetJWKS handles GET /.well-known/jwks.json
+// Returns the current, next and recently retired signing keys as a JWK set so
+// that other services can verify PassGO tokens
+func (h *JWKSHandler) GetJWKS(c *gin.Context) {
+	set, err := auth.JWKS(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Signing keys unavailable"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, "+jwksMaxAge)
+	c.JSON(http.StatusOK, set)
+}
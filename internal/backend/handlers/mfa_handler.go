@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// maxMFAFailures is the number of wrong codes after which a pending MFA login
+// is dropped and the password has to be entered again
+const maxMFAFailures = 5
+
+// SetupTOTP handles POST /api/auth/mfa/totp/setup
+// Generates a TOTP secret that becomes active once a code from it is confirmed
+func (h *AuthHandler) SetupTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFA != nil && user.MFA.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := h.repo.SetPendingTOTP(c.Request.Context(), user.ID.Hex(), secret); err != nil {
+		if errors.Is(err, database.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app is already enabled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPSetupResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(user.Email, secret),
+	})
+}
+
+// ConfirmTOTP handles POST /api/auth/mfa/totp/confirm
+// Enables TOTP once a code proves the authenticator app holds the pending
+// secret. Backup codes are returned if the user had none yet.
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	var req models.TOTPConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFA == nil || user.MFA.TOTPSecret == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app setup has not been started"})
+		return
+	}
+	if user.MFA.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app is already enabled"})
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(user.MFA.TOTPSecret, strings.TrimSpace(req.Code), time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, ok := h.firstBackupCodes(c, user)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.EnableTOTP(c.Request.Context(), user.ID.Hex(), user.MFA.TOTPSecret, step, hashes); err != nil {
+		if errors.Is(err, database.ErrMFAAlreadyEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app setup changed, please start again"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Two-factor authentication enabled.",
+		"backup_codes": codes,
+	})
+}
+
+// RegenerateBackupCodes handles POST /api/auth/mfa/backup-codes
+// Replaces the backup codes after verifying the password; unused old codes stop working
+func (h *AuthHandler) RegenerateBackupCodes(c *gin.Context) {
+	var req models.RegenerateBackupCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.MFAEnabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !h.checkPassword(c, user.Email, req.Password) {
+		return
+	}
+
+	codes, hashes, err := newBackupCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate backup codes"})
+		return
+	}
+
+	if err := h.repo.SetBackupCodes(c.Request.Context(), user.ID.Hex(), hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update backup codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Backup codes regenerated. The previous codes no longer work.",
+		"backup_codes": codes,
+	})
+}
+
+// DisableTOTP handles POST /api/auth/mfa/totp/disable
+// Turns off the authenticator app; requires the password and a current code.
+// Registered security keys keep two-factor authentication enabled.
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	var req models.DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.MFA == nil || !user.MFA.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Authenticator app is not enabled"})
+		return
+	}
+
+	if !h.checkPassword(c, user.Email, req.Password) {
+		return
+	}
+
+	valid, err := h.useMFACode(c.Request.Context(), user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	if err := h.repo.DisableTOTP(c.Request.Context(), user.ID.Hex()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable authenticator app"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Authenticator app disabled"})
+}
+
+// VerifyMFA handles POST /api/auth/mfa/verify
+// Exchanges the MFA token from Login and a TOTP or backup code for a session
+// token. After maxMFAFailures wrong codes the MFA token stops working.
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, claims, ok := h.pendingMFA(c, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	valid, err := h.useMFACode(ctx, user, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+		return
+	}
+	if !valid {
+		h.failMFA(c, claims, "Invalid two-factor code")
+		return
+	}
+
+	// Each MFA token can be exchanged once
+	if err := h.repo.ConsumeMFAChallenge(ctx, claims.UserID, claims.ID); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+// pendingMFA looks up the user of an MFA token whose challenge is still open,
+// writing the error response if there is none
+func (h *AuthHandler) pendingMFA(c *gin.Context, mfaToken string) (*models.User, *auth.Claims, bool) {
+	claims, err := auth.VerifyMFAToken(mfaToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+
+	user, err := h.repo.GetUserByID(c.Request.Context(), claims.UserID)
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, nil, false
+	}
+
+	if err != nil || !user.MFAEnabled() || user.MFA.Challenge == nil ||
+		user.MFA.Challenge.ID != claims.ID || time.Now().After(user.MFA.Challenge.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return nil, nil, false
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return nil, nil, false
+	}
+
+	return user, claims, true
+}
+
+// failMFA counts a failed second factor against the pending login and drops
+// the login after maxMFAFailures
+func (h *AuthHandler) failMFA(c *gin.Context, claims *auth.Claims, message string) {
+	ctx := c.Request.Context()
+	failures, err := h.repo.FailMFAChallenge(ctx, claims.UserID, claims.ID)
+	if err != nil || failures >= maxMFAFailures {
+		h.repo.ConsumeMFAChallenge(ctx, claims.UserID, claims.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many failed attempts, please log in again"})
+		return
+	}
+
+	c.JSON(http.StatusUnauthorized, gin.H{
+		"error":         message,
+		"attempts_left": maxMFAFailures - failures,
+	})
+}
+
+// startMFAChallenge records a pending MFA login for a user whose password was
+// verified and responds with the MFA token instead of a session
+func (h *AuthHandler) startMFAChallenge(c *gin.Context, user *models.User) {
+	challengeID, err := auth.NewChallengeID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor challenge"})
+		return
+	}
+
+	challenge := &models.MFAChallenge{
+		ID:        challengeID,
+		ExpiresAt: time.Now().Add(auth.MFATokenTTL()),
+	}
+	if err := h.repo.SetMFAChallenge(c.Request.Context(), user.ID.Hex(), challenge); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor challenge"})
+		return
+	}
+
+	token, err := auth.GenerateMFAToken(user.ID.Hex(), user.Email, challengeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	// The login lockout must not forget failures before the MFA step completes
+	c.Set("mfaRequired", true)
+	c.JSON(http.StatusOK, models.AuthResponse{
+		User:        user.ToResponse(),
+		MFARequired: true,
+		MFAToken:    token,
+		MFAMethods:  user.MFA.Methods(),
+	})
+}
+
+// useMFACode checks a TOTP or backup code and marks it as used. A TOTP code
+// is refused if its time step was already used; a backup code works once.
+func (h *AuthHandler) useMFACode(ctx context.Context, user *models.User, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	var err error
+	if auth.IsTOTPCode(code) {
+		if !user.MFA.TOTPEnabled {
+			return false, nil
+		}
+		step, valid := auth.ValidateTOTP(user.MFA.TOTPSecret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		err = h.repo.UseTOTPStep(ctx, user.ID.Hex(), step)
+	} else {
+		err = h.repo.UseBackupCode(ctx, user.ID.Hex(), auth.HashBackupCode(code))
+	}
+
+	if errors.Is(err, database.ErrMFACodeUsed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// currentUser loads the authenticated user, writing the error response if it cannot
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	user, err := h.repo.GetUserByID(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// checkPassword verifies the user's password with the identity provider,
+// writing the error response if it is wrong or cannot be checked
+func (h *AuthHandler) checkPassword(c *gin.Context, email, password string) bool {
+	if _, err := h.provider.SignIn(email, password); err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return false
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to verify password"})
+		return false
+	}
+	return true
+}
+
+// firstBackupCodes generates backup codes when the user enables a first
+// second factor and has none yet. It returns nil codes otherwise, writing the
+// error response if generation fails.
+func (h *AuthHandler) firstBackupCodes(c *gin.Context, user *models.User) (codes, hashes []string, ok bool) {
+	if user.MFA != nil && len(user.MFA.BackupCodes) > 0 {
+		return nil, nil, true
+	}
+
+	codes, hashes, err := newBackupCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate backup codes"})
+		return nil, nil, false
+	}
+	return codes, hashes, true
+}
+
+// newBackupCodes generates a set of backup codes and the hashes to store
+func newBackupCodes() (codes, hashes []string, err error) {
+	codes, err = auth.GenerateBackupCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes = make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashBackupCode(code)
+	}
+	return codes, hashes, nil
+}
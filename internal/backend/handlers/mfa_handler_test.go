@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// mfaResponse is the body of the MFA enrolment endpoints
+type mfaResponse struct {
+	BackupCodes []string `json:"backup_codes"`
+	Error       string   `json:"error"`
+}
+
+// loginSession signs up a verified user and returns a session token
+func (e *authTestEnv) loginSession(t *testing.T, email, password string) string {
+	t.Helper()
+
+	signup := models.SignupRequest{Email: email, Password: password, Keys: testVaultKeys(), Auth: testAuthKDF()}
+	if code := e.do(t, "POST", "/api/auth/signup", "", signup, nil); code != http.StatusCreated {
+		t.Fatalf("Expected signup to return %d, got %d", http.StatusCreated, code)
+	}
+	e.gotrue.Confirm(email)
+
+	var session models.AuthResponse
+	login := models.LoginRequest{Email: email, Password: password}
+	if code := e.do(t, "POST", "/api/auth/login", "", login, &session); code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, code)
+	}
+	return session.Token
+}
+
+// enableTOTP enrols TOTP for the session's user and returns the secret and backup codes
+func (e *authTestEnv) enableTOTP(t *testing.T, token string) (string, []string) {
+	t.Helper()
+
+	var setup models.TOTPSetupResponse
+	if code := e.do(t, "POST", "/api/auth/mfa/totp/setup", token, nil, &setup); code != http.StatusOK {
+		t.Fatalf("Expected setup to return %d, got %d", http.StatusOK, code)
+	}
+
+	totp, err := auth.GenerateTOTPCode(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var enabled mfaResponse
+	confirm := models.TOTPConfirmRequest{Code: totp}
+	if code := e.do(t, "POST", "/api/auth/mfa/totp/confirm", token, confirm, &enabled); code != http.StatusOK {
+		t.Fatalf("Expected confirm to return %d, got %d: %s", http.StatusOK, code, enabled.Error)
+	}
+	return setup.Secret, enabled.BackupCodes
+}
+
+// nextTOTPCode returns a code of the step after the current one, which the
+// skew window accepts and which was not used by enrolment
+func nextTOTPCode(t *testing.T, secret string) string {
+	t.Helper()
+	code, err := auth.GenerateTOTPCode(secret, time.Now().Add(30*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPEnrolmentAndTwoStepLogin(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "heidi@example.com", "correct horse"
+	token := env.loginSession(t, email, password)
+
+	var setup models.TOTPSetupResponse
+	env.do(t, "POST", "/api/auth/mfa/totp/setup", token, nil, &setup)
+	wrong := models.TOTPConfirmRequest{Code: "000000"}
+	if code := env.do(t, "POST", "/api/auth/mfa/totp/confirm", token, wrong, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a wrong confirmation code to return %d, got %d", http.StatusBadRequest, code)
+	}
+
+	secret, backupCodes := env.enableTOTP(t, token)
+	if len(backupCodes) != auth.BackupCodeCount {
+		t.Fatalf("Expected %d backup codes, got %d", auth.BackupCodeCount, len(backupCodes))
+	}
+	if code := env.do(t, "POST", "/api/auth/mfa/totp/setup", token, nil, nil); code != http.StatusConflict {
+		t.Errorf("Expected setup with MFA enabled to return %d, got %d", http.StatusConflict, code)
+	}
+
+	// The password now only yields an MFA token
+	var pending models.AuthResponse
+	login := models.LoginRequest{Email: email, Password: password}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, &pending); code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, code)
+	}
+	if !pending.MFARequired || pending.MFAToken == "" || pending.Token != "" || pending.Keys != nil {
+		t.Fatalf("Expected an MFA token without session or keys, got %+v", pending)
+	}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", models.RefreshTokenRequest{RefreshToken: pending.MFAToken}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the MFA token to be refused as a session, got %d", code)
+	}
+
+	// Nor does a provider access token, which the password alone can get
+	var verified models.AuthResponse
+	hash := models.VerifyHashRequest{AccessToken: env.gotrue.AccessToken(email)}
+	env.do(t, "POST", "/api/auth/verify-hash", "", hash, &verified)
+	if verified.Token != "" || verified.RefreshToken != "" {
+		t.Errorf("Expected verify-hash not to issue a session, got %+v", verified)
+	}
+	if code := env.do(t, "POST", "/api/auth/mfa/totp/setup", pending.MFAToken, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the MFA token to be refused on protected routes, got %d", code)
+	}
+
+	verify := models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: nextTOTPCode(t, secret)}
+	var session models.AuthResponse
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, &session); code != http.StatusOK {
+		t.Fatalf("Expected verification to return %d, got %d", http.StatusOK, code)
+	}
+	if session.Token == "" || session.Keys == nil || !session.User.MFAEnabled {
+		t.Errorf("Expected a session with the vault keys, got %+v", session)
+	}
+
+	// Neither the MFA token nor the TOTP code work twice
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a reused MFA token to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	env.do(t, "POST", "/api/auth/login", "", login, &pending)
+	verify = models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: verify.Code}
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed TOTP code to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestBackupCodesAreSingleUse(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "ivan@example.com", "correct horse"
+	token := env.loginSession(t, email, password)
+	_, backupCodes := env.enableTOTP(t, token)
+
+	login := models.LoginRequest{Email: email, Password: password}
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		var pending models.AuthResponse
+		env.do(t, "POST", "/api/auth/login", "", login, &pending)
+
+		verify := models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: backupCodes[0]}
+		if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, nil); code != want {
+			t.Errorf("Expected use %d of a backup code to return %d, got %d", i+1, want, code)
+		}
+	}
+
+	// Regenerating replaces the unused codes
+	var regenerated mfaResponse
+	if code := env.do(t, "POST", "/api/auth/mfa/backup-codes", token, models.RegenerateBackupCodesRequest{Password: "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := env.do(t, "POST", "/api/auth/mfa/backup-codes", token, models.RegenerateBackupCodesRequest{Password: password}, &regenerated); code != http.StatusOK {
+		t.Fatalf("Expected regeneration to return %d, got %d", http.StatusOK, code)
+	}
+
+	var pending models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", login, &pending)
+	verify := models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: backupCodes[1]}
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an old backup code to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	verify.Code = regenerated.BackupCodes[0]
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", verify, nil); code != http.StatusOK {
+		t.Errorf("Expected a new backup code to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestMFAChallengeEndsAfterTooManyFailures(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "judy@example.com", "correct horse"
+	token := env.loginSession(t, email, password)
+	secret, _ := env.enableTOTP(t, token)
+
+	var pending models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: email, Password: password}, &pending)
+
+	wrong := models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: "000000"}
+	for range maxMFAFailures {
+		env.do(t, "POST", "/api/auth/mfa/verify", "", wrong, nil)
+	}
+
+	right := models.MFAVerifyRequest{MFAToken: pending.MFAToken, Code: nextTOTPCode(t, secret)}
+	if code := env.do(t, "POST", "/api/auth/mfa/verify", "", right, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the challenge to be dropped after %d failures, got %d", maxMFAFailures, code)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "mallory@example.com", "correct horse"
+	token := env.loginSession(t, email, password)
+	secret, _ := env.enableTOTP(t, token)
+
+	noCode := models.DisableMFARequest{Password: password, Code: "000000"}
+	if code := env.do(t, "POST", "/api/auth/mfa/totp/disable", token, noCode, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong code to return %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	disable := models.DisableMFARequest{Password: password, Code: nextTOTPCode(t, secret)}
+	if code := env.do(t, "POST", "/api/auth/mfa/totp/disable", token, disable, nil); code != http.StatusOK {
+		t.Fatalf("Expected disabling to return %d, got %d", http.StatusOK, code)
+	}
+
+	user, _ := env.users.GetUserByEmail(context.Background(), email)
+	if user.MFA != nil {
+		t.Errorf("Expected the MFA settings to be removed, got %+v", user.MFA)
+	}
+
+	var session models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: email, Password: password}, &session)
+	if session.MFARequired || session.Token == "" {
+		t.Errorf("Expected a plain session after disabling MFA, got %+v", session)
+	}
+}
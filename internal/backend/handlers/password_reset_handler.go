@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// resetPasswordPage is opened by password reset links. It takes the emailed
+// token from the query, or the access token Supabase puts in the URL hash,
+// and sends it with the new password to POST /api/auth/reset-password.
+const resetPasswordPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Reset Password</title>
+	<script>
+		function show(title, detail) {
+			const heading = document.createElement('h1');
+			heading.textContent = title;
+			document.body.replaceChildren(heading);
+			if (detail) {
+				const paragraph = document.createElement('p');
+				paragraph.textContent = detail;
+				document.body.appendChild(paragraph);
+			}
+		}
+
+		window.onload = function() {
+			const query = new URLSearchParams(window.location.search);
+			const hash = new URLSearchParams(window.location.hash.substring(1));
+			const reset = {
+				email: query.get('email') || '',
+				token: query.get('token') || '',
+				access_token: hash.get('access_token') || ''
+			};
+			if (!reset.access_token && !(reset.email && reset.token)) {
+				show('Invalid Link', hash.get('error_description') || 'No reset token found.');
+				return;
+			}
+
+			document.getElementById('reset').onsubmit = function(event) {
+				event.preventDefault();
+				const error = document.getElementById('error');
+				const password = document.getElementById('password').value;
+				if (password !== document.getElementById('confirm').value) {
+					error.textContent = 'The passwords do not match.';
+					return;
+				}
+
+				reset.new_password = password;
+				reset.erase_vault = document.getElementById('erase').checked;
+				fetch('/api/auth/reset-password', {
+					method: 'POST',
+					headers: {
+						'Content-Type': 'application/json'
+					},
+					body: JSON.stringify(reset)
+				})
+				.then(response => response.json())
+				.then(data => {
+					if (data.error) {
+						error.textContent = data.error;
+					} else {
+						show('Password Reset', data.message);
+					}
+				})
+				.catch(err => {
+					error.textContent = 'Error resetting password';
+				});
+			};
+		}
+	</script>
+</head>
+<body>
+	<h1>Reset Password</h1>
+	<p>
+		Your vault is encrypted with a key that only your master password or your
+		recovery key can unlock, and PassGO cannot read it either. If you have your
+		recovery key, close this page and use account recovery in the app instead:
+		it sets a new master password and keeps your vault.
+	</p>
+	<p>
+		Resetting the password here permanently erases every item, folder and tag
+		in your vault. All devices and personal access tokens are signed out, and
+		the next login starts a new, empty vault.
+	</p>
+	<form id="reset">
+		<p><label>New password <input id="password" type="password" minlength="8" required></label></p>
+		<p><label>Confirm password <input id="confirm" type="password" minlength="8" required></label></p>
+		<p><label><input id="erase" type="checkbox" required> I understand that my vault will be erased</label></p>
+		<p id="error"></p>
+		<button type="submit">Reset password</button>
+	</form>
+</body>
+</html>
+`
+
+// ResetPasswordPage handles GET /api/auth/reset-password
+// Serves the page a password reset link opens
+func (h *AuthHandler) ResetPasswordPage(c *gin.Context) {
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, resetPasswordPage)
+}
+
+// CompletePasswordReset handles POST /api/auth/reset-password
+// Redeems the token of a password reset link and sets the new password. The
+// vault key is wrapped under the old password, so the caller must agree to
+// erase the vault; users holding their recovery key keep it by recovering
+// instead. Every session and personal access token is revoked.
+// Only tokens of reset links are accepted, never a plain provider session.
+func (h *AuthHandler) CompletePasswordReset(c *gin.Context) {
+	var req models.CompletePasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Redeem the link before looking at the account, so that nothing about it
+	// is revealed to a caller without a valid link
+	var providerUser *auth.ProviderUser
+	providerToken := req.AccessToken
+	switch {
+	case req.AccessToken != "":
+		// Only a token from a reset link will do; one from a password sign in
+		// would let the password alone bypass the second factor
+		var err error
+		if providerUser, err = h.provider.GetRecoveryUser(req.AccessToken); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+	case req.Email != "" && req.Token != "":
+		session, err := h.provider.VerifyOTP(req.Email, req.Token, "recovery")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+			return
+		}
+		providerUser, providerToken = &session.User, session.AccessToken
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reset token is required"})
+		return
+	}
+
+	user, err := h.repo.GetUserBySupabaseUID(c.Request.Context(), providerUser.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+
+	if user.Keys != nil && !req.EraseVault {
+		c.JSON(http.StatusConflict, gin.H{"error": "Resetting the password erases your vault, which only the old password or the recovery key can unlock. Use your recovery key to keep it, or request a new reset link and agree to erase the vault."})
+		return
+	}
+
+	if err := h.provider.UpdatePassword(providerToken, req.NewPassword); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// Sign everyone out as soon as the password changed, so that no later
+	// failure leaves an old session or refresh token valid
+	userID := user.ID.Hex()
+	sessionVersion, err := h.repo.RevokeSessions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	events.Publish(userID, events.Event{Type: events.SessionRevoked, SessionVersion: sessionVersion})
+
+	if _, err := h.sessions.RevokeOtherSessions(c.Request.Context(), userID, ""); err != nil {
+		log.Printf("Failed to mark sessions of user %s as revoked: %v", userID, err)
+	}
+	if _, err := h.accessTokens.DeleteAccessTokens(c.Request.Context(), userID); err != nil {
+		log.Printf("Failed to revoke access tokens of user %s after password reset: %v", userID, err)
+	}
+
+	// This page cannot run the derivation, so the account logs in with the new
+	// password itself until the next login switches it to a derived credential
+	if err := h.repo.ClearAuthKDF(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset login credential"})
+		return
+	}
+
+	// The new password cannot unwrap the vault key, so the vault goes with it,
+	// including the folder and tag names encrypted under it. The vault goes
+	// first: while the keys remain, a failed erase can be retried with a new
+	// link instead of leaving ciphertext nobody can open.
+	vaultErased := user.Keys != nil
+	if vaultErased {
+		if _, err := h.items.EraseVault(c.Request.Context(), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase vault"})
+			return
+		}
+		if err := h.repo.ClearVaultKeys(c.Request.Context(), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset vault keys"})
+			return
+		}
+	}
+
+	message := "Password reset. All sessions have been signed out."
+	if vaultErased {
+		message = "Password reset. Your vault has been erased and all sessions have been signed out; log in to start a new vault."
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      message,
+		"vault_erased": vaultErased,
+	})
+}
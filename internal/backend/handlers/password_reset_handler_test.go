@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// memItemStore is an itemStore that records whose vaults were erased
+type memItemStore struct {
+	mu     sync.Mutex
+	erased []string
+	err    error // returned by EraseVault when set
+}
+
+func (s *memItemStore) EraseVault(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	s.erased = append(s.erased, userID)
+	return 0, nil
+}
+
+// memAccessTokenStore is an accessTokenStore that records whose tokens were revoked
+type memAccessTokenStore struct {
+	mu      sync.Mutex
+	revoked []string
+}
+
+func (s *memAccessTokenStore) DeleteAccessTokens(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked = append(s.revoked, userID)
+	return 0, nil
+}
+
+// passwordResetResponse is the body of POST /api/auth/reset-password
+type passwordResetResponse struct {
+	VaultErased bool   `json:"vault_erased"`
+	Error       string `json:"error"`
+}
+
+func TestPasswordResetErasesVault(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "ivan@example.com"
+	token := env.loginSession(t, email, "correct horse")
+
+	forgot := models.ResetPasswordRequest{Email: email}
+	if code := env.do(t, "POST", "/api/auth/forgot-password", "", forgot, nil); code != http.StatusOK {
+		t.Fatalf("Expected forgot-password to return %d, got %d", http.StatusOK, code)
+	}
+	registered, _ := env.gotrue.User(email)
+
+	// Without agreeing to erase the vault nothing changes
+	reset := models.CompletePasswordResetRequest{Email: email, Token: registered.OTP, NewPassword: "battery staple"}
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, nil); code != http.StatusConflict {
+		t.Fatalf("Expected a reset without erasing the vault to return %d, got %d", http.StatusConflict, code)
+	}
+	if user, _ := env.users.GetUserByEmail(context.Background(), email); user.Keys == nil {
+		t.Fatal("Expected the vault keys to be kept")
+	}
+
+	env.do(t, "POST", "/api/auth/forgot-password", "", forgot, nil)
+	registered, _ = env.gotrue.User(email)
+	reset.Token = registered.OTP
+	reset.EraseVault = true
+	var resp passwordResetResponse
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, &resp); code != http.StatusOK {
+		t.Fatalf("Expected reset to return %d, got %d: %s", http.StatusOK, code, resp.Error)
+	}
+	if !resp.VaultErased {
+		t.Error("Expected the response to report the vault as erased")
+	}
+
+	user, _ := env.users.GetUserByEmail(context.Background(), email)
+	if user.Keys != nil || user.Recovery != nil {
+		t.Error("Expected the vault keys to be cleared")
+	}
+	if user.Auth != nil {
+		t.Error("Expected the account to log in with the new password itself")
+	}
+	if len(env.items.erased) != 1 || env.items.erased[0] != user.ID.Hex() {
+		t.Errorf("Expected the user's vault to be erased, got %v", env.items.erased)
+	}
+	if len(env.tokens.revoked) != 1 {
+		t.Errorf("Expected the user's access tokens to be revoked, got %v", env.tokens.revoked)
+	}
+	if code := env.do(t, "GET", "/api/auth/sessions", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the old session to be revoked, got %d", code)
+	}
+
+	// The link only works once
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a used link to return %d, got %d", http.StatusBadRequest, code)
+	}
+
+	var session models.AuthResponse
+	login := models.LoginRequest{Email: email, Password: "battery staple"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, &session); code != http.StatusOK {
+		t.Fatalf("Expected login with the new password to return %d, got %d", http.StatusOK, code)
+	}
+	if session.Keys != nil {
+		t.Error("Expected the login to start a new vault")
+	}
+}
+
+func TestPasswordResetRevokesSessionsBeforeErasing(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "oscar@example.com"
+	token := env.loginSession(t, email, "correct horse")
+
+	env.do(t, "POST", "/api/auth/forgot-password", "", models.ResetPasswordRequest{Email: email}, nil)
+	registered, _ := env.gotrue.User(email)
+
+	// A failed erase still leaves the old sessions signed out
+	env.items.err = errors.New("connection reset")
+	reset := models.CompletePasswordResetRequest{Email: email, Token: registered.OTP, NewPassword: "battery staple", EraseVault: true}
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, nil); code != http.StatusInternalServerError {
+		t.Fatalf("Expected a failed erase to return %d, got %d", http.StatusInternalServerError, code)
+	}
+	if code := env.do(t, "GET", "/api/auth/sessions", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the old session to be revoked, got %d", code)
+	}
+	if user, _ := env.users.GetUserByEmail(context.Background(), email); user.SessionVersion != 1 || user.Keys == nil {
+		t.Error("Expected the sessions to be revoked and the vault keys kept for a retry")
+	}
+}
+
+func TestPasswordResetWithHashAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "judy@example.com"
+
+	// An account that never set up vault keys has nothing to erase
+	signup := models.SignupRequest{Email: email, Password: "correct horse"}
+	env.do(t, "POST", "/api/auth/signup", "", signup, nil)
+	env.gotrue.Confirm(email)
+
+	reset := models.CompletePasswordResetRequest{AccessToken: env.gotrue.RecoveryAccessToken(email), NewPassword: "battery staple"}
+	var resp passwordResetResponse
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, &resp); code != http.StatusOK {
+		t.Fatalf("Expected reset to return %d, got %d: %s", http.StatusOK, code, resp.Error)
+	}
+	if resp.VaultErased || len(env.items.erased) != 0 {
+		t.Error("Expected no vault to be erased")
+	}
+
+	login := models.LoginRequest{Email: email, Password: "battery staple"}
+	if code := env.do(t, "POST", "/api/auth/login", "", login, nil); code != http.StatusOK {
+		t.Errorf("Expected login with the new password to return %d, got %d", http.StatusOK, code)
+	}
+}
+
+func TestPasswordResetRejectsInvalidLinks(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	for _, reset := range []models.CompletePasswordResetRequest{
+		{NewPassword: "battery staple"},
+		{Email: "nobody@example.com", Token: "wrong", NewPassword: "battery staple", EraseVault: true},
+		{AccessToken: "not-a-token", NewPassword: "battery staple", EraseVault: true},
+	} {
+		if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, nil); code != http.StatusBadRequest {
+			t.Errorf("Expected %+v to return %d, got %d", reset, http.StatusBadRequest, code)
+		}
+	}
+}
+
+func TestPasswordResetRejectsSignInAccessToken(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email = "mallory@example.com"
+	env.loginSession(t, email, "correct horse")
+
+	// A token from signing in with the password is not a reset link
+	reset := models.CompletePasswordResetRequest{AccessToken: env.gotrue.AccessToken(email), NewPassword: "battery staple", EraseVault: true}
+	if code := env.do(t, "POST", "/api/auth/reset-password", "", reset, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a sign in token to return %d, got %d", http.StatusBadRequest, code)
+	}
+	if len(env.items.erased) != 0 {
+		t.Error("Expected the vault to be kept")
+	}
+}
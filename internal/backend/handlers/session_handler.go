@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/events"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// maxDeviceNameLength caps the device name a client reports for its session
+const maxDeviceNameLength = 100
+
+// ListSessions handles GET /api/auth/sessions
+// Lists the active sessions of the current user, marking the one the request
+// was made with
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.sessions.ListSessions(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	current := c.GetString("sessionID")
+	responses := make([]models.SessionResponse, len(sessions))
+	for i, session := range sessions {
+		responses[i] = session.ToResponse(current)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": responses})
+}
+
+// RevokeSession handles DELETE /api/auth/sessions/:id
+// Signs a single device out. Revoking the current session logs the caller out.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	sessionID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := h.endSession(c.Request.Context(), c.GetString("userID"), sessionID); err != nil {
+		if errors.Is(err, database.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions handles POST /api/auth/sessions/revoke-others
+// Signs every device out except the one the request was made with
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := c.GetString("userID")
+
+	revoked, err := h.sessions.RevokeOtherSessions(ctx, userID, c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	for _, sessionID := range revoked {
+		if err := h.refreshTokens.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+			log.Printf("Failed to revoke refresh tokens of session %s: %v", sessionID.Hex(), err)
+		}
+		events.Publish(userID, events.Event{Type: events.SessionRevoked, SessionID: sessionID.Hex()})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Other sessions have been signed out",
+		"revoked": len(revoked),
+	})
+}
+
+// endSession revokes an active session of a user together with its refresh
+// tokens and tells its open event streams
+func (h *AuthHandler) endSession(ctx context.Context, userID string, sessionID bson.ObjectID) error {
+	if err := h.sessions.RevokeSession(ctx, userID, sessionID.Hex()); err != nil {
+		return err
+	}
+
+	if err := h.refreshTokens.RevokeRefreshTokenFamily(ctx, sessionID); err != nil {
+		return err
+	}
+
+	events.Publish(userID, events.Event{Type: events.SessionRevoked, SessionID: sessionID.Hex()})
+	return nil
+}
+
+// deviceName returns the name the client reports for its device in the
+// X-Device-Name header
+func deviceName(c *gin.Context) string {
+	name := []rune(strings.TrimSpace(c.GetHeader("X-Device-Name")))
+	if len(name) > maxDeviceNameLength {
+		name = name[:maxDeviceNameLength]
+	}
+	return string(name)
+}
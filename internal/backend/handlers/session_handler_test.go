@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// memSessionStore is an in-memory sessionStore
+type memSessionStore struct {
+	mu       sync.Mutex
+	sessions map[bson.ObjectID]*models.Session
+}
+
+func newMemSessionStore() *memSessionStore {
+	return &memSessionStore{sessions: make(map[bson.ObjectID]*models.Session)}
+}
+
+func (s *memSessionStore) CreateSession(ctx context.Context, session *models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.ID = bson.NewObjectID()
+	session.CreatedAt = time.Now()
+	session.LastSeenAt = session.CreatedAt
+	copied := *session
+	s.sessions[session.ID] = &copied
+	return nil
+}
+
+func (s *memSessionStore) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.active(id)
+	if !ok {
+		return nil, database.ErrSessionNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *memSessionStore) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := []*models.Session{}
+	for id, session := range s.sessions {
+		if _, ok := s.active(id.Hex()); ok && session.UserID.Hex() == userID {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *memSessionStore) ExtendSession(ctx context.Context, id bson.ObjectID, ip string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.active(id.Hex())
+	if !ok {
+		return database.ErrSessionNotFound
+	}
+	session.LastSeenAt = time.Now()
+	session.IP = ip
+	session.ExpiresAt = expiresAt
+	return nil
+}
+
+func (s *memSessionStore) RevokeSession(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.active(id)
+	if !ok || session.UserID.Hex() != userID {
+		return database.ErrSessionNotFound
+	}
+	now := time.Now()
+	session.RevokedAt = &now
+	return nil
+}
+
+func (s *memSessionStore) RevokeOtherSessions(ctx context.Context, userID, keepID string) ([]bson.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var revoked []bson.ObjectID
+	now := time.Now()
+	for id, session := range s.sessions {
+		if _, ok := s.active(id.Hex()); ok && session.UserID.Hex() == userID && id.Hex() != keepID {
+			session.RevokedAt = &now
+			revoked = append(revoked, id)
+		}
+	}
+	return revoked, nil
+}
+
+// active returns a session that is neither revoked nor expired; s.mu must be held
+func (s *memSessionStore) active(id string) (*models.Session, bool) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, false
+	}
+	session, ok := s.sessions[objectID]
+	if !ok || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, false
+	}
+	return session, true
+}
+
+// loginDevice logs a user in from a named device and returns the session
+func (e *authTestEnv) loginDevice(t *testing.T, email, password, device string) models.AuthResponse {
+	t.Helper()
+
+	body, err := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/api/auth/login", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Device-Name", device)
+	req.Header.Set("User-Agent", "passgo-test")
+
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login to return %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var session models.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &session); err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+// sessionList is the body of GET /api/auth/sessions
+type sessionList struct {
+	Sessions []models.SessionResponse `json:"sessions"`
+}
+
+func TestListAndRevokeSession(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "alice@example.com", "correct horse"
+
+	env.loginSession(t, email, password)
+	laptop := env.loginDevice(t, email, password, "Laptop")
+	phone := env.loginDevice(t, email, password, "Phone")
+
+	var list sessionList
+	if code := env.do(t, "GET", "/api/auth/sessions", laptop.Token, nil, &list); code != http.StatusOK {
+		t.Fatalf("Expected listing sessions to return %d, got %d", http.StatusOK, code)
+	}
+	if len(list.Sessions) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", len(list.Sessions))
+	}
+
+	var phoneID string
+	for _, session := range list.Sessions {
+		if session.Current != (session.DeviceName == "Laptop") {
+			t.Errorf("Expected only the laptop session to be current, got %+v", session)
+		}
+		if session.DeviceName == "Phone" {
+			phoneID = session.ID
+			if session.UserAgent != "passgo-test" {
+				t.Errorf("Expected the session to record the user agent, got %q", session.UserAgent)
+			}
+		}
+	}
+	if phoneID == "" {
+		t.Fatal("Expected the phone session to be listed")
+	}
+
+	if code := env.do(t, "DELETE", "/api/auth/sessions/"+phoneID, laptop.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected revoking the phone session to return %d, got %d", http.StatusOK, code)
+	}
+
+	if code := env.do(t, "GET", "/api/auth/sessions", phone.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked access token to be rejected with %d, got %d", http.StatusUnauthorized, code)
+	}
+	refresh := models.RefreshTokenRequest{RefreshToken: phone.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", refresh, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked refresh token to be rejected with %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := env.do(t, "GET", "/api/auth/sessions", laptop.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("Expected the laptop session to stay valid, got %d", code)
+	}
+
+	if code := env.do(t, "DELETE", "/api/auth/sessions/"+phoneID, laptop.Token, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected revoking a revoked session to return %d, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	env := newAuthTestEnv(t)
+
+	alice := env.loginSession(t, "alice@example.com", "correct horse")
+	bob := env.loginSession(t, "bob@example.com", "battery staple")
+
+	var list sessionList
+	if code := env.do(t, "GET", "/api/auth/sessions", alice, nil, &list); code != http.StatusOK || len(list.Sessions) != 1 {
+		t.Fatalf("Expected alice to have one session, got %d %+v", code, list.Sessions)
+	}
+
+	if code := env.do(t, "DELETE", "/api/auth/sessions/"+list.Sessions[0].ID, bob, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected revoking another user's session to return %d, got %d", http.StatusNotFound, code)
+	}
+	if code := env.do(t, "GET", "/api/auth/sessions", alice, nil, nil); code != http.StatusOK {
+		t.Errorf("Expected alice's session to stay valid, got %d", code)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	env := newAuthTestEnv(t)
+	const email, password = "alice@example.com", "correct horse"
+
+	other := env.loginSession(t, email, password)
+	current := env.loginDevice(t, email, password, "Laptop")
+
+	var revoked struct {
+		Revoked int `json:"revoked"`
+	}
+	if code := env.do(t, "POST", "/api/auth/sessions/revoke-others", current.Token, nil, &revoked); code != http.StatusOK {
+		t.Fatalf("Expected revoking other sessions to return %d, got %d", http.StatusOK, code)
+	}
+	if revoked.Revoked != 1 {
+		t.Errorf("Expected 1 revoked session, got %d", revoked.Revoked)
+	}
+
+	if code := env.do(t, "GET", "/api/auth/sessions", other, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the other session to be rejected with %d, got %d", http.StatusUnauthorized, code)
+	}
+
+	var list sessionList
+	if code := env.do(t, "GET", "/api/auth/sessions", current.Token, nil, &list); code != http.StatusOK {
+		t.Fatalf("Expected the current session to stay valid, got %d", code)
+	}
+	if len(list.Sessions) != 1 || !list.Sessions[0].Current {
+		t.Errorf("Expected only the current session to remain, got %+v", list.Sessions)
+	}
+
+	refresh := models.RefreshTokenRequest{RefreshToken: current.RefreshToken}
+	if code := env.do(t, "POST", "/api/auth/refresh", "", refresh, nil); code != http.StatusOK {
+		t.Errorf("Expected the current session to refresh, got %d", code)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// SyncHandler handles HTTP requests for delta sync
+type SyncHandler struct {
+	repo *database.SyncRepository
+}
+
+// NewSyncHandler creates a new sync handler
+func NewSyncHandler() *SyncHandler {
+	return &SyncHandler{
+		repo: database.NewSyncRepository(),
+	}
+}
+
+// Sync handles GET /api/sync?since=<revision>
+func (h *SyncHandler) Sync(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	since := int64(0)
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		var err error
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since revision"})
+			return
+		}
+	}
+
+	changes, err := h.repo.Changes(c.Request.Context(), userID, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve changes"})
+		return
+	}
+
+	// A client ahead of the server (e.g. after a restore) must start over
+	if since > changes.Revision {
+		changes, err = h.repo.Changes(c.Request.Context(), userID, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve changes"})
+			return
+		}
+	}
+
+	resp := models.SyncResponse{
+		Revision:   changes.Revision,
+		Full:       changes.Full,
+		Items:      make([]models.VaultItemResponse, len(changes.Items)),
+		Folders:    make([]models.FolderResponse, len(changes.Folders)),
+		Tags:       make([]models.TagResponse, len(changes.Tags)),
+		Tombstones: make([]models.TombstoneResponse, len(changes.Tombstones)),
+	}
+	for i, item := range changes.Items {
+		resp.Items[i] = item.ToResponse()
+	}
+	for i, folder := range changes.Folders {
+		resp.Folders[i] = folder.ToResponse()
+	}
+	for i, tag := range changes.Tags {
+		resp.Tags[i] = tag.ToResponse()
+	}
+	for i, tombstone := range changes.Tombstones {
+		resp.Tombstones[i] = tombstone.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -126,10 +126,6 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
-		if errors.Is(err, database.ErrDuplicateEmail) {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
-			return
-		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
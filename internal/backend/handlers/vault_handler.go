@@ -0,0 +1,535 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// VaultHandler handles HTTP requests for encrypted vault items
+type VaultHandler struct {
+	repo    *database.VaultItemRepository
+	users   *database.UserRepository
+	folders *database.FolderRepository
+	tags    *database.TagRepository
+}
+
+// NewVaultHandler creates a new vault handler
+func NewVaultHandler() *VaultHandler {
+	return &VaultHandler{
+		repo:    database.NewVaultItemRepository(),
+		users:   database.NewUserRepository(),
+		folders: database.NewFolderRepository(),
+		tags:    database.NewTagRepository(),
+	}
+}
+
+// GetKeys handles GET /api/vault/keys
+// Returns the KDF salt, KDF parameters and wrapped vault key of the current
+// user, or to a personal access token the vault key wrapped for that token
+func (h *VaultHandler) GetKeys(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	if token := requestAccessToken(c); token != nil {
+		if token.WrappedVaultKey == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access token has no vault key"})
+			return
+		}
+		c.JSON(http.StatusOK, models.AccessTokenKeys{WrappedVaultKey: token.WrappedVaultKey})
+		return
+	}
+
+	user, err := h.users.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	if user.Keys == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vault keys not initialized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user.Keys)
+}
+
+// InitKeys handles PUT /api/vault/keys
+// Stores the vault key material for accounts that do not have any yet
+func (h *VaultHandler) InitKeys(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.VaultKeys
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkKDFParams(c, req.KDFParams) {
+		return
+	}
+
+	if err := h.users.InitVaultKeys(c.Request.Context(), userID, &req); err != nil {
+		if errors.Is(err, database.ErrVaultKeysExist) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Vault keys already initialized"})
+			return
+		}
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store vault keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vault keys stored successfully"})
+}
+
+// ListItems handles GET /api/vault/items
+func (h *VaultHandler) ListItems(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	items, err := h.repo.ListItems(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vault items"})
+		return
+	}
+
+	itemResponses := make([]models.VaultItemResponse, 0, len(items))
+	for _, item := range items {
+		if allowsFolder(c, item.FolderID) {
+			itemResponses = append(itemResponses, item.ToResponse())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": itemResponses})
+}
+
+// GetItem handles GET /api/vault/items/:id
+func (h *VaultHandler) GetItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	item, err := h.repo.GetItem(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vault item"})
+		return
+	}
+
+	if !allowsFolder(c, item.FolderID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+		return
+	}
+
+	setETag(c, item.Revision)
+	c.JSON(http.StatusOK, item.ToResponse())
+}
+
+// CreateItem handles POST /api/vault/items
+func (h *VaultHandler) CreateItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateVaultItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item := &models.VaultItem{
+		Type:     req.Type,
+		Data:     req.Data,
+		ClientID: req.ClientID,
+	}
+
+	folderID, ok := h.resolveFolder(c, userID, req.FolderID)
+	if !ok {
+		return
+	}
+	item.FolderID = folderID
+
+	if len(req.TagIDs) > 0 {
+		tagIDs, ok := h.resolveTags(c, userID, req.TagIDs)
+		if !ok {
+			return
+		}
+		item.TagIDs = tagIDs
+	}
+
+	if err := h.repo.CreateItem(c.Request.Context(), userID, item); err != nil {
+		if !errors.Is(err, database.ErrVaultItemExists) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vault item"})
+			return
+		}
+
+		// A retried create answers with the item the first attempt stored
+		existing, err := h.repo.GetItemByClientID(c.Request.Context(), userID, req.ClientID)
+		if err != nil && !errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create vault item"})
+			return
+		}
+		if err != nil || !allowsFolder(c, existing.FolderID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Vault item already exists"})
+			return
+		}
+		item = existing
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Vault item created successfully",
+		"item":    item.ToResponse(),
+	})
+}
+
+// UpdateItem handles PUT /api/vault/items/:id
+// Requires If-Match with the revision the client edited
+func (h *VaultHandler) UpdateItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	ifRevision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateVaultItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update := &database.VaultItemUpdate{
+		IfRevision: ifRevision,
+		Type:       req.Type,
+		Data:       req.Data,
+	}
+
+	// Access tokens restricted to folders may only edit items inside them
+	if token := requestAccessToken(c); token != nil {
+		update.InFolders = token.FolderIDs
+	}
+
+	if req.FolderID != nil {
+		folderID, ok := h.resolveFolder(c, userID, *req.FolderID)
+		if !ok {
+			return
+		}
+		update.SetFolder = true
+		update.FolderID = folderID
+	}
+
+	if req.TagIDs != nil {
+		tagIDs, ok := h.resolveTags(c, userID, *req.TagIDs)
+		if !ok {
+			return
+		}
+		update.SetTags = true
+		update.TagIDs = tagIDs
+	}
+
+	item, err := h.repo.UpdateItem(c.Request.Context(), userID, c.Param("id"), update, writerID(c))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		if errors.Is(err, database.ErrVaultItemConflict) {
+			h.itemConflict(c, userID)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update vault item"})
+		return
+	}
+
+	setETag(c, item.Revision)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Vault item updated successfully",
+		"item":    item.ToResponse(),
+	})
+}
+
+// MoveItems handles POST /api/vault/items/move
+// Assigns several items to a folder at once
+func (h *VaultHandler) MoveItems(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.MoveItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	folderID, ok := h.resolveFolder(c, userID, req.FolderID)
+	if !ok {
+		return
+	}
+
+	moved, err := h.repo.MoveItems(c.Request.Context(), userID, req.ItemIDs, folderID)
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move vault items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Vault items moved successfully",
+		"moved":   moved,
+	})
+}
+
+// ListRevisions handles GET /api/vault/items/:id/revisions
+func (h *VaultHandler) ListRevisions(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	revisions, err := h.repo.ListRevisions(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve revisions"})
+		return
+	}
+
+	revisionResponses := make([]models.VaultItemRevisionResponse, len(revisions))
+	for i, rev := range revisions {
+		revisionResponses[i] = rev.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisionResponses})
+}
+
+// RestoreRevision handles POST /api/vault/items/:id/revisions/:revision/restore
+func (h *VaultHandler) RestoreRevision(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	revision, err := strconv.ParseInt(c.Param("revision"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+		return
+	}
+
+	ifRevision, ok := ifMatchRevision(c)
+	if !ok {
+		return
+	}
+
+	item, err := h.repo.RestoreRevision(c.Request.Context(), userID, c.Param("id"), revision, ifRevision, writerID(c))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		if errors.Is(err, database.ErrRevisionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+			return
+		}
+		if errors.Is(err, database.ErrVaultItemConflict) {
+			h.itemConflict(c, userID)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore revision"})
+		return
+	}
+
+	setETag(c, item.Revision)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Revision restored successfully",
+		"item":    item.ToResponse(),
+	})
+}
+
+// DeleteItem handles DELETE /api/vault/items/:id
+// Moves the item to the trash; it is purged permanently after the retention period
+func (h *VaultHandler) DeleteItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	item, err := h.repo.TrashItem(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vault item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Vault item moved to trash",
+		"item":    item.ToResponse(),
+	})
+}
+
+// ListTrash handles GET /api/vault/trash
+func (h *VaultHandler) ListTrash(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	items, err := h.repo.ListTrash(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve trash"})
+		return
+	}
+
+	itemResponses := make([]models.VaultItemResponse, len(items))
+	for i, item := range items {
+		itemResponses[i] = item.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": itemResponses})
+}
+
+// RestoreItem handles POST /api/vault/trash/:id/restore
+func (h *VaultHandler) RestoreItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	item, err := h.repo.RestoreItem(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore vault item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Vault item restored successfully",
+		"item":    item.ToResponse(),
+	})
+}
+
+// PurgeItem handles DELETE /api/vault/trash/:id
+// Permanently deletes a trashed item and its revision history
+func (h *VaultHandler) PurgeItem(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	if err := h.repo.DeleteItem(c.Request.Context(), userID, c.Param("id")); err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found in trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete vault item"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Vault item deleted permanently"})
+}
+
+// EmptyTrash handles DELETE /api/vault/trash
+func (h *VaultHandler) EmptyTrash(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	deleted, err := h.repo.EmptyTrash(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to empty trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Trash emptied successfully",
+		"deleted": deleted,
+	})
+}
+
+// resolveFolder validates a folder ID from a request, responding with an error if it is unknown
+func (h *VaultHandler) resolveFolder(c *gin.Context, userID, id string) (*bson.ObjectID, bool) {
+	folderID, err := h.folders.ResolveFolderID(c.Request.Context(), userID, id)
+	if err != nil {
+		if errors.Is(err, database.ErrFolderNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Folder not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve folder"})
+		return nil, false
+	}
+	if !allowsFolder(c, folderID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access token cannot use this folder"})
+		return nil, false
+	}
+	return folderID, true
+}
+
+// resolveTags validates tag IDs from a request, responding with an error if any is unknown
+func (h *VaultHandler) resolveTags(c *gin.Context, userID string, ids []string) ([]bson.ObjectID, bool) {
+	tagIDs, err := h.tags.ResolveTagIDs(c.Request.Context(), userID, ids)
+	if err != nil {
+		if errors.Is(err, database.ErrTagNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tag not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve tags"})
+		return nil, false
+	}
+	return tagIDs, true
+}
+
+// itemConflict responds 409 with the current server copy of the requested item
+// so the client can merge or choose between versions
+func (h *VaultHandler) itemConflict(c *gin.Context, userID string) {
+	item, err := h.repo.GetItem(c.Request.Context(), userID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrVaultItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Vault item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vault item"})
+		return
+	}
+
+	setETag(c, item.Revision)
+	c.JSON(http.StatusConflict, gin.H{
+		"error": "Vault item was modified by another device",
+		"item":  item.ToResponse(),
+	})
+}
+
+// ifMatchRevision reads the revision a write is based on from the If-Match header.
+// Both quoted ETags and bare revisions are accepted; "*" matches any revision and
+// yields 0. A missing or malformed header is answered here and ok is false.
+func ifMatchRevision(c *gin.Context) (revision int64, ok bool) {
+	value := strings.TrimSpace(c.GetHeader("If-Match"))
+	if value == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the current revision is required"})
+		return 0, false
+	}
+
+	if value == "*" {
+		return 0, true
+	}
+
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	revision, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || revision < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid If-Match revision"})
+		return 0, false
+	}
+
+	return revision, true
+}
+
+// setETag exposes an entity's revision as its ETag for later If-Match requests
+func setETag(c *gin.Context, revision int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(revision, 10)+`"`)
+}
+
+// writerID identifies the authenticated credential making the request: the
+// login session (JWT ID) or the ID of the personal access token
+func writerID(c *gin.Context) string {
+	if token := requestAccessToken(c); token != nil {
+		return token.ID.Hex()
+	}
+	return c.GetString("sessionID")
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatchRevision(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		header   string
+		status   int
+		revision int64
+		ok       bool
+	}{
+		{"", http.StatusPreconditionRequired, 0, false},
+		{"*", http.StatusOK, 0, true},
+		{`"7"`, http.StatusOK, 7, true},
+		{`W/"7"`, http.StatusOK, 7, true},
+		{"7", http.StatusOK, 7, true},
+		{`"0"`, http.StatusBadRequest, 0, false},
+		{`"abc"`, http.StatusBadRequest, 0, false},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/vault/items/1", nil)
+		if tt.header != "" {
+			c.Request.Header.Set("If-Match", tt.header)
+		}
+
+		revision, ok := ifMatchRevision(c)
+		if ok != tt.ok || revision != tt.revision || w.Code != tt.status {
+			t.Errorf("If-Match %q: got %d, %v with status %d, want %d, %v with status %d",
+				tt.header, revision, ok, w.Code, tt.revision, tt.ok, tt.status)
+		}
+	}
+}
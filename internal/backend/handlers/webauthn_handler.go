@@ -0,0 +1,484 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// errPasskeyNotUsable is returned when an authenticator names a credential
+// that cannot log in without the password
+var errPasskeyNotUsable = errors.New("credential is not a passkey of this user")
+
+// BeginWebAuthnRegistration handles POST /api/auth/webauthn/register/begin
+// Starts registering a security key after verifying the password. A
+// passwordless credential must be discoverable and verify the user itself.
+func (h *AuthHandler) BeginWebAuthnRegistration(c *gin.Context) {
+	var req models.WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !h.checkPassword(c, user.Email, req.Password) {
+		return
+	}
+
+	webUser, ok := h.webauthnUser(c, user)
+	if !ok {
+		return
+	}
+
+	selection := protocol.AuthenticatorSelection{
+		ResidentKey:      protocol.ResidentKeyRequirementDiscouraged,
+		UserVerification: protocol.VerificationPreferred,
+	}
+	if req.Passwordless {
+		selection.ResidentKey = protocol.ResidentKeyRequirementRequired
+		selection.RequireResidentKey = protocol.ResidentKeyRequired()
+		selection.UserVerification = protocol.VerificationRequired
+	}
+
+	options, session, err := h.relyingParty.BeginRegistration(webUser,
+		webauthn.WithAuthenticatorSelection(selection),
+		webauthn.WithExclusions(webauthn.Credentials(webUser.Credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start registration"})
+		return
+	}
+
+	h.startCeremony(c, &models.WebAuthnCeremony{
+		Type:         models.WebAuthnRegistration,
+		UserID:       user.ID,
+		Name:         req.Name,
+		Passwordless: req.Passwordless,
+		Session:      *session,
+	}, options.Response)
+}
+
+// FinishWebAuthnRegistration handles POST /api/auth/webauthn/register/finish
+// Stores the security key once its attestation is verified and turns on
+// WebAuthn as a second factor. Backup codes are returned if the user had none yet.
+func (h *AuthHandler) FinishWebAuthnRegistration(c *gin.Context) {
+	var req models.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	ceremony, ok := h.finishCeremony(c, req.CeremonyID, models.WebAuthnRegistration)
+	if !ok {
+		return
+	}
+	if ceremony.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired ceremony"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator response"})
+		return
+	}
+
+	webUser, ok := h.webauthnUser(c, user)
+	if !ok {
+		return
+	}
+
+	credential, err := h.relyingParty.CreateCredential(webUser, ceremony.Session, parsed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Security key could not be verified"})
+		return
+	}
+
+	codes, hashes, ok := h.firstBackupCodes(c, user)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	record := &models.WebAuthnCredential{
+		UserID:       user.ID,
+		Name:         ceremony.Name,
+		Passwordless: ceremony.Passwordless,
+		Credential:   *credential,
+		CreatedAt:    time.Now(),
+	}
+	if err := h.passkeys.CreateCredential(ctx, record); err != nil {
+		if errors.Is(err, database.ErrWebAuthnCredentialExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Security key is already registered"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store security key"})
+		return
+	}
+
+	if err := h.repo.SetWebAuthnMFA(ctx, user.ID.Hex(), true, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"credential":   record,
+		"backup_codes": codes,
+	})
+}
+
+// ListWebAuthnCredentials handles GET /api/auth/webauthn/credentials
+// Lists the user's security keys and passkeys
+func (h *AuthHandler) ListWebAuthnCredentials(c *gin.Context) {
+	credentials, err := h.passkeys.ListCredentials(c.Request.Context(), c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve security keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials})
+}
+
+// RenameWebAuthnCredential handles PUT /api/auth/webauthn/credentials/:id
+func (h *AuthHandler) RenameWebAuthnCredential(c *gin.Context) {
+	var req models.RenameWebAuthnCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passkeys.RenameCredential(c.Request.Context(), c.GetString("userID"), c.Param("id"), req.Name); err != nil {
+		if errors.Is(err, database.ErrWebAuthnCredentialNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Security key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename security key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Security key renamed"})
+}
+
+// DeleteWebAuthnCredential handles DELETE /api/auth/webauthn/credentials/:id
+// Removes a security key after verifying the password. Removing the last one
+// turns WebAuthn off as a second factor.
+func (h *AuthHandler) DeleteWebAuthnCredential(c *gin.Context) {
+	var req models.DeleteWebAuthnCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !h.checkPassword(c, user.Email, req.Password) {
+		return
+	}
+
+	ctx := c.Request.Context()
+	remaining, err := h.passkeys.DeleteCredential(ctx, user.ID.Hex(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrWebAuthnCredentialNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Security key not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete security key"})
+		return
+	}
+
+	if remaining == 0 {
+		if err := h.repo.SetWebAuthnMFA(ctx, user.ID.Hex(), false, nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two-factor authentication"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Security key deleted"})
+}
+
+// BeginWebAuthnMFA handles POST /api/auth/mfa/webauthn/begin
+// Starts a security key assertion for the pending login of an MFA token
+func (h *AuthHandler) BeginWebAuthnMFA(c *gin.Context) {
+	var req models.WebAuthnMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	user, claims, ok := h.pendingMFA(c, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	if !user.MFA.WebAuthn {
+		c.JSON(http.StatusConflict, gin.H{"error": "No security key is registered"})
+		return
+	}
+
+	webUser, ok := h.webauthnUser(c, user)
+	if !ok {
+		return
+	}
+
+	options, session, err := h.relyingParty.BeginLogin(webUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start security key challenge"})
+		return
+	}
+
+	h.startCeremony(c, &models.WebAuthnCeremony{
+		Type:        models.WebAuthnMFA,
+		UserID:      user.ID,
+		ChallengeID: claims.ID,
+		Session:     *session,
+	}, options.Response)
+}
+
+// FinishWebAuthnMFA handles POST /api/auth/mfa/webauthn/finish
+// Exchanges the MFA token and a security key assertion for a session token.
+// A failed assertion counts against the pending login like a wrong code.
+func (h *AuthHandler) FinishWebAuthnMFA(c *gin.Context) {
+	var req models.WebAuthnMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.CeremonyID == "" || len(req.Credential) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ceremony ID and credential are required"})
+		return
+	}
+
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	user, claims, ok := h.pendingMFA(c, req.MFAToken)
+	if !ok {
+		return
+	}
+
+	ceremony, ok := h.finishCeremony(c, req.CeremonyID, models.WebAuthnMFA)
+	if !ok {
+		return
+	}
+	if ceremony.UserID != user.ID || ceremony.ChallengeID != claims.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired ceremony"})
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator response"})
+		return
+	}
+
+	webUser, ok := h.webauthnUser(c, user)
+	if !ok {
+		return
+	}
+
+	credential, err := h.relyingParty.ValidateLogin(webUser, ceremony.Session, parsed)
+	if err != nil || credential.Authenticator.CloneWarning {
+		h.failMFA(c, claims, "Security key could not be verified")
+		return
+	}
+
+	if !h.recordPasskeyUse(c, credential) {
+		return
+	}
+
+	// Each MFA token can be exchanged once
+	if err := h.repo.ConsumeMFAChallenge(c.Request.Context(), claims.UserID, claims.ID); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+// BeginPasskeyLogin handles POST /api/auth/webauthn/login/begin
+// Starts a login with a passkey; the authenticator picks the account
+func (h *AuthHandler) BeginPasskeyLogin(c *gin.Context) {
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	options, session, err := h.relyingParty.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	h.startCeremony(c, &models.WebAuthnCeremony{
+		Type:    models.WebAuthnPasswordless,
+		Session: *session,
+	}, options.Response)
+}
+
+// FinishPasskeyLogin handles POST /api/auth/webauthn/login/finish
+// Exchanges a passkey assertion for a session token. The passkey verifies the
+// user itself, so no second factor is asked for; the vault still needs the
+// master password to unlock.
+func (h *AuthHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req models.WebAuthnFinishRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.webauthnConfigured(c) {
+		return
+	}
+
+	ceremony, ok := h.finishCeremony(c, req.CeremonyID, models.WebAuthnPasswordless)
+	if !ok {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(req.Credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticator response"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	var user *models.User
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		record, err := h.passkeys.GetCredentialByCredentialID(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !record.Passwordless || !bytes.Equal(record.UserID[:], userHandle) {
+			return nil, errPasskeyNotUsable
+		}
+
+		user, err = h.repo.GetUserByID(ctx, record.UserID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		return &auth.WebAuthnUser{
+			ID:          record.UserID[:],
+			Email:       user.Email,
+			Credentials: []webauthn.Credential{record.Credential},
+		}, nil
+	}
+
+	_, credential, err := h.relyingParty.ValidatePasskeyLogin(findUser, ceremony.Session, parsed)
+	if err != nil || credential.Authenticator.CloneWarning {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey could not be verified"})
+		return
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+
+	if !h.recordPasskeyUse(c, credential) {
+		return
+	}
+
+	h.issueSession(c, user)
+}
+
+// webauthnConfigured writes a 503 response if no relying party is configured
+func (h *AuthHandler) webauthnConfigured(c *gin.Context) bool {
+	if h.relyingParty == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Security keys are not available"})
+		return false
+	}
+	return true
+}
+
+// webauthnUser loads the user's registered credentials for a ceremony,
+// writing the error response if it cannot
+func (h *AuthHandler) webauthnUser(c *gin.Context, user *models.User) (*auth.WebAuthnUser, bool) {
+	records, err := h.passkeys.ListCredentials(c.Request.Context(), user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve security keys"})
+		return nil, false
+	}
+
+	credentials := make([]webauthn.Credential, len(records))
+	for i, record := range records {
+		credentials[i] = record.Credential
+	}
+
+	return &auth.WebAuthnUser{
+		ID:          user.ID[:],
+		Email:       user.Email,
+		Credentials: credentials,
+	}, true
+}
+
+// startCeremony stores a ceremony and responds with the options for the authenticator
+func (h *AuthHandler) startCeremony(c *gin.Context, ceremony *models.WebAuthnCeremony, options any) {
+	ceremony.ExpiresAt = ceremony.Session.Expires
+	if err := h.passkeys.CreateCeremony(c.Request.Context(), ceremony); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store ceremony"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.WebAuthnOptionsResponse{
+		CeremonyID: ceremony.ID.Hex(),
+		Options:    options,
+	})
+}
+
+// finishCeremony takes an unexpired ceremony of the given type out of the
+// store, writing the error response if there is none. A ceremony can be
+// finished once, whether or not the authenticator's response verifies.
+func (h *AuthHandler) finishCeremony(c *gin.Context, id, ceremonyType string) (*models.WebAuthnCeremony, bool) {
+	ceremony, err := h.passkeys.ConsumeCeremony(c.Request.Context(), id)
+	if err != nil && !errors.Is(err, database.ErrWebAuthnCeremonyNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve ceremony"})
+		return nil, false
+	}
+	if err != nil || ceremony.Type != ceremonyType {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired ceremony"})
+		return nil, false
+	}
+	return ceremony, true
+}
+
+// recordPasskeyUse stores the signature counter of a verified assertion,
+// writing the error response if it cannot
+func (h *AuthHandler) recordPasskeyUse(c *gin.Context, credential *webauthn.Credential) bool {
+	if err := h.passkeys.RecordCredentialUse(c.Request.Context(), credential.ID, credential.Authenticator); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security key"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The relying party the tests register security keys with
+const (
+	testRPID   = "passgo.test"
+	testOrigin = "https://passgo.test"
+)
+
+// memPasskeyStore is an in-memory passkeyStore
+type memPasskeyStore struct {
+	mu          sync.Mutex
+	credentials []*models.WebAuthnCredential
+	ceremonies  map[string]*models.WebAuthnCeremony
+}
+
+func newMemPasskeyStore() *memPasskeyStore {
+	return &memPasskeyStore{ceremonies: make(map[string]*models.WebAuthnCeremony)}
+}
+
+func (s *memPasskeyStore) CreateCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.credentials {
+		if bytes.Equal(existing.Credential.ID, credential.Credential.ID) {
+			return database.ErrWebAuthnCredentialExists
+		}
+	}
+	credential.ID = bson.NewObjectID()
+	copied := *credential
+	s.credentials = append(s.credentials, &copied)
+	return nil
+}
+
+func (s *memPasskeyStore) ListCredentials(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	credentials := []*models.WebAuthnCredential{}
+	for _, credential := range s.credentials {
+		if credential.UserID.Hex() == userID {
+			copied := *credential
+			credentials = append(credentials, &copied)
+		}
+	}
+	return credentials, nil
+}
+
+func (s *memPasskeyStore) GetCredentialByCredentialID(ctx context.Context, credentialID []byte) (*models.WebAuthnCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, credential := range s.credentials {
+		if bytes.Equal(credential.Credential.ID, credentialID) {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+	return nil, database.ErrWebAuthnCredentialNotFound
+}
+
+func (s *memPasskeyStore) RecordCredentialUse(ctx context.Context, credentialID []byte, authenticator webauthn.Authenticator) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, credential := range s.credentials {
+		if bytes.Equal(credential.Credential.ID, credentialID) {
+			now := time.Now()
+			credential.Credential.Authenticator = authenticator
+			credential.LastUsedAt = &now
+			return nil
+		}
+	}
+	return database.ErrWebAuthnCredentialNotFound
+}
+
+func (s *memPasskeyStore) RenameCredential(ctx context.Context, userID, id, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, credential := range s.credentials {
+		if credential.UserID.Hex() == userID && credential.ID.Hex() == id {
+			credential.Name = name
+			return nil
+		}
+	}
+	return database.ErrWebAuthnCredentialNotFound
+}
+
+func (s *memPasskeyStore) DeleteCredential(ctx context.Context, userID, id string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var remaining []*models.WebAuthnCredential
+	var left int64
+	for _, credential := range s.credentials {
+		if credential.UserID.Hex() == userID && credential.ID.Hex() == id {
+			continue
+		}
+		if credential.UserID.Hex() == userID {
+			left++
+		}
+		remaining = append(remaining, credential)
+	}
+	if len(remaining) == len(s.credentials) {
+		return 0, database.ErrWebAuthnCredentialNotFound
+	}
+	s.credentials = remaining
+	return left, nil
+}
+
+func (s *memPasskeyStore) CreateCeremony(ctx context.Context, ceremony *models.WebAuthnCeremony) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ceremony.ID = bson.NewObjectID()
+	copied := *ceremony
+	s.ceremonies[ceremony.ID.Hex()] = &copied
+	return nil
+}
+
+func (s *memPasskeyStore) ConsumeCeremony(ctx context.Context, id string) (*models.WebAuthnCeremony, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ceremony, ok := s.ceremonies[id]
+	if !ok || time.Now().After(ceremony.ExpiresAt) {
+		return nil, database.ErrWebAuthnCeremonyNotFound
+	}
+	delete(s.ceremonies, id)
+	return ceremony, nil
+}
+
+// softAuthenticator is a software security key holding one P-256 credential
+type softAuthenticator struct {
+	key        *ecdsa.PrivateKey
+	id         []byte
+	userHandle []byte
+	counter    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{key: key, id: id}
+}
+
+// ceremonyOptions is the part of a begin response the authenticator needs
+type ceremonyOptions struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    struct {
+		Challenge string `json:"challenge"`
+		User      struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"options"`
+	Error string `json:"error"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// clientData builds the clientDataJSON a browser would send for a ceremony
+func clientData(t *testing.T, ceremonyType, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":      ceremonyType,
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// authenticatorData builds the authenticator data for the flags and the
+// next signature counter, followed by any attested credential data
+func (a *softAuthenticator) authenticatorData(flags byte, attested []byte) []byte {
+	a.counter++
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	return append(data, attested...)
+}
+
+// create answers a registration ceremony like navigator.credentials.create()
+func (a *softAuthenticator) create(t *testing.T, options ceremonyOptions) json.RawMessage {
+	t.Helper()
+
+	userHandle, err := b64.DecodeString(options.Options.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = userHandle
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, publicKey...)
+
+	// User present, user verified, attested credential data
+	authData := a.authenticatorData(0x45, attested)
+	attestation, err := webauthncbor.Marshal(struct {
+		Format   string         `cbor:"fmt"`
+		AttStmt  map[string]any `cbor:"attStmt"`
+		AuthData []byte         `cbor:"authData"`
+	}{"none", map[string]any{}, authData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData(t, "webauthn.create", options.Options.Challenge)),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// get answers a login ceremony like navigator.credentials.get()
+func (a *softAuthenticator) get(t *testing.T, options ceremonyOptions) json.RawMessage {
+	t.Helper()
+
+	// User present, user verified
+	authData := a.authenticatorData(0x05, nil)
+	data := clientData(t, "webauthn.get", options.Options.Challenge)
+	dataHash := sha256.Sum256(data)
+	digest := sha256.Sum256(append(bytes.Clone(authData), dataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(data),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+// credential wraps an authenticator response into a PublicKeyCredential
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"id":       b64.EncodeToString(a.id),
+		"rawId":    b64.EncodeToString(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// registrationResponse is the body of the register/finish endpoint
+type registrationResponse struct {
+	Credential  models.WebAuthnCredential `json:"credential"`
+	BackupCodes []string                  `json:"backup_codes"`
+	Error       string                    `json:"error"`
+}
+
+// registerKey registers the authenticator for the session's user
+func (e *authTestEnv) registerKey(t *testing.T, token, password string, key *softAuthenticator, passwordless bool) registrationResponse {
+	t.Helper()
+
+	var options ceremonyOptions
+	begin := models.WebAuthnRegisterRequest{Password: password, Name: "Test key", Passwordless: passwordless}
+	if code := e.do(t, "POST", "/api/auth/webauthn/register/begin", token, begin, &options); code != http.StatusOK {
+		t.Fatalf("Expected register begin to return %d, got %d: %s", http.StatusOK, code, options.Error)
+	}
+
+	var registered registrationResponse
+	finish := models.WebAuthnFinishRequest{CeremonyID: options.CeremonyID, Credential: key.create(t, options)}
+	if code := e.do(t, "POST", "/api/auth/webauthn/register/finish", token, finish, &registered); code != http.StatusCreated {
+		t.Fatalf("Expected register finish to return %d, got %d: %s", http.StatusCreated, code, registered.Error)
+	}
+	return registered
+}
+
+// beginKeyMFA starts a security key assertion for a pending login
+func (e *authTestEnv) beginKeyMFA(t *testing.T, mfaToken string) ceremonyOptions {
+	t.Helper()
+
+	var options ceremonyOptions
+	begin := models.WebAuthnMFARequest{MFAToken: mfaToken}
+	if code := e.do(t, "POST", "/api/auth/mfa/webauthn/begin", "", begin, &options); code != http.StatusOK {
+		t.Fatalf("Expected MFA begin to return %d, got %d: %s", http.StatusOK, code, options.Error)
+	}
+	return options
+}
+
+func TestSecurityKeyAsSecondFactor(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.loginSession(t, "alice@example.com", "password123")
+
+	key := newSoftAuthenticator(t)
+	registered := env.registerKey(t, token, "password123", key, false)
+	if len(registered.BackupCodes) == 0 {
+		t.Fatal("Expected backup codes with the first second factor")
+	}
+	if registered.Credential.Name != "Test key" || registered.Credential.Passwordless {
+		t.Errorf("Unexpected credential %+v", registered.Credential)
+	}
+
+	// The same key cannot be registered twice
+	var options ceremonyOptions
+	begin := models.WebAuthnRegisterRequest{Password: "password123", Name: "Again"}
+	env.do(t, "POST", "/api/auth/webauthn/register/begin", token, begin, &options)
+	again := models.WebAuthnFinishRequest{CeremonyID: options.CeremonyID, Credential: key.create(t, options)}
+	if code := env.do(t, "POST", "/api/auth/webauthn/register/finish", token, again, nil); code == http.StatusCreated {
+		t.Error("Expected an excluded key to be rejected")
+	}
+
+	var login models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: "alice@example.com", Password: "password123"}, &login)
+	if !login.MFARequired || login.Token != "" {
+		t.Fatalf("Expected login to require MFA, got %+v", login)
+	}
+	if len(login.MFAMethods) != 2 || login.MFAMethods[0] != models.MFAMethodWebAuthn {
+		t.Errorf("Expected webauthn and backup code methods, got %v", login.MFAMethods)
+	}
+
+	options = env.beginKeyMFA(t, login.MFAToken)
+	finish := models.WebAuthnMFARequest{MFAToken: login.MFAToken, CeremonyID: options.CeremonyID, Credential: key.get(t, options)}
+
+	var session models.AuthResponse
+	if code := env.do(t, "POST", "/api/auth/mfa/webauthn/finish", "", finish, &session); code != http.StatusOK {
+		t.Fatalf("Expected MFA finish to return %d, got %d", http.StatusOK, code)
+	}
+	if session.Token == "" || session.Keys == nil {
+		t.Error("Expected a session token and vault keys")
+	}
+
+	// The ceremony and the MFA token work once
+	if code := env.do(t, "POST", "/api/auth/mfa/webauthn/finish", "", finish, nil); code == http.StatusOK {
+		t.Error("Expected a replayed assertion to be rejected")
+	}
+
+	stored, _ := env.passkeys.GetCredentialByCredentialID(context.Background(), key.id)
+	if stored.LastUsedAt == nil || stored.Credential.Authenticator.SignCount != key.counter {
+		t.Errorf("Expected the signature counter to be recorded, got %+v", stored.Credential.Authenticator)
+	}
+}
+
+func TestSecurityKeyAssertionIsCountedAsFailure(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.loginSession(t, "alice@example.com", "password123")
+	key := newSoftAuthenticator(t)
+	env.registerKey(t, token, "password123", key, false)
+
+	var login models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: "alice@example.com", Password: "password123"}, &login)
+
+	// A cloned key signs with a counter the server has already seen
+	options := env.beginKeyMFA(t, login.MFAToken)
+	key.counter = 0
+	finish := models.WebAuthnMFARequest{MFAToken: login.MFAToken, CeremonyID: options.CeremonyID, Credential: key.get(t, options)}
+
+	var failed struct {
+		AttemptsLeft int `json:"attempts_left"`
+	}
+	if code := env.do(t, "POST", "/api/auth/mfa/webauthn/finish", "", finish, &failed); code != http.StatusUnauthorized {
+		t.Fatalf("Expected a cloned key to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	if failed.AttemptsLeft != maxMFAFailures-1 {
+		t.Errorf("Expected %d attempts left, got %d", maxMFAFailures-1, failed.AttemptsLeft)
+	}
+
+	// A ceremony of another login cannot finish this one
+	other := newSoftAuthenticator(t)
+	options = env.beginKeyMFA(t, login.MFAToken)
+	finish = models.WebAuthnMFARequest{MFAToken: login.MFAToken, CeremonyID: options.CeremonyID, Credential: other.get(t, options)}
+	if code := env.do(t, "POST", "/api/auth/mfa/webauthn/finish", "", finish, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown key to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.loginSession(t, "alice@example.com", "password123")
+
+	passkey := newSoftAuthenticator(t)
+	env.registerKey(t, token, "password123", passkey, true)
+	securityKey := newSoftAuthenticator(t)
+	env.registerKey(t, token, "password123", securityKey, false)
+
+	var options ceremonyOptions
+	if code := env.do(t, "POST", "/api/auth/webauthn/login/begin", "", nil, &options); code != http.StatusOK {
+		t.Fatalf("Expected login begin to return %d, got %d", http.StatusOK, code)
+	}
+
+	var session models.AuthResponse
+	finish := models.WebAuthnFinishRequest{CeremonyID: options.CeremonyID, Credential: passkey.get(t, options)}
+	if code := env.do(t, "POST", "/api/auth/webauthn/login/finish", "", finish, &session); code != http.StatusOK {
+		t.Fatalf("Expected passkey login to return %d, got %d", http.StatusOK, code)
+	}
+	if session.Token == "" || session.MFARequired || session.User.Email != "alice@example.com" {
+		t.Errorf("Expected a session for alice, got %+v", session)
+	}
+
+	// A key registered as a second factor only cannot replace the password
+	env.do(t, "POST", "/api/auth/webauthn/login/begin", "", nil, &options)
+	finish = models.WebAuthnFinishRequest{CeremonyID: options.CeremonyID, Credential: securityKey.get(t, options)}
+	if code := env.do(t, "POST", "/api/auth/webauthn/login/finish", "", finish, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a second factor key to return %d, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestDeleteLastSecurityKeyDisablesMFA(t *testing.T) {
+	env := newAuthTestEnv(t)
+	token := env.loginSession(t, "alice@example.com", "password123")
+	registered := env.registerKey(t, token, "password123", newSoftAuthenticator(t), false)
+	path := "/api/auth/webauthn/credentials/" + registered.Credential.ID.Hex()
+
+	rename := models.RenameWebAuthnCredentialRequest{Name: "Desk key"}
+	if code := env.do(t, "PUT", path, token, rename, nil); code != http.StatusOK {
+		t.Fatalf("Expected rename to return %d, got %d", http.StatusOK, code)
+	}
+
+	var list struct {
+		Credentials []models.WebAuthnCredential `json:"credentials"`
+	}
+	env.do(t, "GET", "/api/auth/webauthn/credentials", token, nil, &list)
+	if len(list.Credentials) != 1 || list.Credentials[0].Name != "Desk key" {
+		t.Fatalf("Expected the renamed key, got %+v", list.Credentials)
+	}
+
+	if code := env.do(t, "DELETE", path, token, models.DeleteWebAuthnCredentialRequest{Password: "wrong"}, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong password to return %d, got %d", http.StatusUnauthorized, code)
+	}
+	if code := env.do(t, "DELETE", path, token, models.DeleteWebAuthnCredentialRequest{Password: "password123"}, nil); code != http.StatusOK {
+		t.Fatalf("Expected delete to return %d, got %d", http.StatusOK, code)
+	}
+
+	var login models.AuthResponse
+	env.do(t, "POST", "/api/auth/login", "", models.LoginRequest{Email: "alice@example.com", Password: "password123"}, &login)
+	if login.MFARequired || login.Token == "" {
+		t.Error("Expected MFA to be off once the last key is deleted")
+	}
+}
@@ -0,0 +1,75 @@
+// Package mail delivers the transactional emails of the backend
+package mail
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+)
+
+// Sender delivers plain-text emails
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// NewSender creates an SMTP sender when SMTP_HOST is configured. Without it
+// emails are written to the log, which is enough for local development.
+func NewSender() Sender {
+	if config.SMTPHost == "" {
+		return logSender{}
+	}
+
+	return &smtpSender{
+		addr:     net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort)),
+		host:     config.SMTPHost,
+		username: config.SMTPUsername,
+		password: config.SMTPPassword,
+		from:     config.SMTPFrom,
+	}
+}
+
+// smtpSender sends emails through an SMTP server
+type smtpSender struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// Send delivers an email, authenticating when a username is configured
+func (s *smtpSender) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	return smtp.SendMail(s.addr, auth, s.from, []string{to}, message(s.from, to, subject, body))
+}
+
+// logSender writes emails to the log instead of sending them
+type logSender struct{}
+
+// Send logs an email
+func (logSender) Send(to, subject, body string) error {
+	log.Printf("Email to %s (SMTP not configured): %s\n%s", to, subject, body)
+	return nil
+}
+
+// message builds an RFC 5322 plain-text message
+func message(from, to, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
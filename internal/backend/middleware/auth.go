@@ -1,15 +1,31 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
 )
 
-// AuthMiddleware validates JWT tokens and sets user information in context
-func AuthMiddleware() gin.HandlerFunc {
+// sessionTouchInterval is how often the last seen time of a session in use
+// is written, so that not every request costs a database write
+const sessionTouchInterval = 5 * time.Minute
+
+// accessTokenTouchInterval is how often the last used time of a personal
+// access token in use is written
+const accessTokenTouchInterval = time.Minute
+
+// AuthMiddleware validates JWT tokens and sets user information in context.
+// Personal access tokens are accepted as well when the route names the scopes
+// they need; routes without scopes are reserved for logged in sessions.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -28,6 +44,11 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := parts[1]
 
+		if strings.HasPrefix(tokenString, crypto.AccessTokenCredentialPrefix) {
+			authenticateAccessToken(c, tokenString, scopes)
+			return
+		}
+
 		// Verify the token
 		claims, err := auth.VerifyToken(tokenString)
 		if err != nil {
@@ -45,13 +66,130 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Reject tokens of sessions that were signed out or revoked, and
+		// tokens issued before the user's sessions were revoked. Both are
+		// read in one query since every request of a session pays for it.
+		sessions := database.NewSessionRepository()
+		session, user, err := sessions.GetSessionUser(c.Request.Context(), claims.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrSessionNotFound):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			case errors.Is(err, database.ErrUserNotFound):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			}
+			c.Abort()
+			return
+		}
+		if session.UserID.Hex() != claims.UserID || user.SessionVersion != claims.SessionVersion {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+		if !user.IsActive {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+			c.Abort()
+			return
+		}
+		if time.Since(session.LastSeenAt) > sessionTouchInterval {
+			if err := sessions.TouchSession(c.Request.Context(), session.ID, c.ClientIP()); err != nil {
+				log.Printf("Failed to update last seen time of session %s: %v", session.ID.Hex(), err)
+			}
+		}
+
 		// Set user information in context for handlers to use
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("supabaseUID", claims.SupabaseUID)
+		c.Set("sessionID", claims.ID)
 		c.Set("claims", claims)
 
 		c.Next()
 	}
 }
 
+// AdminOnly restricts a route to the accounts listed in ADMIN_EMAILS. It
+// must run after AuthMiddleware, which sets the caller's email.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.GetString("email")
+		for _, admin := range strings.Split(config.AdminEmails, ",") {
+			if admin = strings.TrimSpace(admin); admin != "" && strings.EqualFold(admin, email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		c.Abort()
+	}
+}
+
+// authenticateAccessToken validates a personal access token credential
+// against the scopes a route needs and sets the token's user in context
+func authenticateAccessToken(c *gin.Context, credential string, scopes []string) {
+	if len(scopes) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens cannot be used for this endpoint"})
+		c.Abort()
+		return
+	}
+
+	authKey, err := crypto.ParseAccessTokenCredential(credential)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+		c.Abort()
+		return
+	}
+
+	ctx := c.Request.Context()
+	tokens := database.NewAccessTokenRepository()
+	token, err := tokens.GetAccessTokenByVerifier(ctx, crypto.AccessTokenVerifier(authKey))
+	if err != nil {
+		if errors.Is(err, database.ErrAccessTokenNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Access token is invalid, expired or revoked"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify access token"})
+		}
+		c.Abort()
+		return
+	}
+
+	for _, scope := range scopes {
+		if !token.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access token lacks the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+	}
+
+	user, err := database.NewUserRepository().GetUserByID(ctx, token.UserID.Hex())
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User no longer exists"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify access token"})
+		}
+		c.Abort()
+		return
+	}
+	if !user.IsActive {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		c.Abort()
+		return
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > accessTokenTouchInterval {
+		if err := tokens.RecordAccessTokenUse(ctx, token.ID, c.ClientIP()); err != nil {
+			log.Printf("Failed to update last used time of access token %s: %v", token.ID.Hex(), err)
+		}
+	}
+
+	c.Set("userID", user.ID.Hex())
+	c.Set("email", user.Email)
+	c.Set("supabaseUID", user.SupabaseUID)
+	c.Set("accessToken", token)
+
+	c.Next()
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+)
+
+func TestAccessTokensNeedScopedRoutes(t *testing.T) {
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/account", AuthMiddleware(), ok)
+	router.GET("/vault", AuthMiddleware(models.ScopeVaultRead), ok)
+
+	authKey := make([]byte, crypto.KeySize)
+	for _, tc := range []struct {
+		path       string
+		credential string
+		want       int
+	}{
+		// Routes without scopes refuse tokens before looking them up
+		{"/account", crypto.AccessTokenCredential(authKey), http.StatusForbidden},
+		{"/vault", crypto.AccessTokenCredentialPrefix + "not-a-key", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.credential)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("Expected %s with %q to return %d, got %d", tc.path, tc.credential, tc.want, w.Code)
+		}
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	previous := config.AdminEmails
+	config.AdminEmails = "root@example.com, Admin@Example.com"
+	t.Cleanup(func() { config.AdminEmails = previous })
+
+	for _, tc := range []struct {
+		email string
+		want  int
+	}{
+		{"admin@example.com", http.StatusOK},
+		{"root@example.com", http.StatusOK},
+		{"alice@example.com", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	} {
+		router := gin.New()
+		router.GET("/users", func(c *gin.Context) {
+			if tc.email != "" {
+				c.Set("email", tc.email)
+			}
+		}, AdminOnly(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+		if w.Code != tc.want {
+			t.Errorf("Expected %q to get %d, got %d", tc.email, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// maxPeekBody is how much of a request body is read to find its email
+const maxPeekBody = 64 << 10
+
+// RateLimitStore keeps the counters of rate limits and the failed logins of
+// accounts. database.RateLimitRepository shares them between backend
+// instances; MemoryRateLimitStore keeps them in process memory.
+type RateLimitStore interface {
+	Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (current, previous int64, err error)
+	GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error)
+	RecordLoginFailure(ctx context.Context, key string, ttl time.Duration) (*models.LoginFailures, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// Rate allows Limit requests per sliding Window; the zero Rate allows any number
+type Rate struct {
+	Limit  int64
+	Window time.Duration
+}
+
+// RateLimitRule limits the requests to a route per client IP and per email
+// address named in the request body
+type RateLimitRule struct {
+	Name  string
+	IP    Rate
+	Email Rate
+}
+
+// ParseRateLimit parses a rule written as "<per IP>,<per email>", where each
+// rate is "<requests>/<window>" such as "10/1m", or empty for no limit
+func ParseRateLimit(name, spec string) (RateLimitRule, error) {
+	rule := RateLimitRule{Name: name}
+
+	ipSpec, emailSpec, _ := strings.Cut(spec, ",")
+	var err error
+	if rule.IP, err = parseRate(ipSpec); err != nil {
+		return rule, fmt.Errorf("invalid rate limit %q for %s: %w", spec, name, err)
+	}
+	if rule.Email, err = parseRate(emailSpec); err != nil {
+		return rule, fmt.Errorf("invalid rate limit %q for %s: %w", spec, name, err)
+	}
+
+	return rule, nil
+}
+
+func parseRate(spec string) (Rate, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return Rate{}, nil
+	}
+
+	limitSpec, windowSpec, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("missing window")
+	}
+
+	limit, err := strconv.ParseInt(strings.TrimSpace(limitSpec), 10, 64)
+	if err != nil || limit <= 0 {
+		return Rate{}, fmt.Errorf("invalid request count %q", limitSpec)
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(windowSpec))
+	if err != nil || window < time.Second {
+		return Rate{}, fmt.Errorf("invalid window %q", windowSpec)
+	}
+
+	return Rate{Limit: limit, Window: window}, nil
+}
+
+// LockoutPolicy slows down and then blocks logins to an account after
+// consecutive failures
+type LockoutPolicy struct {
+	// DelayAfter failures are free; each one after that doubles the wait
+	// before the next attempt, starting at one second
+	DelayAfter int64
+	// Threshold failures lock the account for Duration after the last one
+	Threshold int64
+	Duration  time.Duration
+}
+
+// RateLimiter enforces rate limit rules and login lockouts against a store
+type RateLimiter struct {
+	store   RateLimitStore
+	lockout LockoutPolicy
+}
+
+// NewRateLimiter creates a rate limiter with the configured lockout policy
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{
+		store: store,
+		lockout: LockoutPolicy{
+			DelayAfter: int64(config.LoginDelayAfter),
+			Threshold:  int64(config.LoginLockoutThreshold),
+			Duration:   time.Duration(config.LoginLockoutMinutes) * time.Minute,
+		},
+	}
+}
+
+// Limit rejects requests beyond the rule's rates with 429 Too Many Requests.
+// Counting uses sliding windows, estimated from the counts of the current and
+// the previous fixed window. Store failures let requests through.
+func (l *RateLimiter) Limit(rule RateLimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rule.IP.Limit > 0 {
+			if wait, ok := l.allow(c, "ip:"+rule.Name+":"+c.ClientIP(), rule.IP); !ok {
+				tooManyRequests(c, wait, "Too many requests, please try again later")
+				return
+			}
+		}
+
+		if rule.Email.Limit > 0 {
+			if email := requestEmail(c); email != "" {
+				if wait, ok := l.allow(c, "email:"+rule.Name+":"+email, rule.Email); !ok {
+					tooManyRequests(c, wait, "Too many requests for this account, please try again later")
+					return
+				}
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// LoginLockout delays and eventually blocks logins to an account after
+// consecutive failed attempts, and forgets the failures after a successful
+// one. A correct password of an account with two-factor authentication only
+// counts as success once the MFA step completes; see MFALockout.
+func (l *RateLimiter) LoginLockout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := requestEmail(c)
+		if email == "" {
+			c.Next()
+			return
+		}
+		l.limitLogins(c, "login:"+email, true)
+	}
+}
+
+// MFALockout counts failed second factors of a login against the account's
+// login failures, so that guessing codes is throttled like guessing
+// passwords. The account is named by the request's MFA token.
+func (l *RateLimiter) MFALockout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := requestMFAEmail(c)
+		if email == "" {
+			c.Next()
+			return
+		}
+		l.limitLogins(c, "login:"+email, true)
+	}
+}
+
+// PasswordLockout counts wrong passwords sent to authenticated routes that
+// check the password again, such as a password change, against the account's
+// login failures. It must run after AuthMiddleware, which names the account.
+// A correct password there proves no second factor, so it forgets nothing.
+func (l *RateLimiter) PasswordLockout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email := c.GetString("email")
+		if email == "" {
+			c.Next()
+			return
+		}
+		l.limitLogins(c, "login:"+hashedEmail(email), false)
+	}
+}
+
+// limitLogins applies the lockout policy to a request of the account key.
+// Unless reset is false, a successful login forgets earlier failures.
+func (l *RateLimiter) limitLogins(c *gin.Context, key string, reset bool) {
+	ctx := c.Request.Context()
+	failures, err := l.store.GetLoginFailures(ctx, key)
+	if err != nil {
+		log.Printf("Failed to read login failures: %v", err)
+		c.Next()
+		return
+	}
+
+	if wait := l.lockout.wait(failures, time.Now()); wait > 0 {
+		tooManyRequests(c, wait, "Too many failed login attempts, please try again later")
+		return
+	}
+
+	c.Next()
+
+	switch c.Writer.Status() {
+	case http.StatusUnauthorized:
+		if _, err := l.store.RecordLoginFailure(ctx, key, l.lockout.Duration); err != nil {
+			log.Printf("Failed to record login failure: %v", err)
+		}
+	case http.StatusOK:
+		if reset && failures.Failures > 0 && !c.GetBool("mfaRequired") {
+			if err := l.store.ResetLoginFailures(ctx, key); err != nil {
+				log.Printf("Failed to reset login failures: %v", err)
+			}
+		}
+	}
+}
+
+// allow counts a request against key and reports whether it is within rate,
+// or else how long the client should wait
+func (l *RateLimiter) allow(c *gin.Context, key string, rate Rate) (time.Duration, bool) {
+	now := time.Now()
+	windowStart := now.Truncate(rate.Window)
+
+	current, previous, err := l.store.Hit(c.Request.Context(), key, windowStart, rate.Window)
+	if err != nil {
+		log.Printf("Failed to count request for rate limit: %v", err)
+		return 0, true
+	}
+
+	// The previous window counts in proportion to how much of it the sliding
+	// window still covers
+	elapsed := now.Sub(windowStart)
+	weight := float64(rate.Window-elapsed) / float64(rate.Window)
+	estimate := float64(previous)*weight + float64(current)
+	if estimate <= float64(rate.Limit) {
+		return 0, true
+	}
+
+	return windowStart.Add(rate.Window).Sub(now), false
+}
+
+// wait returns how long the next login attempt must wait after failures
+func (p LockoutPolicy) wait(failures *models.LoginFailures, now time.Time) time.Duration {
+	var delay time.Duration
+	switch {
+	case p.Threshold > 0 && failures.Failures >= p.Threshold:
+		delay = p.Duration
+	case failures.Failures > p.DelayAfter:
+		exponent := min(failures.Failures-p.DelayAfter-1, 30)
+		delay = min(time.Second<<exponent, p.Duration)
+	default:
+		return 0
+	}
+
+	return failures.LastFailureAt.Add(delay).Sub(now)
+}
+
+// tooManyRequests rejects a request with 429 and a Retry-After header
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.FormatInt(max(seconds, 1), 10))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message})
+	c.Abort()
+}
+
+// requestEmail returns a hash of the email address in a JSON request body,
+// or "" if there is none, and leaves the body for the handler to read. Only
+// the hash is used in keys, so stored counters do not reveal addresses.
+func requestEmail(c *gin.Context) string {
+	if value, ok := c.Get("rateLimitEmail"); ok {
+		return value.(string)
+	}
+
+	email := ""
+	var req struct {
+		Email string `json:"email"`
+	}
+	if peekJSON(c, &req) && req.Email != "" {
+		email = hashedEmail(req.Email)
+	}
+
+	c.Set("rateLimitEmail", email)
+	return email
+}
+
+// requestMFAEmail returns a hash of the email address of the account whose
+// MFA token is in a JSON request body, or "" if there is no valid one
+func requestMFAEmail(c *gin.Context) string {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	if !peekJSON(c, &req) || req.MFAToken == "" {
+		return ""
+	}
+
+	claims, err := auth.VerifyMFAToken(req.MFAToken)
+	if err != nil || claims.Email == "" {
+		return ""
+	}
+	return hashedEmail(claims.Email)
+}
+
+// peekJSON decodes the start of a JSON request body into v and leaves the
+// body for the handler to read. It reports whether decoding succeeded.
+func peekJSON(c *gin.Context, v any) bool {
+	if c.Request.Body == nil {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	return err == nil && json.Unmarshal(body, v) == nil
+}
+
+// hashedEmail returns the hash of a normalized email address
+func hashedEmail(email string) string {
+	digest := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(digest[:])
+}
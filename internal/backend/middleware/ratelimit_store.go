@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// memorySweepInterval is how often MemoryRateLimitStore drops expired entries
+const memorySweepInterval = time.Minute
+
+// MemoryRateLimitStore keeps rate limit counters and login failures in
+// process memory. Limits only hold per backend instance, so deployments with
+// several instances should use database.RateLimitRepository instead.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	counters  map[string]*models.RateLimitCounter
+	failures  map[string]*models.LoginFailures
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		counters:  make(map[string]*models.RateLimitCounter),
+		failures:  make(map[string]*models.LoginFailures),
+		lastSweep: time.Now(),
+	}
+}
+
+// Hit counts a request against key in the window starting at windowStart and
+// returns the counts of that window and of the one before it
+func (s *MemoryRateLimitStore) Hit(ctx context.Context, key string, windowStart time.Time, window time.Duration) (current, previous int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+
+	id := key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	counter, ok := s.counters[id]
+	if !ok {
+		counter = &models.RateLimitCounter{ID: id, ExpiresAt: windowStart.Add(2 * window)}
+		s.counters[id] = counter
+	}
+	counter.Count++
+
+	if before, ok := s.counters[key+":"+strconv.FormatInt(windowStart.Add(-window).Unix(), 10)]; ok {
+		previous = before.Count
+	}
+
+	return counter.Count, previous, nil
+}
+
+// GetLoginFailures retrieves the failed logins recorded under key
+func (s *MemoryRateLimitStore) GetLoginFailures(ctx context.Context, key string) (*models.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failures, ok := s.failures[key]
+	if !ok || !failures.ExpiresAt.After(time.Now()) {
+		return &models.LoginFailures{ID: key}, nil
+	}
+
+	copied := *failures
+	return &copied, nil
+}
+
+// RecordLoginFailure counts a failed login under key and keeps the failures
+// until ttl has passed without another one
+func (s *MemoryRateLimitStore) RecordLoginFailure(ctx context.Context, key string, ttl time.Duration) (*models.LoginFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep()
+
+	now := time.Now()
+	failures, ok := s.failures[key]
+	if !ok || !failures.ExpiresAt.After(now) {
+		failures = &models.LoginFailures{ID: key}
+		s.failures[key] = failures
+	}
+	failures.Failures++
+	failures.LastFailureAt = now
+	failures.ExpiresAt = now.Add(ttl)
+
+	copied := *failures
+	return &copied, nil
+}
+
+// ResetLoginFailures forgets the failed logins recorded under key
+func (s *MemoryRateLimitStore) ResetLoginFailures(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops expired entries at most once per memorySweepInterval; s.mu must be held
+func (s *MemoryRateLimitStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for id, counter := range s.counters {
+		if !counter.ExpiresAt.After(now) {
+			delete(s.counters, id)
+		}
+	}
+	for key, failures := range s.failures {
+		if !failures.ExpiresAt.After(now) {
+			delete(s.failures, key)
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// post sends a JSON body from an IP address and returns the response
+func post(router *gin.Engine, ip, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestParseRateLimit(t *testing.T) {
+	rule, err := ParseRateLimit("login", "30/1m, 10/1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.IP != (Rate{Limit: 30, Window: time.Minute}) || rule.Email != (Rate{Limit: 10, Window: time.Hour}) {
+		t.Errorf("Unexpected rule %+v", rule)
+	}
+
+	rule, err = ParseRateLimit("mfa", "30/1m,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Email.Limit != 0 {
+		t.Errorf("Expected an empty rate to mean no limit, got %+v", rule.Email)
+	}
+
+	for _, spec := range []string{"30", "0/1m", "x/1m", "10/soon", "10/1ms"} {
+		if _, err := ParseRateLimit("login", spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestLimitPerIPAndEmail(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryRateLimitStore())
+	rule := RateLimitRule{
+		Name:  "test",
+		IP:    Rate{Limit: 3, Window: time.Hour},
+		Email: Rate{Limit: 2, Window: time.Hour},
+	}
+
+	router := gin.New()
+	router.POST("/", limiter.Limit(rule), func(c *gin.Context) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"email": req.Email})
+	})
+
+	// The email limit holds across IP addresses, and handlers still read the body
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		w := post(router, ip, `{"email":"Alice@example.com"}`)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Alice@example.com") {
+			t.Fatalf("Expected request %d to pass with its body intact, got %d %s", i, w.Code, w.Body)
+		}
+	}
+	w := post(router, "10.0.0.3", `{"email":" alice@example.com"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the third request for the email to return %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	// The IP limit holds across email addresses
+	for i, email := range []string{"bob@example.com", "carol@example.com"} {
+		if w := post(router, "10.0.0.1", `{"email":"`+email+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d", i, w.Code)
+		}
+	}
+	if w := post(router, "10.0.0.1", `{"email":"dave@example.com"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the fourth request from the IP to return %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestSlidingWindowCountsPreviousWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limiter := NewRateLimiter(store)
+	rate := Rate{Limit: 4, Window: time.Hour}
+
+	// Four requests in the previous window still weigh on the current one
+	previousStart := time.Now().Truncate(rate.Window).Add(-rate.Window)
+	for range 4 {
+		store.Hit(t.Context(), "ip:test:10.0.0.1", previousStart, rate.Window)
+	}
+
+	router := gin.New()
+	router.POST("/", limiter.Limit(RateLimitRule{Name: "test", IP: rate}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	elapsed := time.Since(time.Now().Truncate(rate.Window))
+	allowed := int(float64(rate.Limit) * float64(elapsed) / float64(rate.Window))
+	for i := range allowed {
+		if w := post(router, "10.0.0.1", "{}"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to pass, got %d", i, w.Code)
+		}
+	}
+	if w := post(router, "10.0.0.1", "{}"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the sliding window to be full after %d requests, got %d", allowed, w.Code)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limiter := &RateLimiter{
+		store:   store,
+		lockout: LockoutPolicy{DelayAfter: 2, Threshold: 4, Duration: 15 * time.Minute},
+	}
+
+	router := gin.New()
+	router.POST("/", limiter.LoginLockout(), func(c *gin.Context) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		c.ShouldBindJSON(&req)
+		if req.Password != "correct horse" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	const wrong = `{"email":"alice@example.com","password":"wrong"}`
+	const right = `{"email":"alice@example.com","password":"correct horse"}`
+
+	// Waiting out each delay is simulated by moving the last failure back
+	elapse := func(d time.Duration) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		for _, failures := range store.failures {
+			failures.LastFailureAt = failures.LastFailureAt.Add(-d)
+		}
+	}
+
+	for i := range 3 {
+		if w := post(router, "10.0.0.1", wrong); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failure %d to reach the handler, got %d", i+1, w.Code)
+		}
+	}
+
+	// The third failure is delayed by a second, also from another IP
+	if w := post(router, "10.0.0.2", right); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected a delay after 3 failures, got %d", w.Code)
+	}
+	elapse(time.Second)
+	if w := post(router, "10.0.0.1", wrong); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected the attempt after the delay to reach the handler, got %d", w.Code)
+	}
+
+	// The fourth failure locks the account
+	elapse(time.Minute)
+	w := post(router, "10.0.0.1", right)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected the account to be locked, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "840" {
+		t.Errorf("Expected to retry after the rest of the lockout, got %q", w.Header().Get("Retry-After"))
+	}
+
+	elapse(15 * time.Minute)
+	store.mu.Lock()
+	for _, failures := range store.failures {
+		failures.ExpiresAt = time.Now()
+	}
+	store.mu.Unlock()
+	if w := post(router, "10.0.0.1", right); w.Code != http.StatusOK {
+		t.Fatalf("Expected login to work after the lockout, got %d", w.Code)
+	}
+
+	if w := post(router, "10.0.0.1", wrong); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected failures to start over, got %d", w.Code)
+	}
+	if w := post(router, "10.0.0.1", right); w.Code != http.StatusOK {
+		t.Fatalf("Expected a success to pass, got %d", w.Code)
+	}
+	if failures, _ := store.GetLoginFailures(t.Context(), "login:"+hashedEmail("alice@example.com")); failures.Failures != 0 {
+		t.Errorf("Expected a successful login to reset failures, got %d", failures.Failures)
+	}
+}
+
+// memSigningKeyStore is an in-memory auth.SigningKeyStore
+type memSigningKeyStore struct {
+	mu   sync.Mutex
+	keys []*models.SigningKey
+}
+
+func (s *memSigningKeyStore) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key.ID = bson.NewObjectID()
+	key.CreatedAt = time.Now()
+	copied := *key
+	s.keys = append(s.keys, &copied)
+	return nil
+}
+
+func (s *memSigningKeyStore) ListSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]*models.SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+func TestMFAFailuresCountAgainstLogin(t *testing.T) {
+	config.JWTSecret = "test-secret"
+	auth.UseSigningKeyStore(&memSigningKeyStore{})
+
+	store := NewMemoryRateLimitStore()
+	limiter := &RateLimiter{
+		store:   store,
+		lockout: LockoutPolicy{DelayAfter: 10, Threshold: 3, Duration: 15 * time.Minute},
+	}
+
+	login := gin.New()
+	login.POST("/", limiter.LoginLockout(), func(c *gin.Context) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		c.ShouldBindJSON(&req)
+		if req.Password != "correct horse" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+		c.Set("mfaRequired", true)
+		c.Status(http.StatusOK)
+	})
+
+	mfa := gin.New()
+	mfa.POST("/", limiter.MFALockout(), func(c *gin.Context) {
+		var req struct {
+			Code string `json:"code"`
+		}
+		c.ShouldBindJSON(&req)
+		if req.Code != "123456" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	token, err := auth.GenerateMFAToken(bson.NewObjectID().Hex(), "Alice@example.com", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "login:" + hashedEmail("alice@example.com")
+	failures := func() int64 {
+		f, _ := store.GetLoginFailures(t.Context(), key)
+		return f.Failures
+	}
+
+	const wrongPassword = `{"email":"alice@example.com","password":"wrong"}`
+	const rightPassword = `{"email":"alice@example.com","password":"correct horse"}`
+	wrongCode := `{"mfa_token":"` + token + `","code":"000000"}`
+	rightCode := `{"mfa_token":"` + token + `","code":"123456"}`
+
+	// The password step alone does not forget earlier failures
+	post(login, "10.0.0.1", wrongPassword)
+	if w := post(login, "10.0.0.1", rightPassword); w.Code != http.StatusOK {
+		t.Fatalf("Expected the password step to pass, got %d", w.Code)
+	}
+	if got := failures(); got != 1 {
+		t.Fatalf("Expected the failure to be kept until the MFA step, got %d", got)
+	}
+
+	// A wrong code counts, a right one completes the login
+	post(mfa, "10.0.0.1", wrongCode)
+	if got := failures(); got != 2 {
+		t.Fatalf("Expected a wrong code to count as a failure, got %d", got)
+	}
+	if w := post(mfa, "10.0.0.1", rightCode); w.Code != http.StatusOK {
+		t.Fatalf("Expected the right code to pass, got %d", w.Code)
+	}
+	if got := failures(); got != 0 {
+		t.Fatalf("Expected the completed login to reset failures, got %d", got)
+	}
+
+	// Guessing codes locks the account for the password step as well
+	for range 3 {
+		post(mfa, "10.0.0.1", wrongCode)
+	}
+	if w := post(mfa, "10.0.0.1", rightCode); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the MFA step to be locked, got %d", w.Code)
+	}
+	if w := post(login, "10.0.0.2", rightPassword); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the login to be locked, got %d", w.Code)
+	}
+}
+
+func TestPasswordChecksCountAgainstLogin(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limiter := &RateLimiter{
+		store:   store,
+		lockout: LockoutPolicy{DelayAfter: 10, Threshold: 3, Duration: 15 * time.Minute},
+	}
+
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		c.Set("email", "Alice@example.com")
+	}, limiter.PasswordLockout(), func(c *gin.Context) {
+		var req struct {
+			Password string `json:"password"`
+		}
+		c.ShouldBindJSON(&req)
+		if req.Password != "correct horse" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	key := "login:" + hashedEmail("alice@example.com")
+	failures := func() int64 {
+		f, _ := store.GetLoginFailures(t.Context(), key)
+		return f.Failures
+	}
+
+	// Wrong passwords count under the login key, right ones forget nothing
+	post(router, "10.0.0.1", `{"password":"wrong"}`)
+	if w := post(router, "10.0.0.1", `{"password":"correct horse"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected the right password to pass, got %d", w.Code)
+	}
+	if got := failures(); got != 1 {
+		t.Fatalf("Expected the failure to be kept, got %d", got)
+	}
+
+	for range 2 {
+		post(router, "10.0.0.1", `{"password":"wrong"}`)
+	}
+	if w := post(router, "10.0.0.1", `{"password":"correct horse"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the password check to be locked, got %d", w.Code)
+	}
+}
+
+func TestLockoutPolicyWait(t *testing.T) {
+	policy := LockoutPolicy{DelayAfter: 3, Threshold: 10, Duration: 15 * time.Minute}
+	now := time.Now()
+
+	for failures, want := range map[int64]time.Duration{
+		0:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		9:  32 * time.Second,
+		10: 15 * time.Minute,
+		50: 15 * time.Minute,
+	} {
+		got := policy.wait(&models.LoginFailures{Failures: failures, LastFailureAt: now}, now)
+		if got != want {
+			t.Errorf("Expected %d failures to wait %v, got %v", failures, want, got)
+		}
+	}
+}
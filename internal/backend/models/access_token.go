@@ -0,0 +1,101 @@
+package models
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Scopes of personal access tokens
+const (
+	// ScopeVaultRead allows reading vault items, folders and tags
+	ScopeVaultRead = "vault:read"
+	// ScopeVaultWrite allows creating and updating vault items as well as
+	// everything ScopeVaultRead allows
+	ScopeVaultWrite = "vault:write"
+)
+
+// AccessToken is a named personal access token for scripts and integrations.
+// Only a verifier of the token's auth key is stored; WrappedVaultKey is the
+// vault key wrapped under a key derived from the token on the client.
+type AccessToken struct {
+	ID       bson.ObjectID `bson:"_id,omitempty"`
+	UserID   bson.ObjectID `bson:"user_id"`
+	Name     string        `bson:"name"`
+	Verifier string        `bson:"verifier"`
+	Scopes   []string      `bson:"scopes"`
+	// FolderIDs restricts the token to items in these folders; empty means the whole vault
+	FolderIDs       []bson.ObjectID `bson:"folder_ids,omitempty"`
+	WrappedVaultKey string          `bson:"wrapped_vault_key,omitempty"`
+	CreatedAt       time.Time       `bson:"created_at"`
+	ExpiresAt       time.Time       `bson:"expires_at"`
+	LastUsedAt      *time.Time      `bson:"last_used_at,omitempty"`
+	LastUsedIP      string          `bson:"last_used_ip,omitempty"`
+}
+
+// HasScope reports whether the token grants scope
+func (t *AccessToken) HasScope(scope string) bool {
+	if slices.Contains(t.Scopes, scope) {
+		return true
+	}
+	return scope == ScopeVaultRead && slices.Contains(t.Scopes, ScopeVaultWrite)
+}
+
+// AllowsFolder reports whether the token may access items in a folder; a nil
+// folderID stands for items outside of any folder
+func (t *AccessToken) AllowsFolder(folderID *bson.ObjectID) bool {
+	if len(t.FolderIDs) == 0 {
+		return true
+	}
+	return folderID != nil && slices.Contains(t.FolderIDs, *folderID)
+}
+
+// CreateAccessTokenRequest represents the request to create a personal access
+// token. The client generates the token; AuthKey is derived from it and only
+// its verifier is stored.
+type CreateAccessTokenRequest struct {
+	Name            string   `json:"name" binding:"required,max=100"`
+	Scopes          []string `json:"scopes" binding:"required,min=1,dive,oneof=vault:read vault:write"`
+	FolderIDs       []string `json:"folder_ids,omitempty" binding:"max=100"`
+	ExpiresInDays   int      `json:"expires_in_days" binding:"required,min=1,max=365"`
+	AuthKey         string   `json:"auth_key" binding:"required,base64"`
+	WrappedVaultKey string   `json:"wrapped_vault_key,omitempty" binding:"omitempty,base64"`
+}
+
+// AccessTokenResponse represents a personal access token in API responses
+type AccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	FolderIDs  []string   `json:"folder_ids,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// ToResponse converts an AccessToken to AccessTokenResponse
+func (t *AccessToken) ToResponse() AccessTokenResponse {
+	var folderIDs []string
+	for _, id := range t.FolderIDs {
+		folderIDs = append(folderIDs, id.Hex())
+	}
+
+	return AccessTokenResponse{
+		ID:         t.ID.Hex(),
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		FolderIDs:  folderIDs,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+	}
+}
+
+// AccessTokenKeys is what GET /api/vault/keys returns to a personal access
+// token: the vault key wrapped under the token's wrapping key
+type AccessTokenKeys struct {
+	WrappedVaultKey string `json:"wrapped_vault_key"`
+}
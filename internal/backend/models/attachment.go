@@ -0,0 +1,75 @@
+package models
+
+import (
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Attachment status values
+const (
+	AttachmentPending = "pending"
+	AttachmentReady   = "ready"
+)
+
+// Attachment is a client-encrypted file attached to a vault item.
+// The file is uploaded and downloaded in chunks, each stored as a separate
+// blob; the server only knows the sizes of the encrypted chunks.
+type Attachment struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	ItemID     bson.ObjectID `bson:"item_id" json:"item_id"`
+	UserID     bson.ObjectID `bson:"user_id" json:"user_id"`
+	FileName   string        `bson:"file_name" json:"file_name"` // client-encrypted
+	Key        string        `bson:"key,omitempty" json:"key,omitempty"`
+	Size       int64         `bson:"size" json:"size"`
+	ChunkCount int           `bson:"chunk_count" json:"chunk_count"`
+	ChunkSizes []int64       `bson:"chunk_sizes" json:"chunk_sizes"`
+	Status     string        `bson:"status" json:"status"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// CreateAttachmentRequest represents the request to start an attachment upload.
+// Size is the total size of all encrypted chunks; it is reserved against the quota.
+type CreateAttachmentRequest struct {
+	FileName   string `json:"file_name" binding:"required"`
+	Key        string `json:"key,omitempty"`
+	Size       int64  `json:"size" binding:"required,min=1"`
+	ChunkCount int    `json:"chunk_count" binding:"required,min=1,max=10000"`
+}
+
+// AttachmentResponse represents the attachment metadata sent to clients
+type AttachmentResponse struct {
+	ID         string    `json:"id"`
+	ItemID     string    `json:"item_id"`
+	FileName   string    `json:"file_name"`
+	Key        string    `json:"key,omitempty"`
+	Size       int64     `json:"size"`
+	ChunkCount int       `json:"chunk_count"`
+	ChunkSizes []int64   `json:"chunk_sizes"`
+	Status     string    `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ToResponse converts an Attachment to AttachmentResponse
+func (a *Attachment) ToResponse() AttachmentResponse {
+	return AttachmentResponse{
+		ID:         a.ID.Hex(),
+		ItemID:     a.ItemID.Hex(),
+		FileName:   a.FileName,
+		Key:        a.Key,
+		Size:       a.Size,
+		ChunkCount: a.ChunkCount,
+		ChunkSizes: a.ChunkSizes,
+		Status:     a.Status,
+		CreatedAt:  a.CreatedAt,
+		UpdatedAt:  a.UpdatedAt,
+	}
+}
+
+// ChunkKey returns the blob storage key of one chunk of the attachment
+func (a *Attachment) ChunkKey(index int) string {
+	return a.UserID.Hex() + "/" + a.ID.Hex() + "/" + strconv.Itoa(index)
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Folder groups vault items. Its name is client-encrypted; nesting is
+// expressed through ParentID so clients can build paths after decryption.
+type Folder struct {
+	ID           bson.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID       bson.ObjectID  `bson:"user_id" json:"user_id"`
+	ParentID     *bson.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Name         string         `bson:"name" json:"name"`
+	Revision     int64          `bson:"revision" json:"revision"`
+	UserRevision int64          `bson:"user_revision" json:"-"`
+	CreatedAt    time.Time      `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time      `bson:"updated_at" json:"updated_at"`
+}
+
+// Tag labels vault items. Like folders, its name is client-encrypted.
+type Tag struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       bson.ObjectID `bson:"user_id" json:"user_id"`
+	Name         string        `bson:"name" json:"name"`
+	Revision     int64         `bson:"revision" json:"revision"`
+	UserRevision int64         `bson:"user_revision" json:"-"`
+	CreatedAt    time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// CreateFolderRequest represents the request to create a folder
+type CreateFolderRequest struct {
+	Name     string `json:"name" binding:"required"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// UpdateFolderRequest represents the request to rename or move a folder.
+// A nil ParentID keeps the current parent, an empty one moves the folder to the root.
+type UpdateFolderRequest struct {
+	Name     string  `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// TagRequest represents the request to create or rename a tag
+type TagRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// MoveItemsRequest represents the request to move several items to a folder.
+// An empty FolderID moves the items out of any folder.
+type MoveItemsRequest struct {
+	ItemIDs  []string `json:"item_ids" binding:"required,min=1,max=500"`
+	FolderID string   `json:"folder_id"`
+}
+
+// FolderResponse represents the folder data sent to clients
+type FolderResponse struct {
+	ID        string    `json:"id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ToResponse converts a Folder to FolderResponse
+func (f *Folder) ToResponse() FolderResponse {
+	resp := FolderResponse{
+		ID:        f.ID.Hex(),
+		Name:      f.Name,
+		Revision:  f.Revision,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+	}
+	if f.ParentID != nil {
+		resp.ParentID = f.ParentID.Hex()
+	}
+	return resp
+}
+
+// TagResponse represents the tag data sent to clients
+type TagResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ToResponse converts a Tag to TagResponse
+func (t *Tag) ToResponse() TagResponse {
+	return TagResponse{
+		ID:        t.ID.Hex(),
+		Name:      t.Name,
+		Revision:  t.Revision,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
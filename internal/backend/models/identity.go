@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Identity token types of the local identity provider
+const (
+	IdentityTokenSignup      = "signup"
+	IdentityTokenRecovery    = "recovery"
+	IdentityTokenAccess      = "access"
+	IdentityTokenEmailChange = "email_change"
+)
+
+// Identity is an account of the built-in local identity provider. It plays
+// the role of the Supabase auth user when self-hosting without Supabase.
+type Identity struct {
+	ID               bson.ObjectID `bson:"_id,omitempty"`
+	Email            string        `bson:"email"`
+	PasswordHash     string        `bson:"password_hash"` // Argon2id in PHC string format
+	EmailConfirmedAt *time.Time    `bson:"email_confirmed_at,omitempty"`
+	CreatedAt        time.Time     `bson:"created_at"`
+	UpdatedAt        time.Time     `bson:"updated_at"`
+	// PendingEmail is the address of a requested email change until it is confirmed
+	PendingEmail string `bson:"pending_email,omitempty"`
+}
+
+// IdentityToken is a verification, recovery or access token issued by the
+// local identity provider. Only the SHA-256 hash of the token is stored.
+type IdentityToken struct {
+	ID         bson.ObjectID `bson:"_id,omitempty"`
+	IdentityID bson.ObjectID `bson:"identity_id"`
+	Type       string        `bson:"type"`
+	TokenHash  string        `bson:"token_hash"`
+	ExpiresAt  time.Time     `bson:"expires_at"`
+	CreatedAt  time.Time     `bson:"created_at"`
+}
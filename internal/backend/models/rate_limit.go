@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// RateLimitCounter counts the requests of one client in one fixed window of a
+// rate limit. Its ID is the counter key followed by the window start.
+type RateLimitCounter struct {
+	ID        string    `bson:"_id"`
+	Count     int64     `bson:"count"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// LoginFailures counts the consecutive failed logins of an account. It
+// expires once no login has failed for the lockout period.
+type LoginFailures struct {
+	ID            string    `bson:"_id"`
+	Failures      int64     `bson:"failures"`
+	LastFailureAt time.Time `bson:"last_failure_at"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RefreshToken is an opaque, single-use refresh token. Exchanging it issues
+// the next token of the same family, so a replayed token shows that one of
+// the family leaked. Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        bson.ObjectID `bson:"_id,omitempty"`
+	UserID    bson.ObjectID `bson:"user_id"`
+	FamilyID  bson.ObjectID `bson:"family_id"`
+	TokenHash string        `bson:"token_hash"`
+	// SessionVersion must match the user's current session version
+	SessionVersion int64      `bson:"session_version"`
+	CreatedAt      time.Time  `bson:"created_at"`
+	ExpiresAt      time.Time  `bson:"expires_at"`
+	UsedAt         *time.Time `bson:"used_at,omitempty"`
+	RevokedAt      *time.Time `bson:"revoked_at,omitempty"`
+}
+
+// RefreshTokenRequest represents the request to exchange a refresh token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshTokenResponse carries a new access token and the refresh token that
+// replaces the one exchanged
+type RefreshTokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
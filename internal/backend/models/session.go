@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Session is a login of a user on one device. Access tokens name it in their
+// jti claim and its refresh tokens form the token family with the same ID.
+type Session struct {
+	ID         bson.ObjectID `bson:"_id,omitempty"`
+	UserID     bson.ObjectID `bson:"user_id"`
+	DeviceName string        `bson:"device_name,omitempty"`
+	UserAgent  string        `bson:"user_agent,omitempty"`
+	IP         string        `bson:"ip,omitempty"`
+	CreatedAt  time.Time     `bson:"created_at"`
+	LastSeenAt time.Time     `bson:"last_seen_at"`
+	// ExpiresAt is when the session's last refresh token expires
+	ExpiresAt time.Time  `bson:"expires_at"`
+	RevokedAt *time.Time `bson:"revoked_at,omitempty"`
+}
+
+// SessionResponse represents a session in API responses
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current marks the session the request was made with
+	Current bool `json:"current"`
+}
+
+// ToResponse converts a Session to SessionResponse
+func (s *Session) ToResponse(currentID string) SessionResponse {
+	return SessionResponse{
+		ID:         s.ID.Hex(),
+		DeviceName: s.DeviceName,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		Current:    s.ID.Hex() == currentID,
+	}
+}
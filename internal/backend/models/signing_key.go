@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SigningKey is a key pair that signs PassGO tokens. Keys rotate on a schedule:
+// each is published before it starts signing and stays published until the
+// last token it signed has expired.
+type SigningKey struct {
+	ID bson.ObjectID `bson:"_id,omitempty"`
+	// KID is the key ID tokens name in their kid header
+	KID       string `bson:"kid"`
+	Algorithm string `bson:"algorithm"`
+	PublicKey []byte `bson:"public_key"`
+	// PrivateKey is the private key sealed under a key derived from JWT_SECRET
+	PrivateKey string    `bson:"private_key"`
+	CreatedAt  time.Time `bson:"created_at"`
+	// ActiveAt and RetiresAt bound the period in which the key signs tokens
+	ActiveAt  time.Time `bson:"active_at"`
+	RetiresAt time.Time `bson:"retires_at"`
+	// ExpiresAt is when the last token signed with the key has expired
+	ExpiresAt time.Time `bson:"expires_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Tombstone kinds
+const (
+	TombstoneItem   = "item"
+	TombstoneFolder = "folder"
+	TombstoneTag    = "tag"
+)
+
+// Tombstone records the permanent deletion of a synced entity so clients
+// that last synced before the deletion can drop their local copy
+type Tombstone struct {
+	ID           bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       bson.ObjectID `bson:"user_id" json:"user_id"`
+	Kind         string        `bson:"kind" json:"kind"`
+	EntityID     bson.ObjectID `bson:"entity_id" json:"entity_id"`
+	UserRevision int64         `bson:"user_revision" json:"user_revision"`
+	DeletedAt    time.Time     `bson:"deleted_at" json:"deleted_at"`
+}
+
+// TombstoneResponse represents a deletion sent to clients
+type TombstoneResponse struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Revision  int64     `json:"revision"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ToResponse converts a Tombstone to TombstoneResponse
+func (t *Tombstone) ToResponse() TombstoneResponse {
+	return TombstoneResponse{
+		Kind:      t.Kind,
+		ID:        t.EntityID.Hex(),
+		Revision:  t.UserRevision,
+		DeletedAt: t.DeletedAt,
+	}
+}
+
+// SyncResponse represents everything that changed in a vault since a given revision.
+// Items include trashed ones; permanently deleted entities appear as tombstones.
+// When Full is set the response is a complete snapshot and replaces local state.
+type SyncResponse struct {
+	Revision   int64               `json:"revision"`
+	Full       bool                `json:"full"`
+	Items      []VaultItemResponse `json:"items"`
+	Folders    []FolderResponse    `json:"folders"`
+	Tags       []TagResponse       `json:"tags"`
+	Tombstones []TombstoneResponse `json:"tombstones"`
+}
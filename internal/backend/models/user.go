@@ -1,8 +1,11 @@
 package models
 
 import (
+	"crypto/subtle"
+	"encoding/base64"
 	"time"
 
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -10,11 +13,120 @@ import (
 type User struct {
 	ID            bson.ObjectID `bson:"_id,omitempty" json:"id"`
 	Email         string        `bson:"email" json:"email" binding:"required,email"`
-	SupabaseUID   string        `bson:"supabase_uid,omitempty" json:"supabase_uid,omitempty"`
+	SupabaseUID   string        `bson:"supabase_uid,omitempty" json:"supabase_uid,omitempty"` // user ID at the identity provider
 	EmailVerified bool          `bson:"email_verified" json:"email_verified"`
 	CreatedAt     time.Time     `bson:"created_at" json:"created_at"`
 	UpdatedAt     time.Time     `bson:"updated_at" json:"updated_at"`
 	IsActive      bool          `bson:"is_active" json:"is_active"`
+	Keys          *VaultKeys    `bson:"keys,omitempty" json:"-"`
+	Revision      int64         `bson:"revision" json:"revision"`
+	// PrunedRevision is the newest revision whose tombstones were pruned; a
+	// sync from before it gets the whole vault
+	PrunedRevision int64 `bson:"pruned_revision,omitempty" json:"-"`
+	// SessionVersion is embedded in issued tokens; bumping it revokes every older token
+	SessionVersion int64 `bson:"session_version" json:"-"`
+	// Recovery is the vault key wrapped under the user's recovery key, if one was set up
+	Recovery *RecoveryKeys `bson:"recovery,omitempty" json:"-"`
+	// MFA holds the second-factor settings; nil until TOTP setup starts
+	MFA *MFASettings `bson:"mfa,omitempty" json:"-"`
+	// PendingEmail is the address of a requested email change until it is confirmed
+	PendingEmail string `bson:"pending_email,omitempty" json:"pending_email,omitempty"`
+	// Auth tells clients how to derive the login credential from the master
+	// password; nil for accounts that still log in with the password itself
+	Auth *AuthKDF `bson:"auth,omitempty" json:"-"`
+}
+
+// MFAEnabled reports whether logging in requires a second factor
+func (u *User) MFAEnabled() bool {
+	return u.MFA != nil && (u.MFA.TOTPEnabled || u.MFA.WebAuthn)
+}
+
+// MFASettings holds a user's second factors. Until TOTPEnabled is set,
+// TOTPSecret is pending confirmation and does not guard logins. WebAuthn is
+// set while the user has security keys or passkeys registered.
+type MFASettings struct {
+	TOTPEnabled bool   `bson:"totp_enabled" json:"totp_enabled"`
+	TOTPSecret  string `bson:"totp_secret,omitempty" json:"-"`
+	// LastTOTPStep is the time step of the last accepted code; codes of that
+	// step or earlier are refused so a code cannot be replayed
+	LastTOTPStep  int64      `bson:"last_totp_step" json:"-"`
+	TOTPEnabledAt *time.Time `bson:"totp_enabled_at,omitempty" json:"totp_enabled_at,omitempty"`
+	WebAuthn      bool       `bson:"webauthn" json:"webauthn"`
+	// BackupCodes are SHA-256 hashes of the unused single-use backup codes
+	BackupCodes []string      `bson:"backup_codes,omitempty" json:"-"`
+	Challenge   *MFAChallenge `bson:"challenge,omitempty" json:"-"`
+}
+
+// MFAChallenge is a login waiting for its second factor. Its ID is carried
+// by the MFA token, so each token is good for one successful verification.
+type MFAChallenge struct {
+	ID        string    `bson:"id" json:"id"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+	Failures  int       `bson:"failures" json:"failures"`
+}
+
+// VaultKeys holds the client-generated material needed to unlock a vault.
+// The vault key is wrapped by a master key the server never sees.
+type VaultKeys struct {
+	KDFSalt         string           `bson:"kdf_salt" json:"kdf_salt" binding:"required,base64"`
+	KDFParams       crypto.KDFParams `bson:"kdf_params" json:"kdf_params" binding:"required"`
+	WrappedVaultKey string           `bson:"wrapped_vault_key" json:"wrapped_vault_key" binding:"required,base64"`
+}
+
+// AuthKDF describes how a client derives the credential it logs in with from
+// the master password. The salt is separate from the master key's and stays
+// the same when the password changes.
+type AuthKDF struct {
+	Salt   string           `bson:"salt" json:"salt" binding:"required,base64"`
+	Params crypto.KDFParams `bson:"params" json:"params" binding:"required"`
+}
+
+// RecoveryKeys holds the vault key wrapped under a key derived from the
+// user's recovery key, and a verifier of the recovery auth key. Neither lets
+// the server unwrap the vault key.
+type RecoveryKeys struct {
+	WrappedVaultKey string    `bson:"wrapped_vault_key" json:"wrapped_vault_key"`
+	Verifier        string    `bson:"verifier" json:"-"`
+	CreatedAt       time.Time `bson:"created_at" json:"created_at"`
+}
+
+// RecoveryKeyRequest represents client-generated recovery material. AuthKey is
+// derived from the recovery key; only its verifier is stored.
+type RecoveryKeyRequest struct {
+	WrappedVaultKey string `json:"wrapped_vault_key" binding:"required,base64"`
+	AuthKey         string `json:"auth_key" binding:"required,base64"`
+}
+
+// ToRecoveryKeys converts a RecoveryKeyRequest to the RecoveryKeys stored on the user
+func (r *RecoveryKeyRequest) ToRecoveryKeys() (*RecoveryKeys, error) {
+	authKey, err := decodeAuthKey(r.AuthKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecoveryKeys{
+		WrappedVaultKey: r.WrappedVaultKey,
+		Verifier:        crypto.RecoveryVerifier(authKey),
+		CreatedAt:       time.Now(),
+	}, nil
+}
+
+// Verify reports whether a base64 encoded auth key matches the stored verifier
+func (r *RecoveryKeys) Verify(authKey string) bool {
+	key, err := decodeAuthKey(authKey)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(crypto.RecoveryVerifier(key)), []byte(r.Verifier)) == 1
+}
+
+// decodeAuthKey decodes a base64 encoded recovery auth key
+func decodeAuthKey(authKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(authKey)
+	if err != nil || len(key) != crypto.KeySize {
+		return nil, crypto.ErrInvalidRecoveryKey
+	}
+	return key, nil
 }
 
 // CreateUserRequest represents the request to create a new user
@@ -23,10 +135,26 @@ type CreateUserRequest struct {
 	Password string `json:"password" binding:"required,min=8"`
 }
 
-// UpdateUserRequest represents the request to update a user
+// UpdateUserRequest represents the request to update a user. Email changes
+// must be confirmed by the new address and go through ChangeEmailRequest.
 type UpdateUserRequest struct {
-	Email    string `json:"email,omitempty" binding:"omitempty,email"`
-	IsActive *bool  `json:"is_active,omitempty"`
+	IsActive *bool `json:"is_active,omitempty"`
+}
+
+// ChangeEmailRequest represents the request to change the account's email.
+// The change takes effect once the new address confirms it.
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest represents the token of an email change
+// confirmation link, either as emailed (email and token) or as the access
+// token Supabase puts in the URL hash
+type ConfirmEmailChangeRequest struct {
+	Email       string `form:"email" json:"email"`
+	Token       string `form:"token" json:"token"`
+	AccessToken string `form:"access_token" json:"access_token"`
 }
 
 // LoginRequest represents the login credentials
@@ -37,30 +165,54 @@ type LoginRequest struct {
 
 // UserResponse represents the user data sent to clients (without sensitive info)
 type UserResponse struct {
-	ID            string    `json:"id"`
-	Email         string    `json:"email"`
-	EmailVerified bool      `json:"email_verified"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	IsActive      bool      `json:"is_active"`
+	ID             string    `json:"id"`
+	Email          string    `json:"email"`
+	EmailVerified  bool      `json:"email_verified"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	IsActive       bool      `json:"is_active"`
+	HasRecoveryKey bool      `json:"has_recovery_key"`
+	MFAEnabled     bool      `json:"mfa_enabled"`
+	PendingEmail   string    `json:"pending_email,omitempty"`
 }
 
 // ToResponse converts a User to UserResponse
 func (u *User) ToResponse() UserResponse {
 	return UserResponse{
-		ID:            u.ID.Hex(),
-		Email:         u.Email,
-		EmailVerified: u.EmailVerified,
-		CreatedAt:     u.CreatedAt,
-		UpdatedAt:     u.UpdatedAt,
-		IsActive:      u.IsActive,
+		ID:             u.ID.Hex(),
+		Email:          u.Email,
+		EmailVerified:  u.EmailVerified,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
+		IsActive:       u.IsActive,
+		HasRecoveryKey: u.Recovery != nil,
+		MFAEnabled:     u.MFAEnabled(),
+		PendingEmail:   u.PendingEmail,
 	}
 }
 
 // SignupRequest represents the signup request
 type SignupRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Email    string     `json:"email" binding:"required,email"`
+	Password string     `json:"password" binding:"required,min=8"`
+	Keys     *VaultKeys `json:"keys,omitempty"`
+	// Recovery optionally wraps the same vault key under a recovery key
+	Recovery *RecoveryKeyRequest `json:"recovery,omitempty"`
+	// Auth describes how Password was derived from the master password
+	Auth *AuthKDF `json:"auth,omitempty"`
+}
+
+// PreloginRequest asks how to derive the login credential of an account
+type PreloginRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PreloginResponse tells a client how to derive its login credential. Legacy
+// is set for accounts that still log in with the master password itself,
+// whose Auth is made up like that of an unknown email.
+type PreloginResponse struct {
+	Auth   *AuthKDF `json:"auth"`
+	Legacy bool     `json:"legacy"`
 }
 
 // VerifyEmailRequest represents the email verification request
@@ -79,13 +231,126 @@ type ResetPasswordRequest struct {
 	Email string `json:"email" binding:"required,email"`
 }
 
+// CompletePasswordResetRequest sets a new password with the token of a reset
+// link, either as emailed (email and token) or as the access token Supabase
+// puts in the URL hash. EraseVault acknowledges that the vault, which the new
+// password cannot unlock, is erased.
+type CompletePasswordResetRequest struct {
+	Email       string `json:"email"`
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+	EraseVault  bool   `json:"erase_vault"`
+}
+
 // UpdatePasswordRequest represents the update password request
 type UpdatePasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required,min=8"`
 }
 
-// AuthResponse represents the authentication response with token
+// ChangePasswordRequest represents the request to change the master password.
+// Keys holds the existing vault key re-wrapped under the new password.
+type ChangePasswordRequest struct {
+	CurrentPassword string    `json:"current_password" binding:"required"`
+	NewPassword     string    `json:"new_password" binding:"required,min=8"`
+	Keys            VaultKeys `json:"keys" binding:"required"`
+}
+
+// BeginRecoveryRequest represents the request for the recovery-wrapped vault key
+type BeginRecoveryRequest struct {
+	Email   string `json:"email" binding:"required,email"`
+	AuthKey string `json:"auth_key" binding:"required,base64"`
+}
+
+// CompleteRecoveryRequest represents the request to set a new master password
+// with the recovery key. Keys holds the vault key wrapped under the new
+// password; Recovery optionally replaces the recovery key that was used.
+type CompleteRecoveryRequest struct {
+	Email       string              `json:"email" binding:"required,email"`
+	AuthKey     string              `json:"auth_key" binding:"required,base64"`
+	NewPassword string              `json:"new_password" binding:"required,min=8"`
+	Keys        VaultKeys           `json:"keys" binding:"required"`
+	Recovery    *RecoveryKeyRequest `json:"recovery,omitempty"`
+}
+
+// RegenerateRecoveryKeyRequest represents the request to replace the recovery
+// key, which invalidates the previous one
+type RegenerateRecoveryKeyRequest struct {
+	CurrentPassword string             `json:"current_password" binding:"required"`
+	Recovery        RecoveryKeyRequest `json:"recovery" binding:"required"`
+}
+
+// UpgradeKDFRequest represents the request to re-wrap the vault key with
+// stronger KDF parameters. The master password itself does not change.
+type UpgradeKDFRequest struct {
+	Password string    `json:"password" binding:"required"`
+	Keys     VaultKeys `json:"keys" binding:"required"`
+}
+
+// TOTPConfirmRequest represents the request to enable TOTP with a first code
+type TOTPConfirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest represents the second login step. Code is either a TOTP
+// code or an unused backup code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DisableMFARequest represents the request to turn off two-factor
+// authentication, which needs both the password and a current code
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RegenerateBackupCodesRequest represents the request to replace the backup
+// codes, which invalidates the unused ones
+type RegenerateBackupCodesRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TOTPSetupResponse carries a new TOTP secret and its provisioning URI
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// AuthResponse represents the authentication response with token.
+// KDFMinimum tells the client which KDF parameters its keys must meet.
+// When MFARequired is set, Token and Keys are empty and MFAToken must be
+// exchanged at POST /api/auth/mfa/verify together with a second factor.
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string            `json:"token"`
+	RefreshToken string            `json:"refresh_token,omitempty"`
+	User         UserResponse      `json:"user"`
+	Keys         *VaultKeys        `json:"keys,omitempty"`
+	KDFMinimum   *crypto.KDFParams `json:"kdf_minimum,omitempty"`
+	MFARequired  bool              `json:"mfa_required,omitempty"`
+	MFAToken     string            `json:"mfa_token,omitempty"`
+	MFAMethods   []string          `json:"mfa_methods,omitempty"`
+}
+
+// Second factors a pending login can be finished with
+const (
+	MFAMethodTOTP       = "totp"
+	MFAMethodWebAuthn   = "webauthn"
+	MFAMethodBackupCode = "backup_code"
+)
+
+// Methods lists the second factors the user can finish a login with
+func (m *MFASettings) Methods() []string {
+	var methods []string
+	if m.TOTPEnabled {
+		methods = append(methods, MFAMethodTOTP)
+	}
+	if m.WebAuthn {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+	if len(m.BackupCodes) > 0 {
+		methods = append(methods, MFAMethodBackupCode)
+	}
+	return methods
 }
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// VaultItem represents an encrypted vault entry owned by a user.
+// The server never sees the plaintext: Data holds the client-encrypted
+// ciphertext and only the minimal metadata needed for storage is kept in clear.
+type VaultItem struct {
+	ID           bson.ObjectID   `bson:"_id,omitempty" json:"id"`
+	UserID       bson.ObjectID   `bson:"user_id" json:"user_id"`
+	Type         string          `bson:"type" json:"type"` // one of the pkg/vault item types
+	Data         string          `bson:"data" json:"data"`
+	FolderID     *bson.ObjectID  `bson:"folder_id,omitempty" json:"folder_id,omitempty"`
+	TagIDs       []bson.ObjectID `bson:"tag_ids,omitempty" json:"tag_ids,omitempty"`
+	Revision     int64           `bson:"revision" json:"revision"`
+	UserRevision int64           `bson:"user_revision" json:"-"`                           // user vault revision of the last write, for delta sync
+	SessionID    string          `bson:"session_id,omitempty" json:"session_id,omitempty"` // login session (JWT ID) or access token of the last write
+	ClientID     string          `bson:"client_id,omitempty" json:"-"`                     // key a client created the item under, so that a retried create is not stored twice
+	CreatedAt    time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time       `bson:"updated_at" json:"updated_at"`
+	DeletedAt    *time.Time      `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	PurgeAt      *time.Time      `bson:"purge_at,omitempty" json:"purge_at,omitempty"`
+}
+
+// VaultItemRevision is a previous encrypted version of a vault item,
+// archived whenever the item is overwritten
+type VaultItemRevision struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"id"`
+	ItemID     bson.ObjectID `bson:"item_id" json:"item_id"`
+	UserID     bson.ObjectID `bson:"user_id" json:"user_id"`
+	Revision   int64         `bson:"revision" json:"revision"`
+	Type       string        `bson:"type" json:"type"`
+	Data       string        `bson:"data" json:"data"`
+	SessionID  string        `bson:"session_id,omitempty" json:"session_id,omitempty"`
+	WrittenAt  time.Time     `bson:"written_at" json:"written_at"`
+	ArchivedAt time.Time     `bson:"archived_at" json:"archived_at"`
+}
+
+// CreateVaultItemRequest represents the request to store a new vault item
+type CreateVaultItemRequest struct {
+	Type     string   `json:"type" binding:"required,max=32"`
+	Data     string   `json:"data" binding:"required"`
+	FolderID string   `json:"folder_id,omitempty"`
+	TagIDs   []string `json:"tag_ids,omitempty"`
+	// ClientID optionally names the item on the client; sending the same
+	// one again returns the item created the first time
+	ClientID string `json:"client_id,omitempty" binding:"max=64"`
+}
+
+// UpdateVaultItemRequest represents the request to replace a vault item's ciphertext.
+// A nil FolderID or TagIDs keeps the current assignment; an empty FolderID
+// moves the item out of its folder and an empty TagIDs list clears its tags.
+type UpdateVaultItemRequest struct {
+	Type     string    `json:"type,omitempty" binding:"omitempty,max=32"`
+	Data     string    `json:"data" binding:"required"`
+	FolderID *string   `json:"folder_id,omitempty"`
+	TagIDs   *[]string `json:"tag_ids,omitempty"`
+}
+
+// VaultItemResponse represents the vault item data sent to clients
+type VaultItemResponse struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Data      string     `json:"data"`
+	FolderID  string     `json:"folder_id,omitempty"`
+	TagIDs    []string   `json:"tag_ids"`
+	Revision  int64      `json:"revision"`
+	SessionID string     `json:"session_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+// ToResponse converts a VaultItem to VaultItemResponse
+func (i *VaultItem) ToResponse() VaultItemResponse {
+	resp := VaultItemResponse{
+		ID:        i.ID.Hex(),
+		Type:      i.Type,
+		Data:      i.Data,
+		TagIDs:    make([]string, len(i.TagIDs)),
+		Revision:  i.Revision,
+		SessionID: i.SessionID,
+		CreatedAt: i.CreatedAt,
+		UpdatedAt: i.UpdatedAt,
+		DeletedAt: i.DeletedAt,
+		PurgeAt:   i.PurgeAt,
+	}
+	if i.FolderID != nil {
+		resp.FolderID = i.FolderID.Hex()
+	}
+	for n, tagID := range i.TagIDs {
+		resp.TagIDs[n] = tagID.Hex()
+	}
+	return resp
+}
+
+// VaultItemRevisionResponse represents an archived item revision sent to clients
+type VaultItemRevisionResponse struct {
+	Revision   int64     `json:"revision"`
+	Type       string    `json:"type"`
+	Data       string    `json:"data"`
+	SessionID  string    `json:"session_id,omitempty"`
+	WrittenAt  time.Time `json:"written_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// ToResponse converts a VaultItemRevision to VaultItemRevisionResponse
+func (r *VaultItemRevision) ToResponse() VaultItemRevisionResponse {
+	return VaultItemRevisionResponse{
+		Revision:   r.Revision,
+		Type:       r.Type,
+		Data:       r.Data,
+		SessionID:  r.SessionID,
+		WrittenAt:  r.WrittenAt,
+		ArchivedAt: r.ArchivedAt,
+	}
+}
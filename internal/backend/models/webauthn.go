@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WebAuthn ceremony types
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnMFA          = "mfa"
+	WebAuthnPasswordless = "passwordless"
+)
+
+// WebAuthnCredential is a security key or passkey registered by a user. A
+// Passwordless credential can also log in without the password.
+type WebAuthnCredential struct {
+	ID           bson.ObjectID       `bson:"_id,omitempty" json:"id"`
+	UserID       bson.ObjectID       `bson:"user_id" json:"-"`
+	Name         string              `bson:"name" json:"name"`
+	Passwordless bool                `bson:"passwordless" json:"passwordless"`
+	Credential   webauthn.Credential `bson:"credential" json:"-"`
+	CreatedAt    time.Time           `bson:"created_at" json:"created_at"`
+	LastUsedAt   *time.Time          `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+}
+
+// WebAuthnCeremony is a registration or login waiting for the authenticator's
+// response. UserID is unset for passwordless logins, where the authenticator
+// names the user; ChallengeID ties an MFA ceremony to its pending login.
+type WebAuthnCeremony struct {
+	ID           bson.ObjectID        `bson:"_id,omitempty"`
+	Type         string               `bson:"type"`
+	UserID       bson.ObjectID        `bson:"user_id,omitempty"`
+	ChallengeID  string               `bson:"challenge_id,omitempty"`
+	Name         string               `bson:"name,omitempty"`
+	Passwordless bool                 `bson:"passwordless,omitempty"`
+	Session      webauthn.SessionData `bson:"session"`
+	ExpiresAt    time.Time            `bson:"expires_at"`
+}
+
+// WebAuthnRegisterRequest represents the request to start registering a
+// security key or passkey
+type WebAuthnRegisterRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Name         string `json:"name" binding:"required,max=64"`
+	Passwordless bool   `json:"passwordless"`
+}
+
+// WebAuthnFinishRequest carries the authenticator's response to a ceremony,
+// as returned by navigator.credentials.create() or get()
+type WebAuthnFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id" binding:"required"`
+	Credential json.RawMessage `json:"credential" binding:"required"`
+}
+
+// WebAuthnMFARequest represents the request to start or finish a WebAuthn
+// second factor for a pending login
+type WebAuthnMFARequest struct {
+	MFAToken   string          `json:"mfa_token" binding:"required"`
+	CeremonyID string          `json:"ceremony_id,omitempty"`
+	Credential json.RawMessage `json:"credential,omitempty"`
+}
+
+// RenameWebAuthnCredentialRequest represents the request to rename a credential
+type RenameWebAuthnCredentialRequest struct {
+	Name string `json:"name" binding:"required,max=64"`
+}
+
+// DeleteWebAuthnCredentialRequest represents the request to remove a
+// credential, which needs the password
+type DeleteWebAuthnCredentialRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// WebAuthnOptionsResponse carries the options to pass to
+// navigator.credentials.create() or get() and the ceremony to finish
+type WebAuthnOptionsResponse struct {
+	CeremonyID string `json:"ceremony_id"`
+	Options    any    `json:"options"`
+}
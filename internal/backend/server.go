@@ -4,13 +4,18 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/philopaterwaheed/passGO/internal/backend/auth"
 	"github.com/philopaterwaheed/passGO/internal/backend/config"
 	"github.com/philopaterwaheed/passGO/internal/backend/database"
 	"github.com/philopaterwaheed/passGO/internal/backend/handlers"
 	"github.com/philopaterwaheed/passGO/internal/backend/middleware"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+	"github.com/philopaterwaheed/passGO/internal/backend/storage"
 )
 
 // Run starts the Gin HTTP server
@@ -30,6 +35,88 @@ func Run() {
 		log.Println("Database indexes created successfully")
 	}
 
+	// Sign tokens with keys shared by every backend instance and rotate them
+	signingKeyRepo := database.NewSigningKeyRepository()
+	if err := signingKeyRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create signing key indexes: %v", err)
+	}
+	auth.UseSigningKeyStore(signingKeyRepo)
+	go auth.RotateSigningKeys(ctx)
+
+	refreshTokenRepo := database.NewRefreshTokenRepository()
+	if err := refreshTokenRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create refresh token indexes: %v", err)
+	}
+
+	sessionRepo := database.NewSessionRepository()
+	if err := sessionRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create session indexes: %v", err)
+	}
+
+	webauthnRepo := database.NewWebAuthnRepository()
+	if err := webauthnRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create WebAuthn indexes: %v", err)
+	}
+
+	if config.AuthProvider == auth.ProviderLocal {
+		identityRepo := database.NewIdentityRepository()
+		if err := identityRepo.CreateIndexes(ctx); err != nil {
+			log.Printf("Warning: Failed to create identity indexes: %v", err)
+		}
+	}
+
+	accessTokenRepo := database.NewAccessTokenRepository()
+	if err := accessTokenRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create access token indexes: %v", err)
+	}
+
+	vaultItemRepo := database.NewVaultItemRepository()
+	if err := vaultItemRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create vault item indexes: %v", err)
+	}
+
+	folderRepo := database.NewFolderRepository()
+	if err := folderRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create folder indexes: %v", err)
+	}
+
+	tagRepo := database.NewTagRepository()
+	if err := tagRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create tag indexes: %v", err)
+	}
+
+	syncRepo := database.NewSyncRepository()
+	if err := syncRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create sync indexes: %v", err)
+	}
+
+	if config.RateLimitStore == "mongo" {
+		rateLimitRepo := database.NewRateLimitRepository()
+		if err := rateLimitRepo.CreateIndexes(ctx); err != nil {
+			log.Printf("Warning: Failed to create rate limit indexes: %v", err)
+		}
+	}
+
+	attachmentRepo := database.NewAttachmentRepository()
+	if err := attachmentRepo.CreateIndexes(ctx); err != nil {
+		log.Printf("Warning: Failed to create attachment indexes: %v", err)
+	}
+
+	blobStore, err := storage.NewBlobStore()
+	if err != nil {
+		log.Printf("Warning: Attachment storage not initialized: %v", err)
+	}
+
+	// Permanently purge trashed vault items once their retention period is over
+	sweeper := &trashSweeper{
+		items:              vaultItemRepo,
+		attachments:        attachmentRepo,
+		sync:               syncRepo,
+		store:              blobStore,
+		tombstoneRetention: time.Duration(config.SyncTombstoneRetention) * 24 * time.Hour,
+	}
+	go sweeper.run(ctx, time.Duration(config.VaultTrashSweepInterval)*time.Minute)
+
 	router := SetupRouter()
 	router.Run(":" + config.Port)
 }
@@ -38,6 +125,24 @@ func Run() {
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
 
+	// Rate limits key on the client IP, which only trusted proxies may forward
+	if config.TrustedProxies != "" {
+		if err := router.SetTrustedProxies(strings.Split(config.TrustedProxies, ",")); err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+		}
+	}
+	limiter := newRateLimiter()
+	loginLimit := rateLimit(limiter, "login", config.RateLimitLogin)
+	signupLimit := rateLimit(limiter, "signup", config.RateLimitSignup)
+	forgotPasswordLimit := rateLimit(limiter, "forgot-password", config.RateLimitForgotPassword)
+	resendVerificationLimit := rateLimit(limiter, "resend-verification", config.RateLimitResendVerification)
+	recoveryLimit := rateLimit(limiter, "recovery", config.RateLimitRecovery)
+	mfaLimit := rateLimit(limiter, "mfa", config.RateLimitMFA)
+	preloginLimit := rateLimit(limiter, "prelogin", config.RateLimitLogin)
+	refreshLimit := rateLimit(limiter, "refresh", config.RateLimitRefresh)
+	verifyLimit := rateLimit(limiter, "verify", config.RateLimitVerify)
+	passwordLockout := limiter.PasswordLockout()
+
 	// CORS configuration
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = false
@@ -45,7 +150,8 @@ func SetupRouter() *gin.Engine {
 	config.AllowOriginFunc = func(origin string) bool {
 		return true
 	}
-	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept"}
+	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept", "X-Device-Name", "If-Match"}
+	config.ExposeHeaders = []string{"ETag"}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
 	router.Use(cors.New(config))
 
@@ -66,6 +172,10 @@ func SetupRouter() *gin.Engine {
 		})
 	})
 
+	// Public keys that verify PassGO tokens
+	jwksHandler := handlers.NewJWKSHandler()
+	router.GET("/.well-known/jwks.json", jwksHandler.GetJWKS)
+
 	// API routes group
 	api := router.Group("/api")
 	{
@@ -78,26 +188,59 @@ func SetupRouter() *gin.Engine {
 		// Auth routes (public)
 		authHandler, err := handlers.NewAuthHandler()
 		if err != nil {
-			log.Printf("Warning: Auth handler not initialized (Supabase not configured): %v", err)
+			log.Printf("Warning: Auth handler not initialized (identity provider not configured): %v", err)
 		} else {
+			accessTokenHandler := handlers.NewAccessTokenHandler()
 			auth := api.Group("/auth")
 			{
-				auth.POST("/signup", authHandler.Signup)
-				auth.POST("/login", authHandler.Login)
+				auth.POST("/signup", signupLimit, authHandler.Signup)
+				auth.POST("/prelogin", preloginLimit, authHandler.Prelogin)
+				auth.POST("/login", loginLimit, limiter.LoginLockout(), authHandler.Login)
 				auth.GET("/verify-email", authHandler.VerifyEmail)
-				auth.POST("/verify-hash", authHandler.VerifyHash)
-				auth.POST("/resend-verification", authHandler.ResendVerification)
-				auth.POST("/forgot-password", authHandler.ForgotPassword)
-				auth.POST("/refresh", authHandler.RefreshToken)
+				auth.POST("/verify-hash", verifyLimit, authHandler.VerifyHash)
+				auth.GET("/confirm-email-change", verifyLimit, authHandler.ConfirmEmailChange)
+				auth.POST("/confirm-email-change", verifyLimit, authHandler.ConfirmEmailChangeHash)
+				auth.POST("/resend-verification", resendVerificationLimit, authHandler.ResendVerification)
+				auth.POST("/forgot-password", forgotPasswordLimit, authHandler.ForgotPassword)
+				auth.GET("/reset-password", authHandler.ResetPasswordPage)
+				auth.POST("/reset-password", recoveryLimit, authHandler.CompletePasswordReset)
+				auth.POST("/refresh", refreshLimit, authHandler.RefreshToken)
+				auth.POST("/recovery/begin", recoveryLimit, authHandler.BeginRecovery)
+				auth.POST("/recovery/complete", recoveryLimit, authHandler.CompleteRecovery)
+				auth.GET("/kdf-policy", authHandler.GetKDFPolicy)
+				auth.POST("/mfa/verify", mfaLimit, limiter.MFALockout(), authHandler.VerifyMFA)
+				auth.POST("/mfa/webauthn/begin", mfaLimit, authHandler.BeginWebAuthnMFA)
+				auth.POST("/mfa/webauthn/finish", mfaLimit, limiter.MFALockout(), authHandler.FinishWebAuthnMFA)
+				auth.POST("/webauthn/login/begin", mfaLimit, authHandler.BeginPasskeyLogin)
+				auth.POST("/webauthn/login/finish", mfaLimit, authHandler.FinishPasskeyLogin)
 
 				// Protected auth routes
 				auth.GET("/me", middleware.AuthMiddleware(), authHandler.GetCurrentUser)
+				auth.POST("/change-password", middleware.AuthMiddleware(), passwordLockout, authHandler.ChangePassword)
+				auth.POST("/change-email", middleware.AuthMiddleware(), passwordLockout, authHandler.ChangeEmail)
+				auth.PUT("/recovery", middleware.AuthMiddleware(), passwordLockout, authHandler.RegenerateRecoveryKey)
+				auth.POST("/upgrade-kdf", middleware.AuthMiddleware(), passwordLockout, authHandler.UpgradeKDF)
+				auth.POST("/mfa/totp/setup", middleware.AuthMiddleware(), authHandler.SetupTOTP)
+				auth.POST("/mfa/totp/confirm", middleware.AuthMiddleware(), authHandler.ConfirmTOTP)
+				auth.POST("/mfa/backup-codes", middleware.AuthMiddleware(), passwordLockout, authHandler.RegenerateBackupCodes)
+				auth.POST("/mfa/totp/disable", middleware.AuthMiddleware(), passwordLockout, authHandler.DisableTOTP)
+				auth.POST("/webauthn/register/begin", middleware.AuthMiddleware(), passwordLockout, authHandler.BeginWebAuthnRegistration)
+				auth.POST("/webauthn/register/finish", middleware.AuthMiddleware(), authHandler.FinishWebAuthnRegistration)
+				auth.GET("/webauthn/credentials", middleware.AuthMiddleware(), authHandler.ListWebAuthnCredentials)
+				auth.PUT("/webauthn/credentials/:id", middleware.AuthMiddleware(), authHandler.RenameWebAuthnCredential)
+				auth.DELETE("/webauthn/credentials/:id", middleware.AuthMiddleware(), passwordLockout, authHandler.DeleteWebAuthnCredential)
+				auth.GET("/sessions", middleware.AuthMiddleware(), authHandler.ListSessions)
+				auth.POST("/sessions/revoke-others", middleware.AuthMiddleware(), authHandler.RevokeOtherSessions)
+				auth.DELETE("/sessions/:id", middleware.AuthMiddleware(), authHandler.RevokeSession)
+				auth.POST("/tokens", middleware.AuthMiddleware(), accessTokenHandler.CreateAccessToken)
+				auth.GET("/tokens", middleware.AuthMiddleware(), accessTokenHandler.ListAccessTokens)
+				auth.DELETE("/tokens/:id", middleware.AuthMiddleware(), accessTokenHandler.RevokeAccessToken)
 			}
 		}
 
-		// User routes
+		// User routes (admin only)
 		userHandler := handlers.NewUserHandler()
-		users := api.Group("/users")
+		users := api.Group("/users", middleware.AuthMiddleware(), middleware.AdminOnly())
 		{
 			users.POST("", userHandler.CreateUser)
 			users.GET("", userHandler.GetAllUsers)
@@ -106,7 +249,90 @@ func SetupRouter() *gin.Engine {
 			users.DELETE("/:id", userHandler.DeleteUser)
 			users.GET("/email/:email", userHandler.GetUserByEmail)
 		}
+
+		// Vault routes (protected)
+		vaultHandler := handlers.NewVaultHandler()
+		folderHandler := handlers.NewFolderHandler()
+
+		// Personal access tokens may read the vault and create and edit items
+		sessionAuth := middleware.AuthMiddleware()
+		vaultRead := middleware.AuthMiddleware(models.ScopeVaultRead)
+		vaultWrite := middleware.AuthMiddleware(models.ScopeVaultWrite)
+		vault := api.Group("/vault")
+		{
+			vault.GET("/keys", vaultRead, vaultHandler.GetKeys)
+			vault.PUT("/keys", sessionAuth, vaultHandler.InitKeys)
+
+			vault.GET("/items", vaultRead, vaultHandler.ListItems)
+			vault.POST("/items", vaultWrite, vaultHandler.CreateItem)
+			vault.POST("/items/move", sessionAuth, vaultHandler.MoveItems)
+			vault.GET("/items/:id", vaultRead, vaultHandler.GetItem)
+			vault.PUT("/items/:id", vaultWrite, vaultHandler.UpdateItem)
+			vault.DELETE("/items/:id", sessionAuth, vaultHandler.DeleteItem)
+			vault.GET("/items/:id/revisions", sessionAuth, vaultHandler.ListRevisions)
+			vault.POST("/items/:id/revisions/:revision/restore", sessionAuth, vaultHandler.RestoreRevision)
+
+			vault.GET("/trash", sessionAuth, vaultHandler.ListTrash)
+			vault.DELETE("/trash", sessionAuth, vaultHandler.EmptyTrash)
+			vault.POST("/trash/:id/restore", sessionAuth, vaultHandler.RestoreItem)
+			vault.DELETE("/trash/:id", sessionAuth, vaultHandler.PurgeItem)
+
+			vault.GET("/folders", vaultRead, folderHandler.ListFolders)
+			vault.POST("/folders", sessionAuth, folderHandler.CreateFolder)
+			vault.GET("/folders/:id", vaultRead, folderHandler.GetFolder)
+			vault.PUT("/folders/:id", sessionAuth, folderHandler.UpdateFolder)
+			vault.DELETE("/folders/:id", sessionAuth, folderHandler.DeleteFolder)
+
+			vault.GET("/tags", vaultRead, folderHandler.ListTags)
+			vault.POST("/tags", sessionAuth, folderHandler.CreateTag)
+			vault.PUT("/tags/:id", sessionAuth, folderHandler.UpdateTag)
+			vault.DELETE("/tags/:id", sessionAuth, folderHandler.DeleteTag)
+		}
+
+		// Sync routes (protected)
+		syncHandler := handlers.NewSyncHandler()
+		api.GET("/sync", middleware.AuthMiddleware(), syncHandler.Sync)
+
+		// Event stream routes (protected)
+		eventHandler := handlers.NewEventHandler()
+		api.GET("/events", middleware.AuthMiddleware(), eventHandler.Stream)
+
+		// Attachment routes (protected)
+		attachmentHandler, err := handlers.NewAttachmentHandler()
+		if err != nil {
+			log.Printf("Warning: Attachment handler not initialized: %v", err)
+		} else {
+			attachments := api.Group("/vault", middleware.AuthMiddleware())
+			{
+				attachments.GET("/attachments/usage", attachmentHandler.GetUsage)
+				attachments.GET("/items/:id/attachments", attachmentHandler.ListAttachments)
+				attachments.POST("/items/:id/attachments", attachmentHandler.CreateAttachment)
+				attachments.GET("/items/:id/attachments/:attachmentId", attachmentHandler.GetAttachment)
+				attachments.DELETE("/items/:id/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
+				attachments.POST("/items/:id/attachments/:attachmentId/complete", attachmentHandler.CompleteAttachment)
+				attachments.PUT("/items/:id/attachments/:attachmentId/chunks/:index", attachmentHandler.UploadChunk)
+				attachments.GET("/items/:id/attachments/:attachmentId/chunks/:index", attachmentHandler.DownloadChunk)
+			}
+		}
 	}
 
 	return router
 }
+
+// newRateLimiter creates the rate limiter of the auth routes. With
+// RATE_LIMIT_STORE=mongo every backend instance shares its counters.
+func newRateLimiter() *middleware.RateLimiter {
+	if config.RateLimitStore == "mongo" {
+		return middleware.NewRateLimiter(database.NewRateLimitRepository())
+	}
+	return middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore())
+}
+
+// rateLimit creates the middleware enforcing a configured rate limit rule
+func rateLimit(limiter *middleware.RateLimiter, name, spec string) gin.HandlerFunc {
+	rule, err := middleware.ParseRateLimit(name, spec)
+	if err != nil {
+		log.Fatalf("Invalid rate limit configuration: %v", err)
+	}
+	return limiter.Limit(rule)
+}
@@ -0,0 +1,20 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/models"
+)
+
+// DeleteAttachment removes every chunk of an attachment from the blob store
+// and then its metadata
+func DeleteAttachment(ctx context.Context, store BlobStore, repo *database.AttachmentRepository, attachment *models.Attachment) error {
+	for i := 0; i < attachment.ChunkCount; i++ {
+		if err := store.Delete(ctx, attachment.ChunkKey(i)); err != nil {
+			return err
+		}
+	}
+
+	return repo.DeleteAttachment(ctx, attachment)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GridFSStore stores blobs in a MongoDB GridFS bucket, using the key as file
+// name. A key may briefly have several revisions; readers get the newest.
+type GridFSStore struct {
+	bucket *mongo.GridFSBucket
+}
+
+// NewGridFSStore creates a blob store backed by the named GridFS bucket
+func NewGridFSStore(db *mongo.Database, bucketName string) *GridFSStore {
+	return &GridFSStore{
+		bucket: db.GridFSBucket(options.GridFSBucket().SetName(bucketName)),
+	}
+}
+
+// Put streams r into GridFS under key, replacing any existing blob. The
+// upload is stored as a new revision and the older ones are only removed once
+// it is complete, so a failed upload leaves the previous blob in place.
+func (s *GridFSStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	upload, err := s.bucket.OpenUploadStream(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(upload, r)
+	if err != nil {
+		_ = upload.Abort()
+		return 0, err
+	}
+
+	if err := upload.Close(); err != nil {
+		return 0, err
+	}
+
+	if err := s.deleteFiles(ctx, bson.M{"filename": key, "_id": bson.M{"$ne": upload.FileID}}); err != nil {
+		return 0, err
+	}
+
+	return written, nil
+}
+
+// Get opens a download stream for the newest blob stored under key
+func (s *GridFSStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	stream, err := s.bucket.OpenDownloadStreamByName(ctx, key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrFileNotFound) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Delete removes every revision of the blob stored under key
+func (s *GridFSStore) Delete(ctx context.Context, key string) error {
+	return s.deleteFiles(ctx, bson.M{"filename": key})
+}
+
+// deleteFiles removes the files matching filter along with their chunks
+func (s *GridFSStore) deleteFiles(ctx context.Context, filter bson.M) error {
+	cursor, err := s.bucket.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var files []struct {
+		ID any `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err := s.bucket.Delete(ctx, file.ID)
+		if err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePathStaysBelowRoot(t *testing.T) {
+	root := t.TempDir()
+	s := &LocalStore{root: root}
+
+	for _, key := range []string{"", "..", "../escape", "a/../../escape", "/etc/passwd", `a\..\..\escape`} {
+		if path, err := s.path(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("key %q: got %q, %v, want ErrInvalidKey", key, path, err)
+		}
+	}
+
+	path, err := s.path("user1/item1/attachment1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(root, "user1", "item1", "attachment1"); path != want {
+		t.Errorf("got %q, want %q", path, want)
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Put(ctx, "../escape", strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("put outside the root: %v", err)
+	}
+
+	if n, err := s.Put(ctx, "a/b", strings.NewReader("blob")); err != nil || n != 4 {
+		t.Fatalf("put: %d, %v", n, err)
+	}
+	r, err := s.Get(ctx, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "blob" {
+		t.Errorf("got %q", data)
+	}
+
+	if err := s.Delete(ctx, "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "a/b"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("get after delete: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+// Package storage provides pluggable blob storage for encrypted attachment data.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/config"
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+)
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+// BlobStore stores opaque blobs by key. Implementations must stream data
+// instead of buffering whole blobs in memory.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any existing blob,
+	// and returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Get opens the blob stored under key for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key; missing blobs are not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBlobStore creates the blob store selected by config.AttachmentStorage
+func NewBlobStore() (BlobStore, error) {
+	switch config.AttachmentStorage {
+	case "gridfs":
+		return NewGridFSStore(database.GetDatabase(), "attachments"), nil
+	case "local":
+		return NewLocalStore(config.AttachmentPath)
+	default:
+		return nil, fmt.Errorf("unknown attachment storage %q", config.AttachmentStorage)
+	}
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/backend/database"
+	"github.com/philopaterwaheed/passGO/internal/backend/storage"
+)
+
+// abandonedUploadAge is how long a pending attachment upload may stay incomplete
+const abandonedUploadAge = 24 * time.Hour
+
+// trashSweeper permanently deletes trashed vault items whose purge date has
+// passed, together with the attachments left behind by deleted items, and
+// prunes sync tombstones older than tombstoneRetention
+type trashSweeper struct {
+	items              *database.VaultItemRepository
+	attachments        *database.AttachmentRepository
+	sync               *database.SyncRepository
+	store              storage.BlobStore
+	tombstoneRetention time.Duration
+}
+
+// run sweeps once immediately and then on every interval until ctx is done
+func (s *trashSweeper) run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sweep(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *trashSweeper) sweep(ctx context.Context) {
+	purged, err := s.items.PurgeExpired(ctx, time.Now())
+	if err != nil {
+		log.Printf("Warning: Failed to purge trashed vault items: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d trashed vault items", purged)
+	}
+
+	if s.tombstoneRetention > 0 {
+		pruned, err := s.sync.PruneTombstones(ctx, time.Now().Add(-s.tombstoneRetention))
+		if err != nil {
+			log.Printf("Warning: Failed to prune sync tombstones: %v", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d sync tombstones", pruned)
+		}
+	}
+
+	if s.store == nil {
+		return
+	}
+
+	orphaned, err := s.attachments.ListOrphaned(ctx, time.Now().Add(-abandonedUploadAge))
+	if err != nil {
+		log.Printf("Warning: Failed to list orphaned attachments: %v", err)
+		return
+	}
+
+	for _, attachment := range orphaned {
+		if err := storage.DeleteAttachment(ctx, s.store, s.attachments, attachment); err != nil {
+			log.Printf("Warning: Failed to delete attachment %s: %v", attachment.ID.Hex(), err)
+		}
+	}
+}
@@ -6,14 +6,24 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"runtime"
+	"sync"
 	"time"
+
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
 )
 
 // Client handles API communication with the backend
 type Client struct {
-	BaseURL    string
-	HTTPClient *http.Client
-	Token      string
+	BaseURL      string
+	HTTPClient   *http.Client
+	Token        string
+	RefreshToken string // exchanged for a new Token once it expires
+	DeviceName   string // sent as X-Device-Name when logging in, to label the session
+
+	// refreshMu makes concurrent requests share one refresh, since presenting
+	// a refresh token twice makes the backend end the session
+	refreshMu sync.Mutex
 }
 
 // NewClient creates a new API client
@@ -23,10 +33,13 @@ func NewClient(baseURL string) *Client {
 		HTTPClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		DeviceName: "PassGO on " + runtime.GOOS,
 	}
 }
 
-// LoginRequest represents login credentials
+// LoginRequest represents login credentials. Password is the credential
+// derived from the master password as Prelogin describes, never the master
+// password itself.
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -34,25 +47,49 @@ type LoginRequest struct {
 
 // SignupRequest represents signup data
 type SignupRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string        `json:"email"`
+	Password string        `json:"password"`
+	Auth     *AuthKDF      `json:"auth,omitempty"`
+	Keys     *VaultKeys    `json:"keys,omitempty"`
+	Recovery *RecoveryKeys `json:"recovery,omitempty"`
+}
+
+// VaultKeys represents the key material needed to unlock a vault locally
+type VaultKeys struct {
+	KDFSalt         string           `json:"kdf_salt"`
+	KDFParams       crypto.KDFParams `json:"kdf_params"`
+	WrappedVaultKey string           `json:"wrapped_vault_key"`
 }
 
 // UserResponse represents user data from API
 type UserResponse struct {
-	ID            string    `json:"id"`
-	Email         string    `json:"email"`
-	EmailVerified bool      `json:"email_verified"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	IsActive      bool      `json:"is_active"`
+	ID             string    `json:"id"`
+	Email          string    `json:"email"`
+	EmailVerified  bool      `json:"email_verified"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	IsActive       bool      `json:"is_active"`
+	HasRecoveryKey bool      `json:"has_recovery_key"`
+	MFAEnabled     bool      `json:"mfa_enabled"`
+	PendingEmail   string    `json:"pending_email,omitempty"`
 }
 
 // AuthResponse represents authentication response
 type AuthResponse struct {
-	Token   string       `json:"token"`
-	User    UserResponse `json:"user"`
-	Message string       `json:"message,omitempty"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	User         UserResponse `json:"user"`
+	Keys         *VaultKeys   `json:"keys,omitempty"`
+	Message      string       `json:"message,omitempty"`
+	// KDFMinimum holds the weakest KDF parameters the backend accepts
+	KDFMinimum *crypto.KDFParams `json:"kdf_minimum,omitempty"`
+	// MFARequired means Token and Keys are empty until MFAToken and a second
+	// factor are passed to VerifyMFA
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	MFAToken    string `json:"mfa_token,omitempty"`
+	// MFAMethods lists the second factors the account has: "totp",
+	// "webauthn" and "backup_code"
+	MFAMethods []string `json:"mfa_methods,omitempty"`
 }
 
 // ErrorResponse represents an error from the API
@@ -72,11 +109,14 @@ func (c *Client) Login(email, password string) (*AuthResponse, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := c.HTTPClient.Post(
-		c.BaseURL+"/api/auth/login",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	httpReq, err := http.NewRequest("POST", c.BaseURL+"/api/auth/login", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	c.setDeviceName(httpReq)
+
+	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
@@ -100,15 +140,20 @@ func (c *Client) Login(email, password string) (*AuthResponse, error) {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	c.Token = authResp.Token
+	c.setSession(&authResp)
 	return &authResp, nil
 }
 
-// Signup registers a new user
-func (c *Client) Signup(email, password string) (*AuthResponse, error) {
+// Signup registers a new user together with how their login credential is
+// derived, their wrapped vault key and, optionally, the same vault key
+// wrapped under a recovery key
+func (c *Client) Signup(email, password string, auth *AuthKDF, keys *VaultKeys, recovery *RecoveryKeys) (*AuthResponse, error) {
 	req := SignupRequest{
 		Email:    email,
 		Password: password,
+		Auth:     auth,
+		Keys:     keys,
+		Recovery: recovery,
 	}
 
 	body, err := json.Marshal(req)
@@ -149,7 +194,8 @@ func (c *Client) Signup(email, password string) (*AuthResponse, error) {
 
 // GetCurrentUser retrieves the current authenticated user
 func (c *Client) GetCurrentUser() (*UserResponse, error) {
-	if c.Token == "" {
+	token := c.AccessToken()
+	if token == "" {
 		return nil, fmt.Errorf("no authentication token")
 	}
 
@@ -158,7 +204,7 @@ func (c *Client) GetCurrentUser() (*UserResponse, error) {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
@@ -186,3 +232,81 @@ func (c *Client) GetCurrentUser() (*UserResponse, error) {
 
 	return &user, nil
 }
+
+// GetVaultKeys retrieves the current user's vault key material
+func (c *Client) GetVaultKeys() (*VaultKeys, error) {
+	token := c.AccessToken()
+	if token == "" {
+		return nil, fmt.Errorf("no authentication token")
+	}
+
+	req, err := http.NewRequest("GET", c.BaseURL+"/api/vault/keys", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.Unmarshal(respBody, &errResp); err != nil {
+			return nil, fmt.Errorf("request failed with status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("%s", errResp.Error)
+	}
+
+	var keys VaultKeys
+	if err := json.Unmarshal(respBody, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &keys, nil
+}
+
+// InitVaultKeys stores vault key material for an account that has none yet
+func (c *Client) InitVaultKeys(keys *VaultKeys) error {
+	token := c.AccessToken()
+	if token == "" {
+		return fmt.Errorf("no authentication token")
+	}
+
+	body, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("PUT", c.BaseURL+"/api/vault/keys", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+			return fmt.Errorf("request failed with status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("%s", errResp.Error)
+	}
+
+	return nil
+}
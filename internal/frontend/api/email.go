@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ChangeEmailRequest represents a change of the account's email
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// ChangeEmail asks for the account's email to be changed. A confirmation link
+// is sent to the new address, and the current email stays in use until it is
+// followed. Returns the pending address.
+func (c *Client) ChangeEmail(req *ChangeEmailRequest) (string, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/change-email", 0, req)
+	if err != nil {
+		return "", err
+	}
+
+	if status != http.StatusOK {
+		return "", apiError(status, respBody)
+	}
+
+	var result struct {
+		PendingEmail string `json:"pending_email"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.PendingEmail, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Event types pushed by the backend
+const (
+	EventVaultChanged   = "vault_changed"
+	EventSessionRevoked = "session_revoked"
+	EventShareReceived  = "share_received"
+)
+
+// Event is a change notification received from the backend
+type Event struct {
+	Type     string `json:"type"`
+	Revision int64  `json:"revision,omitempty"`
+}
+
+// Subscribe opens the server-sent event stream and calls onEvent for every
+// event until ctx is cancelled or the stream ends. It always returns a non-nil
+// error describing why the stream stopped; callers typically reconnect and sync.
+func (c *Client) Subscribe(ctx context.Context, onEvent func(Event)) error {
+	token := c.AccessToken()
+	if token == "" {
+		return fmt.Errorf("no authentication token")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/api/events", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	// The stream stays open indefinitely, so the regular request timeout can't apply
+	streamClient := &http.Client{Transport: c.HTTPClient.Transport}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return apiError(resp.StatusCode, respBody)
+	}
+
+	var eventType, data string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			// A blank line dispatches the event collected so far
+			if eventType != "" {
+				event := Event{Type: eventType}
+				if data != "" {
+					json.Unmarshal([]byte(data), &event)
+				}
+				onEvent(event)
+			}
+			eventType, data = "", ""
+		case strings.HasPrefix(line, ":"):
+			// Comment, used as keep-alive
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream failed: %w", err)
+	}
+	return fmt.Errorf("event stream closed")
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+)
+
+// AuthKDF describes how the credential an account logs in with is derived
+// from its master password
+type AuthKDF struct {
+	Salt   string           `json:"salt"`
+	Params crypto.KDFParams `json:"params"`
+}
+
+// Prelogin retrieves how to derive the login credential of an account. It
+// returns nil for accounts that still log in with the master password itself.
+func (c *Client) Prelogin(email string) (*AuthKDF, error) {
+	status, respBody, err := c.publicRequest("POST", "/api/auth/prelogin", map[string]string{"email": email})
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Auth   *AuthKDF `json:"auth"`
+		Legacy bool     `json:"legacy"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if result.Legacy {
+		return nil, nil
+	}
+	return result.Auth, nil
+}
+
+// KDFPolicy retrieves the weakest KDF parameters the backend accepts for new
+// key material
+func (c *Client) KDFPolicy() (*crypto.KDFParams, error) {
+	status, respBody, err := c.publicRequest("GET", "/api/auth/kdf-policy", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Minimum crypto.KDFParams `json:"minimum"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result.Minimum, nil
+}
+
+// UpgradeKDF swaps in the vault key re-wrapped with stronger KDF parameters.
+// The master password stays the same; its login credential is sent only to
+// be verified.
+func (c *Client) UpgradeKDF(password string, keys *VaultKeys) error {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/upgrade-kdf", 0, map[string]any{
+		"password": password,
+		"keys":     keys,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TOTPSetup holds a new TOTP secret and the otpauth:// URI to add it to an
+// authenticator app
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// MFACodeError is returned when the backend rejects a two-factor code but the
+// login can still be finished with another one
+type MFACodeError struct {
+	Message      string
+	AttemptsLeft int
+}
+
+func (e *MFACodeError) Error() string {
+	return e.Message
+}
+
+// VerifyMFA finishes a login that returned MFARequired by exchanging its MFA
+// token and a TOTP or backup code for a session
+func (c *Client) VerifyMFA(mfaToken, code string) (*AuthResponse, error) {
+	status, respBody, err := c.publicRequest("POST", "/api/auth/mfa/verify", map[string]string{
+		"mfa_token": mfaToken,
+		"code":      code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		var errResp struct {
+			Error        string `json:"error"`
+			AttemptsLeft int    `json:"attempts_left"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.AttemptsLeft > 0 {
+			return nil, &MFACodeError{Message: errResp.Error, AttemptsLeft: errResp.AttemptsLeft}
+		}
+		return nil, apiError(status, respBody)
+	}
+
+	var authResp AuthResponse
+	if err := json.Unmarshal(respBody, &authResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	c.setSession(&authResp)
+	return &authResp, nil
+}
+
+// SetupTOTP starts TOTP enrolment. The secret only protects logins once
+// ConfirmTOTP succeeds with a code from it.
+func (c *Client) SetupTOTP() (*TOTPSetup, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/mfa/totp/setup", 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var setup TOTPSetup
+	if err := json.Unmarshal(respBody, &setup); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &setup, nil
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the backup codes
+func (c *Client) ConfirmTOTP(code string) ([]string, error) {
+	return c.backupCodesRequest("/api/auth/mfa/totp/confirm", map[string]string{"code": code})
+}
+
+// RegenerateBackupCodes replaces the backup codes; the unused old ones stop working
+func (c *Client) RegenerateBackupCodes(password string) ([]string, error) {
+	return c.backupCodesRequest("/api/auth/mfa/backup-codes", map[string]string{"password": password})
+}
+
+// DisableTOTP turns off the authenticator app. Two-factor authentication
+// stays on while security keys are registered.
+func (c *Client) DisableTOTP(password, code string) error {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/mfa/totp/disable", 0, map[string]string{
+		"password": password,
+		"code":     code,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
+
+// backupCodesRequest posts body to an endpoint that responds with new backup codes
+func (c *Client) backupCodesRequest(path string, body any) ([]string, error) {
+	status, respBody, err := c.vaultRequest("POST", path, 0, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		BackupCodes []string `json:"backup_codes"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.BackupCodes, nil
+}
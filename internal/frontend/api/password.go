@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ChangePasswordRequest represents a master password change. The passwords are
+// the login credentials derived from the master passwords, and Keys holds the
+// existing vault key re-wrapped under the new password.
+type ChangePasswordRequest struct {
+	CurrentPassword string    `json:"current_password"`
+	NewPassword     string    `json:"new_password"`
+	Keys            VaultKeys `json:"keys"`
+}
+
+// ChangePassword changes the master password and swaps in the re-wrapped vault
+// key. Every other session is signed out; this client continues with the new
+// token returned by the backend.
+func (c *Client) ChangePassword(req *ChangePasswordRequest) (*AuthResponse, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/change-password", 0, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		c.keepSession(respBody)
+		return nil, apiError(status, respBody)
+	}
+
+	var authResp AuthResponse
+	if err := json.Unmarshal(respBody, &authResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	c.setSession(&authResp)
+	return &authResp, nil
+}
+
+// keepSession continues with the tokens of an error response. A password
+// update that fails at the identity provider still signs out every session,
+// and the backend hands the caller fresh tokens along with the error.
+func (c *Client) keepSession(respBody []byte) {
+	var authResp AuthResponse
+	if json.Unmarshal(respBody, &authResp) == nil && authResp.Token != "" {
+		c.setSession(&authResp)
+	}
+}
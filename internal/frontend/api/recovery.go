@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// RecoveryKeys represents the vault key wrapped under a recovery key and the
+// auth key that proves possession of it. Both are derived on the client.
+type RecoveryKeys struct {
+	WrappedVaultKey string `json:"wrapped_vault_key"`
+	AuthKey         string `json:"auth_key"`
+}
+
+// CompleteRecoveryRequest represents a master password reset with the recovery
+// key. NewPassword is the login credential derived from the new master
+// password, and Keys holds the vault key wrapped under it.
+type CompleteRecoveryRequest struct {
+	Email       string        `json:"email"`
+	AuthKey     string        `json:"auth_key"`
+	NewPassword string        `json:"new_password"`
+	Keys        VaultKeys     `json:"keys"`
+	Recovery    *RecoveryKeys `json:"recovery,omitempty"`
+}
+
+// RegenerateRecoveryKeyRequest represents the replacement of the recovery key
+type RegenerateRecoveryKeyRequest struct {
+	CurrentPassword string       `json:"current_password"`
+	Recovery        RecoveryKeys `json:"recovery"`
+}
+
+// BeginRecovery proves possession of the recovery key and returns the vault
+// key wrapped under it
+func (c *Client) BeginRecovery(email, authKey string) (string, error) {
+	status, respBody, err := c.publicRequest("POST", "/api/auth/recovery/begin", map[string]string{
+		"email":    email,
+		"auth_key": authKey,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if status != http.StatusOK {
+		return "", apiError(status, respBody)
+	}
+
+	var result struct {
+		WrappedVaultKey string `json:"wrapped_vault_key"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.WrappedVaultKey, nil
+}
+
+// CompleteRecovery sets a new master password with the recovery key. Every
+// session of the account is signed out; this client continues with the token
+// returned by the backend.
+func (c *Client) CompleteRecovery(req *CompleteRecoveryRequest) (*AuthResponse, error) {
+	status, respBody, err := c.publicRequest("POST", "/api/auth/recovery/complete", req)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		c.keepSession(respBody)
+		return nil, apiError(status, respBody)
+	}
+
+	var authResp AuthResponse
+	if err := json.Unmarshal(respBody, &authResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	c.setSession(&authResp)
+	return &authResp, nil
+}
+
+// RegenerateRecoveryKey replaces the recovery key of the logged in user; the
+// previous recovery key stops working
+func (c *Client) RegenerateRecoveryKey(req *RegenerateRecoveryKeyRequest) error {
+	status, respBody, err := c.vaultRequest("PUT", "/api/auth/recovery", 0, req)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
+
+// publicRequest sends an unauthenticated JSON request and returns the status and body
+func (c *Client) publicRequest(method, path string, body any) (int, []byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.setDeviceName(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return resp.StatusCode, respBody, nil
+}
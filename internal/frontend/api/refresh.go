@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// errTokenExpired is the error the backend answers an expired access token with
+const errTokenExpired = "Token has expired"
+
+// AccessToken returns the current access token. It waits for a refresh in
+// progress, so that it never returns a token that is being replaced.
+func (c *Client) AccessToken() string {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.Token
+}
+
+// setSession stores the tokens of a new or renewed session
+func (c *Client) setSession(resp *AuthResponse) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	c.storeSession(resp)
+}
+
+// storeSession stores session tokens; the caller holds refreshMu
+func (c *Client) storeSession(resp *AuthResponse) {
+	c.Token = resp.Token
+	c.RefreshToken = resp.RefreshToken
+}
+
+// refresh exchanges the refresh token for a new access token and refresh
+// token. staleToken is the access token the backend rejected; when another
+// request has replaced it in the meantime, the new one is used as is.
+func (c *Client) refresh(staleToken string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.Token != staleToken {
+		return nil
+	}
+	if c.RefreshToken == "" {
+		return fmt.Errorf("no refresh token")
+	}
+
+	status, respBody, err := c.publicRequest("POST", "/api/auth/refresh", map[string]string{
+		"refresh_token": c.RefreshToken,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		// A rejected refresh token will not work again, but one that met a
+		// server error or rate limit can be presented once more later
+		if status == http.StatusUnauthorized {
+			c.RefreshToken = ""
+		}
+		return apiError(status, respBody)
+	}
+
+	var authResp AuthResponse
+	if err := json.Unmarshal(respBody, &authResp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	c.storeSession(&authResp)
+	return nil
+}
+
+// isTokenExpired reports whether an error response says the access token expired
+func isTokenExpired(status int, body []byte) bool {
+	if status != http.StatusUnauthorized {
+		return false
+	}
+	var errResp ErrorResponse
+	return json.Unmarshal(body, &errResp) == nil && errResp.Error == errTokenExpired
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Session is a login of the account on one device
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current marks the session this client is using
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the account's active sessions, most recently used first
+func (c *Client) ListSessions() ([]Session, error) {
+	status, respBody, err := c.vaultRequest("GET", "/api/auth/sessions", 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Sessions []Session `json:"sessions"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Sessions, nil
+}
+
+// RevokeSession signs a device out. Revoking the current session logs this
+// client out.
+func (c *Client) RevokeSession(id string) error {
+	status, respBody, err := c.vaultRequest("DELETE", "/api/auth/sessions/"+id, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions signs every other device out and returns how many
+// sessions were revoked
+func (c *Client) RevokeOtherSessions() (int, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/sessions/revoke-others", 0, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if status != http.StatusOK {
+		return 0, apiError(status, respBody)
+	}
+
+	var result struct {
+		Revoked int `json:"revoked"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Revoked, nil
+}
+
+// setDeviceName labels the session a request may start with the client's device name
+func (c *Client) setDeviceName(req *http.Request) {
+	if c.DeviceName != "" {
+		req.Header.Set("X-Device-Name", c.DeviceName)
+	}
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// VaultItem represents an encrypted vault item as stored by the server
+type VaultItem struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Data      string     `json:"data"`
+	FolderID  string     `json:"folder_id,omitempty"`
+	TagIDs    []string   `json:"tag_ids"`
+	Revision  int64      `json:"revision"`
+	SessionID string     `json:"session_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+// Folder represents a folder with a client-encrypted name
+type Folder struct {
+	ID        string    `json:"id"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Name      string    `json:"name"`
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tag represents a tag with a client-encrypted name
+type Tag struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Revision  int64     `json:"revision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Tombstone kinds
+const (
+	TombstoneItem   = "item"
+	TombstoneFolder = "folder"
+	TombstoneTag    = "tag"
+)
+
+// Tombstone reports a permanently deleted item, folder or tag
+type Tombstone struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	Revision  int64     `json:"revision"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncResponse holds the vault changes since the requested revision.
+// When Full is set it is a complete snapshot that replaces local state.
+type SyncResponse struct {
+	Revision   int64       `json:"revision"`
+	Full       bool        `json:"full"`
+	Items      []VaultItem `json:"items"`
+	Folders    []Folder    `json:"folders"`
+	Tags       []Tag       `json:"tags"`
+	Tombstones []Tombstone `json:"tombstones"`
+}
+
+// Sync fetches the vault changes made after the given revision.
+// Pass 0 to download the whole vault; keep the returned Revision for the next call.
+func (c *Client) Sync(since int64) (*SyncResponse, error) {
+	status, respBody, err := c.vaultRequest("GET", "/api/sync?since="+strconv.FormatInt(since, 10), 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var syncResp SyncResponse
+	if err := json.Unmarshal(respBody, &syncResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &syncResp, nil
+}
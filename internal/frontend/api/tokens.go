@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// AccessToken is a personal access token of the account, without its secret
+type AccessToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	FolderIDs  []string   `json:"folder_ids,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+}
+
+// CreateAccessTokenRequest represents a new personal access token. The token
+// is generated on the client; AuthKey and the wrapping key of
+// WrappedVaultKey are derived from it with crypto.DeriveAccessTokenKeys.
+type CreateAccessTokenRequest struct {
+	Name            string   `json:"name"`
+	Scopes          []string `json:"scopes"`
+	FolderIDs       []string `json:"folder_ids,omitempty"`
+	ExpiresInDays   int      `json:"expires_in_days"`
+	AuthKey         string   `json:"auth_key"`
+	WrappedVaultKey string   `json:"wrapped_vault_key,omitempty"`
+}
+
+// CreateAccessToken registers a personal access token
+func (c *Client) CreateAccessToken(req *CreateAccessTokenRequest) (*AccessToken, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/auth/tokens", 0, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusCreated {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Token AccessToken `json:"token"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result.Token, nil
+}
+
+// ListAccessTokens returns the account's unexpired personal access tokens
+func (c *Client) ListAccessTokens() ([]AccessToken, error) {
+	status, respBody, err := c.vaultRequest("GET", "/api/auth/tokens", 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Tokens []AccessToken `json:"tokens"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Tokens, nil
+}
+
+// RevokeAccessToken deletes a personal access token; it stops working at once
+func (c *Client) RevokeAccessToken(id string) error {
+	status, respBody, err := c.vaultRequest("DELETE", "/api/auth/tokens/"+id, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateItemRequest represents the data needed to store a new vault item
+type CreateItemRequest struct {
+	Type     string   `json:"type"`
+	Data     string   `json:"data"`
+	FolderID string   `json:"folder_id,omitempty"`
+	TagIDs   []string `json:"tag_ids,omitempty"`
+	// ClientID lets the backend recognise a create sent again after its
+	// response was lost, and answer with the item it already stored
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// UpdateItemRequest represents a replacement of a vault item's ciphertext.
+// Nil FolderID or TagIDs keep the current assignment.
+type UpdateItemRequest struct {
+	Type     string    `json:"type,omitempty"`
+	Data     string    `json:"data"`
+	FolderID *string   `json:"folder_id,omitempty"`
+	TagIDs   *[]string `json:"tag_ids,omitempty"`
+}
+
+// UpdateFolderRequest represents a rename or move of a folder.
+// A nil ParentID keeps the current parent; an empty one moves it to the top level.
+type UpdateFolderRequest struct {
+	Name     string  `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// ConflictError is returned when a write was based on a stale revision because
+// another device changed the entity first. It carries the current server copy
+// so the UI can merge, keep one side, or retry on top of it.
+type ConflictError struct {
+	Message string
+	Item    *VaultItem // set for item conflicts
+	Folder  *Folder    // set for folder conflicts
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// GetItem fetches a single vault item
+func (c *Client) GetItem(id string) (*VaultItem, error) {
+	status, respBody, err := c.vaultRequest("GET", "/api/vault/items/"+id, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var item VaultItem
+	if err := json.Unmarshal(respBody, &item); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &item, nil
+}
+
+// CreateItem stores a new encrypted vault item
+func (c *Client) CreateItem(item *CreateItemRequest) (*VaultItem, error) {
+	status, respBody, err := c.vaultRequest("POST", "/api/vault/items", 0, item)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusCreated {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Item VaultItem `json:"item"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result.Item, nil
+}
+
+// UpdateItem replaces a vault item that the caller last saw at revision.
+// If another device changed it since, a *ConflictError holding the current
+// item is returned.
+func (c *Client) UpdateItem(id string, revision int64, item *UpdateItemRequest) (*VaultItem, error) {
+	status, respBody, err := c.vaultRequest("PUT", "/api/vault/items/"+id, revision, item)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Error string    `json:"error"`
+		Item  VaultItem `json:"item"`
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusConflict:
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	default:
+		return nil, apiError(status, respBody)
+	}
+
+	if status == http.StatusConflict {
+		return nil, &ConflictError{Message: result.Error, Item: &result.Item}
+	}
+
+	return &result.Item, nil
+}
+
+// TrashItem moves a vault item to the trash
+func (c *Client) TrashItem(id string) error {
+	status, respBody, err := c.vaultRequest("DELETE", "/api/vault/items/"+id, 0, nil)
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
+
+// UpdateFolder renames or moves a folder that the caller last saw at revision.
+// If another device changed it since, a *ConflictError holding the current
+// folder is returned.
+func (c *Client) UpdateFolder(id string, revision int64, folder *UpdateFolderRequest) (*Folder, error) {
+	status, respBody, err := c.vaultRequest("PUT", "/api/vault/folders/"+id, revision, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Error  string `json:"error"`
+		Folder Folder `json:"folder"`
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusConflict:
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	default:
+		return nil, apiError(status, respBody)
+	}
+
+	if status == http.StatusConflict {
+		return nil, &ConflictError{Message: result.Error, Folder: &result.Folder}
+	}
+
+	return &result.Folder, nil
+}
+
+// vaultRequest sends an authenticated vault request and returns the status and body.
+// A non-zero revision is sent as If-Match so the server can reject stale writes.
+// An expired access token is renewed with the refresh token and the request sent again.
+func (c *Client) vaultRequest(method, path string, revision int64, body any) (int, []byte, error) {
+	token := c.AccessToken()
+	status, respBody, err := c.sendVaultRequest(method, path, token, revision, body)
+	if err == nil && isTokenExpired(status, respBody) && c.refresh(token) == nil {
+		return c.sendVaultRequest(method, path, c.AccessToken(), revision, body)
+	}
+	return status, respBody, err
+}
+
+// sendVaultRequest sends a vault request authenticated with token
+func (c *Client) sendVaultRequest(method, path, token string, revision int64, body any) (int, []byte, error) {
+	if token == "" {
+		return 0, nil, fmt.Errorf("no authentication token")
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if revision != 0 {
+		req.Header.Set("If-Match", `"`+strconv.FormatInt(revision, 10)+`"`)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return resp.StatusCode, respBody, nil
+}
+
+// IsUnreachable reports whether err means the backend could not be reached at
+// all, as opposed to the backend rejecting the request
+func IsUnreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// StatusError is an error response of the backend
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status of the error response err carries, or 0
+// if the backend did not answer with one
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status
+	}
+	return 0
+}
+
+// apiError converts an error response body into an error
+func apiError(status int, body []byte) error {
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err != nil || errResp.Error == "" {
+		return &StatusError{Status: status, Message: fmt.Sprintf("request failed with status %d", status)}
+	}
+	return &StatusError{Status: status, Message: errResp.Error}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpdateConflictsCarryServerCopy(t *testing.T) {
+	var ifMatch []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+
+		switch r.URL.Path {
+		case "/api/vault/items/item1":
+			json.NewEncoder(w).Encode(map[string]any{"error": "item changed", "item": VaultItem{ID: "item1", Data: "theirs", Revision: 5}})
+		case "/api/vault/folders/folder1":
+			json.NewEncoder(w).Encode(map[string]any{"error": "folder changed", "folder": Folder{ID: "folder1", Name: "theirs", Revision: 3}})
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	client.Token = "token"
+
+	_, err := client.UpdateItem("item1", 4, &UpdateItemRequest{Data: "mine"})
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("got %v, want a ConflictError", err)
+	}
+	if conflict.Message != "item changed" || conflict.Item == nil || conflict.Item.Data != "theirs" || conflict.Item.Revision != 5 || conflict.Folder != nil {
+		t.Errorf("item conflict decoded as %+v", conflict)
+	}
+
+	_, err = client.UpdateFolder("folder1", 2, &UpdateFolderRequest{Name: "mine"})
+	if !errors.As(err, &conflict) {
+		t.Fatalf("got %v, want a ConflictError", err)
+	}
+	if conflict.Message != "folder changed" || conflict.Folder == nil || conflict.Folder.Name != "theirs" || conflict.Item != nil {
+		t.Errorf("folder conflict decoded as %+v", conflict)
+	}
+
+	if len(ifMatch) != 2 || ifMatch[0] != `"4"` || ifMatch[1] != `"2"` {
+		t.Errorf("If-Match headers: %q", ifMatch)
+	}
+}
+
+func TestErrorResponsesAreNotConflicts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusPreconditionRequired)
+		json.NewEncoder(w).Encode(map[string]string{"error": "If-Match header with the current revision is required"})
+	}))
+	defer srv.Close()
+
+	client := NewClient(srv.URL)
+	client.Token = "token"
+
+	_, err := client.UpdateItem("item1", 0, &UpdateItemRequest{Data: "mine"})
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		t.Fatalf("got a conflict for %v", err)
+	}
+	if StatusCode(err) != http.StatusPreconditionRequired {
+		t.Errorf("got %v, want status 428", err)
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SecurityKey is a WebAuthn security key or passkey registered to the account.
+// Keys are registered from a browser, which talks to the authenticator.
+type SecurityKey struct {
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Passwordless bool       `json:"passwordless"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// ListSecurityKeys returns the account's security keys and passkeys
+func (c *Client) ListSecurityKeys() ([]SecurityKey, error) {
+	status, respBody, err := c.vaultRequest("GET", "/api/auth/webauthn/credentials", 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, apiError(status, respBody)
+	}
+
+	var result struct {
+		Credentials []SecurityKey `json:"credentials"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return result.Credentials, nil
+}
+
+// RenameSecurityKey changes the display name of a security key
+func (c *Client) RenameSecurityKey(id, name string) error {
+	status, respBody, err := c.vaultRequest("PUT", "/api/auth/webauthn/credentials/"+id, 0, map[string]string{
+		"name": name,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
+
+// DeleteSecurityKey removes a security key. Removing the last one turns off
+// two-factor authentication unless an authenticator app is enabled.
+func (c *Client) DeleteSecurityKey(id, password string) error {
+	status, respBody, err := c.vaultRequest("DELETE", "/api/auth/webauthn/credentials/"+id, 0, map[string]string{
+		"password": password,
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != http.StatusOK {
+		return apiError(status, respBody)
+	}
+
+	return nil
+}
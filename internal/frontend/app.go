@@ -1,6 +1,7 @@
 package frontend
 
 import (
+	"errors"
 	"image/color"
 	"log"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"gioui.org/widget/material"
 	"github.com/philopaterwaheed/passGO/internal/frontend/api"
 	. "github.com/philopaterwaheed/passGO/internal/frontend/pages"
+	"github.com/philopaterwaheed/passGO/internal/frontend/store"
 )
 
 // Run starts the Gio desktop/web application
@@ -76,29 +78,95 @@ func loop(w *app.Window) error {
 			if loginPage.LoginBtn.Clicked(gtx) && !loginPage.IsLoading {
 				email := loginPage.EmailInput.Text()
 				password := loginPage.PasswordInput.Text()
+				mfaToken := loginPage.MFAToken
+				code := strings.TrimSpace(loginPage.CodeInput.Text())
 
 				if email == "" || password == "" {
 					loginPage.ErrorMsg = "Email and password are required"
+				} else if mfaToken != "" && code == "" {
+					loginPage.ErrorMsg = "Enter the code from your authenticator app or a backup code"
 				} else {
 					loginPage.IsLoading = true
 					loginPage.ErrorMsg = ""
 					loginPage.SuccessMsg = ""
 
-					// Call backend API in goroutine
-					go func() {
-						resp, err := apiClient.Login(email, password)
-						if err != nil {
-							loginPage.ErrorMsg = err.Error()
+					// finish unlocks the vault once the backend issued a session
+					finish := func(resp *api.AuthResponse) {
+						if err := goOnline(apiClient, w, loginPage, email, password, resp); err != nil {
+							setVaultKey(nil)
+							loginPage.ErrorMsg = "Failed to unlock vault: " + err.Error()
 							loginPage.IsLoading = false
 							w.Invalidate()
 							return
 						}
 
+						loginPage.MFAToken = ""
 						loginPage.SuccessMsg = "Login successful! Welcome, " + resp.User.Email
 						loginPage.IsLoading = false
 						// TODO: Navigate to main app and store token
 						log.Printf("Logged in successfully: %+v", resp.User)
 						w.Invalidate()
+					}
+
+					// Call backend API in goroutine
+					go func() {
+						if mfaToken != "" {
+							resp, err := apiClient.VerifyMFA(mfaToken, code)
+							if err != nil {
+								// Unless only the code was wrong, the next attempt starts over with the password
+								var codeErr *api.MFACodeError
+								if !errors.As(err, &codeErr) && !api.IsUnreachable(err) {
+									loginPage.MFAToken = ""
+								}
+								loginPage.ErrorMsg = err.Error()
+								loginPage.IsLoading = false
+								w.Invalidate()
+								return
+							}
+							finish(resp)
+							return
+						}
+
+						resp, err := logIn(apiClient, email, password)
+						if err != nil && api.IsUnreachable(err) {
+							// Fall back to the vault saved on this device
+							if offlineErr := unlockOffline(email, password); offlineErr == nil {
+								loginPage.SuccessMsg = "Offline: showing your last synced vault. Changes will sync when the connection returns."
+								loginPage.IsLoading = false
+								w.Invalidate()
+								loginWhenReachable(apiClient, email, password, func(resp *api.AuthResponse) {
+									if resp.MFARequired {
+										// Syncing resumes once the second factor is entered
+										loginPage.MFAToken = resp.MFAToken
+										loginPage.SuccessMsg = "Back online. Enter your two-factor code to sync your vault."
+										w.Invalidate()
+										return
+									}
+									if err := goOnline(apiClient, w, loginPage, email, password, resp); err != nil {
+										log.Printf("Failed to go online: %v", err)
+									}
+								})
+								return
+							} else if !errors.Is(offlineErr, store.ErrNotFound) {
+								err = offlineErr
+							}
+						}
+						if err != nil {
+							loginPage.ErrorMsg = err.Error()
+							loginPage.IsLoading = false
+							w.Invalidate()
+							return
+						}
+
+						if resp.MFARequired {
+							loginPage.MFAToken = resp.MFAToken
+							loginPage.SuccessMsg = "Enter the code from your authenticator app or a backup code"
+							loginPage.IsLoading = false
+							w.Invalidate()
+							return
+						}
+
+						finish(resp)
 					}()
 				}
 			}
@@ -124,7 +192,36 @@ func loop(w *app.Window) error {
 
 					// Call backend API in goroutine
 					go func() {
-						resp, err := apiClient.Signup(email, password)
+						// Derive the new keys with at least the parameters the backend requires
+						if minimum, err := apiClient.KDFPolicy(); err == nil {
+							kdfMinimum = minimum
+						}
+
+						keys, key, err := newVaultKeys(password)
+						if err != nil {
+							registerPage.ErrorMsg = "Failed to generate vault keys: " + err.Error()
+							registerPage.IsLoading = false
+							w.Invalidate()
+							return
+						}
+
+						recoveryKey, recovery, err := newRecoveryKey(key)
+						if err != nil {
+							registerPage.ErrorMsg = "Failed to generate recovery key: " + err.Error()
+							registerPage.IsLoading = false
+							w.Invalidate()
+							return
+						}
+
+						auth, credential, err := newAuthKDF(password)
+						if err != nil {
+							registerPage.ErrorMsg = "Failed to derive login credential: " + err.Error()
+							registerPage.IsLoading = false
+							w.Invalidate()
+							return
+						}
+
+						resp, err := apiClient.Signup(email, credential, auth, keys, recovery)
 						if err != nil {
 							registerPage.ErrorMsg = err.Error()
 							registerPage.IsLoading = false
@@ -136,6 +233,10 @@ func loop(w *app.Window) error {
 						if registerPage.SuccessMsg == "" {
 							registerPage.SuccessMsg = "Registration successful! Please check your email."
 						}
+						// The recovery key is the only way back into the vault if the
+						// master password is forgotten, and it is shown only this once
+						registerPage.SuccessMsg += "\n\nYour recovery key: " + recoveryKey +
+							"\nWrite it down and keep it somewhere safe."
 						registerPage.IsLoading = false
 						// Clear password fields after successful registration
 						registerPage.PasswordInput.SetText("")
@@ -191,3 +292,69 @@ func loop(w *app.Window) error {
 		}
 	}
 }
+
+// goOnline unlocks the vault with the keys returned at login, creating keys
+// for accounts without any, then opens the local vault and starts syncing it
+func goOnline(apiClient *api.Client, w *app.Window, loginPage *LoginPage, email, password string, resp *api.AuthResponse) error {
+	kdfMinimum = resp.KDFMinimum
+
+	keys := resp.Keys
+	var key []byte
+	var err error
+	if keys != nil {
+		key, err = unlockVault(password, keys)
+		if err == nil {
+			setVaultKey(key)
+			// Transparently strengthen keys derived with outdated parameters;
+			// the vault stays usable with the old ones if this fails
+			if upgraded, upgradeErr := upgradeKDF(apiClient, email, password, keys); upgradeErr != nil {
+				log.Printf("Failed to upgrade KDF parameters: %v", upgradeErr)
+			} else {
+				keys = upgraded
+			}
+		}
+	} else {
+		keys, key, err = newVaultKeys(password)
+		if err == nil {
+			setVaultKey(key)
+			err = apiClient.InitVaultKeys(keys)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	openLocalVault(email, resp.User.ID, keys)
+
+	// Keep the local vault in sync with changes from other devices
+	startWatching(apiClient, w.Invalidate, func() {
+		setVaultKey(nil)
+		loginPage.SuccessMsg = ""
+		loginPage.ErrorMsg = "Your session was revoked. Please log in again."
+		w.Invalidate()
+	})
+
+	return nil
+}
+
+// unlockOffline unlocks the vault saved on this device with the master password
+func unlockOffline(email, password string) error {
+	v, err := loadOfflineVault(email)
+	if err != nil {
+		return err
+	}
+	if v.Keys == nil {
+		return store.ErrNotFound
+	}
+
+	key, err := unlockVault(password, v.Keys)
+	if err != nil {
+		return err
+	}
+
+	vaultMu.Lock()
+	localVault = v
+	vaultMu.Unlock()
+	setVaultKey(key)
+	return nil
+}
@@ -0,0 +1,345 @@
+package frontend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/philopaterwaheed/passGO/internal/frontend/api"
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+)
+
+var (
+	// vaultKeyMu guards vaultKey, which the login goroutine sets while the UI
+	// and the event stream read or clear it
+	vaultKeyMu sync.RWMutex
+	// vaultKey is the unlocked vault key of the logged in user.
+	// It only ever lives in memory and is never sent to the backend.
+	vaultKey []byte
+)
+
+// currentVaultKey returns the unlocked vault key, or nil while the vault is locked
+func currentVaultKey() []byte {
+	vaultKeyMu.RLock()
+	defer vaultKeyMu.RUnlock()
+	return vaultKey
+}
+
+// setVaultKey unlocks the vault with key, or locks it when key is nil
+func setVaultKey(key []byte) {
+	vaultKeyMu.Lock()
+	defer vaultKeyMu.Unlock()
+	vaultKey = key
+}
+
+// kdfMinimum holds the weakest KDF parameters the backend accepts, as it last
+// advertised them
+var kdfMinimum *crypto.KDFParams
+
+// kdfParams returns the KDF parameters for new key material: the client
+// defaults, raised to the backend minimums where those are stronger
+func kdfParams() crypto.KDFParams {
+	params := crypto.DefaultKDFParams()
+	if kdfMinimum != nil {
+		params = params.AtLeast(*kdfMinimum)
+	}
+	return params
+}
+
+// newVaultKeys generates a fresh vault key and wraps it under a master key
+// derived from the master password. It returns the material to upload and
+// the plaintext vault key to keep in memory.
+func newVaultKeys(password string) (*api.VaultKeys, []byte, error) {
+	key, err := crypto.GenerateVaultKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := rewrapVaultKey(password, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keys, key, nil
+}
+
+// rewrapVaultKey wraps an unlocked vault key under a master password with a
+// fresh salt and the current KDF parameters. Items stay encrypted under the
+// same vault key, so none of them need re-encrypting.
+func rewrapVaultKey(password string, key []byte) (*api.VaultKeys, error) {
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	params := kdfParams()
+	masterKey, err := crypto.DeriveMasterKey(password, salt, params)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := crypto.WrapVaultKey(masterKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api.VaultKeys{
+		KDFSalt:         base64.StdEncoding.EncodeToString(salt),
+		KDFParams:       params,
+		WrappedVaultKey: wrapped,
+	}, nil
+}
+
+// newAuthKDF picks a salt and parameters for deriving the login credential of
+// a new account. It returns them together with the credential.
+func newAuthKDF(password string) (*api.AuthKDF, string, error) {
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return nil, "", err
+	}
+
+	auth := &api.AuthKDF{
+		Salt:   base64.StdEncoding.EncodeToString(salt),
+		Params: kdfParams(),
+	}
+	credential, err := crypto.DeriveAuthCredential(password, salt, auth.Params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return auth, credential, nil
+}
+
+// authCredential derives the login credential of a master password. Accounts
+// without an AuthKDF still log in with the master password itself, until the
+// backend switches them over on their next login.
+func authCredential(auth *api.AuthKDF, password string) (string, error) {
+	if auth == nil {
+		return password, nil
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(auth.Salt)
+	if err != nil {
+		return "", fmt.Errorf("invalid login salt: %w", err)
+	}
+
+	return crypto.DeriveAuthCredential(password, salt, auth.Params)
+}
+
+// loginCredential looks up how the account derives its login credential and
+// derives it from the master password
+func loginCredential(client *api.Client, email, password string) (string, error) {
+	auth, err := client.Prelogin(email)
+	if err != nil {
+		return "", err
+	}
+
+	return authCredential(auth, password)
+}
+
+// logIn logs in with the credential derived from the master password; the
+// master password itself never leaves the client
+func logIn(client *api.Client, email, password string) (*api.AuthResponse, error) {
+	credential, err := loginCredential(client, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Login(email, credential)
+}
+
+// upgradeKDF re-wraps the unlocked vault key when keys were derived with
+// weaker parameters than new key material would use, and returns the keys in
+// effect afterwards. The master password stays the same.
+func upgradeKDF(client *api.Client, email, password string, keys *api.VaultKeys) (*api.VaultKeys, error) {
+	if keys.KDFParams.Meets(kdfParams()) {
+		return keys, nil
+	}
+
+	key := currentVaultKey()
+	if key == nil {
+		return keys, fmt.Errorf("vault is locked")
+	}
+
+	upgraded, err := rewrapVaultKey(password, key)
+	if err != nil {
+		return keys, err
+	}
+
+	credential, err := loginCredential(client, email, password)
+	if err != nil {
+		return keys, err
+	}
+
+	if err := client.UpgradeKDF(credential, upgraded); err != nil {
+		return keys, err
+	}
+
+	return upgraded, nil
+}
+
+// changeMasterPassword re-wraps the vault key under a new master password and
+// stores it on the backend and in the local vault. The login credential keeps
+// its salt, so only the password it is derived from changes.
+func changeMasterPassword(client *api.Client, email, currentPassword, newPassword string) error {
+	key := currentVaultKey()
+	if key == nil {
+		return fmt.Errorf("vault is locked")
+	}
+
+	keys, err := rewrapVaultKey(newPassword, key)
+	if err != nil {
+		return err
+	}
+
+	auth, err := client.Prelogin(email)
+	if err != nil {
+		return err
+	}
+	currentCredential, err := authCredential(auth, currentPassword)
+	if err != nil {
+		return err
+	}
+	newCredential, err := authCredential(auth, newPassword)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.ChangePassword(&api.ChangePasswordRequest{
+		CurrentPassword: currentCredential,
+		NewPassword:     newCredential,
+		Keys:            *keys,
+	}); err != nil {
+		return err
+	}
+
+	vaultMu.Lock()
+	if localVault != nil {
+		localVault.Keys = keys
+		saveLocalVault()
+	}
+	vaultMu.Unlock()
+
+	return nil
+}
+
+// newRecoveryKey generates a recovery key and wraps the vault key under it.
+// It returns the formatted key to show the user once and the material to upload.
+func newRecoveryKey(key []byte) (string, *api.RecoveryKeys, error) {
+	formatted, err := crypto.GenerateRecoveryKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	recoveryKey, err := crypto.ParseRecoveryKey(formatted)
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapKey, authKey, err := crypto.DeriveRecoveryKeys(recoveryKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapped, err := crypto.WrapVaultKeyForRecovery(wrapKey, key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return formatted, &api.RecoveryKeys{
+		WrappedVaultKey: wrapped,
+		AuthKey:         base64.StdEncoding.EncodeToString(authKey),
+	}, nil
+}
+
+// regenerateRecoveryKey replaces the recovery key of the logged in user and
+// returns the new one to show the user
+func regenerateRecoveryKey(client *api.Client, email, currentPassword string) (string, error) {
+	key := currentVaultKey()
+	if key == nil {
+		return "", fmt.Errorf("vault is locked")
+	}
+
+	formatted, recovery, err := newRecoveryKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	credential, err := loginCredential(client, email, currentPassword)
+	if err != nil {
+		return "", err
+	}
+
+	if err := client.RegenerateRecoveryKey(&api.RegenerateRecoveryKeyRequest{
+		CurrentPassword: credential,
+		Recovery:        *recovery,
+	}); err != nil {
+		return "", err
+	}
+
+	return formatted, nil
+}
+
+// recoverAccount sets a new master password with the recovery key: it unwraps
+// the vault key with the recovery key and re-wraps it under the new password.
+// Items keep their encryption, and the recovery key stays valid.
+func recoverAccount(client *api.Client, email, formattedKey, newPassword string) (*api.AuthResponse, error) {
+	recoveryKey, err := crypto.ParseRecoveryKey(formattedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapKey, authKey, err := crypto.DeriveRecoveryKeys(recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+	encodedAuthKey := base64.StdEncoding.EncodeToString(authKey)
+
+	wrapped, err := client.BeginRecovery(email, encodedAuthKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := crypto.UnwrapVaultKeyForRecovery(wrapKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := rewrapVaultKey(newPassword, key)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := loginCredential(client, email, newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.CompleteRecovery(&api.CompleteRecoveryRequest{
+		Email:       email,
+		AuthKey:     encodedAuthKey,
+		NewPassword: credential,
+		Keys:        *keys,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	setVaultKey(key)
+	return resp, nil
+}
+
+// unlockVault derives the master key locally and unwraps the vault key
+func unlockVault(password string, keys *api.VaultKeys) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(keys.KDFSalt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KDF salt: %w", err)
+	}
+
+	masterKey, err := crypto.DeriveMasterKey(password, salt, keys.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.UnwrapVaultKey(masterKey, keys.WrappedVaultKey)
+}
@@ -10,11 +10,14 @@ import (
 type LoginPage struct {
 	EmailInput    widget.Editor
 	PasswordInput widget.Editor
+	CodeInput     widget.Editor
 	LoginBtn      widget.Clickable
 	BackBtn       widget.Clickable
 	ErrorMsg      string
 	SuccessMsg    string
 	IsLoading     bool
+	// MFAToken is set while the password was accepted and a second factor is pending
+	MFAToken string
 }
 
 func NewLoginPage() *LoginPage {
@@ -28,12 +31,18 @@ func NewLoginPage() *LoginPage {
 			Submit:     true,
 			Mask:       '*',
 		},
+		CodeInput: widget.Editor{
+			SingleLine: true,
+			Submit:     true,
+		},
 	}
 }
 
 func (p *LoginPage) Reset() {
 	p.EmailInput.SetText("")
 	p.PasswordInput.SetText("")
+	p.CodeInput.SetText("")
+	p.MFAToken = ""
 	p.ErrorMsg = ""
 	p.SuccessMsg = ""
 	p.IsLoading = false
@@ -81,9 +90,26 @@ func (p *LoginPage) Layout(gtx layout.Context, th *material.Theme) layout.Dimens
 				e := material.Editor(th, &p.PasswordInput, "Password")
 				return e.Layout(gtx)
 			}),
+		)
+
+		// Ask for the second factor once the password was accepted
+		if p.MFAToken != "" {
+			children = append(children,
+				layout.Rigid(layout.Spacer{Height: unit.Dp(10)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					e := material.Editor(th, &p.CodeInput, "Authenticator or backup code")
+					return e.Layout(gtx)
+				}),
+			)
+		}
+
+		children = append(children,
 			layout.Rigid(layout.Spacer{Height: unit.Dp(20)}.Layout),
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				btnText := "Login"
+				if p.MFAToken != "" {
+					btnText = "Verify"
+				}
 				if p.IsLoading {
 					btnText = "Loading..."
 				}
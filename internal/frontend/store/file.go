@@ -0,0 +1,90 @@
+//go:build !js
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// fileStore keeps each vault as a JSON file in the user's config directory
+type fileStore struct {
+	dir string
+}
+
+// Open returns the store for this platform: JSON files below the user's
+// config directory on desktop builds
+func Open() (Store, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFileStore(filepath.Join(configDir, "passgo", "vaults"))
+}
+
+// NewFileStore creates a store that keeps vaults in dir
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(email string) string {
+	return filepath.Join(s.dir, vaultKey(email)+".json")
+}
+
+func (s *fileStore) Load(email string) (*Vault, error) {
+	data, err := os.ReadFile(s.path(email))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	v := NewVault(email, "")
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *fileStore) Save(v *Vault) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated vault
+	tmp, err := os.CreateTemp(s.dir, ".vault-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(v.Email))
+}
+
+func (s *fileStore) Delete(email string) error {
+	err := os.Remove(s.path(email))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+//go:build js
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+const (
+	idbName    = "passgo"
+	idbVersion = 1
+	idbVaults  = "vaults"
+)
+
+// indexedDBStore keeps each vault as a JSON string in the browser's IndexedDB
+type indexedDBStore struct {
+	db js.Value
+}
+
+// Open returns the store for this platform: IndexedDB on the web build
+func Open() (Store, error) {
+	indexedDB := js.Global().Get("indexedDB")
+	if indexedDB.IsUndefined() || indexedDB.IsNull() {
+		return nil, errors.New("IndexedDB is not available")
+	}
+
+	req := indexedDB.Call("open", idbName, idbVersion)
+
+	onUpgrade := js.FuncOf(func(this js.Value, args []js.Value) any {
+		db := req.Get("result")
+		if !db.Get("objectStoreNames").Call("contains", idbVaults).Bool() {
+			db.Call("createObjectStore", idbVaults)
+		}
+		return nil
+	})
+	defer onUpgrade.Release()
+	req.Set("onupgradeneeded", onUpgrade)
+
+	db, err := await(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &indexedDBStore{db: db}, nil
+}
+
+func (s *indexedDBStore) objectStore(mode string) js.Value {
+	return s.db.Call("transaction", idbVaults, mode).Call("objectStore", idbVaults)
+}
+
+func (s *indexedDBStore) Load(email string) (*Vault, error) {
+	value, err := await(s.objectStore("readonly").Call("get", vaultKey(email)))
+	if err != nil {
+		return nil, err
+	}
+	if value.IsUndefined() || value.IsNull() {
+		return nil, ErrNotFound
+	}
+
+	v := NewVault(email, "")
+	if err := json.Unmarshal([]byte(value.String()), v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *indexedDBStore) Save(v *Vault) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = await(s.objectStore("readwrite").Call("put", string(data), vaultKey(v.Email)))
+	return err
+}
+
+func (s *indexedDBStore) Delete(email string) error {
+	_, err := await(s.objectStore("readwrite").Call("delete", vaultKey(email)))
+	return err
+}
+
+// await blocks the calling goroutine until an IDBRequest succeeds or fails.
+// It must not be called from inside a JavaScript callback.
+func await(req js.Value) (js.Value, error) {
+	done := make(chan struct{})
+	var result js.Value
+	var err error
+
+	onSuccess := js.FuncOf(func(this js.Value, args []js.Value) any {
+		result = req.Get("result")
+		close(done)
+		return nil
+	})
+	defer onSuccess.Release()
+
+	onError := js.FuncOf(func(this js.Value, args []js.Value) any {
+		err = fmt.Errorf("indexeddb: %s", req.Get("error").Get("message").String())
+		close(done)
+		return nil
+	})
+	defer onError.Release()
+
+	req.Set("onsuccess", onSuccess)
+	req.Set("onerror", onError)
+	<-done
+
+	return result, err
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/philopaterwaheed/passGO/internal/frontend/api"
+)
+
+// Replay sends the queued writes to the backend in order, for callers that
+// have the vault to themselves. It stops at the first write that fails,
+// keeping it and everything after it queued for the next attempt, and returns
+// that error. Callers that share the vault send each write with SendWrite
+// between NextWrite and FinishWrite instead, without holding their lock.
+func (v *Vault) Replay(client *api.Client) error {
+	for {
+		w, ok := v.NextWrite()
+		if !ok {
+			return nil
+		}
+		if err := v.FinishWrite(SendWrite(client, w)); err != nil {
+			return err
+		}
+	}
+}
+
+// NextWrite returns the oldest queued write and marks it as being sent.
+// Until FinishWrite is called, local edits queue behind it rather than
+// change it, so it can be sent while the vault is in use.
+func (v *Vault) NextWrite() (PendingWrite, bool) {
+	if len(v.Pending) == 0 {
+		v.Pending = nil
+		return PendingWrite{}, false
+	}
+
+	v.sending = true
+	return v.Pending[0], true
+}
+
+// SendWrite sends a queued write to the backend and returns the backend's
+// copy of the item, if there is one. It touches no vault state.
+func SendWrite(client *api.Client, w PendingWrite) (*api.VaultItem, error) {
+	switch w.Op {
+	case OpCreate:
+		return client.CreateItem(w.Create)
+	case OpUpdate:
+		return client.UpdateItem(w.ItemID, w.BaseRevision, w.Update)
+	case OpTrash:
+		return nil, client.TrashItem(w.ItemID)
+	}
+	return nil, nil
+}
+
+// FinishWrite records the result of sending the write NextWrite returned. A
+// write that failed but may succeed later stays queued and its error is
+// returned. Only writes the backend refuses for good are dropped: invalid
+// ones, those of missing items and conflicts. Stale updates become Conflicts
+// holding the server copy.
+func (v *Vault) FinishWrite(item *api.VaultItem, err error) error {
+	v.sending = false
+	if len(v.Pending) == 0 {
+		return nil
+	}
+	w := v.Pending[0]
+
+	var conflict *api.ConflictError
+	switch {
+	case w.Op == OpUpdate && errors.As(err, &conflict):
+		v.Conflicts = append(v.Conflicts, Conflict{Local: *w.Update, Server: *conflict.Item})
+		v.Items[w.ItemID] = *conflict.Item
+		v.rebasePending(w.ItemID, conflict.Item.Revision)
+	case err != nil && !rejected(err):
+		return err
+	case err != nil:
+		log.Printf("Dropping queued %s of item %s: %v", w.Op, w.ItemID, err)
+	case w.Op == OpCreate:
+		v.storeSent(w.ItemID, *item)
+		v.renamePending(w.ItemID, item.ID, item.Revision)
+	case w.Op == OpUpdate:
+		v.storeSent(w.ItemID, *item)
+		v.rebasePending(w.ItemID, item.Revision)
+	}
+
+	v.Pending = v.Pending[1:]
+	return nil
+}
+
+// rejected reports whether the backend refused a write for good, so that
+// sending it again cannot succeed
+func rejected(err error) bool {
+	switch api.StatusCode(err) {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusConflict:
+		return true
+	}
+	return false
+}
+
+// storeSent replaces the local copy of an item with the backend's copy after
+// a write was sent. Edits made meanwhile are still queued, so their local
+// version is kept and only takes on the backend's ID and revision.
+func (v *Vault) storeSent(localID string, item api.VaultItem) {
+	local, edited := v.Items[localID]
+	edited = edited && v.hasLaterPending(localID)
+	delete(v.Items, localID)
+
+	if edited {
+		local.ID = item.ID
+		local.Revision = item.Revision
+		local.CreatedAt = item.CreatedAt
+		item = local
+	}
+	v.Items[item.ID] = item
+}
+
+// hasLaterPending reports whether writes to an item are queued behind the
+// first one
+func (v *Vault) hasLaterPending(id string) bool {
+	for i := 1; i < len(v.Pending); i++ {
+		if v.Pending[i].ItemID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// renamePending points the remaining queued writes of an item created offline
+// at the ID the backend assigned to it
+func (v *Vault) renamePending(localID, id string, revision int64) {
+	for i := 1; i < len(v.Pending); i++ {
+		if v.Pending[i].ItemID == localID {
+			v.Pending[i].ItemID = id
+			v.Pending[i].BaseRevision = revision
+		}
+	}
+}
+
+// rebasePending moves the remaining queued writes of an item onto a new revision
+func (v *Vault) rebasePending(id string, revision int64) {
+	for i := 1; i < len(v.Pending); i++ {
+		if v.Pending[i].ItemID == id {
+			v.Pending[i].BaseRevision = revision
+		}
+	}
+}
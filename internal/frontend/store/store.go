@@ -0,0 +1,31 @@
+// Package store persists the encrypted vault and its sync state on the device
+// so the client keeps working without a connection to the backend.
+// Everything stored is either ciphertext or wrapped key material; the vault
+// key itself never touches the disk.
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrNotFound = errors.New("no local vault for this account")
+
+// Store loads and saves the local vault of an account
+type Store interface {
+	// Load returns the vault saved for the given email, or ErrNotFound
+	Load(email string) (*Vault, error)
+	// Save persists the vault under its Email
+	Save(v *Vault) error
+	// Delete removes the vault saved for the given email, if any
+	Delete(email string) error
+}
+
+// vaultKey derives the storage key of an account's vault. Emails are hashed so
+// the list of accounts used on a device is not readable from the store itself.
+func vaultKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,277 @@
+//go:build !js
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/internal/frontend/api"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load("a@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load of missing vault: got %v, want ErrNotFound", err)
+	}
+
+	v := NewVault("a@example.com", "user1")
+	v.Revision = 7
+	if _, err := v.CreateItem(api.CreateItemRequest{Type: "login", Data: "ct"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(v); err != nil {
+		t.Fatal(err)
+	}
+
+	// Emails are matched case-insensitively
+	loaded, err := s.Load("A@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.UserID != "user1" || loaded.Revision != 7 || len(loaded.Items) != 1 || len(loaded.Pending) != 1 {
+		t.Fatalf("loaded vault does not match saved one: %+v", loaded)
+	}
+
+	if err := s.Delete("a@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("a@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load after Delete: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalEditsCollapse(t *testing.T) {
+	v := NewVault("a@example.com", "user1")
+	v.Items["srv1"] = api.VaultItem{ID: "srv1", Type: "login", Data: "v1", Revision: 3}
+
+	if _, err := v.UpdateItem("srv1", api.UpdateItemRequest{Data: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	folder := "f1"
+	if _, err := v.UpdateItem("srv1", api.UpdateItemRequest{Data: "v3", FolderID: &folder}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.Pending) != 1 {
+		t.Fatalf("got %d pending writes, want 1", len(v.Pending))
+	}
+	w := v.Pending[0]
+	if w.Op != OpUpdate || w.BaseRevision != 3 || w.Update.Data != "v3" || *w.Update.FolderID != "f1" {
+		t.Fatalf("unexpected pending write: %+v", w)
+	}
+
+	// An item created and trashed offline never reaches the backend
+	item, err := v.CreateItem(api.CreateItemRequest{Type: "secure_note", Data: "n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.TrashItem(item.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v.Items[item.ID]; ok || len(v.Pending) != 1 {
+		t.Fatalf("offline item should be gone: items=%v pending=%v", v.Items, v.Pending)
+	}
+}
+
+func TestApplySyncKeepsPendingEdits(t *testing.T) {
+	v := NewVault("a@example.com", "user1")
+	v.Items["srv1"] = api.VaultItem{ID: "srv1", Data: "v1", Revision: 1}
+	v.Items["srv2"] = api.VaultItem{ID: "srv2", Data: "x", Revision: 1}
+	if _, err := v.UpdateItem("srv1", api.UpdateItemRequest{Data: "local"}); err != nil {
+		t.Fatal(err)
+	}
+
+	v.ApplySync(&api.SyncResponse{
+		Revision: 9,
+		Full:     true,
+		Items:    []api.VaultItem{{ID: "srv1", Data: "remote", Revision: 2}, {ID: "srv3", Data: "new", Revision: 1}},
+	})
+
+	if v.Items["srv1"].Data != "local" {
+		t.Errorf("pending edit was overwritten by sync: %q", v.Items["srv1"].Data)
+	}
+	if _, ok := v.Items["srv2"]; ok {
+		t.Error("full sync should drop items missing on the server")
+	}
+	if _, ok := v.Items["srv3"]; !ok || v.Revision != 9 {
+		t.Error("full sync was not applied")
+	}
+
+	v.ApplySync(&api.SyncResponse{
+		Revision:   10,
+		Tombstones: []api.Tombstone{{Kind: api.TombstoneItem, ID: "srv1"}},
+	})
+	if _, ok := v.Items["srv1"]; ok || len(v.Pending) != 0 {
+		t.Error("tombstone should remove the item and its pending writes")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("If-Match"))
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/vault/items":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"item": api.VaultItem{ID: "srvNew", Data: "created", Revision: 1}})
+		case r.Method == "PUT" && r.URL.Path == "/api/vault/items/srvNew":
+			json.NewEncoder(w).Encode(map[string]any{"item": api.VaultItem{ID: "srvNew", Data: "edited", Revision: 2}})
+		case r.Method == "PUT" && r.URL.Path == "/api/vault/items/srv1":
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]any{"error": "conflict", "item": api.VaultItem{ID: "srv1", Data: "theirs", Revision: 5}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "not found"})
+		}
+	}))
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL)
+	client.Token = "token"
+
+	v := NewVault("a@example.com", "user1")
+	v.Items["srv1"] = api.VaultItem{ID: "srv1", Data: "base", Revision: 4}
+	created, err := v.CreateItem(api.CreateItemRequest{Type: "login", Data: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Queue an edit of the new item behind its creation, as if made after a replay started
+	v.Pending = append(v.Pending, PendingWrite{Op: OpUpdate, ItemID: created.ID, Update: &api.UpdateItemRequest{Data: "edited"}})
+	if _, err := v.UpdateItem("srv1", api.UpdateItemRequest{Data: "mine"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Replay(client); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`POST /api/vault/items `,
+		`PUT /api/vault/items/srvNew "1"`,
+		`PUT /api/vault/items/srv1 "4"`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("requests:\n%s\nwant:\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+
+	if _, ok := v.Items[created.ID]; ok || v.Items["srvNew"].Data != "edited" {
+		t.Error("created item was not renamed to its server ID")
+	}
+	if len(v.Conflicts) != 1 || v.Conflicts[0].Local.Data != "mine" || v.Items["srv1"].Data != "theirs" {
+		t.Errorf("conflict was not recorded: %+v", v.Conflicts)
+	}
+	if len(v.Pending) != 0 {
+		t.Errorf("queue not drained: %+v", v.Pending)
+	}
+}
+
+func TestReplayKeepsQueueWhileOffline(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	client := api.NewClient(srv.URL)
+	client.Token = "token"
+
+	v := NewVault("a@example.com", "user1")
+	if _, err := v.CreateItem(api.CreateItemRequest{Type: "login", Data: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := v.Replay(client)
+	if err == nil || !api.IsUnreachable(err) {
+		t.Fatalf("got %v, want an unreachable error", err)
+	}
+	if len(v.Pending) != 1 {
+		t.Fatalf("queued write was lost: %+v", v.Pending)
+	}
+}
+
+func TestReplayKeepsQueueOnServerError(t *testing.T) {
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": "failed"})
+	}))
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL)
+	client.Token = "token"
+
+	v := NewVault("a@example.com", "user1")
+	if _, err := v.CreateItem(api.CreateItemRequest{Type: "login", Data: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing backend may accept the write later
+	if err := v.Replay(client); api.StatusCode(err) != http.StatusInternalServerError {
+		t.Fatalf("got %v, want the server error", err)
+	}
+	if len(v.Pending) != 1 {
+		t.Fatalf("queued write was lost: %+v", v.Pending)
+	}
+
+	// A write the backend rejects as invalid never will
+	status = http.StatusBadRequest
+	if err := v.Replay(client); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Pending) != 0 {
+		t.Errorf("rejected write was kept: %+v", v.Pending)
+	}
+}
+
+func TestEditDuringSendQueuesBehindIt(t *testing.T) {
+	var creates []api.CreateItemRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var req api.CreateItemRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		creates = append(creates, req)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"item": api.VaultItem{ID: "srvNew", Data: req.Data, Revision: 1}})
+	}))
+	defer srv.Close()
+
+	client := api.NewClient(srv.URL)
+	client.Token = "token"
+
+	v := NewVault("a@example.com", "user1")
+	created, err := v.CreateItem(api.CreateItemRequest{Type: "login", Data: "created"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, ok := v.NextWrite()
+	if !ok {
+		t.Fatal("no write queued")
+	}
+	// Edited while the create is on the wire
+	if _, err := v.UpdateItem(created.ID, api.UpdateItemRequest{Data: "edited"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.FinishWrite(SendWrite(client, w)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(creates) != 1 || creates[0].ClientID != created.ID || creates[0].Data != "created" {
+		t.Fatalf("create sent as %+v", creates)
+	}
+	if v.Items["srvNew"].Data != "edited" {
+		t.Errorf("local edit was lost: %+v", v.Items["srvNew"])
+	}
+	if len(v.Pending) != 1 || v.Pending[0].Op != OpUpdate || v.Pending[0].ItemID != "srvNew" || v.Pending[0].BaseRevision != 1 {
+		t.Errorf("edit was not queued behind the create: %+v", v.Pending)
+	}
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/frontend/api"
+)
+
+// localIDPrefix marks items created offline that the backend has not assigned an ID to yet
+const localIDPrefix = "local-"
+
+var ErrItemNotFound = errors.New("vault item not found")
+
+// Pending write operations
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpTrash  = "trash"
+)
+
+// PendingWrite is a local change waiting to be sent to the backend
+type PendingWrite struct {
+	Op     string `json:"op"`
+	ItemID string `json:"item_id"`
+	// BaseRevision is the server revision the change was made on, sent as If-Match
+	BaseRevision int64                  `json:"base_revision,omitempty"`
+	Create       *api.CreateItemRequest `json:"create,omitempty"`
+	Update       *api.UpdateItemRequest `json:"update,omitempty"`
+	QueuedAt     time.Time              `json:"queued_at"`
+}
+
+// Conflict is an offline edit that another device overwrote before it could be
+// replayed. The server copy has been kept; the UI decides what to do with Local.
+type Conflict struct {
+	Local  api.UpdateItemRequest `json:"local"`
+	Server api.VaultItem         `json:"server"`
+}
+
+// Vault is the local copy of an account's encrypted vault and sync state
+type Vault struct {
+	Email     string                   `json:"email"`
+	UserID    string                   `json:"user_id"`
+	Keys      *api.VaultKeys           `json:"keys,omitempty"`
+	Revision  int64                    `json:"revision"`
+	Items     map[string]api.VaultItem `json:"items"`
+	Folders   map[string]api.Folder    `json:"folders"`
+	Tags      map[string]api.Tag       `json:"tags"`
+	Pending   []PendingWrite           `json:"pending"`
+	Conflicts []Conflict               `json:"conflicts"`
+
+	// sending is set while the first pending write is being sent
+	sending bool
+}
+
+// NewVault creates an empty local vault for an account
+func NewVault(email, userID string) *Vault {
+	v := &Vault{Email: email, UserID: userID}
+	v.Reset()
+	return v
+}
+
+// Reset drops all synced data and pending writes
+func (v *Vault) Reset() {
+	v.Revision = 0
+	v.Items = make(map[string]api.VaultItem)
+	v.Folders = make(map[string]api.Folder)
+	v.Tags = make(map[string]api.Tag)
+	v.Pending = nil
+	v.Conflicts = nil
+}
+
+// ApplySync merges a sync response. Items with writes still queued keep their
+// local version until the writes are replayed.
+func (v *Vault) ApplySync(resp *api.SyncResponse) {
+	if resp.Full {
+		pending := v.Pending
+		conflicts := v.Conflicts
+		local := make(map[string]api.VaultItem)
+		for _, w := range pending {
+			if item, ok := v.Items[w.ItemID]; ok {
+				local[w.ItemID] = item
+			}
+		}
+
+		v.Reset()
+		v.Pending = pending
+		v.Conflicts = conflicts
+		for id, item := range local {
+			v.Items[id] = item
+		}
+	}
+
+	for _, item := range resp.Items {
+		if !v.hasPending(item.ID) {
+			v.Items[item.ID] = item
+		}
+	}
+	for _, folder := range resp.Folders {
+		v.Folders[folder.ID] = folder
+	}
+	for _, tag := range resp.Tags {
+		v.Tags[tag.ID] = tag
+	}
+	for _, tombstone := range resp.Tombstones {
+		switch tombstone.Kind {
+		case api.TombstoneItem:
+			delete(v.Items, tombstone.ID)
+			v.dropPending(tombstone.ID)
+		case api.TombstoneFolder:
+			delete(v.Folders, tombstone.ID)
+		case api.TombstoneTag:
+			delete(v.Tags, tombstone.ID)
+		}
+	}
+
+	v.Revision = resp.Revision
+}
+
+// CreateItem stores a new item locally and queues it for upload
+func (v *Vault) CreateItem(req api.CreateItemRequest) (api.VaultItem, error) {
+	id, err := newLocalID()
+	if err != nil {
+		return api.VaultItem{}, err
+	}
+
+	now := time.Now()
+	item := api.VaultItem{
+		ID:        id,
+		Type:      req.Type,
+		Data:      req.Data,
+		FolderID:  req.FolderID,
+		TagIDs:    req.TagIDs,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	v.Items[id] = item
+
+	req.ClientID = id
+	v.Pending = append(v.Pending, PendingWrite{
+		Op:       OpCreate,
+		ItemID:   id,
+		Create:   &req,
+		QueuedAt: now,
+	})
+
+	return item, nil
+}
+
+// UpdateItem changes an item locally and queues the change. Repeated edits of
+// the same item collapse into a single pending write, unless that write is
+// already being sent.
+func (v *Vault) UpdateItem(id string, req api.UpdateItemRequest) (api.VaultItem, error) {
+	item, ok := v.Items[id]
+	if !ok || item.DeletedAt != nil {
+		return api.VaultItem{}, ErrItemNotFound
+	}
+
+	item.Data = req.Data
+	if req.Type != "" {
+		item.Type = req.Type
+	}
+	if req.FolderID != nil {
+		item.FolderID = *req.FolderID
+	}
+	if req.TagIDs != nil {
+		item.TagIDs = *req.TagIDs
+	}
+	item.UpdatedAt = time.Now()
+	v.Items[id] = item
+
+	for i := range v.Pending {
+		w := &v.Pending[i]
+		if w.ItemID != id || (i == 0 && v.sending) {
+			continue
+		}
+		switch w.Op {
+		case OpCreate:
+			w.Create = &api.CreateItemRequest{
+				Type:     item.Type,
+				Data:     item.Data,
+				FolderID: item.FolderID,
+				TagIDs:   item.TagIDs,
+				ClientID: w.Create.ClientID,
+			}
+			return item, nil
+		case OpUpdate:
+			w.Update = mergeUpdate(w.Update, &req)
+			return item, nil
+		}
+	}
+
+	v.Pending = append(v.Pending, PendingWrite{
+		Op:           OpUpdate,
+		ItemID:       id,
+		BaseRevision: item.Revision,
+		Update:       &req,
+		QueuedAt:     time.Now(),
+	})
+
+	return item, nil
+}
+
+// TrashItem moves an item to the trash locally and queues the change.
+// Items that never reached the backend are simply dropped.
+func (v *Vault) TrashItem(id string) error {
+	item, ok := v.Items[id]
+	if !ok || item.DeletedAt != nil {
+		return ErrItemNotFound
+	}
+
+	// An item whose create is being sent may reach the backend after all
+	sendingCreate := v.sending && len(v.Pending) > 0 && v.Pending[0].ItemID == id
+	if strings.HasPrefix(id, localIDPrefix) && !sendingCreate {
+		delete(v.Items, id)
+		v.dropPending(id)
+		return nil
+	}
+
+	now := time.Now()
+	item.DeletedAt = &now
+	v.Items[id] = item
+
+	v.Pending = append(v.Pending, PendingWrite{
+		Op:       OpTrash,
+		ItemID:   id,
+		QueuedAt: now,
+	})
+
+	return nil
+}
+
+// hasPending reports whether writes to an item are still queued
+func (v *Vault) hasPending(id string) bool {
+	for _, w := range v.Pending {
+		if w.ItemID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// dropPending removes every queued write to an item
+func (v *Vault) dropPending(id string) {
+	kept := v.Pending[:0]
+	for _, w := range v.Pending {
+		if w.ItemID != id {
+			kept = append(kept, w)
+		}
+	}
+	v.Pending = kept
+}
+
+// mergeUpdate folds a newer update into an older queued one. The newer
+// ciphertext wins; folder and tag changes accumulate.
+func mergeUpdate(older, newer *api.UpdateItemRequest) *api.UpdateItemRequest {
+	merged := *newer
+	if merged.Type == "" {
+		merged.Type = older.Type
+	}
+	if merged.FolderID == nil {
+		merged.FolderID = older.FolderID
+	}
+	if merged.TagIDs == nil {
+		merged.TagIDs = older.TagIDs
+	}
+	return &merged
+}
+
+func newLocalID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return localIDPrefix + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,327 @@
+package frontend
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/philopaterwaheed/passGO/internal/frontend/api"
+	"github.com/philopaterwaheed/passGO/internal/frontend/store"
+)
+
+var (
+	// vaultMu guards localVault and every change to it
+	vaultMu sync.Mutex
+	// localVault is the logged in user's offline copy of the vault
+	localVault *store.Vault
+	// localStore persists localVault; nil when the platform offers no storage
+	localStore store.Store
+
+	// syncMu lets only one sync talk to the backend at a time
+	syncMu sync.Mutex
+
+	// retryMu guards retryTimer and retryDelay
+	retryMu sync.Mutex
+	// retryTimer syncs again after a replay left writes queued
+	retryTimer *time.Timer
+	// retryDelay is how long retryTimer waited last
+	retryDelay time.Duration
+)
+
+func init() {
+	s, err := store.Open()
+	if err != nil {
+		log.Printf("Warning: Local vault storage unavailable, working online only: %v", err)
+		return
+	}
+	localStore = s
+}
+
+// openLocalVault loads the saved vault of an account, starting a fresh one when
+// there is none or it belongs to a different user, and records the latest keys
+func openLocalVault(email, userID string, keys *api.VaultKeys) {
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+
+	localVault = nil
+	if localStore != nil {
+		v, err := localStore.Load(email)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("Failed to load local vault: %v", err)
+		}
+		if err == nil && v.UserID == userID {
+			localVault = v
+		}
+	}
+	if localVault == nil {
+		localVault = store.NewVault(email, userID)
+	}
+
+	if keys != nil {
+		localVault.Keys = keys
+	}
+	saveLocalVault()
+}
+
+// loadOfflineVault opens the saved vault of an account without contacting the backend
+func loadOfflineVault(email string) (*store.Vault, error) {
+	if localStore == nil {
+		return nil, store.ErrNotFound
+	}
+	return localStore.Load(email)
+}
+
+// saveLocalVault persists localVault. The caller must hold vaultMu.
+func saveLocalVault() {
+	if localStore == nil || localVault == nil {
+		return
+	}
+	if err := localStore.Save(localVault); err != nil {
+		log.Printf("Failed to save local vault: %v", err)
+	}
+}
+
+// createItem stores a new item locally and uploads it as soon as possible
+func createItem(client *api.Client, req api.CreateItemRequest) (api.VaultItem, error) {
+	vaultMu.Lock()
+	item, err := localVault.CreateItem(req)
+	if err == nil {
+		saveLocalVault()
+	}
+	vaultMu.Unlock()
+
+	if err == nil {
+		go syncVault(client)
+	}
+	return item, err
+}
+
+// updateItem changes an item locally and uploads the change as soon as possible
+func updateItem(client *api.Client, id string, req api.UpdateItemRequest) (api.VaultItem, error) {
+	vaultMu.Lock()
+	item, err := localVault.UpdateItem(id, req)
+	if err == nil {
+		saveLocalVault()
+	}
+	vaultMu.Unlock()
+
+	if err == nil {
+		go syncVault(client)
+	}
+	return item, err
+}
+
+// trashItem trashes an item locally and uploads the change as soon as possible
+func trashItem(client *api.Client, id string) error {
+	vaultMu.Lock()
+	err := localVault.TrashItem(id)
+	if err == nil {
+		saveLocalVault()
+	}
+	vaultMu.Unlock()
+
+	if err == nil {
+		go syncVault(client)
+	}
+	return err
+}
+
+// syncVault replays queued offline writes, then pulls the changes made since
+// the last sync. Without a connection it leaves the queue untouched.
+func syncVault(client *api.Client) error {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	vaultMu.Lock()
+	v := localVault
+	vaultMu.Unlock()
+	if v == nil {
+		return nil
+	}
+
+	// Each write is sent without holding vaultMu, so that the UI can keep
+	// reading and editing the vault while the backend is slow to answer
+	for {
+		vaultMu.Lock()
+		if localVault != v {
+			vaultMu.Unlock()
+			return nil
+		}
+		w, ok := v.NextWrite()
+		vaultMu.Unlock()
+		if !ok {
+			break
+		}
+
+		item, err := store.SendWrite(client, w)
+
+		vaultMu.Lock()
+		if localVault != v {
+			vaultMu.Unlock()
+			return nil
+		}
+		err = v.FinishWrite(item, err)
+		saveLocalVault()
+		vaultMu.Unlock()
+		if err != nil {
+			retryReplay(client)
+			return err
+		}
+	}
+	replaySucceeded()
+
+	vaultMu.Lock()
+	since := v.Revision
+	vaultMu.Unlock()
+
+	resp, err := client.Sync(since)
+	if err != nil {
+		return err
+	}
+
+	vaultMu.Lock()
+	defer vaultMu.Unlock()
+	if localVault != v {
+		// Another account logged in meanwhile
+		return nil
+	}
+	v.ApplySync(resp)
+	saveLocalVault()
+	return nil
+}
+
+// retryReplay schedules another sync after a replay left writes queued,
+// waiting twice as long as the time before, from a second up to five minutes
+func retryReplay(client *api.Client) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+
+	if retryTimer != nil {
+		return
+	}
+	retryDelay = min(max(2*retryDelay, time.Second), 5*time.Minute)
+	retryTimer = time.AfterFunc(retryDelay, func() {
+		retryMu.Lock()
+		retryTimer = nil
+		retryMu.Unlock()
+
+		if err := syncVault(client); err != nil {
+			log.Printf("Vault sync failed: %v", err)
+		}
+	})
+}
+
+// replaySucceeded resets the delay of retryReplay once the queue drained
+func replaySucceeded() {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	retryDelay = 0
+}
+
+var (
+	watchMu     sync.Mutex
+	stopWatcher context.CancelFunc
+)
+
+// startWatching syncs the vault and keeps it current from the backend's event
+// stream, replacing any previous watcher. onChange is called after every sync;
+// onRevoked when the backend reports that the session was revoked.
+func startWatching(client *api.Client, onChange, onRevoked func()) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+
+	if stopWatcher != nil {
+		stopWatcher()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopWatcher = cancel
+	go watchVault(ctx, client, onChange, onRevoked)
+}
+
+// watchVault runs until ctx is cancelled or the session is revoked,
+// reconnecting with backoff whenever the stream drops. Every reconnect
+// replays the writes queued while offline.
+func watchVault(ctx context.Context, client *api.Client, onChange, onRevoked func()) {
+	backoff := time.Second
+
+	for ctx.Err() == nil {
+		// Catch up on anything missed while disconnected
+		if err := syncVault(client); err != nil {
+			log.Printf("Vault sync failed: %v", err)
+		} else {
+			onChange()
+		}
+
+		revoked := false
+		token := client.AccessToken()
+		connectedAt := time.Now()
+		err := client.Subscribe(ctx, func(event api.Event) {
+			switch event.Type {
+			case api.EventVaultChanged:
+				if err := syncVault(client); err != nil {
+					log.Printf("Vault sync failed: %v", err)
+					return
+				}
+				onChange()
+			case api.EventSessionRevoked:
+				revoked = true
+			}
+		})
+
+		// A password change on this device revokes the stream's old token
+		// but hands the client a new one; keep going with that
+		if revoked && client.AccessToken() != token {
+			continue
+		}
+		if revoked {
+			vaultMu.Lock()
+			localVault = nil
+			vaultMu.Unlock()
+			onRevoked()
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if time.Since(connectedAt) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("Event stream disconnected: %v; reconnecting in %s", err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// loginWhenReachable retries a login that failed for lack of a connection
+// until the backend answers, then calls onOnline with the result
+func loginWhenReachable(client *api.Client, email, password string, onOnline func(*api.AuthResponse)) {
+	backoff := time.Second
+	for {
+		time.Sleep(backoff)
+
+		resp, err := logIn(client, email, password)
+		if err == nil {
+			onOnline(resp)
+			return
+		}
+		if !api.IsUnreachable(err) {
+			log.Printf("Reconnecting login failed: %v", err)
+			return
+		}
+
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
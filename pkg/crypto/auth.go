@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var authCredentialInfo = []byte("passgo:auth")
+
+// DeriveAuthCredential derives the credential a client logs in with from the
+// master password. It runs Argon2id under a salt of its own, separate from
+// the one of the master key, and passes the result through HKDF, so the
+// credential the server checks cannot be used to unwrap the vault key.
+func DeriveAuthCredential(password string, salt []byte, params KDFParams) (string, error) {
+	key, err := DeriveMasterKey(password, salt, params)
+	if err != nil {
+		return "", err
+	}
+
+	credential := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, authCredentialInfo), credential); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(credential), nil
+}
@@ -0,0 +1,283 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testParams keeps Argon2id cheap enough for unit tests
+var testParams = KDFParams{Algorithm: KDFArgon2id, Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestDeriveMasterKeyIsDeterministic(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := DeriveMasterKey("correct horse", salt, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := DeriveMasterKey("correct horse", salt, testParams)
+	c, _ := DeriveMasterKey("battery staple", salt, testParams)
+
+	if !bytes.Equal(a, b) {
+		t.Error("Expected identical keys for identical inputs")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("Expected different keys for different passwords")
+	}
+	if len(a) != KeySize {
+		t.Errorf("Expected key size %d, got %d", KeySize, len(a))
+	}
+}
+
+func TestDeriveMasterKeyRejectsBadParams(t *testing.T) {
+	salt, _ := NewSalt()
+
+	if _, err := DeriveMasterKey("pw", salt, KDFParams{Algorithm: "scrypt", Memory: 64, Iterations: 1, Parallelism: 1}); !errors.Is(err, ErrUnsupportedKDF) {
+		t.Errorf("Expected ErrUnsupportedKDF, got %v", err)
+	}
+	if _, err := DeriveMasterKey("pw", salt, KDFParams{Algorithm: KDFArgon2id}); !errors.Is(err, ErrInvalidKDFParams) {
+		t.Errorf("Expected ErrInvalidKDFParams, got %v", err)
+	}
+	for _, params := range []KDFParams{
+		{Algorithm: KDFArgon2id, Memory: MaxKDFMemory + 1, Iterations: 1, Parallelism: 1},
+		{Algorithm: KDFArgon2id, Memory: 64, Iterations: MaxKDFIterations + 1, Parallelism: 1},
+		{Algorithm: KDFArgon2id, Memory: 1024, Iterations: 1, Parallelism: MaxKDFParallelism + 1},
+	} {
+		if _, err := DeriveMasterKey("pw", salt, params); !errors.Is(err, ErrInvalidKDFParams) {
+			t.Errorf("Expected ErrInvalidKDFParams for %+v, got %v", params, err)
+		}
+	}
+	if _, err := DeriveMasterKey("pw", nil, testParams); !errors.Is(err, ErrInvalidSalt) {
+		t.Errorf("Expected ErrInvalidSalt, got %v", err)
+	}
+}
+
+func TestKDFParamsMeetMinimums(t *testing.T) {
+	min := KDFParams{Algorithm: KDFArgon2id, Memory: 19 * 1024, Iterations: 2, Parallelism: 1}
+
+	if !DefaultKDFParams().Meets(min) {
+		t.Error("Expected default parameters to meet the minimums")
+	}
+	if testParams.Meets(min) {
+		t.Error("Expected test parameters to fall short of the minimums")
+	}
+
+	upgraded := testParams.AtLeast(min)
+	if !upgraded.Meets(min) {
+		t.Errorf("Expected upgraded parameters to meet the minimums, got %+v", upgraded)
+	}
+	if upgraded.Parallelism != testParams.Parallelism {
+		t.Error("Expected parallelism to be kept")
+	}
+	if err := upgraded.Validate(); err != nil {
+		t.Errorf("Expected upgraded parameters to be valid, got %v", err)
+	}
+}
+
+func TestWrapAndUnwrapVaultKey(t *testing.T) {
+	salt, _ := NewSalt()
+	masterKey, _ := DeriveMasterKey("correct horse", salt, testParams)
+	vaultKey, err := GenerateVaultKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := WrapVaultKey(masterKey, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := UnwrapVaultKey(masterKey, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, vaultKey) {
+		t.Error("Unwrapped key does not match original")
+	}
+
+	wrongKey, _ := DeriveMasterKey("wrong", salt, testParams)
+	if _, err := UnwrapVaultKey(wrongKey, wrapped); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Expected ErrWrongPassword, got %v", err)
+	}
+}
+
+func TestEnvelopeRejectsTampering(t *testing.T) {
+	key, _ := GenerateVaultKey()
+
+	envelope, err := EncryptItem(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := DecryptItem(key, envelope)
+	if err != nil || string(plaintext) != "secret" {
+		t.Fatalf("Expected round trip, got %q, %v", plaintext, err)
+	}
+
+	raw, _ := base64.StdEncoding.DecodeString(envelope)
+	raw[len(raw)-1] ^= 0xff
+	if _, err := DecryptItem(key, base64.StdEncoding.EncodeToString(raw)); !errors.Is(err, ErrDecryptionFailed) {
+		t.Errorf("Expected ErrDecryptionFailed for tampered ciphertext, got %v", err)
+	}
+
+	raw[0] = 99
+	if _, err := DecryptItem(key, base64.StdEncoding.EncodeToString(raw)); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	// An item envelope must not be accepted as a wrapped vault key
+	if _, err := UnwrapVaultKey(key, envelope); err == nil {
+		t.Error("Expected item envelope to be rejected as vault key")
+	}
+}
+
+func TestRecoveryKeyRoundTrip(t *testing.T) {
+	formatted, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recoveryKey, err := ParseRecoveryKey(formatted)
+	if err != nil {
+		t.Fatalf("Failed to parse generated key %q: %v", formatted, err)
+	}
+
+	// Users may retype the key in lower case without dashes
+	retyped, err := ParseRecoveryKey(strings.ToLower(strings.ReplaceAll(formatted, "-", " ")))
+	if err != nil || !bytes.Equal(retyped, recoveryKey) {
+		t.Fatalf("Expected retyped key to parse to the same bytes, got %v", err)
+	}
+
+	wrapKey, authKey, err := DeriveRecoveryKeys(recoveryKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(wrapKey, authKey) {
+		t.Fatal("Wrap key and auth key must differ")
+	}
+
+	vaultKey, _ := GenerateVaultKey()
+	wrapped, err := WrapVaultKeyForRecovery(wrapKey, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := UnwrapVaultKeyForRecovery(wrapKey, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, vaultKey) {
+		t.Fatalf("Expected recovery round trip, got %v", err)
+	}
+
+	// A recovery envelope must not unwrap as a password-wrapped vault key
+	if _, err := UnwrapVaultKey(wrapKey, wrapped); err == nil {
+		t.Error("Expected recovery envelope to be rejected as password-wrapped key")
+	}
+
+	otherKey, _ := ParseRecoveryKey(strings.Repeat("A", 32))
+	otherWrapKey, _, _ := DeriveRecoveryKeys(otherKey)
+	if _, err := UnwrapVaultKeyForRecovery(otherWrapKey, wrapped); !errors.Is(err, ErrInvalidRecoveryKey) {
+		t.Errorf("Expected ErrInvalidRecoveryKey, got %v", err)
+	}
+}
+
+func TestParseRecoveryKeyRejectsMalformedKeys(t *testing.T) {
+	for _, key := range []string{"", "ABCD-EFGH", "1111-1111-1111-1111-1111-1111-1111-1111", strings.Repeat("A", 40)} {
+		if _, err := ParseRecoveryKey(key); !errors.Is(err, ErrInvalidRecoveryKey) {
+			t.Errorf("Expected ErrInvalidRecoveryKey for %q, got %v", key, err)
+		}
+	}
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	token, err := GenerateAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		t.Fatalf("Expected the token to start with %q, got %q", AccessTokenPrefix, token)
+	}
+
+	raw, err := ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to parse generated token: %v", err)
+	}
+	wrapKey, authKey, err := DeriveAccessTokenKeys(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(wrapKey, authKey) {
+		t.Fatal("Wrap key and auth key must differ")
+	}
+
+	credential := AccessTokenCredential(authKey)
+	parsed, err := ParseAccessTokenCredential(credential)
+	if err != nil || !bytes.Equal(parsed, authKey) {
+		t.Fatalf("Expected the credential to carry the auth key, got %v", err)
+	}
+	if AccessTokenVerifier(parsed) != AccessTokenVerifier(authKey) {
+		t.Error("Expected the verifier to be deterministic")
+	}
+
+	vaultKey, _ := GenerateVaultKey()
+	wrapped, err := WrapVaultKeyForAccessToken(wrapKey, vaultKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := UnwrapVaultKeyForAccessToken(wrapKey, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, vaultKey) {
+		t.Fatalf("Expected access token round trip, got %v", err)
+	}
+
+	// A token envelope must not unwrap as a recovery-wrapped vault key
+	if _, err := UnwrapVaultKeyForRecovery(wrapKey, wrapped); err == nil {
+		t.Error("Expected access token envelope to be rejected as recovery-wrapped key")
+	}
+
+	if _, err := UnwrapVaultKeyForAccessToken(authKey, wrapped); !errors.Is(err, ErrInvalidAccessToken) {
+		t.Errorf("Expected ErrInvalidAccessToken, got %v", err)
+	}
+}
+
+func TestParseAccessTokenRejectsMalformedTokens(t *testing.T) {
+	for _, token := range []string{"", "pgo_", "pgo_abc", "pat_" + strings.Repeat("A", 43), strings.Repeat("A", 43)} {
+		if _, err := ParseAccessToken(token); !errors.Is(err, ErrInvalidAccessToken) {
+			t.Errorf("Expected ErrInvalidAccessToken for %q, got %v", token, err)
+		}
+	}
+	for _, credential := range []string{"", "pat_abc", "pgo_" + strings.Repeat("A", 43), "eyJhbGciOiJFZERTQSJ9"} {
+		if _, err := ParseAccessTokenCredential(credential); !errors.Is(err, ErrInvalidAccessToken) {
+			t.Errorf("Expected ErrInvalidAccessToken for %q, got %v", credential, err)
+		}
+	}
+}
+
+func TestDeriveAuthCredential(t *testing.T) {
+	salt, _ := NewSalt()
+
+	a, err := DeriveAuthCredential("correct horse", salt, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := DeriveAuthCredential("correct horse", salt, testParams)
+	if a != b {
+		t.Error("Expected identical credentials for identical inputs")
+	}
+	if strings.Contains(a, "correct horse") {
+		t.Error("Expected the credential not to contain the password")
+	}
+
+	// The credential is not the master key derived under the same salt
+	masterKey, _ := DeriveMasterKey("correct horse", salt, testParams)
+	if a == base64.StdEncoding.EncodeToString(masterKey) {
+		t.Error("Expected the credential to differ from the master key")
+	}
+
+	if _, err := DeriveAuthCredential("correct horse", nil, testParams); !errors.Is(err, ErrInvalidSalt) {
+		t.Errorf("Expected ErrInvalidSalt, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// EnvelopeV1 is the version byte of envelopes sealed with XChaCha20-Poly1305
+const EnvelopeV1 byte = 1
+
+var (
+	ErrInvalidKey         = errors.New("invalid key size")
+	ErrInvalidEnvelope    = errors.New("invalid envelope")
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrDecryptionFailed   = errors.New("decryption failed")
+)
+
+// Encrypt seals plaintext under key and returns a base64 encoded envelope.
+//
+// The envelope layout is version (1 byte) || nonce (24 bytes) || ciphertext.
+// The version byte and the optional additional data are authenticated, so an
+// envelope cannot be replayed under a different context or version.
+func Encrypt(key, plaintext, additionalData []byte) (string, error) {
+	if len(key) != KeySize {
+		return "", ErrInvalidKey
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return "", err
+	}
+
+	out := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = EnvelopeV1
+	nonce := out[1:]
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	out = aead.Seal(out, nonce, plaintext, envelopeAD(EnvelopeV1, additionalData))
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// Decrypt opens an envelope produced by Encrypt
+func Decrypt(key []byte, envelope string, additionalData []byte) ([]byte, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(envelope)
+	if err != nil || len(raw) == 0 {
+		return nil, ErrInvalidEnvelope
+	}
+
+	if raw[0] != EnvelopeV1 {
+		return nil, ErrUnsupportedVersion
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) < 1+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidEnvelope
+	}
+
+	nonce := raw[1 : 1+aead.NonceSize()]
+	ciphertext := raw[1+aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, envelopeAD(raw[0], additionalData))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
+
+// envelopeAD binds the envelope version to the caller supplied additional data
+func envelopeAD(version byte, additionalData []byte) []byte {
+	ad := make([]byte, 0, 1+len(additionalData))
+	ad = append(ad, version)
+	return append(ad, additionalData...)
+}
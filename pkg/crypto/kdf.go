@@ -0,0 +1,115 @@
+// Package crypto implements the PassGO client-side key hierarchy.
+//
+// A master key is derived from the user's master password with Argon2id.
+// The master key never leaves the client; it only wraps a random vault key,
+// which in turn encrypts every vault item. The server stores the KDF salt,
+// the KDF parameters and the wrapped vault key, none of which allow it to
+// decrypt anything on its own. The master password does not leave the client
+// either: logins send a credential derived from it under a separate salt.
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KDFArgon2id identifies the Argon2id key derivation function
+const KDFArgon2id = "argon2id"
+
+const (
+	// KeySize is the size in bytes of master and vault keys
+	KeySize = 32
+	// SaltSize is the size in bytes of a freshly generated KDF salt
+	SaltSize = 16
+)
+
+// Upper bounds on KDF parameters. Parameters come from the server and from
+// other clients, so without them a single account could make every client
+// that unlocks it allocate gigabytes or spin for minutes.
+const (
+	MaxKDFMemory      = 1024 * 1024 // in KiB, 1 GiB
+	MaxKDFIterations  = 64
+	MaxKDFParallelism = 16
+)
+
+var (
+	ErrUnsupportedKDF   = errors.New("unsupported key derivation function")
+	ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+	ErrInvalidSalt      = errors.New("invalid key derivation salt")
+	ErrWeakKDFParams    = errors.New("key derivation parameters are weaker than required")
+)
+
+// KDFParams describes how a master key is derived from a master password
+type KDFParams struct {
+	Algorithm   string `bson:"algorithm" json:"algorithm" binding:"required"`
+	Memory      uint32 `bson:"memory" json:"memory" binding:"required"` // in KiB
+	Iterations  uint32 `bson:"iterations" json:"iterations" binding:"required"`
+	Parallelism uint8  `bson:"parallelism" json:"parallelism" binding:"required"`
+}
+
+// DefaultKDFParams returns the parameters used for newly created vaults
+func DefaultKDFParams() KDFParams {
+	return KDFParams{
+		Algorithm:   KDFArgon2id,
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 4,
+	}
+}
+
+// Validate checks that the parameters describe a usable derivation
+func (p KDFParams) Validate() error {
+	if p.Algorithm != KDFArgon2id {
+		return fmt.Errorf("%w: %q", ErrUnsupportedKDF, p.Algorithm)
+	}
+	if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 {
+		return ErrInvalidKDFParams
+	}
+	if p.Memory < 8*uint32(p.Parallelism) {
+		return ErrInvalidKDFParams
+	}
+	if p.Memory > MaxKDFMemory || p.Iterations > MaxKDFIterations || p.Parallelism > MaxKDFParallelism {
+		return ErrInvalidKDFParams
+	}
+	return nil
+}
+
+// Meets reports whether the parameters use the same algorithm as min and cost
+// at least as much memory and as many iterations. Parallelism does not add to
+// an attacker's cost, so it is not compared.
+func (p KDFParams) Meets(min KDFParams) bool {
+	return p.Algorithm == min.Algorithm && p.Memory >= min.Memory && p.Iterations >= min.Iterations
+}
+
+// AtLeast returns the parameters with their memory and iteration cost raised
+// to those of min where they fall short
+func (p KDFParams) AtLeast(min KDFParams) KDFParams {
+	p.Memory = max(p.Memory, min.Memory)
+	p.Iterations = max(p.Iterations, min.Iterations)
+	return p
+}
+
+// NewSalt generates a random salt for master key derivation
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// DeriveMasterKey derives the master key from a master password
+func DeriveMasterKey(password string, salt []byte, params KDFParams) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	if len(salt) < 8 {
+		return nil, ErrInvalidSalt
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, KeySize)
+	return key, nil
+}
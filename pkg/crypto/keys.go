@@ -0,0 +1,56 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Additional data labels keep envelopes of different purposes apart
+var (
+	vaultKeyAD = []byte("passgo:vault-key")
+	itemAD     = []byte("passgo:item")
+)
+
+var ErrWrongPassword = errors.New("wrong master password or corrupted vault key")
+
+// GenerateVaultKey creates a new random vault key
+func GenerateVaultKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapVaultKey encrypts the vault key under a master key
+func WrapVaultKey(masterKey, vaultKey []byte) (string, error) {
+	if len(vaultKey) != KeySize {
+		return "", ErrInvalidKey
+	}
+	return Encrypt(masterKey, vaultKey, vaultKeyAD)
+}
+
+// UnwrapVaultKey decrypts a vault key previously wrapped with WrapVaultKey
+func UnwrapVaultKey(masterKey []byte, wrappedKey string) ([]byte, error) {
+	vaultKey, err := Decrypt(masterKey, wrappedKey, vaultKeyAD)
+	if err != nil {
+		if errors.Is(err, ErrDecryptionFailed) {
+			return nil, ErrWrongPassword
+		}
+		return nil, err
+	}
+	if len(vaultKey) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return vaultKey, nil
+}
+
+// EncryptItem seals a serialized vault item payload under the vault key
+func EncryptItem(vaultKey, plaintext []byte) (string, error) {
+	return Encrypt(vaultKey, plaintext, itemAD)
+}
+
+// DecryptItem opens a vault item payload sealed with EncryptItem
+func DecryptItem(vaultKey []byte, ciphertext string) ([]byte, error) {
+	return Decrypt(vaultKey, ciphertext, itemAD)
+}
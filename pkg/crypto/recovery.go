@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+// RecoveryKeySize is the number of random bytes in a recovery key (160 bits).
+// The key is random rather than chosen by the user, so it needs no slow KDF.
+const RecoveryKeySize = 20
+
+// recoveryGroupSize is the number of characters per dash-separated group
+// of a formatted recovery key
+const recoveryGroupSize = 4
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var ErrInvalidRecoveryKey = errors.New("invalid recovery key")
+
+var recoverySplit = splitKey{
+	size:     RecoveryKeySize,
+	wrapInfo: []byte("passgo:recovery-wrap"),
+	authInfo: []byte("passgo:recovery-auth"),
+	ad:       []byte("passgo:recovery-vault-key"),
+	invalid:  ErrInvalidRecoveryKey,
+}
+
+// GenerateRecoveryKey creates a new random recovery key formatted for the
+// user to write down, e.g. "ABCD-EFGH-..."
+func GenerateRecoveryKey() (string, error) {
+	key := make([]byte, RecoveryKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	encoded := recoveryEncoding.EncodeToString(key)
+	groups := make([]string, 0, len(encoded)/recoveryGroupSize)
+	for i := 0; i < len(encoded); i += recoveryGroupSize {
+		groups = append(groups, encoded[i:min(i+recoveryGroupSize, len(encoded))])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// ParseRecoveryKey decodes a recovery key as typed by the user. Case, dashes
+// and whitespace are ignored.
+func ParseRecoveryKey(s string) ([]byte, error) {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(s))
+
+	key, err := recoveryEncoding.DecodeString(normalized)
+	if err != nil || len(key) != RecoveryKeySize {
+		return nil, ErrInvalidRecoveryKey
+	}
+	return key, nil
+}
+
+// DeriveRecoveryKeys splits a recovery key into its wrapping key and the auth
+// key that proves possession of it to the server
+func DeriveRecoveryKeys(recoveryKey []byte) (wrapKey, authKey []byte, err error) {
+	return recoverySplit.derive(recoveryKey)
+}
+
+// WrapVaultKeyForRecovery encrypts the vault key under a recovery wrapping key
+func WrapVaultKeyForRecovery(wrapKey, vaultKey []byte) (string, error) {
+	return recoverySplit.wrap(wrapKey, vaultKey)
+}
+
+// UnwrapVaultKeyForRecovery decrypts a vault key previously wrapped with
+// WrapVaultKeyForRecovery
+func UnwrapVaultKeyForRecovery(wrapKey []byte, wrappedKey string) ([]byte, error) {
+	return recoverySplit.unwrap(wrapKey, wrappedKey)
+}
+
+// RecoveryVerifier hashes a recovery auth key into the verifier the server
+// stores
+func RecoveryVerifier(authKey []byte) string {
+	return verifier(authKey)
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// splitKey describes a random secret held by the user, such as a recovery key
+// or an access token, that is split into a wrapping key, which wraps the vault
+// key and never leaves the client, and an auth key, which proves possession of
+// the secret to the server. The labels keep the keys of different secrets apart.
+type splitKey struct {
+	size     int
+	wrapInfo []byte
+	authInfo []byte
+	ad       []byte
+	invalid  error
+}
+
+func (k splitKey) derive(secret []byte) (wrapKey, authKey []byte, err error) {
+	if len(secret) != k.size {
+		return nil, nil, k.invalid
+	}
+
+	wrapKey = make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, k.wrapInfo), wrapKey); err != nil {
+		return nil, nil, err
+	}
+
+	authKey = make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, k.authInfo), authKey); err != nil {
+		return nil, nil, err
+	}
+
+	return wrapKey, authKey, nil
+}
+
+func (k splitKey) wrap(wrapKey, vaultKey []byte) (string, error) {
+	if len(vaultKey) != KeySize {
+		return "", ErrInvalidKey
+	}
+	return Encrypt(wrapKey, vaultKey, k.ad)
+}
+
+func (k splitKey) unwrap(wrapKey []byte, wrappedKey string) ([]byte, error) {
+	vaultKey, err := Decrypt(wrapKey, wrappedKey, k.ad)
+	if err != nil {
+		if errors.Is(err, ErrDecryptionFailed) {
+			return nil, k.invalid
+		}
+		return nil, err
+	}
+	if len(vaultKey) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return vaultKey, nil
+}
+
+// verifier hashes an auth key into the base64 encoded verifier the server
+// stores. The auth key is high-entropy, so a plain hash suffices.
+func verifier(authKey []byte) string {
+	sum := sha256.Sum256(authKey)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
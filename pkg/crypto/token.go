@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// AccessTokenSize is the number of random bytes in a personal access token
+const AccessTokenSize = 32
+
+const (
+	// AccessTokenPrefix marks a personal access token as handed to the user
+	AccessTokenPrefix = "pgo_"
+	// AccessTokenCredentialPrefix marks the bearer credential derived from a
+	// personal access token, which is what clients send to the server
+	AccessTokenCredentialPrefix = "pat_"
+)
+
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+var accessTokenSplit = splitKey{
+	size:     AccessTokenSize,
+	wrapInfo: []byte("passgo:access-token-wrap"),
+	authInfo: []byte("passgo:access-token-auth"),
+	ad:       []byte("passgo:access-token-vault-key"),
+	invalid:  ErrInvalidAccessToken,
+}
+
+// GenerateAccessToken creates a new random personal access token, e.g. "pgo_..."
+func GenerateAccessToken() (string, error) {
+	token := make([]byte, AccessTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// ParseAccessToken decodes a personal access token as given to the user
+func ParseAccessToken(s string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(s), AccessTokenPrefix)
+	if !ok {
+		return nil, ErrInvalidAccessToken
+	}
+
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != AccessTokenSize {
+		return nil, ErrInvalidAccessToken
+	}
+	return token, nil
+}
+
+// DeriveAccessTokenKeys splits a personal access token into its wrapping key
+// and the auth key that authenticates requests made with the token
+func DeriveAccessTokenKeys(token []byte) (wrapKey, authKey []byte, err error) {
+	return accessTokenSplit.derive(token)
+}
+
+// AccessTokenCredential formats an access token auth key as the bearer
+// credential sent in the Authorization header
+func AccessTokenCredential(authKey []byte) string {
+	return AccessTokenCredentialPrefix + base64.RawURLEncoding.EncodeToString(authKey)
+}
+
+// ParseAccessTokenCredential decodes the auth key of a bearer credential
+// formatted by AccessTokenCredential
+func ParseAccessTokenCredential(s string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(s, AccessTokenCredentialPrefix)
+	if !ok {
+		return nil, ErrInvalidAccessToken
+	}
+
+	authKey, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(authKey) != KeySize {
+		return nil, ErrInvalidAccessToken
+	}
+	return authKey, nil
+}
+
+// AccessTokenVerifier hashes an access token auth key into the verifier the
+// server stores and looks tokens up by
+func AccessTokenVerifier(authKey []byte) string {
+	return verifier(authKey)
+}
+
+// WrapVaultKeyForAccessToken encrypts the vault key under an access token
+// wrapping key
+func WrapVaultKeyForAccessToken(wrapKey, vaultKey []byte) (string, error) {
+	return accessTokenSplit.wrap(wrapKey, vaultKey)
+}
+
+// UnwrapVaultKeyForAccessToken decrypts a vault key previously wrapped with
+// WrapVaultKeyForAccessToken
+func UnwrapVaultKeyForAccessToken(wrapKey []byte, wrappedKey string) ([]byte, error) {
+	return accessTokenSplit.unwrap(wrapKey, wrappedKey)
+}
@@ -0,0 +1,325 @@
+// Package vault defines the plaintext schema of vault items.
+//
+// Items are serialized to JSON and encrypted with the vault key before they
+// leave the client; the backend only ever sees the resulting ciphertext. Every
+// client (the Gio frontend, CLIs, importers) must go through this package so
+// items are encoded identically. Decoding is forward compatible: members
+// introduced by newer schema versions are preserved when an item is re-encoded.
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+)
+
+// SchemaVersion is the item schema version written by this package
+const SchemaVersion = 1
+
+// ItemType identifies the kind of a vault item
+type ItemType string
+
+const (
+	TypeLogin      ItemType = "login"
+	TypeCard       ItemType = "card"
+	TypeIdentity   ItemType = "identity"
+	TypeSecureNote ItemType = "secure_note"
+	TypeSSHKey     ItemType = "ssh_key"
+)
+
+// FieldType identifies the kind of a custom field
+type FieldType string
+
+const (
+	FieldText    FieldType = "text"
+	FieldHidden  FieldType = "hidden"
+	FieldBoolean FieldType = "boolean"
+)
+
+var (
+	ErrMissingName    = errors.New("item name is required")
+	ErrMissingSection = errors.New("item is missing the section for its type")
+	ErrInvalidField   = errors.New("invalid custom field")
+)
+
+// Item is the decrypted content of a vault item
+type Item struct {
+	Version  int      `json:"version"`
+	Type     ItemType `json:"type"`
+	Name     string   `json:"name"`
+	Notes    string   `json:"notes,omitempty"`
+	Favorite bool     `json:"favorite,omitempty"`
+
+	Login    *Login    `json:"login,omitempty"`
+	Card     *Card     `json:"card,omitempty"`
+	Identity *Identity `json:"identity,omitempty"`
+	SSHKey   *SSHKey   `json:"ssh_key,omitempty"`
+
+	Fields []Field `json:"fields,omitempty"`
+
+	Extra Extra `json:"-"`
+}
+
+// Login holds website or application credentials
+type Login struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	URIs     []URI  `json:"uris,omitempty"`
+	TOTP     string `json:"totp,omitempty"` // base32 seed or otpauth:// URI
+
+	Extra Extra `json:"-"`
+}
+
+// URI is a location a login applies to
+type URI struct {
+	URI   string `json:"uri"`
+	Match string `json:"match,omitempty"`
+
+	Extra Extra `json:"-"`
+}
+
+// Card holds payment card details
+type Card struct {
+	CardholderName string `json:"cardholder_name,omitempty"`
+	Brand          string `json:"brand,omitempty"`
+	Number         string `json:"number,omitempty"`
+	ExpMonth       string `json:"exp_month,omitempty"`
+	ExpYear        string `json:"exp_year,omitempty"`
+	Code           string `json:"code,omitempty"`
+
+	Extra Extra `json:"-"`
+}
+
+// Identity holds personal details used to fill forms
+type Identity struct {
+	Title          string `json:"title,omitempty"`
+	FirstName      string `json:"first_name,omitempty"`
+	MiddleName     string `json:"middle_name,omitempty"`
+	LastName       string `json:"last_name,omitempty"`
+	Company        string `json:"company,omitempty"`
+	Email          string `json:"email,omitempty"`
+	Phone          string `json:"phone,omitempty"`
+	Address1       string `json:"address1,omitempty"`
+	Address2       string `json:"address2,omitempty"`
+	City           string `json:"city,omitempty"`
+	State          string `json:"state,omitempty"`
+	PostalCode     string `json:"postal_code,omitempty"`
+	Country        string `json:"country,omitempty"`
+	Username       string `json:"username,omitempty"`
+	SSN            string `json:"ssn,omitempty"`
+	PassportNumber string `json:"passport_number,omitempty"`
+	LicenseNumber  string `json:"license_number,omitempty"`
+
+	Extra Extra `json:"-"`
+}
+
+// SSHKey holds an SSH key pair
+type SSHKey struct {
+	PrivateKey  string `json:"private_key,omitempty"`
+	PublicKey   string `json:"public_key,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	Extra Extra `json:"-"`
+}
+
+// Field is an arbitrary user-defined field attached to an item
+type Field struct {
+	Name  string    `json:"name"`
+	Value string    `json:"value"`
+	Type  FieldType `json:"type"`
+
+	Extra Extra `json:"-"`
+}
+
+// NewItem creates an empty item of the given type at the current schema version
+func NewItem(itemType ItemType, name string) *Item {
+	item := &Item{
+		Version: SchemaVersion,
+		Type:    itemType,
+		Name:    name,
+	}
+
+	switch itemType {
+	case TypeLogin:
+		item.Login = &Login{}
+	case TypeCard:
+		item.Card = &Card{}
+	case TypeIdentity:
+		item.Identity = &Identity{}
+	case TypeSSHKey:
+		item.SSHKey = &SSHKey{}
+	}
+
+	return item
+}
+
+// Validate checks that the item is well formed for its type.
+// Unknown item types are accepted so items from newer clients survive.
+func (i *Item) Validate() error {
+	if i.Name == "" {
+		return ErrMissingName
+	}
+
+	switch i.Type {
+	case TypeLogin:
+		if i.Login == nil {
+			return fmt.Errorf("%w: %s", ErrMissingSection, i.Type)
+		}
+	case TypeCard:
+		if i.Card == nil {
+			return fmt.Errorf("%w: %s", ErrMissingSection, i.Type)
+		}
+	case TypeIdentity:
+		if i.Identity == nil {
+			return fmt.Errorf("%w: %s", ErrMissingSection, i.Type)
+		}
+	case TypeSSHKey:
+		if i.SSHKey == nil {
+			return fmt.Errorf("%w: %s", ErrMissingSection, i.Type)
+		}
+	}
+
+	for _, field := range i.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("%w: missing name", ErrInvalidField)
+		}
+		if field.Type == FieldBoolean && field.Value != "true" && field.Value != "false" {
+			return fmt.Errorf("%w: %q is not a boolean", ErrInvalidField, field.Name)
+		}
+	}
+
+	return nil
+}
+
+// Encrypt validates and serializes the item, then seals it under the vault key.
+// The result is what gets stored as the vault item's data on the backend.
+func Encrypt(vaultKey []byte, item *Item) (string, error) {
+	if err := item.Validate(); err != nil {
+		return "", err
+	}
+	if item.Version == 0 {
+		item.Version = SchemaVersion
+	}
+
+	plaintext, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.EncryptItem(vaultKey, plaintext)
+}
+
+// Decrypt opens a vault item's data and decodes it
+func Decrypt(vaultKey []byte, ciphertext string) (*Item, error) {
+	plaintext, err := crypto.DecryptItem(vaultKey, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var item Item
+	if err := json.Unmarshal(plaintext, &item); err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (i *Item) UnmarshalJSON(data []byte) error {
+	type alias Item
+	extra, err := decodeWithExtra(data, (*alias)(i))
+	i.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (i Item) MarshalJSON() ([]byte, error) {
+	type alias Item
+	return encodeWithExtra(alias(i), i.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (l *Login) UnmarshalJSON(data []byte) error {
+	type alias Login
+	extra, err := decodeWithExtra(data, (*alias)(l))
+	l.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (l Login) MarshalJSON() ([]byte, error) {
+	type alias Login
+	return encodeWithExtra(alias(l), l.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (u *URI) UnmarshalJSON(data []byte) error {
+	type alias URI
+	extra, err := decodeWithExtra(data, (*alias)(u))
+	u.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (u URI) MarshalJSON() ([]byte, error) {
+	type alias URI
+	return encodeWithExtra(alias(u), u.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (c *Card) UnmarshalJSON(data []byte) error {
+	type alias Card
+	extra, err := decodeWithExtra(data, (*alias)(c))
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (c Card) MarshalJSON() ([]byte, error) {
+	type alias Card
+	return encodeWithExtra(alias(c), c.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (id *Identity) UnmarshalJSON(data []byte) error {
+	type alias Identity
+	extra, err := decodeWithExtra(data, (*alias)(id))
+	id.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (id Identity) MarshalJSON() ([]byte, error) {
+	type alias Identity
+	return encodeWithExtra(alias(id), id.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (k *SSHKey) UnmarshalJSON(data []byte) error {
+	type alias SSHKey
+	extra, err := decodeWithExtra(data, (*alias)(k))
+	k.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (k SSHKey) MarshalJSON() ([]byte, error) {
+	type alias SSHKey
+	return encodeWithExtra(alias(k), k.Extra)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, preserving unknown members
+func (f *Field) UnmarshalJSON(data []byte) error {
+	type alias Field
+	extra, err := decodeWithExtra(data, (*alias)(f))
+	f.Extra = extra
+	return err
+}
+
+// MarshalJSON implements json.Marshaler, writing back unknown members
+func (f Field) MarshalJSON() ([]byte, error) {
+	type alias Field
+	return encodeWithExtra(alias(f), f.Extra)
+}
@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/philopaterwaheed/passGO/pkg/crypto"
+)
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	key, _ := crypto.GenerateVaultKey()
+
+	item := NewItem(TypeLogin, "Example")
+	item.Login.Username = "alice"
+	item.Login.Password = "hunter2"
+	item.Login.URIs = []URI{{URI: "https://example.com"}}
+	item.Fields = []Field{{Name: "pin", Value: "1234", Type: FieldHidden}}
+
+	ciphertext, err := Encrypt(key, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := Decrypt(key, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Version != SchemaVersion || decoded.Type != TypeLogin || decoded.Name != "Example" {
+		t.Errorf("Unexpected item header: %+v", decoded)
+	}
+	if decoded.Login == nil || decoded.Login.Password != "hunter2" || len(decoded.Login.URIs) != 1 {
+		t.Errorf("Unexpected login section: %+v", decoded.Login)
+	}
+	if len(decoded.Fields) != 1 || decoded.Fields[0].Type != FieldHidden {
+		t.Errorf("Unexpected custom fields: %+v", decoded.Fields)
+	}
+}
+
+func TestUnknownMembersArePreserved(t *testing.T) {
+	input := `{
+		"version": 2,
+		"type": "login",
+		"name": "Future",
+		"color": "red",
+		"login": {"username": "bob", "passkey": {"id": "abc"}},
+		"fields": [{"name": "x", "value": "y", "type": "text", "label": "z"}]
+	}`
+
+	var item Item
+	if err := json.Unmarshal([]byte(input), &item); err != nil {
+		t.Fatal(err)
+	}
+
+	item.Login.Username = "carol"
+
+	out, err := json.Marshal(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var roundTrip map[string]any
+	if err := json.Unmarshal(out, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+
+	if roundTrip["color"] != "red" {
+		t.Errorf("Expected top-level unknown member to survive, got %v", roundTrip["color"])
+	}
+	login := roundTrip["login"].(map[string]any)
+	if login["username"] != "carol" {
+		t.Errorf("Expected edited username, got %v", login["username"])
+	}
+	if _, ok := login["passkey"]; !ok {
+		t.Error("Expected nested unknown member to survive")
+	}
+	field := roundTrip["fields"].([]any)[0].(map[string]any)
+	if field["label"] != "z" {
+		t.Errorf("Expected unknown field member to survive, got %v", field["label"])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (&Item{Type: TypeLogin}).Validate(); !errors.Is(err, ErrMissingName) {
+		t.Errorf("Expected ErrMissingName, got %v", err)
+	}
+	if err := (&Item{Type: TypeCard, Name: "Visa"}).Validate(); !errors.Is(err, ErrMissingSection) {
+		t.Errorf("Expected ErrMissingSection, got %v", err)
+	}
+
+	item := NewItem(TypeSecureNote, "Note")
+	item.Fields = []Field{{Name: "flag", Value: "maybe", Type: FieldBoolean}}
+	if err := item.Validate(); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField, got %v", err)
+	}
+
+	if err := (&Item{Type: "passport", Name: "From the future"}).Validate(); err != nil {
+		t.Errorf("Expected unknown types to be accepted, got %v", err)
+	}
+}